@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+	"go.uber.org/fx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authorizationMetadataKey is the gRPC metadata key holding the credentials of
+// calls, as the Authorization header does for HTTP requests.
+const authorizationMetadataKey = "authorization"
+
+// retryAfterMetadataKey is the gRPC header metadata key telling rate limited
+// callers how many seconds to wait, as the Retry-After header does for HTTP.
+const retryAfterMetadataKey = "retry-after"
+
+// GRPCCall describes a gRPC call as its equivalent HTTP request.
+type GRPCCall struct {
+	Method string
+	Path   string
+
+	// Vars are the route variables of the request, such as its bucket.
+	Vars map[string]string
+
+	// Header holds the headers of the request other than Authorization, which
+	// comes from the call metadata.
+	Header http.Header
+}
+
+// GRPCAuthenticator authenticates, authorizes and rate limits a gRPC call as
+// its equivalent HTTP request. It returns the context of that request once it
+// went through the chain, holding the bascule token.
+type GRPCAuthenticator func(ctx context.Context, call GRPCCall) (context.Context, error)
+
+type grpcAuthenticatorIn struct {
+	fx.In
+	AuthChain alice.Chain `name:"auth_chain"`
+	// RateLimit runs after AuthChain, as it does for HTTP requests.
+	RateLimit alice.Chain `name:"rate_limit_chain" optional:"true"`
+}
+
+// NewGRPCAuthenticator runs gRPC calls through the auth and rate limiting
+// chain of the primary server, so that they are checked exactly as their HTTP
+// equivalents.
+func NewGRPCAuthenticator(chain alice.Chain) GRPCAuthenticator {
+	return func(ctx context.Context, call GRPCCall) (context.Context, error) {
+		r, err := http.NewRequestWithContext(ctx, call.Method, call.Path, nil)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		r = mux.SetURLVars(r, call.Vars)
+		for key, values := range call.Header {
+			r.Header[key] = values
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get(authorizationMetadataKey) {
+			r.Header.Add("Authorization", value)
+		}
+
+		var authorized context.Context
+		rw := &statusRecorder{header: make(http.Header), code: http.StatusOK}
+		chain.Then(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			authorized = r.Context()
+		})).ServeHTTP(rw, r)
+		if authorized != nil {
+			return authorized, nil
+		}
+
+		code := codes.PermissionDenied
+		switch rw.code {
+		case http.StatusUnauthorized:
+			code = codes.Unauthenticated
+		case http.StatusTooManyRequests:
+			code = codes.ResourceExhausted
+			if retryAfter := rw.header.Get("Retry-After"); retryAfter != "" {
+				// SetHeader only fails outside of gRPC handlers, losing the hint.
+				_ = grpc.SetHeader(ctx, metadata.Pairs(retryAfterMetadataKey, retryAfter))
+			}
+		}
+		return nil, status.Error(code, http.StatusText(rw.code))
+	}
+}
+
+// statusRecorder keeps the status code and headers the chain rejects requests
+// with.
+type statusRecorder struct {
+	header http.Header
+	code   int
+}
+
+func (r *statusRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+}
@@ -4,6 +4,8 @@
 package auth
 
 import (
+	"net/url"
+
 	"github.com/xmidt-org/bascule/basculechecks"
 	"github.com/xmidt-org/bascule/basculehttp"
 	"go.uber.org/fx"
@@ -12,16 +14,36 @@ import (
 type APIBaseIn struct {
 	fx.In
 	Val string `name:"api_base"`
+
+	// V2 is the base of the v2 API, whose paths are checked against the
+	// same capabilities as their v1 counterparts.
+	V2 string `name:"api_base_v2" optional:"true"`
+}
+
+// parseURL strips the v1 or v2 API base from the URLs of requests.
+func (in APIBaseIn) parseURL() basculehttp.ParseURL {
+	v1 := basculehttp.CreateRemovePrefixURLFunc("/"+in.Val, nil)
+	if in.V2 == "" {
+		return v1
+	}
+	v2 := basculehttp.CreateRemovePrefixURLFunc("/"+in.V2, nil)
+	return func(u *url.URL) (*url.URL, error) {
+		if parsed, err := v2(u); err == nil {
+			return parsed, nil
+		}
+		return v1(u)
+	}
 }
 
-// Provide provides the auth alice.Chain for the primary server.
+// Provide provides the auth alice.Chain for the primary server and the
+// GRPCAuthenticator running gRPC calls through it and the rate_limit_chain.
 func Provide(configKey string) fx.Option {
 	return fx.Options(
 		basculehttp.ProvideMetrics(),
 		basculechecks.ProvideMetrics(),
 		fx.Provide(
 			func(in APIBaseIn) basculehttp.ParseURL {
-				return basculehttp.CreateRemovePrefixURLFunc("/"+in.Val, nil)
+				return in.parseURL()
 			},
 		),
 		basculehttp.ProvideBasicAuth(configKey),
@@ -29,5 +51,10 @@ func Provide(configKey string) fx.Option {
 		basculechecks.ProvideRegexCapabilitiesValidator(),
 		basculehttp.ProvideBearerValidator(),
 		basculehttp.ProvideServerChain(),
+		fx.Provide(
+			func(in grpcAuthenticatorIn) GRPCAuthenticator {
+				return NewGRPCAuthenticator(in.AuthChain.Extend(in.RateLimit))
+			},
+		),
 	)
 }
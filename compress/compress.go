@@ -0,0 +1,178 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package compress provides a middleware which gzips responses for the clients
+// accepting it.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultMinSize = 1024
+
+// Config configures the compression of responses.
+type Config struct {
+	// Disabled sends all responses as is.
+	// (Optional) responses are compressed by default.
+	Disabled bool
+
+	// MinSize is the size under which responses are sent as is, compression
+	// not being worth it.
+	// (Optional) defaults to 1024.
+	MinSize int
+
+	// Level is the gzip compression level, from 1 (best speed) to 9 (best
+	// compression).
+	// (Optional) defaults to gzip's default level.
+	Level int
+}
+
+// Compressor gzips the responses of the requests accepting it through their
+// Accept-Encoding header.
+type Compressor struct {
+	minSize int
+	writers sync.Pool
+}
+
+// New builds a Compressor. It fails on invalid levels.
+func New(config Config) (*Compressor, error) {
+	if config.MinSize <= 0 {
+		config.MinSize = defaultMinSize
+	}
+	if config.Level == 0 {
+		config.Level = gzip.DefaultCompression
+	}
+	if _, err := gzip.NewWriterLevel(nil, config.Level); err != nil {
+		return nil, fmt.Errorf("invalid response compression level: %w", err)
+	}
+	c := &Compressor{minSize: config.MinSize}
+	c.writers.New = func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, config.Level)
+		return w
+	}
+	return c, nil
+}
+
+// Then wraps next so its responses are compressed when the request accepts
+// gzip and they're at least the minimum size.
+func (c *Compressor) Then(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, compressor: c, code: http.StatusOK}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptsGzip is true when the Accept-Encoding header value gives gzip a
+// non-zero quality, or * when gzip isn't listed.
+func acceptsGzip(header string) bool {
+	gzipQuality, anyQuality := -1.0, -1.0
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		switch strings.ToLower(strings.TrimSpace(coding)) {
+		case "gzip":
+			gzipQuality = quality(params)
+		case "*":
+			anyQuality = quality(params)
+		}
+	}
+	if gzipQuality >= 0 {
+		return gzipQuality > 0
+	}
+	return anyQuality > 0
+}
+
+// quality returns the q parameter among the parameters of an Accept-Encoding
+// entry, 1 when it's missing and 0 when it's invalid.
+func quality(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		q, ok := strings.CutPrefix(strings.TrimSpace(param), "q=")
+		if !ok {
+			continue
+		}
+		quality, err := strconv.ParseFloat(q, 64)
+		if err != nil {
+			return 0
+		}
+		return quality
+	}
+	return 1
+}
+
+// compressWriter buffers the beginning of the response until it knows whether
+// it's large enough to be compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor  *Compressor
+	code        int
+	wroteHeader bool
+	passthrough bool
+	buf         bytes.Buffer
+	gz          *gzip.Writer
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.code = code
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified ||
+		cw.Header().Get("Content-Encoding") != "" {
+		cw.passthrough = true
+		cw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case cw.passthrough:
+		return cw.ResponseWriter.Write(p)
+	case cw.gz != nil:
+		return cw.gz.Write(p)
+	}
+	cw.buf.Write(p)
+	if cw.buf.Len() < cw.compressor.minSize {
+		return len(p), nil
+	}
+
+	h := cw.Header()
+	h.Set("Content-Encoding", "gzip")
+	h.Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.code)
+	cw.gz = cw.compressor.writers.Get().(*gzip.Writer)
+	cw.gz.Reset(cw.ResponseWriter)
+	if _, err := cw.gz.Write(cw.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// close flushes the compressed response, or sends the buffered one as is when
+// it's too small.
+func (cw *compressWriter) close() {
+	switch {
+	case cw.passthrough:
+	case cw.gz != nil:
+		cw.gz.Close()
+		cw.compressor.writers.Put(cw.gz)
+	default:
+		cw.ResponseWriter.WriteHeader(cw.code)
+		cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+}
@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tcs := []struct {
+		Description string
+		Header      string
+		Expected    bool
+	}{
+		{Description: "Missing"},
+		{Description: "Other encodings", Header: "br, deflate"},
+		{Description: "Gzip", Header: "deflate, gzip", Expected: true},
+		{Description: "Any", Header: "*", Expected: true},
+		{Description: "Quality", Header: "GZIP;q=0.5", Expected: true},
+		{Description: "Refused", Header: "gzip;q=0"},
+		{Description: "Refused but any accepted", Header: "gzip;q=0, *"},
+		{Description: "Any refused but gzip accepted", Header: "*;q=0, gzip", Expected: true},
+		{Description: "Any accepted", Header: "br, *;q=0.1", Expected: true},
+		{Description: "Quality after other parameters", Header: "gzip;level=1;q=0"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert.Equal(t, tc.Expected, acceptsGzip(tc.Header))
+		})
+	}
+}
+
+func TestCompressor(t *testing.T) {
+	large := strings.Repeat("argus ", 500)
+	tcs := []struct {
+		Description        string
+		Method             string
+		AcceptEncoding     string
+		Code               int
+		Body               string
+		ContentEncoding    string
+		ExpectedCompressed bool
+	}{
+		{
+			Description:        "Large response",
+			AcceptEncoding:     "gzip",
+			Code:               http.StatusOK,
+			Body:               large,
+			ExpectedCompressed: true,
+		},
+		{
+			Description:        "Large error response",
+			AcceptEncoding:     "gzip",
+			Code:               http.StatusBadRequest,
+			Body:               large,
+			ExpectedCompressed: true,
+		},
+		{
+			Description:    "Small response",
+			AcceptEncoding: "gzip",
+			Code:           http.StatusOK,
+			Body:           "argus",
+		},
+		{
+			Description:    "Empty response",
+			AcceptEncoding: "gzip",
+			Code:           http.StatusNotFound,
+		},
+		{
+			Description: "Gzip not accepted",
+			Code:        http.StatusOK,
+			Body:        large,
+		},
+		{
+			Description:     "Already encoded",
+			AcceptEncoding:  "gzip",
+			Code:            http.StatusOK,
+			Body:            large,
+			ContentEncoding: "br",
+		},
+		{
+			Description:    "HEAD request",
+			Method:         http.MethodHead,
+			AcceptEncoding: "gzip",
+			Code:           http.StatusOK,
+		},
+	}
+
+	c, err := New(Config{})
+	require.NoError(t, err)
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			h := c.Then(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if tc.ContentEncoding != "" {
+					w.Header().Set("Content-Encoding", tc.ContentEncoding)
+				}
+				w.WriteHeader(tc.Code)
+				// Written in chunks to go over the minimum size midway.
+				for i := 0; i < len(tc.Body); i += 100 {
+					w.Write([]byte(tc.Body[i:min(i+100, len(tc.Body))]))
+				}
+			}))
+			method := tc.Method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "http://localhost", nil)
+			if tc.AcceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tc.AcceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			assert.Equal(tc.Code, rec.Code)
+			assert.Equal("application/json", rec.Header().Get("Content-Type"))
+			assert.Equal("Accept-Encoding", rec.Header().Get("Vary"))
+			if !tc.ExpectedCompressed {
+				assert.Equal(tc.ContentEncoding, rec.Header().Get("Content-Encoding"))
+				assert.Equal(tc.Body, rec.Body.String())
+				return
+			}
+			assert.Equal("gzip", rec.Header().Get("Content-Encoding"))
+			assert.Less(rec.Body.Len(), len(tc.Body))
+			gz, err := gzip.NewReader(rec.Body)
+			require.NoError(err)
+			body, err := io.ReadAll(gz)
+			require.NoError(err)
+			assert.Equal(tc.Body, string(body))
+		})
+	}
+}
+
+func TestNewInvalidLevel(t *testing.T) {
+	_, err := New(Config{Level: 42})
+	assert.Error(t, err)
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package compress
+
+import (
+	"github.com/justinas/alice"
+	"github.com/xmidt-org/arrange"
+	"go.uber.org/fx"
+)
+
+// Provide provides the response compression alice.Chain for the primary
+// server, named compression_chain. The chain is empty when compression is
+// disabled.
+func Provide(configKey string) fx.Option {
+	return fx.Provide(
+		arrange.UnmarshalKey(configKey, Config{}),
+		fx.Annotated{
+			Name: "compression_chain",
+			Target: func(config Config) (alice.Chain, error) {
+				if config.Disabled {
+					return alice.New(), nil
+				}
+				c, err := New(config)
+				if err != nil {
+					return alice.Chain{}, err
+				}
+				return alice.New(c.Then), nil
+			},
+		},
+	)
+}
@@ -0,0 +1,83 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/xmidt-org/argus/store/storepb"
+	"github.com/xmidt-org/arrange"
+	"github.com/xmidt-org/arrange/arrangehttp"
+	"go.uber.org/fx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type GRPCServerIn struct {
+	fx.In
+	Lifecycle  fx.Lifecycle
+	Shutdowner fx.Shutdowner
+	Config     arrangehttp.ServerConfig `name:"server_grpc_config"`
+	Store      storepb.ArgusStoreServer
+}
+
+// provideGRPCServer serves the ArgusStore gRPC service on the address, network and
+// TLS settings of servers.grpc. Other server settings don't apply to gRPC.
+// The server isn't started when servers.grpc has no address.
+func provideGRPCServer() fx.Option {
+	return fx.Options(
+		fx.Provide(
+			fx.Annotated{
+				Name:   "server_grpc_config",
+				Target: arrange.UnmarshalKey("servers.grpc", arrangehttp.ServerConfig{}),
+			},
+		),
+		fx.Invoke(startGRPCServer),
+	)
+}
+
+func startGRPCServer(in GRPCServerIn) error {
+	if len(in.Config.Address) == 0 {
+		return nil
+	}
+
+	var options []grpc.ServerOption
+	tlsConfig, err := in.Config.TLS.New()
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(options...)
+	storepb.RegisterArgusStoreServer(server, in.Store)
+
+	in.Lifecycle.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			// TLS is handled by the gRPC credentials rather than the listener.
+			listener, err := in.Config.Listen(ctx, &http.Server{Addr: in.Config.Address})
+			if err != nil {
+				return err
+			}
+			go arrangehttp.Serve(server, listener, arrangehttp.ShutdownOnExit(in.Shutdowner))
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			stopped := make(chan struct{})
+			go func() {
+				server.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				// watches never end on their own.
+				server.Stop()
+			}
+			return nil
+		},
+	})
+	return nil
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package health runs dependency checks in the background and serves their
+// cached results through liveness and readiness handlers.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Check statuses.
+const (
+	StatusUp      = "up"
+	StatusDown    = "down"
+	StatusUnknown = "unknown"
+)
+
+// Messages of the failed checks whose errors have no sanitized message.
+const (
+	checkFailedMessage   = "check failed"
+	checkTimedOutMessage = "check timed out"
+)
+
+// Check is a named dependency check. Func should return a non-nil error when
+// the dependency is unusable.
+type Check struct {
+	Name string
+	Func func(context.Context) error
+}
+
+// sanitizedErrorer is implemented by the errors, such as the store ones, with
+// a message safe to share with the unauthenticated callers of the handlers.
+type sanitizedErrorer interface {
+	SanitizedError() string
+}
+
+// Result is the outcome of the latest run of a check. Error holds a sanitized
+// message, the full error being logged.
+type Result struct {
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	LastChecked *time.Time `json:"lastChecked,omitempty"`
+	Duration    string     `json:"duration,omitempty"`
+}
+
+// Report is the JSON body returned by the health handlers.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker periodically runs a set of checks and caches their results.
+type Checker struct {
+	checks   []Check
+	liveness map[string]bool
+	interval time.Duration
+	timeout  time.Duration
+	measures Measures
+	logger   *zap.Logger
+	now      func() time.Time
+
+	lock    sync.RWMutex
+	results map[string]Result
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Measures are the metrics updated on every check run.
+type Measures struct {
+	Status   *prometheus.GaugeVec
+	Duration prometheus.ObserverVec
+}
+
+// RunOnce runs every check concurrently and stores their results.
+func (c *Checker) RunOnce(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			c.run(ctx, check)
+		}(check)
+	}
+	wg.Wait()
+}
+
+func (c *Checker) run(ctx context.Context, check Check) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := c.now()
+	err := check.Func(ctx)
+	duration := c.now().Sub(start)
+
+	result := Result{
+		Status:      StatusUp,
+		LastChecked: &start,
+		Duration:    duration.String(),
+	}
+	status := 1.0
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = sanitizeError(err)
+		status = 0
+		c.logger.Error("health check failed", zap.String("check", check.Name), zap.Error(err))
+	}
+
+	labels := prometheus.Labels{CheckLabelKey: check.Name}
+	c.measures.Status.With(labels).Set(status)
+	c.measures.Duration.With(labels).Observe(duration.Seconds())
+
+	c.lock.Lock()
+	c.results[check.Name] = result
+	c.lock.Unlock()
+}
+
+// sanitizeError returns the message of err safe to serve to any caller.
+func sanitizeError(err error) string {
+	var sErrorer sanitizedErrorer
+	switch {
+	case errors.As(err, &sErrorer):
+		return sErrorer.SanitizedError()
+	case errors.Is(err, context.DeadlineExceeded):
+		return checkTimedOutMessage
+	default:
+		return checkFailedMessage
+	}
+}
+
+// Start runs the checks right away and then on every interval until Stop is called.
+func (c *Checker) Start() {
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			c.RunOnce(context.Background())
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the background checks.
+func (c *Checker) Stop() {
+	close(c.stop)
+	<-c.done
+}
+
+// report builds a report from the cached results. When liveness is true, only
+// the checks configured to affect liveness decide the overall status and checks
+// that haven't run yet are not held against it.
+func (c *Checker) report(liveness bool) Report {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	r := Report{
+		Status: StatusUp,
+		Checks: make(map[string]Result, len(c.checks)),
+	}
+	for _, check := range c.checks {
+		result, ok := c.results[check.Name]
+		if !ok {
+			result = Result{Status: StatusUnknown}
+		}
+		r.Checks[check.Name] = result
+
+		if liveness && !c.liveness[check.Name] {
+			continue
+		}
+		if result.Status == StatusDown || (!liveness && result.Status == StatusUnknown) {
+			r.Status = StatusDown
+		}
+	}
+	return r
+}
+
+// LivenessHandler serves the cached state of the checks configured to affect liveness.
+func (c *Checker) LivenessHandler() http.Handler {
+	return reportHandler(func() Report { return c.report(true) })
+}
+
+// ReadinessHandler serves the cached state of all checks.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return reportHandler(func() Report { return c.report(false) })
+}
+
+func reportHandler(report func() Report) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		r := report()
+		data, err := json.Marshal(&r)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		if r.Status == StatusUp {
+			rw.WriteHeader(http.StatusOK)
+		} else {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		rw.Write(data)
+	})
+}
@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMeasures() Measures {
+	return Measures{
+		Status: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "status"}, []string{CheckLabelKey}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration"},
+			[]string{CheckLabelKey}),
+	}
+}
+
+func serve(t *testing.T, h http.Handler) (int, Report) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var r Report
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	return rec.Code, r
+}
+
+// testSanitizedError has a message for logs and a sanitized one for responses.
+type testSanitizedError struct{}
+
+func (testSanitizedError) Error() string {
+	return "dial tcp 10.0.0.1:9042: connection refused"
+}
+
+func (testSanitizedError) SanitizedError() string {
+	return "store unavailable"
+}
+
+func TestChecker(t *testing.T) {
+	var storeErr error
+	checks := []Check{
+		{
+			Name: "store",
+			Func: func(context.Context) error { return storeErr },
+		},
+		{
+			Name: "cache",
+			Func: func(context.Context) error { return nil },
+		},
+	}
+
+	tcs := []struct {
+		Description       string
+		LivenessChecks    []string
+		Run               bool
+		StoreErr          error
+		ExpectedLiveness  int
+		ExpectedReadiness int
+		ExpectedStore     string
+		ExpectedError     string
+	}{
+		{
+			Description:       "Not run yet",
+			ExpectedLiveness:  http.StatusOK,
+			ExpectedReadiness: http.StatusServiceUnavailable,
+			ExpectedStore:     StatusUnknown,
+		},
+		{
+			Description:       "All up",
+			Run:               true,
+			ExpectedLiveness:  http.StatusOK,
+			ExpectedReadiness: http.StatusOK,
+			ExpectedStore:     StatusUp,
+		},
+		{
+			Description:       "Store down",
+			Run:               true,
+			StoreErr:          errors.New("unreachable"),
+			ExpectedLiveness:  http.StatusOK,
+			ExpectedReadiness: http.StatusServiceUnavailable,
+			ExpectedStore:     StatusDown,
+			ExpectedError:     checkFailedMessage,
+		},
+		{
+			Description:       "Store down with a sanitized error",
+			Run:               true,
+			StoreErr:          testSanitizedError{},
+			ExpectedLiveness:  http.StatusOK,
+			ExpectedReadiness: http.StatusServiceUnavailable,
+			ExpectedStore:     StatusDown,
+			ExpectedError:     "store unavailable",
+		},
+		{
+			Description:       "Store down affects liveness",
+			LivenessChecks:    []string{"store"},
+			Run:               true,
+			StoreErr:          errors.New("unreachable"),
+			ExpectedLiveness:  http.StatusServiceUnavailable,
+			ExpectedReadiness: http.StatusServiceUnavailable,
+			ExpectedStore:     StatusDown,
+			ExpectedError:     checkFailedMessage,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			storeErr = tc.StoreErr
+			measures := newTestMeasures()
+			c := New(Config{LivenessChecks: tc.LivenessChecks}, checks, measures, nil)
+			if tc.Run {
+				c.RunOnce(context.Background())
+			}
+
+			code, r := serve(t, c.LivenessHandler())
+			assert.Equal(tc.ExpectedLiveness, code)
+			assert.Equal(tc.ExpectedStore, r.Checks["store"].Status)
+
+			code, r = serve(t, c.ReadinessHandler())
+			assert.Equal(tc.ExpectedReadiness, code)
+			assert.Equal(tc.ExpectedStore, r.Checks["store"].Status)
+			if tc.StoreErr != nil {
+				assert.Equal(tc.ExpectedError, r.Checks["store"].Error)
+				assert.Equal(float64(0), testutil.ToFloat64(measures.Status.WithLabelValues("store")))
+			}
+			if tc.Run {
+				assert.Equal(float64(1), testutil.ToFloat64(measures.Status.WithLabelValues("cache")))
+				assert.NotNil(r.Checks["cache"].LastChecked)
+			}
+		})
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	assert := assert.New(t)
+	checks := []Check{
+		{
+			Name: "slow",
+			Func: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		},
+	}
+	c := New(Config{Timeout: 10 * time.Millisecond}, checks, newTestMeasures(), nil)
+	c.RunOnce(context.Background())
+
+	code, r := serve(t, c.ReadinessHandler())
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Equal(checkTimedOutMessage, r.Checks["slow"].Error)
+}
+
+func TestStartStop(t *testing.T) {
+	assert := assert.New(t)
+	runs := make(chan struct{}, 10)
+	checks := []Check{
+		{
+			Name: "counting",
+			Func: func(context.Context) error {
+				select {
+				case runs <- struct{}{}:
+				default:
+				}
+				return nil
+			},
+		},
+	}
+	c := New(Config{Interval: time.Millisecond}, checks, newTestMeasures(), nil)
+	c.Start()
+	<-runs
+	<-runs
+	c.Stop()
+
+	code, _ := serve(t, c.ReadinessHandler())
+	assert.Equal(http.StatusOK, code)
+}
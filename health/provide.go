@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xmidt-org/arrange"
+	"github.com/xmidt-org/touchstone"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Metric names.
+const (
+	CheckStatusGauge              = "health_check_status"
+	CheckDurationSecondsHistogram = "health_check_duration_seconds"
+)
+
+// CheckLabelKey is the metric label key holding the name of a check.
+const CheckLabelKey = "check"
+
+// ChecksGroup is the fx value group components use to register their checks.
+const ChecksGroup = "health_checks"
+
+const (
+	defaultInterval = 5 * time.Second
+	defaultTimeout  = 2 * time.Second
+)
+
+// Config configures how checks are run.
+type Config struct {
+	// Interval is the time between two runs of the checks.
+	// (Optional) defaults to 5s.
+	Interval time.Duration
+
+	// Timeout bounds a single run of a check.
+	// (Optional) defaults to 2s.
+	Timeout time.Duration
+
+	// LivenessChecks lists the names of the checks which also affect liveness.
+	// All checks affect readiness.
+	// (Optional) by default, liveness only reports on the checks without depending on them.
+	LivenessChecks []string
+}
+
+type checkerIn struct {
+	fx.In
+	Config   Config
+	Checks   []Check `group:"health_checks"`
+	Measures Measures
+	Logger   *zap.Logger
+	LC       fx.Lifecycle
+}
+
+type measuresIn struct {
+	fx.In
+	Status   *prometheus.GaugeVec   `name:"health_check_status"`
+	Duration prometheus.ObserverVec `name:"health_check_duration_seconds"`
+}
+
+// Provide provides a started *Checker which runs the checks registered
+// in the ChecksGroup value group.
+func Provide(configKey string) fx.Option {
+	return fx.Options(
+		touchstone.GaugeVec(
+			prometheus.GaugeOpts{
+				Name: CheckStatusGauge,
+				Help: "Result of the latest run of a health check. 1 is up and 0 is down.",
+			},
+			CheckLabelKey,
+		),
+		touchstone.HistogramVec(
+			prometheus.HistogramOpts{
+				Name:    CheckDurationSecondsHistogram,
+				Help:    "A histogram of health check latencies.",
+				Buckets: []float64{0.01, 0.025, 0.05, 0.1, .25, .5, 1, 2, 5},
+			},
+			CheckLabelKey,
+		),
+		fx.Provide(
+			arrange.UnmarshalKey(configKey, Config{}),
+			func(in measuresIn) Measures {
+				return Measures{Status: in.Status, Duration: in.Duration}
+			},
+			newChecker,
+		),
+	)
+}
+
+func newChecker(in checkerIn) *Checker {
+	c := New(in.Config, in.Checks, in.Measures, in.Logger)
+	in.LC.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			c.Start()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			c.Stop()
+			return nil
+		},
+	})
+	return c
+}
+
+// New builds a Checker. It doesn't run any check until Start or RunOnce is called.
+func New(config Config, checks []Check, measures Measures, logger *zap.Logger) *Checker {
+	if config.Interval <= 0 {
+		config.Interval = defaultInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	liveness := make(map[string]bool, len(config.LivenessChecks))
+	for _, name := range config.LivenessChecks {
+		liveness[name] = true
+	}
+
+	return &Checker{
+		checks:   checks,
+		liveness: liveness,
+		interval: config.Interval,
+		timeout:  config.Timeout,
+		measures: measures,
+		logger:   logger,
+		now:      time.Now,
+		results:  make(map[string]Result, len(checks)),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
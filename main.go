@@ -10,6 +10,9 @@ import (
 
 	"github.com/spf13/pflag"
 	"github.com/xmidt-org/argus/auth"
+	"github.com/xmidt-org/argus/compress"
+	"github.com/xmidt-org/argus/health"
+	"github.com/xmidt-org/argus/ratelimit"
 	"github.com/xmidt-org/argus/store"
 	"github.com/xmidt-org/argus/store/db"
 	"github.com/xmidt-org/argus/store/db/metric"
@@ -25,6 +28,7 @@ import (
 const (
 	applicationName = "argus"
 	apiBase         = "api/v1"
+	apiBaseV2       = "api/v2"
 	defaultKeyID    = "current"
 )
 
@@ -40,6 +44,14 @@ type CandlelightConfigIn struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == migrateCommand {
+		if err := migrate(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	v, logger, err := setup(os.Args[1:])
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -55,9 +67,14 @@ func main() {
 		touchstone.Provide(),
 		store.ProvideHandlers(),
 		db.Provide(),
+		health.Provide("health"),
+		ratelimit.Provide("rateLimit"),
+		compress.Provide("compression"),
 		fx.Provide(
 			consts,
 			arrange.UnmarshalKey("userInputValidation", store.UserInputValidationConfig{}),
+			arrange.UnmarshalKey("redaction", store.RedactionConfig{}),
+			arrange.UnmarshalKey("grpc", store.GRPCConfig{}),
 			arrange.UnmarshalKey("prometheus", touchstone.Config{}),
 			arrange.UnmarshalKey("prometheus.handler", touchhttp.Config{}),
 			fx.Annotated{
@@ -93,12 +110,14 @@ func main() {
 type ConstOut struct {
 	fx.Out
 	APIBase      string `name:"api_base"`
+	APIBaseV2    string `name:"api_base_v2"`
 	DefaultKeyID string `name:"default_key_id"`
 }
 
 func consts() ConstOut {
 	return ConstOut{
 		APIBase:      apiBase,
+		APIBaseV2:    apiBaseV2,
 		DefaultKeyID: defaultKeyID,
 	}
 }
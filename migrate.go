@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xmidt-org/argus/store/cassandra"
+)
+
+const migrateCommand = "migrate"
+
+// migrate applies the pending schema migrations of the configured yugabyte store and exits.
+func migrate(args []string) error {
+	v, logger, err := setup(args)
+	if err != nil {
+		return err
+	}
+	if !v.IsSet("store.yugabyte") {
+		return errors.New("migrations only apply to the yugabyte store but store.yugabyte isn't configured")
+	}
+
+	var config cassandra.Config
+	if err := v.UnmarshalKey("store.yugabyte", &config); err != nil {
+		return err
+	}
+	if err := cassandra.Migrate(context.Background(), config, logger); err != nil {
+		return err
+	}
+	logger.Info("schema is up to date")
+	return nil
+}
@@ -3,6 +3,8 @@
 
 package model
 
+import "time"
+
 // Key defines the field mapping to retrieve an item from storage.
 type Key struct {
 	// Bucket is the name for a collection or partition to which an item belongs.
@@ -27,3 +29,29 @@ type Item struct {
 	// Optional. When not set, items don't expire.
 	TTL *int64 `json:"ttl,omitempty"`
 }
+
+// ItemEnvelope is the representation of items in version 2 of the API, which
+// adds the metadata kept by argus to the item.
+type ItemEnvelope struct {
+	Item
+
+	// Owner is the owner of the item. Only its owner and callers with elevated
+	// access can read an item, so it's only ever shown to them.
+	Owner string `json:"owner,omitempty"`
+
+	// CreatedAt and UpdatedAt are the times the item was created and last
+	// written. They're not set for items written before they were tracked.
+	CreatedAt time.Time `json:"createdAt,omitzero"`
+	UpdatedAt time.Time `json:"updatedAt,omitzero"`
+
+	// ModifiedBy is the principal of the token of the last write of the item.
+	// It's not set for items written without one or before it was tracked.
+	ModifiedBy string `json:"modifiedBy,omitempty"`
+
+	// Version increases by one every time the item is written.
+	Version int64 `json:"version"`
+
+	// ExpiresAt is the time the item expires. It's not set for items which
+	// don't expire.
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
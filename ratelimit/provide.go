@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimit
+
+import (
+	"github.com/justinas/alice"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xmidt-org/argus/auth"
+	"github.com/xmidt-org/arrange"
+	"github.com/xmidt-org/touchstone"
+	"go.uber.org/fx"
+)
+
+// Metric names.
+const (
+	LimitedRequestsCounter = "rate_limited_requests_total"
+	ExemptRequestsCounter  = "rate_limit_exempt_requests_total"
+)
+
+// RuleLabelKey is the metric label key holding the name of a rule.
+const RuleLabelKey = "rule"
+
+type measuresIn struct {
+	fx.In
+	Limited *prometheus.CounterVec `name:"rate_limited_requests_total"`
+	Exempt  prometheus.Counter     `name:"rate_limit_exempt_requests_total"`
+}
+
+type chainIn struct {
+	fx.In
+	Config      Config
+	AccessLevel auth.AccessLevel
+	Measures    Measures
+}
+
+// Provide provides the rate limiting alice.Chain for the primary server,
+// named rate_limit_chain.
+func Provide(configKey string) fx.Option {
+	return fx.Options(
+		touchstone.CounterVec(
+			prometheus.CounterOpts{
+				Name: LimitedRequestsCounter,
+				Help: "Count of the requests rejected by a rate limiting rule.",
+			},
+			RuleLabelKey,
+		),
+		touchstone.Counter(
+			prometheus.CounterOpts{
+				Name: ExemptRequestsCounter,
+				Help: "Count of the requests with elevated access exempt from rate limiting.",
+			},
+		),
+		fx.Provide(
+			arrange.UnmarshalKey(configKey, Config{}),
+			func(in measuresIn) Measures {
+				return Measures{Limited: in.Limited, Exempt: in.Exempt}
+			},
+			fx.Annotated{
+				Name: "rate_limit_chain",
+				Target: func(in chainIn) alice.Chain {
+					return alice.New(New(in.Config, in.AccessLevel.AttributeKey, in.Measures).Then)
+				},
+			},
+		),
+	)
+}
@@ -0,0 +1,252 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ratelimit provides a middleware which limits the rate of the requests
+// of the primary server with token buckets.
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xmidt-org/argus/auth"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/bascule"
+)
+
+// Request attributes rules can key their token buckets by.
+const (
+	PrincipalKey = "principal"
+	OwnerKey     = "owner"
+	BucketKey    = "bucket"
+	MethodKey    = "method"
+)
+
+const sweepInterval = time.Minute
+
+// Rule limits the rate of the requests it applies to. Each distinct combination
+// of the values of Keys gets its own token bucket.
+type Rule struct {
+	// Name identifies the rule in the metrics.
+	Name string
+
+	// Keys lists the request attributes the token buckets are keyed by among
+	// principal, owner, bucket and method.
+	// (Optional) by default, all the requests share a single token bucket.
+	Keys []string
+
+	// Methods restricts the rule to requests with these HTTP methods.
+	// (Optional) by default, the rule applies to all methods.
+	Methods []string
+
+	// Buckets restricts the rule to requests on these buckets.
+	// (Optional) by default, the rule applies to all buckets.
+	Buckets []string
+
+	// Rate is the number of requests per second a token bucket refills.
+	Rate float64
+
+	// Burst is the number of requests a full token bucket accepts at once.
+	// (Optional) defaults to Rate, rounded up.
+	Burst int
+}
+
+// Config configures the rate limits.
+type Config struct {
+	// Rules are all applied to each request, which is rejected as soon as one of
+	// them runs out of tokens.
+	// (Optional) requests aren't limited when empty.
+	Rules []Rule
+
+	// LimitElevatedAccess applies the rules to requests with elevated access too.
+	// (Optional) by default, such requests are exempt.
+	LimitElevatedAccess bool
+}
+
+// Measures are the metrics of the limiter.
+type Measures struct {
+	Limited *prometheus.CounterVec
+	Exempt  prometheus.Counter
+}
+
+// tokenBucket holds the tokens left as of last.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type limit struct {
+	rule    Rule
+	keys    []string
+	methods map[string]bool
+	buckets map[string]bool
+
+	lock      sync.Mutex
+	tokens    map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// Limiter rejects the requests exceeding the rates of its rules.
+type Limiter struct {
+	limits                  []*limit
+	limitElevatedAccess     bool
+	accessLevelAttributeKey string
+	measures                Measures
+	now                     func() time.Time
+}
+
+// New builds a Limiter from config. Requests with elevated access are recognized
+// through the bascule attribute named accessLevelAttributeKey.
+func New(config Config, accessLevelAttributeKey string, measures Measures) *Limiter {
+	l := &Limiter{
+		limitElevatedAccess:     config.LimitElevatedAccess,
+		accessLevelAttributeKey: accessLevelAttributeKey,
+		measures:                measures,
+		now:                     time.Now,
+	}
+	for _, rule := range config.Rules {
+		if rule.Rate <= 0 {
+			continue
+		}
+		if rule.Burst <= 0 {
+			rule.Burst = int(math.Ceil(rule.Rate))
+		}
+		l.limits = append(l.limits, &limit{
+			rule:    rule,
+			keys:    rule.Keys,
+			methods: set(rule.Methods, strings.ToUpper),
+			buckets: set(rule.Buckets, nil),
+			tokens:  map[string]*tokenBucket{},
+		})
+	}
+	return l
+}
+
+// Then wraps next so that limited requests get a 429 with a Retry-After header
+// instead. It's meant to run after authentication and routing so that the
+// principal and the bucket of requests are known.
+func (l *Limiter) Then(next http.Handler) http.Handler {
+	if len(l.limits) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.limitElevatedAccess && l.hasElevatedAccess(r) {
+			l.measures.Exempt.Inc()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := l.now()
+		for _, lim := range l.limits {
+			if !lim.applies(r) {
+				continue
+			}
+			if wait, ok := lim.take(lim.key(r), now); !ok {
+				l.measures.Limited.WithLabelValues(lim.rule.Name).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				store.WriteProblem(r.Context(), w, http.StatusTooManyRequests, "rate_limited", "rate limit exceeded")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *Limiter) hasElevatedAccess(r *http.Request) bool {
+	basculeAuth, ok := bascule.FromContext(r.Context())
+	if !ok || basculeAuth.Token == nil {
+		return false
+	}
+	attribute, ok := basculeAuth.Token.Attributes().Get(l.accessLevelAttributeKey)
+	if !ok {
+		return false
+	}
+	accessLevel, ok := attribute.(int)
+	return ok && accessLevel == auth.ElevatedAccessLevelAttributeValue
+}
+
+func (lim *limit) applies(r *http.Request) bool {
+	if len(lim.methods) > 0 && !lim.methods[r.Method] {
+		return false
+	}
+	if len(lim.buckets) > 0 && !lim.buckets[mux.Vars(r)["bucket"]] {
+		return false
+	}
+	return true
+}
+
+// key joins the values of the request attributes of the rule.
+func (lim *limit) key(r *http.Request) string {
+	values := make([]string, len(lim.keys))
+	for i, k := range lim.keys {
+		switch k {
+		case PrincipalKey:
+			if basculeAuth, ok := bascule.FromContext(r.Context()); ok && basculeAuth.Token != nil {
+				values[i] = basculeAuth.Token.Principal()
+			}
+		case OwnerKey:
+			values[i] = r.Header.Get(store.ItemOwnerHeaderKey)
+		case BucketKey:
+			values[i] = mux.Vars(r)["bucket"]
+		case MethodKey:
+			values[i] = r.Method
+		}
+	}
+	return strings.Join(values, "\x00")
+}
+
+// take consumes a token from the bucket of key. When it's empty, take returns
+// how long until a token is available.
+func (lim *limit) take(key string, now time.Time) (time.Duration, bool) {
+	lim.lock.Lock()
+	defer lim.lock.Unlock()
+	lim.sweep(now)
+
+	burst := float64(lim.rule.Burst)
+	b, ok := lim.tokens[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		lim.tokens[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed.Seconds()*lim.rule.Rate)
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / lim.rule.Rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// sweep drops the token buckets which have refilled since their last use, as
+// they're no different from new ones.
+func (lim *limit) sweep(now time.Time) {
+	if now.Sub(lim.lastSweep) < sweepInterval {
+		return
+	}
+	lim.lastSweep = now
+	refill := time.Duration(float64(lim.rule.Burst) / lim.rule.Rate * float64(time.Second))
+	for key, b := range lim.tokens {
+		if now.Sub(b.last) >= refill {
+			delete(lim.tokens, key)
+		}
+	}
+}
+
+func set(values []string, normalize func(string) string) map[string]bool {
+	s := make(map[string]bool, len(values))
+	for _, v := range values {
+		if normalize != nil {
+			v = normalize(v)
+		}
+		s[v] = true
+	}
+	return s
+}
@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/xmidt-org/argus/auth"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/bascule"
+)
+
+func newTestMeasures() Measures {
+	return Measures{
+		Limited: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "limited"}, []string{RuleLabelKey}),
+		Exempt:  prometheus.NewCounter(prometheus.CounterOpts{Name: "exempt"}),
+	}
+}
+
+type testRequest struct {
+	Method    string
+	Principal string
+	Owner     string
+	Bucket    string
+	Elevated  bool
+}
+
+func (tr testRequest) build() *http.Request {
+	method := tr.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	r := httptest.NewRequest(method, "http://localhost/test", nil)
+	r = mux.SetURLVars(r, map[string]string{"bucket": tr.Bucket})
+	if tr.Owner != "" {
+		r.Header.Set(store.ItemOwnerHeaderKey, tr.Owner)
+	}
+	if tr.Principal == "" && !tr.Elevated {
+		return r
+	}
+	accessLevel := auth.DefaultAccessLevelAttributeValue
+	if tr.Elevated {
+		accessLevel = auth.ElevatedAccessLevelAttributeValue
+	}
+	attributes := bascule.NewAttributes(map[string]interface{}{
+		auth.DefaultAccessLevelAttributeKey: accessLevel,
+	})
+	ctx := bascule.WithAuthentication(context.Background(), bascule.Authentication{
+		Authorization: bascule.Authorization("Bearer"),
+		Token:         bascule.NewToken("Bearer", tr.Principal, attributes),
+	})
+	return r.WithContext(ctx)
+}
+
+func TestLimiter(t *testing.T) {
+	tcs := []struct {
+		Description         string
+		Rules               []Rule
+		LimitElevatedAccess bool
+		Requests            []testRequest
+		ExpectedCodes       []int
+		ExpectedLimited     float64
+		ExpectedExempt      float64
+	}{
+		{
+			Description:   "No rules",
+			Requests:      []testRequest{{}, {}, {}},
+			ExpectedCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+		{
+			Description:     "Shared bucket",
+			Rules:           []Rule{{Name: "all", Rate: 1, Burst: 2}},
+			Requests:        []testRequest{{Principal: "a"}, {Principal: "b"}, {Principal: "c"}},
+			ExpectedCodes:   []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+			ExpectedLimited: 1,
+		},
+		{
+			Description:     "Keyed by principal",
+			Rules:           []Rule{{Name: "principal", Keys: []string{PrincipalKey}, Rate: 1}},
+			Requests:        []testRequest{{Principal: "a"}, {Principal: "b"}, {Principal: "a"}},
+			ExpectedCodes:   []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+			ExpectedLimited: 1,
+		},
+		{
+			Description:     "Keyed by owner and bucket",
+			Rules:           []Rule{{Name: "owner", Keys: []string{OwnerKey, BucketKey}, Rate: 1}},
+			Requests:        []testRequest{{Owner: "a", Bucket: "x"}, {Owner: "a", Bucket: "y"}, {Owner: "a", Bucket: "x"}},
+			ExpectedCodes:   []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+			ExpectedLimited: 1,
+		},
+		{
+			Description: "Restricted to methods and buckets",
+			Rules:       []Rule{{Name: "getall", Methods: []string{"get"}, Buckets: []string{"x"}, Rate: 1}},
+			Requests: []testRequest{
+				{Bucket: "x"},
+				{Bucket: "y"},
+				{Method: http.MethodPut, Bucket: "x"},
+				{Bucket: "x"},
+			},
+			ExpectedCodes:   []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+			ExpectedLimited: 1,
+		},
+		{
+			Description:    "Elevated access exempt",
+			Rules:          []Rule{{Name: "all", Rate: 1}},
+			Requests:       []testRequest{{Elevated: true}, {Elevated: true}},
+			ExpectedCodes:  []int{http.StatusOK, http.StatusOK},
+			ExpectedExempt: 2,
+		},
+		{
+			Description:         "Elevated access limited",
+			Rules:               []Rule{{Name: "all", Rate: 1}},
+			LimitElevatedAccess: true,
+			Requests:            []testRequest{{Elevated: true}, {Elevated: true}},
+			ExpectedCodes:       []int{http.StatusOK, http.StatusTooManyRequests},
+			ExpectedLimited:     1,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			measures := newTestMeasures()
+			l := New(Config{Rules: tc.Rules, LimitElevatedAccess: tc.LimitElevatedAccess}, auth.DefaultAccessLevelAttributeKey, measures)
+			now := time.Now()
+			l.now = func() time.Time { return now }
+			h := l.Then(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			for i, tr := range tc.Requests {
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, tr.build())
+				assert.Equal(tc.ExpectedCodes[i], rec.Code, "request %d", i)
+			}
+			for _, rule := range tc.Rules {
+				assert.Equal(tc.ExpectedLimited, testutil.ToFloat64(measures.Limited.WithLabelValues(rule.Name)))
+			}
+			assert.Equal(tc.ExpectedExempt, testutil.ToFloat64(measures.Exempt))
+		})
+	}
+}
+
+func TestRefill(t *testing.T) {
+	assert := assert.New(t)
+	l := New(Config{Rules: []Rule{{Name: "all", Rate: 0.5}}}, auth.DefaultAccessLevelAttributeKey, newTestMeasures())
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	h := l.Then(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, testRequest{}.build())
+		return rec
+	}
+
+	assert.Equal(http.StatusOK, serve().Code)
+	rec := serve()
+	assert.Equal(http.StatusTooManyRequests, rec.Code)
+	assert.Equal("2", rec.Header().Get("Retry-After"))
+	assert.Equal("rate limit exceeded", rec.Header().Get(store.XmidtErrorHeaderKey))
+	assert.Equal(store.ProblemContentType, rec.Header().Get("Content-Type"))
+	assert.Contains(rec.Body.String(), `"code":"rate_limited"`)
+
+	now = now.Add(time.Second)
+	assert.Equal("1", serve().Header().Get("Retry-After"))
+	now = now.Add(time.Second)
+	assert.Equal(http.StatusOK, serve().Code)
+
+	now = now.Add(time.Hour)
+	assert.Equal(http.StatusOK, serve().Code)
+	assert.Len(l.limits[0].tokens, 1, "refilled token buckets are swept")
+}
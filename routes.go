@@ -9,11 +9,11 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
+	"github.com/xmidt-org/argus/health"
 	"github.com/xmidt-org/argus/store"
 	"github.com/xmidt-org/arrange"
 	"github.com/xmidt-org/arrange/arrangehttp"
 	"github.com/xmidt-org/candlelight"
-	"github.com/xmidt-org/httpaux"
 	"github.com/xmidt-org/touchstone"
 	"github.com/xmidt-org/touchstone/touchhttp"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
@@ -24,7 +24,12 @@ type PrimaryRouterIn struct {
 	fx.In
 	Router    *mux.Router `name:"server_primary"`
 	APIBase   string      `name:"api_base"`
+	APIBaseV2 string      `name:"api_base_v2"`
 	AuthChain alice.Chain `name:"auth_chain"`
+	// RateLimit runs after AuthChain so that the principal of requests is known.
+	RateLimit alice.Chain `name:"rate_limit_chain"`
+	// Compression gzips responses negotiated through Accept-Encoding.
+	Compression alice.Chain `name:"compression_chain"`
 	// Tracing will be used to set up tracing instrumentation code.
 	Tracing  candlelight.Tracing
 	Handlers PrimaryHandlersIn
@@ -36,6 +41,27 @@ type PrimaryHandlersIn struct {
 	Delete store.Handler `name:"delete_handler"`
 	Get    store.Handler `name:"get_handler"`
 	GetAll store.Handler `name:"get_all_handler"`
+
+	Increment store.Handler `name:"increment_handler"`
+	Transact  store.Handler `name:"transaction_handler"`
+
+	AcquireLease store.Handler `name:"acquire_lease_handler"`
+	RenewLease   store.Handler `name:"renew_lease_handler"`
+	ReleaseLease store.Handler `name:"release_lease_handler"`
+	GetLease     store.Handler `name:"get_lease_handler"`
+
+	// Reconcile is nil when the store isn't replicated.
+	Reconcile store.Handler `name:"reconcile_handler"`
+
+	// Quota is nil when the store doesn't enforce quotas.
+	Quota store.Handler `name:"quota_handler"`
+
+	OpenAPI store.Handler `name:"openapi_handler"`
+
+	// The v2 handlers send items along with their metadata.
+	GetV2    store.Handler `name:"get_v2_handler"`
+	GetAllV2 store.Handler `name:"get_all_v2_handler"`
+	DeleteV2 store.Handler `name:"delete_v2_handler"`
 }
 
 type MetricRouterIn struct {
@@ -44,6 +70,12 @@ type MetricRouterIn struct {
 	Handler touchhttp.Handler
 }
 
+type HealthRouterIn struct {
+	fx.In
+	Router  *mux.Router `name:"server_health"`
+	Checker *health.Checker
+}
+
 type PrimaryMMIn struct {
 	fx.In
 	Primary alice.Chain `name:"middleware_primary_metrics"`
@@ -78,21 +110,16 @@ func provideServers() fx.Option {
 			Inject: arrange.Inject{
 				HealthMMIn{},
 			},
-			Invoke: arrange.Invoke{
-				func(r *mux.Router) {
-					r.Handle("/health", httpaux.ConstantHandler{
-						StatusCode: http.StatusOK,
-					}).Methods("GET")
-				},
-			},
 		}.Provide(),
 		arrangehttp.Server{
 			Name: "server_metrics",
 			Key:  "servers.metrics",
 		}.Provide(),
+		provideGRPCServer(),
 
 		fx.Invoke(
 			handlePrimaryEndpoint,
+			handleHealthEndpoint,
 			handleMetricEndpoint,
 		),
 	)
@@ -105,16 +132,56 @@ func handlePrimaryEndpoint(in PrimaryRouterIn) {
 	}
 	in.Router.Use(
 		in.AuthChain.Then,
+		in.RateLimit.Then,
+		in.Compression.Then,
 		otelmux.Middleware("server_primary", options...),
 		candlelight.EchoFirstTraceNodeInfo(in.Tracing, false),
 	)
 
-	bucketPath := fmt.Sprintf("/%s/store/{bucket}", in.APIBase)
+	handleStoreRoutes(in.Router, in.APIBase, in.Handlers)
+	handleStoreV2Routes(in.Router, in.APIBaseV2, in.Handlers)
+}
+
+// handleStoreRoutes registers the store API routes under apiBase. They're
+// described by the document of the openapi handler, which must be kept in sync.
+func handleStoreRoutes(router *mux.Router, apiBase string, handlers PrimaryHandlersIn) {
+	router.Handle(fmt.Sprintf("/%s/openapi.json", apiBase), handlers.OpenAPI).Methods(http.MethodGet)
+
+	bucketPath := fmt.Sprintf("/%s/store/{bucket}", apiBase)
+	itemPath := fmt.Sprintf("%s/{id}", bucketPath)
+	router.Handle(itemPath, handlers.Set).Methods(http.MethodPut)
+	router.Handle(itemPath, handlers.Get).Methods(http.MethodGet)
+	router.Handle(bucketPath, handlers.GetAll).Methods(http.MethodGet)
+	router.Handle(itemPath, handlers.Delete).Methods(http.MethodDelete)
+	router.Handle(itemPath+":increment", handlers.Increment).Methods(http.MethodPost)
+	router.Handle(fmt.Sprintf("/%s/transactions", apiBase), handlers.Transact).Methods(http.MethodPost)
+
+	leasePath := fmt.Sprintf("/%s/leases/{bucket}/{id}", apiBase)
+	router.Handle(leasePath, handlers.AcquireLease).Methods(http.MethodPost)
+	router.Handle(leasePath, handlers.RenewLease).Methods(http.MethodPut)
+	router.Handle(leasePath, handlers.ReleaseLease).Methods(http.MethodDelete)
+	router.Handle(leasePath, handlers.GetLease).Methods(http.MethodGet)
+
+	if handlers.Reconcile != nil {
+		reconcilePath := fmt.Sprintf("/%s/reconcile/{bucket}", apiBase)
+		router.Handle(reconcilePath, handlers.Reconcile).Methods(http.MethodGet, http.MethodPost)
+	}
+
+	if handlers.Quota != nil {
+		quotaPath := fmt.Sprintf("/%s/quotas/{bucket}", apiBase)
+		router.Handle(quotaPath, handlers.Quota).Methods(http.MethodGet, http.MethodPut)
+	}
+}
+
+// handleStoreV2Routes registers the v2 store routes under apiBase. Items are
+// written as in v1 but read and deleted along with their metadata.
+func handleStoreV2Routes(router *mux.Router, apiBase string, handlers PrimaryHandlersIn) {
+	bucketPath := fmt.Sprintf("/%s/store/{bucket}", apiBase)
 	itemPath := fmt.Sprintf("%s/{id}", bucketPath)
-	in.Router.Handle(itemPath, in.Handlers.Set).Methods(http.MethodPut)
-	in.Router.Handle(itemPath, in.Handlers.Get).Methods(http.MethodGet)
-	in.Router.Handle(bucketPath, in.Handlers.GetAll).Methods(http.MethodGet)
-	in.Router.Handle(itemPath, in.Handlers.Delete).Methods(http.MethodDelete)
+	router.Handle(itemPath, handlers.Set).Methods(http.MethodPut)
+	router.Handle(itemPath, handlers.GetV2).Methods(http.MethodGet)
+	router.Handle(bucketPath, handlers.GetAllV2).Methods(http.MethodGet)
+	router.Handle(itemPath, handlers.DeleteV2).Methods(http.MethodDelete)
 }
 
 func metricMiddleware(f *touchstone.Factory) (out MetricMiddlewareOut) {
@@ -137,6 +204,11 @@ func metricMiddleware(f *touchstone.Factory) (out MetricMiddlewareOut) {
 	return
 }
 
+func handleHealthEndpoint(in HealthRouterIn) {
+	in.Router.Handle("/health", in.Checker.LivenessHandler()).Methods(http.MethodGet)
+	in.Router.Handle("/ready", in.Checker.ReadinessHandler()).Methods(http.MethodGet)
+}
+
 func handleMetricEndpoint(in MetricRouterIn) {
 	in.Router.Handle("/metrics", in.Handler).Methods("GET")
 }
@@ -0,0 +1,331 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/auth"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/argus/store/inmem"
+	"go.uber.org/fx"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+const testAPIBase = "api/v1"
+
+// openAPITestStore replicates and enforces quotas so that every route is
+// served.
+type openAPITestStore struct {
+	store.S
+}
+
+func (openAPITestStore) Reconcile(bucket string, _ bool) (store.ReconcileReport, error) {
+	return store.ReconcileReport{Bucket: bucket}, nil
+}
+
+func (openAPITestStore) Usage(bucket string) (store.BucketUsage, error) {
+	return store.BucketUsage{Bucket: bucket}, nil
+}
+
+func (openAPITestStore) AdjustUsage(bucket, _ string, _ store.Usage) (store.BucketUsage, error) {
+	return store.BucketUsage{Bucket: bucket}, nil
+}
+
+type openAPIDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Parameters map[string]struct {
+			Name   string `json:"name"`
+			In     string `json:"in"`
+			Schema struct {
+				Pattern string `json:"pattern"`
+			} `json:"schema"`
+		} `json:"parameters"`
+	} `json:"components"`
+}
+
+// newTestHandlers builds the store handlers from the validation config, the
+// way the primary server does.
+func newTestHandlers(t *testing.T, config store.UserInputValidationConfig, replicated bool) PrimaryHandlersIn {
+	var (
+		handlers PrimaryHandlersIn
+		s        store.S = inmem.NewSharded(inmem.Config{}, nil)
+		options          = []fx.Option{
+			store.ProvideHandlers(),
+			fx.Supply(config, auth.AccessLevel{AttributeKey: "access-level"}),
+			fx.Provide(
+				func() func(context.Context) *zap.Logger {
+					return func(context.Context) *zap.Logger { return zap.NewNop() }
+				},
+				func() auth.GRPCAuthenticator {
+					return auth.NewGRPCAuthenticator(alice.New())
+				},
+				fx.Annotated{
+					Name:   "api_base",
+					Target: func() string { return testAPIBase },
+				},
+			),
+			fx.Invoke(func(in PrimaryHandlersIn) {
+				handlers = in
+			}),
+		}
+	)
+
+	if replicated {
+		ts := openAPITestStore{S: s}
+		s = ts
+		options = append(options, fx.Provide(
+			func() store.Reconciler { return ts },
+			func() store.UsageTracker { return ts },
+		))
+	}
+	options = append(options, fx.Provide(func() store.S { return s }))
+
+	app := fxtest.New(t, options...)
+	app.RequireStart()
+	app.RequireStop()
+	return handlers
+}
+
+// stubHandlers replaces the handlers of all routes but the openapi one by
+// handlers echoing their name.
+func stubHandlers(handlers PrimaryHandlersIn) PrimaryHandlersIn {
+	stub := func(name string) store.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			rw.Header().Set("X-Handler", name)
+		})
+	}
+
+	stubs := PrimaryHandlersIn{
+		Set:          stub("set"),
+		Delete:       stub("delete"),
+		Get:          stub("get"),
+		GetAll:       stub("get_all"),
+		Increment:    stub("increment"),
+		Transact:     stub("transaction"),
+		AcquireLease: stub("acquire_lease"),
+		RenewLease:   stub("renew_lease"),
+		ReleaseLease: stub("release_lease"),
+		GetLease:     stub("get_lease"),
+		OpenAPI:      handlers.OpenAPI,
+	}
+	if handlers.Reconcile != nil {
+		stubs.Reconcile = stub("reconcile")
+	}
+	if handlers.Quota != nil {
+		stubs.Quota = stub("quota")
+	}
+	return stubs
+}
+
+func TestOpenAPI(t *testing.T) {
+	type testCase struct {
+		Description     string
+		Config          store.UserInputValidationConfig
+		Replicated      bool
+		ParamValues     map[string]string
+		ExpectedHandler map[string]string
+	}
+
+	var (
+		routeHandlers = map[string]string{
+			"GET /openapi.json":                   "",
+			"GET /store/{bucket}":                 "get_all",
+			"PUT /store/{bucket}/{id}":            "set",
+			"GET /store/{bucket}/{id}":            "get",
+			"DELETE /store/{bucket}/{id}":         "delete",
+			"POST /store/{bucket}/{id}:increment": "increment",
+			"POST /transactions":                  "transaction",
+			"POST /leases/{bucket}/{id}":          "acquire_lease",
+			"PUT /leases/{bucket}/{id}":           "renew_lease",
+			"DELETE /leases/{bucket}/{id}":        "release_lease",
+			"GET /leases/{bucket}/{id}":           "get_lease",
+		}
+		replicatedRouteHandlers = map[string]string{
+			"GET /reconcile/{bucket}":  "reconcile",
+			"POST /reconcile/{bucket}": "reconcile",
+			"GET /quotas/{bucket}":     "quota",
+			"PUT /quotas/{bucket}":     "quota",
+		}
+		allRouteHandlers = map[string]string{}
+		id               = "7e8c5f378b4addbaebc70897c4478cca06009e3e360208ebd073dbee4b3774e7"
+	)
+	for _, handlers := range []map[string]string{routeHandlers, replicatedRouteHandlers} {
+		for route, handler := range handlers {
+			allRouteHandlers[route] = handler
+		}
+	}
+
+	tcs := []testCase{
+		{
+			Description:     "Default config",
+			ParamValues:     map[string]string{"bucket": "testing-bucket", "id": id, "X-Xmidt-Owner": "owner-name"},
+			ExpectedHandler: routeHandlers,
+		},
+		{
+			Description:     "Replicated store with quotas",
+			Replicated:      true,
+			ParamValues:     map[string]string{"bucket": "testing-bucket", "id": id, "X-Xmidt-Owner": "owner-name"},
+			ExpectedHandler: allRouteHandlers,
+		},
+		{
+			Description: "Custom formats",
+			Config: store.UserInputValidationConfig{
+				BucketFormatRegex: "^[A-Z]+$",
+				OwnerFormatRegex:  "^[a-z]{3}$",
+			},
+			ParamValues:     map[string]string{"bucket": "TESTING", "id": id, "X-Xmidt-Owner": "own"},
+			ExpectedHandler: routeHandlers,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			router := mux.NewRouter()
+			handleStoreRoutes(router, testAPIBase, stubHandlers(newTestHandlers(t, tc.Config, tc.Replicated)))
+
+			rw := httptest.NewRecorder()
+			router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/"+testAPIBase+"/openapi.json", nil))
+			require.Equal(http.StatusOK, rw.Code)
+			assert.Equal(store.JSONContentType, rw.Header().Get("Content-Type"))
+			var doc openAPIDocument
+			require.Nil(json.Unmarshal(rw.Body.Bytes(), &doc))
+
+			// Every route of the router must be described by the document.
+			var routes []string
+			err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+				template, err := route.GetPathTemplate()
+				if err != nil {
+					return err
+				}
+				methods, err := route.GetMethods()
+				if err != nil {
+					return err
+				}
+				for _, method := range methods {
+					routes = append(routes, method+" "+strings.TrimPrefix(template, "/"+testAPIBase))
+				}
+				return nil
+			})
+			require.Nil(err)
+
+			var operations []string
+			for path, item := range doc.Paths {
+				for method := range item {
+					operations = append(operations, strings.ToUpper(method)+" "+path)
+				}
+			}
+			sort.Strings(routes)
+			sort.Strings(operations)
+			assert.Equal(routes, operations)
+
+			// Requests satisfying the documented constraints must reach the
+			// handler of their route.
+			for route, handler := range tc.ExpectedHandler {
+				method, path, _ := strings.Cut(route, " ")
+				for _, parameter := range doc.Components.Parameters {
+					value, ok := tc.ParamValues[parameter.Name]
+					if !ok || parameter.Schema.Pattern == "" {
+						continue
+					}
+					assert.Regexp(regexp.MustCompile(parameter.Schema.Pattern), value, parameter.Name)
+					if parameter.In == "path" {
+						path = strings.ReplaceAll(path, "{"+parameter.Name+"}", value)
+					}
+				}
+
+				rw := httptest.NewRecorder()
+				router.ServeHTTP(rw, httptest.NewRequest(method, "/"+testAPIBase+path, nil))
+				assert.Equal(http.StatusOK, rw.Code, route)
+				assert.Equal(handler, rw.Header().Get("X-Handler"), route)
+			}
+		})
+	}
+}
+
+func TestStoreV2Routes(t *testing.T) {
+	const (
+		testAPIBaseV2 = "api/v2"
+		owner         = "owner-name-testing"
+		id            = "7e8c5f378b4addbaebc70897c4478cca06009e3e360208ebd073dbee4b3774e7"
+	)
+	var (
+		assert   = assert.New(t)
+		require  = require.New(t)
+		router   = mux.NewRouter()
+		handlers = newTestHandlers(t, store.UserInputValidationConfig{}, false)
+		itemPath = "/store/testing-bucket/" + id
+	)
+	handleStoreRoutes(router, testAPIBase, handlers)
+	handleStoreV2Routes(router, testAPIBaseV2, handlers)
+
+	serve := func(method, apiBase, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/"+apiBase+path, strings.NewReader(body))
+		r.Header.Set(store.ItemOwnerHeaderKey, owner)
+		rw := httptest.NewRecorder()
+		router.ServeHTTP(rw, r)
+		return rw
+	}
+
+	body := `{"id":"` + id + `","data":{"key":"value"},"ttl":60}`
+	require.Equal(http.StatusCreated, serve(http.MethodPut, testAPIBaseV2, itemPath, body).Code)
+	require.Equal(http.StatusOK, serve(http.MethodPut, testAPIBaseV2, itemPath, body).Code)
+
+	// v1 responses don't carry the metadata.
+	rw := serve(http.MethodGet, testAPIBase, itemPath, "")
+	require.Equal(http.StatusOK, rw.Code)
+	var v1Item map[string]interface{}
+	require.Nil(json.Unmarshal(rw.Body.Bytes(), &v1Item))
+	assert.ElementsMatch([]string{"id", "data", "ttl"}, mapKeys(v1Item))
+
+	var envelope model.ItemEnvelope
+	rw = serve(http.MethodGet, testAPIBaseV2, itemPath, "")
+	require.Equal(http.StatusOK, rw.Code)
+	require.Nil(json.Unmarshal(rw.Body.Bytes(), &envelope))
+	assert.Equal(id, envelope.ID)
+	assert.Equal(owner, envelope.Owner)
+	assert.Equal(int64(2), envelope.Version)
+	assert.False(envelope.CreatedAt.IsZero())
+	assert.False(envelope.UpdatedAt.Before(envelope.CreatedAt))
+	assert.WithinDuration(time.Now().Add(time.Minute), envelope.ExpiresAt, 2*time.Second)
+
+	var envelopes []model.ItemEnvelope
+	rw = serve(http.MethodGet, testAPIBaseV2, "/store/testing-bucket", "")
+	require.Equal(http.StatusOK, rw.Code)
+	require.Nil(json.Unmarshal(rw.Body.Bytes(), &envelopes))
+	assert.Equal([]model.ItemEnvelope{envelope}, envelopes)
+
+	rw = serve(http.MethodDelete, testAPIBaseV2, itemPath, "")
+	require.Equal(http.StatusOK, rw.Code)
+	envelope = model.ItemEnvelope{}
+	require.Nil(json.Unmarshal(rw.Body.Bytes(), &envelope))
+	assert.Equal(int64(2), envelope.Version)
+	assert.Equal(http.StatusNotFound, serve(http.MethodGet, testAPIBaseV2, itemPath, "").Code)
+}
+
+func mapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
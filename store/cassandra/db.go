@@ -6,10 +6,13 @@ package cassandra
 import (
 	"context"
 	"errors"
+	"fmt"
+	"regexp"
 	"time"
 
 	"emperror.dev/emperror"
 	"github.com/gocql/gocql"
+	"github.com/hailocab/go-hostpool"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/xmidt-org/argus/model"
 	"github.com/xmidt-org/argus/store"
@@ -24,9 +27,14 @@ const (
 
 	defaultOpTimeout             = time.Duration(10) * time.Second
 	defaultDatabase              = "argus"
+	defaultTable                 = "gifnoc"
 	defaultNumRetries            = 0
 	defaultWaitTimeMult          = 1
 	defaultMaxNumberConnsPerHost = 2
+
+	// Requests are limited to the 16MB frames of the native protocol by
+	// default. 1KB is left for the rest of the statement.
+	maxItemDataBytes = 16*1024*1024 - 1024
 )
 
 type Config struct {
@@ -36,6 +44,15 @@ type Config struct {
 	// Database aka Keyspace for cassandra
 	Database string
 
+	// Table holding the items. Several Argus instances can share a keyspace
+	// as long as each of them uses its own table.
+	// (Optional) defaults to "gifnoc".
+	Table string
+
+	// AutoMigrate applies the pending schema migrations on startup. Otherwise,
+	// they are expected to be applied beforehand with the migrate command.
+	AutoMigrate bool
+
 	// OpTimeout
 	OpTimeout time.Duration
 
@@ -72,22 +89,17 @@ type Client struct {
 }
 
 func NewCassandra(config Config, metricsIn metric.Measures, lc fx.Lifecycle, logger *zap.Logger) (store.S, error) {
-	client, err := CreateCassandraClient(config, metricsIn)
-	ticker := doEvery(time.Second*5, func(_ time.Time) {
-		err := client.Ping()
-		if err != nil {
-			logger.Error("ping failed", zap.Error(err))
+	if config.AutoMigrate {
+		if err := Migrate(context.Background(), config, logger); err != nil {
+			return nil, err
 		}
-	})
+	}
+	client, err := CreateCassandraClient(config, metricsIn)
 	if err != nil {
-		return client, err
+		return nil, err
 	}
 	lc.Append(fx.Hook{
-		OnStart: func(ctx context.Context) error {
-			return nil
-		},
 		OnStop: func(context context.Context) error {
-			ticker.Stop()
 			client.Close()
 			return nil
 		},
@@ -95,26 +107,34 @@ func NewCassandra(config Config, metricsIn metric.Measures, lc fx.Lifecycle, log
 	return client, nil
 }
 
-func doEvery(d time.Duration, f func(time.Time)) *time.Ticker {
-	ticker := time.NewTicker(d)
-	go func() {
-		for x := range ticker.C {
-			f(x)
-		}
-	}()
-	return ticker
+func CreateCassandraClient(config Config, measures metric.Measures) (*Client, error) {
+	validateConfig(&config)
+	if err := validateTable(config.Table); err != nil {
+		return nil, err
+	}
+
+	session, err := createSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		client:   newExecutor(session, config.Table),
+		config:   config,
+		measures: measures,
+	}, nil
 }
 
-func CreateCassandraClient(config Config, measures metric.Measures) (*Client, error) {
+// createSession connects to the keyspace, retrying as configured.
+func createSession(config Config) (*gocql.Session, error) {
 	if len(config.Hosts) == 0 {
 		return nil, errors.New("number of hosts must be > 0")
 	}
 
-	validateConfig(&config)
-
 	clusterConfig := gocql.NewCluster(config.Hosts...)
 	clusterConfig.Consistency = gocql.LocalQuorum
 	clusterConfig.Keyspace = config.Database
+	clusterConfig.PoolConfig.HostSelectionPolicy = gocql.HostPoolHostPolicy(hostpool.New(nil))
 	clusterConfig.Timeout = config.OpTimeout
 	// let retry package handle it
 	clusterConfig.RetryPolicy = &gocql.SimpleRetryPolicy{NumRetries: 1}
@@ -135,24 +155,20 @@ func CreateCassandraClient(config Config, measures metric.Measures) (*Client, er
 		}
 	}
 
-	session, err := connect(clusterConfig)
+	session, err := clusterConfig.CreateSession()
 
 	// retry if it fails
 	waitTime := 1 * time.Second
 	for attempt := 0; attempt < config.NumRetries && err != nil; attempt++ {
 		time.Sleep(waitTime)
-		session, err = connect(clusterConfig)
+		session, err = clusterConfig.CreateSession()
 		waitTime = waitTime * config.WaitTimeMult
 	}
 	if err != nil {
 		return nil, emperror.WrapWith(err, "Connecting to database failed", "hosts", config.Hosts)
 	}
+	return session, nil
 
-	return &Client{
-		client:   session,
-		config:   config,
-		measures: measures,
-	}, nil
 }
 
 func (s *Client) Push(key model.Key, item store.OwnableItem) error {
@@ -171,6 +187,63 @@ func (s *Client) Push(key model.Key, item store.OwnableItem) error {
 	return nil
 }
 
+// PushIfAbsent counts items already existing as successful queries.
+func (s *Client) PushIfAbsent(key model.Key, item store.OwnableItem) error {
+	err := s.client.PushIfAbsent(key, item)
+	outcome := metric.SuccessQueryOutcome
+	if err != nil && !errors.Is(err, store.ErrItemExists) {
+		outcome = metric.FailQueryOutcome
+	}
+	s.measures.Queries.With(prometheus.Labels{
+		metric.QueryTypeLabelKey:    metric.PushIfAbsentQueryType,
+		metric.QueryOutcomeLabelKey: outcome,
+	}).Add(1)
+	return store.SanitizeError(err)
+}
+
+// CompareAndSwap counts items which changed or are missing as successful queries.
+func (s *Client) CompareAndSwap(key model.Key, old, item store.OwnableItem) error {
+	err := s.client.CompareAndSwap(key, old, item)
+	outcome := metric.SuccessQueryOutcome
+	if err != nil && !errors.Is(err, store.ErrItemChanged) && !errors.Is(err, store.ErrItemNotFound) {
+		outcome = metric.FailQueryOutcome
+	}
+	s.measures.Queries.With(prometheus.Labels{
+		metric.QueryTypeLabelKey:    metric.CompareAndSwapQueryType,
+		metric.QueryOutcomeLabelKey: outcome,
+	}).Add(1)
+	return store.SanitizeError(err)
+}
+
+// Increment counts missing items as successful queries.
+func (s *Client) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	value, err := s.client.Increment(key, path, delta, modifiedBy)
+	outcome := metric.SuccessQueryOutcome
+	if err != nil && !errors.Is(err, store.ErrItemNotFound) && !errors.Is(err, store.ErrNotNumeric) {
+		outcome = metric.FailQueryOutcome
+	}
+	s.measures.Queries.With(prometheus.Labels{
+		metric.QueryTypeLabelKey:    metric.IncrementQueryType,
+		metric.QueryOutcomeLabelKey: outcome,
+	}).Add(1)
+	return value, store.SanitizeError(err)
+}
+
+// Transact counts transactions aborted by a condition as successful queries.
+func (s *Client) Transact(ops []store.TransactionOp) error {
+	err := s.client.Transact(ops)
+	outcome := metric.SuccessQueryOutcome
+	var conditionErr store.TransactionConditionError
+	if err != nil && !errors.As(err, &conditionErr) {
+		outcome = metric.FailQueryOutcome
+	}
+	s.measures.Queries.With(prometheus.Labels{
+		metric.QueryTypeLabelKey:    metric.TransactQueryType,
+		metric.QueryOutcomeLabelKey: outcome,
+	}).Add(1)
+	return store.SanitizeError(err)
+}
+
 // nolint:dupl
 func (s *Client) Get(key model.Key) (store.OwnableItem, error) {
 	item, err := s.client.Get(key)
@@ -235,13 +308,34 @@ func (s *Client) GetAll(bucket string) (map[string]store.OwnableItem, error) {
 	return item, err
 }
 
+func (s *Client) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, error) {
+	item, err := s.client.GetAllByOwner(bucket, owner)
+	if err != nil {
+		s.measures.Queries.With(prometheus.Labels{
+			metric.QueryTypeLabelKey:    metric.GetAllByOwnerQueryType,
+			metric.QueryOutcomeLabelKey: metric.FailQueryOutcome,
+		}).Add(1)
+		return item, store.SanitizeError(err)
+	}
+	s.measures.Queries.With(prometheus.Labels{
+		metric.QueryTypeLabelKey:    metric.GetAllByOwnerQueryType,
+		metric.QueryOutcomeLabelKey: metric.SuccessQueryOutcome,
+	}).Add(1)
+	return item, err
+}
+
+// MaxItemDataBytes returns the size limit of the item data the database accepts.
+func (s *Client) MaxItemDataBytes() int64 {
+	return maxItemDataBytes
+}
+
 func (s *Client) Close() {
 	s.client.Close()
 }
 
 // Ping is for pinging the database to verify that the connection is still good.
-func (s *Client) Ping() error {
-	err := s.client.Ping()
+func (s *Client) Ping(ctx context.Context) error {
+	err := s.client.Ping(ctx)
 	if err != nil {
 		s.measures.Queries.With(prometheus.Labels{
 			metric.QueryTypeLabelKey:    metric.PingQueryType,
@@ -266,6 +360,9 @@ func validateConfig(config *Config) {
 	if config.Database == "" {
 		config.Database = defaultDatabase
 	}
+	if config.Table == "" {
+		config.Table = defaultTable
+	}
 	if config.NumRetries < 0 {
 		config.NumRetries = defaultNumRetries
 	}
@@ -276,3 +373,13 @@ func validateConfig(config *Config) {
 		config.MaxConnsPerHost = defaultMaxNumberConnsPerHost
 	}
 }
+
+var validTableName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,47}$`)
+
+// validateTable makes sure the table name can safely be formatted into CQL statements.
+func validateTable(table string) error {
+	if !validTableName.MatchString(table) {
+		return fmt.Errorf("invalid table name %q", table)
+	}
+	return nil
+}
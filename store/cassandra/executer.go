@@ -4,70 +4,267 @@
 package cassandra
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"time"
 
 	"github.com/gocql/gocql"
-	"github.com/hailocab/go-hostpool"
 	"github.com/xmidt-org/argus/model"
 	"github.com/xmidt-org/argus/store"
 )
 
 type dbStore interface {
 	store.S
+	store.OwnerQuerier
+	store.Creator
+	store.Swapper
+	store.Incrementer
+	store.Transactor
 	Close()
-	Ping() error
+	Ping(ctx context.Context) error
 }
 
 var errServerClosed = errors.New("server is closed")
 
+// maxIncrementAttempts bounds the lightweight transaction loop of increments.
+const maxIncrementAttempts = 10
+
 type cassandraExecutor struct {
 	session *gocql.Session
+	now     func() time.Time
+
+	pushQuery          string
+	pushIfAbsentQuery  string
+	swapQuery          string
+	deleteIfQuery      string
+	getQuery           string
+	deleteQuery        string
+	getAllQuery        string
+	getAllByOwnerQuery string
 }
 
-func connect(clusterConfig *gocql.ClusterConfig) (dbStore, error) {
-	clusterConfig.PoolConfig.HostSelectionPolicy = gocql.HostPoolHostPolicy(hostpool.New(nil))
-	session, err := clusterConfig.CreateSession()
-	if err != nil {
-		return nil, err
+// newExecutor builds the executor for the given table. The table name
+// must have been validated beforehand.
+func newExecutor(session *gocql.Session, table string) *cassandraExecutor {
+	return &cassandraExecutor{
+		session:            session,
+		now:                time.Now,
+		pushQuery:          fmt.Sprintf("INSERT INTO %s (bucket, id, owner, expires, data, last_modified, created_at, version, modified_by) VALUES (?,?,?,?,?,?,?,?,?) USING TTL ?", table),
+		pushIfAbsentQuery:  fmt.Sprintf("INSERT INTO %s (bucket, id, owner, expires, data, last_modified, created_at, version, modified_by) VALUES (?,?,?,?,?,?,?,?,?) IF NOT EXISTS USING TTL ?", table),
+		swapQuery:          fmt.Sprintf("UPDATE %s USING TTL ? SET owner = ?, expires = ?, data = ?, last_modified = ?, created_at = ?, version = ?, modified_by = ? WHERE bucket = ? AND id = ? IF owner = ? AND data = ?", table),
+		deleteIfQuery:      fmt.Sprintf("DELETE from %s WHERE bucket = ? AND id = ? IF owner = ? AND data = ?", table),
+		getQuery:           fmt.Sprintf("SELECT %s from %s WHERE bucket = ? AND id = ?", rowColumns, table),
+		deleteQuery:        fmt.Sprintf("DELETE from %s WHERE bucket = ? AND id = ?", table),
+		getAllQuery:        fmt.Sprintf("SELECT %s from %s WHERE bucket = ?", rowColumns, table),
+		getAllByOwnerQuery: fmt.Sprintf("SELECT %s from %s WHERE bucket = ? AND owner = ?", rowColumns, table),
 	}
-
-	return &cassandraExecutor{session: session}, nil
 }
 
 func (s *cassandraExecutor) Push(key model.Key, item store.OwnableItem) error {
-	data, err := json.Marshal(&item)
+	now := s.now()
+	data, expires, err := encodeItem(item, now)
 	if err != nil {
 		return store.ItemOperationError{Err: fmt.Errorf("%w: %v", store.ErrJSONEncode, err), Key: key, Operation: "push"}
 	}
-	err = s.session.Query("INSERT INTO gifnoc (bucket, id, data) VALUES (?,?,?) USING TTL ?", key.Bucket, key.ID, data, item.TTL).Exec()
+	err = s.session.Query(s.pushQuery, key.Bucket, key.ID, item.Owner, expires, data, now, createdAt(item, now), item.Version, item.ModifiedBy, item.TTL).Exec()
 	if err != nil {
-		return store.ItemOperationError{Err: fmt.Errorf("%w: %v", store.ErrQueryExecution, err), Key: key, Operation: "push"}
+		return store.ItemOperationError{Err: queryError(err), Key: key, Operation: "push"}
+	}
+	return nil
+}
+
+// PushIfAbsent relies on a lightweight transaction so concurrent creations of
+// the same key can't both succeed. Expired rows are purged by their TTL and
+// don't prevent the insertion.
+func (s *cassandraExecutor) PushIfAbsent(key model.Key, item store.OwnableItem) error {
+	now := s.now()
+	data, expires, err := encodeItem(item, now)
+	if err != nil {
+		return store.ItemOperationError{Err: fmt.Errorf("%w: %v", store.ErrJSONEncode, err), Key: key, Operation: "push"}
+	}
+	applied, err := s.session.Query(s.pushIfAbsentQuery, key.Bucket, key.ID, item.Owner, expires, data, now, createdAt(item, now), item.Version, item.ModifiedBy, item.TTL).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return store.ItemOperationError{Err: queryError(err), Key: key, Operation: "push"}
+	}
+	if !applied {
+		return store.ItemOperationError{Err: store.ErrItemExists, Key: key, Operation: "push"}
+	}
+	return nil
+}
+
+// CompareAndSwap reads the row to compare it with old, then updates it through
+// a lightweight transaction conditioned on the columns read, so the update is
+// only applied when no other write happened in between.
+func (s *cassandraExecutor) CompareAndSwap(key model.Key, old, item store.OwnableItem) error {
+	r, current, err := s.getRow(key)
+	if err != nil {
+		return store.ItemOperationError{Err: err, Key: key, Operation: "compareandswap"}
+	}
+	if current.Owner != old.Owner || !reflect.DeepEqual(current.Data, old.Data) {
+		return store.ItemOperationError{Err: store.ErrItemChanged, Key: key, Operation: "compareandswap"}
+	}
+	if err := s.swapRow(key, r, item); err != nil {
+		return store.ItemOperationError{Err: err, Key: key, Operation: "compareandswap"}
+	}
+	return nil
+}
+
+// Increment runs a lightweight transaction loop: the row is read, updated and
+// written back unless another write happened in between, in which case the
+// increment is tried again on the new row.
+func (s *cassandraExecutor) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	for attempt := 0; attempt < maxIncrementAttempts; attempt++ {
+		r, item, err := s.getRow(key)
+		if err != nil {
+			return 0, store.ItemOperationError{Err: err, Key: key, Operation: "increment"}
+		}
+		value, err := store.IncrementData(item.Data, path, delta)
+		if err != nil {
+			return 0, store.ItemOperationError{Err: err, Key: key, Operation: "increment"}
+		}
+		item.Version++
+		item.ModifiedBy = modifiedBy
+		err = s.swapRow(key, r, item)
+		if err == nil {
+			return value, nil
+		}
+		if !errors.Is(err, store.ErrItemChanged) {
+			return 0, store.ItemOperationError{Err: err, Key: key, Operation: "increment"}
+		}
+	}
+	return 0, store.ItemOperationError{Err: store.ErrItemChanged, Key: key, Operation: "increment"}
+}
+
+// Transact reads the items of the operations to check their conditions, then
+// applies them in a logged batch, so either all or none are written. Lightweight
+// transactions are limited to a single partition: when all the operations
+// target the same bucket the batch is conditioned on the rows read, otherwise
+// a write between the reads and the batch isn't detected.
+func (s *cassandraExecutor) Transact(ops []store.TransactionOp) error {
+	rows := make([]row, len(ops))
+	singleBucket := true
+	for i, op := range ops {
+		r, item, err := s.getRow(op.Key)
+		var current *store.OwnableItem
+		switch {
+		case err == nil:
+			current = &item
+		case !errors.Is(err, store.ErrItemNotFound):
+			return store.ItemOperationError{Err: err, Key: op.Key, Operation: "transact"}
+		}
+		if err := store.CheckCondition(op, current); err != nil {
+			return store.TransactionConditionError{Index: i, Err: err}
+		}
+		rows[i] = r
+		singleBucket = singleBucket && op.Key.Bucket == ops[0].Key.Bucket
+	}
+
+	batch := s.session.NewBatch(gocql.LoggedBatch)
+	for i, op := range ops {
+		conditional := singleBucket && op.Condition != store.Unconditional
+		switch {
+		case op.Delete && conditional:
+			batch.Query(s.deleteIfQuery, op.Key.Bucket, op.Key.ID, rows[i].owner, rows[i].data)
+		case op.Delete:
+			batch.Query(s.deleteQuery, op.Key.Bucket, op.Key.ID)
+		default:
+			now := s.now()
+			data, expires, err := encodeItem(op.Item, now)
+			if err != nil {
+				return store.ItemOperationError{Err: fmt.Errorf("%w: %v", store.ErrJSONEncode, err), Key: op.Key, Operation: "transact"}
+			}
+			switch {
+			case conditional && op.Condition == store.IfAbsent:
+				batch.Query(s.pushIfAbsentQuery, op.Key.Bucket, op.Key.ID, op.Item.Owner, expires, data, now, createdAt(op.Item, now), op.Item.Version, op.Item.ModifiedBy, op.Item.TTL)
+			case conditional:
+				batch.Query(s.swapQuery, op.Item.TTL, op.Item.Owner, expires, data, now, createdAt(op.Item, now), op.Item.Version, op.Item.ModifiedBy, op.Key.Bucket, op.Key.ID, rows[i].owner, rows[i].data)
+			default:
+				batch.Query(s.pushQuery, op.Key.Bucket, op.Key.ID, op.Item.Owner, expires, data, now, createdAt(op.Item, now), op.Item.Version, op.Item.ModifiedBy, op.Item.TTL)
+			}
+		}
+	}
+
+	if !singleBucket {
+		if err := s.session.ExecuteBatch(batch); err != nil {
+			return queryError(err)
+		}
+		return nil
+	}
+	applied, iter, err := s.session.MapExecuteBatchCAS(batch, map[string]interface{}{})
+	if iter != nil {
+		iter.Close()
+	}
+	if err != nil {
+		return queryError(err)
+	}
+	if !applied {
+		return store.TransactionConditionError{Index: -1, Err: store.ErrItemChanged}
+	}
+	return nil
+}
+
+// getRow reads the live row at key along with its decoded item.
+func (s *cassandraExecutor) getRow(key model.Key) (row, store.OwnableItem, error) {
+	var r row
+	iter := s.session.Query(s.getQuery, key.Bucket, key.ID).Iter()
+	ok := iter.Scan(r.dest()...)
+	if err := iter.Close(); err != nil {
+		return r, store.OwnableItem{}, queryError(err)
+	}
+	if !ok {
+		return r, store.OwnableItem{}, store.ErrItemNotFound
+	}
+	r.id = key.ID
+	item, expired, err := r.item(s.now())
+	if err != nil {
+		return r, store.OwnableItem{}, fmt.Errorf("%w: %v", store.ErrJSONDecode, err)
+	}
+	if expired {
+		return r, store.OwnableItem{}, store.ErrItemNotFound
+	}
+	return r, item, nil
+}
+
+// swapRow replaces the row r read at key with item unless it was written since.
+func (s *cassandraExecutor) swapRow(key model.Key, r row, item store.OwnableItem) error {
+	now := s.now()
+	data, expires, err := encodeItem(item, now)
+	if err != nil {
+		return fmt.Errorf("%w: %v", store.ErrJSONEncode, err)
+	}
+	applied, err := s.session.Query(s.swapQuery, item.TTL, item.Owner, expires, data, now, createdAt(item, now), item.Version, item.ModifiedBy, key.Bucket, key.ID, r.owner, r.data).
+		MapScanCAS(map[string]interface{}{})
+	if err != nil {
+		return queryError(err)
+	}
+	if !applied {
+		return store.ErrItemChanged
 	}
 	return nil
 }
 
 func (s *cassandraExecutor) Get(key model.Key) (store.OwnableItem, error) {
-	var (
-		data []byte
-		ttl  int64
-	)
-	iter := s.session.Query("SELECT data, ttl(data) from gifnoc WHERE bucket = ? AND id = ?", key.Bucket, key.ID).Iter()
-	ok := iter.Scan(&data, &ttl)
+	var r row
+	iter := s.session.Query(s.getQuery, key.Bucket, key.ID).Iter()
+	ok := iter.Scan(r.dest()...)
 	err := iter.Close()
 	if !ok {
 		if err != nil {
-			return store.OwnableItem{}, store.ItemOperationError{Err: fmt.Errorf("%w: %v", store.ErrQueryExecution, err), Key: key, Operation: "get"}
+			return store.OwnableItem{}, store.ItemOperationError{Err: queryError(err), Key: key, Operation: "get"}
 		}
 		return store.OwnableItem{}, store.ItemOperationError{Err: fmt.Errorf("%w: %v", store.ErrItemNotFound, err), Key: key, Operation: "get"}
 	}
-	item := store.OwnableItem{}
-	err = json.Unmarshal(data, &item)
+	r.id = key.ID
+	item, expired, err := r.item(s.now())
 	if err != nil {
 		return store.OwnableItem{}, store.ItemOperationError{Err: fmt.Errorf("%w: %v", store.ErrJSONDecode, err), Key: key, Operation: "get"}
 	}
-	item.TTL = &ttl
+	if expired {
+		return store.OwnableItem{}, store.ItemOperationError{Err: store.ErrItemNotFound, Key: key, Operation: "get"}
+	}
 	return item, nil
 }
 
@@ -76,45 +273,96 @@ func (s *cassandraExecutor) Delete(key model.Key) (store.OwnableItem, error) {
 	if err != nil {
 		return item, store.ItemOperationError{Err: err, Key: key, Operation: "delete"}
 	}
-	err = s.session.Query("DELETE from gifnoc WHERE bucket = ? AND id = ?", key.Bucket, key.ID).Exec()
+	err = s.session.Query(s.deleteQuery, key.Bucket, key.ID).Exec()
 	if err != nil {
-		return store.OwnableItem{}, store.ItemOperationError{Err: fmt.Errorf("%w: %v", store.ErrQueryExecution, err), Key: key, Operation: "delete"}
+		return store.OwnableItem{}, store.ItemOperationError{Err: queryError(err), Key: key, Operation: "delete"}
 	}
 	return item, nil
 }
 
 func (s *cassandraExecutor) GetAll(bucket string) (map[string]store.OwnableItem, error) {
+	return s.scanAll(s.session.Query(s.getAllQuery, bucket), bucket)
+}
+
+// GetAllByOwner relies on the owner index so only the rows of the owner
+// are read and decoded.
+func (s *cassandraExecutor) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, error) {
+	return s.scanAll(s.session.Query(s.getAllByOwnerQuery, bucket, owner), bucket)
+}
+
+func (s *cassandraExecutor) scanAll(query *gocql.Query, bucket string) (map[string]store.OwnableItem, error) {
 	result := map[string]store.OwnableItem{}
-	var (
-		key  string
-		data []byte
-		ttl  int64
-	)
-	iter := s.session.Query("SELECT id, data, ttl(data) from gifnoc WHERE bucket = ?", bucket).Iter()
-	for iter.Scan(&key, &data, &ttl) {
-		item := store.OwnableItem{}
-		err := json.Unmarshal(data, &item)
+	now := s.now()
+	var r row
+	iter := query.Iter()
+	for iter.Scan(append([]interface{}{&r.id}, r.dest()...)...) {
+		item, expired, err := r.item(now)
 		if err != nil {
 			iter.Close()
 			return result, store.GetAllItemsOperationErr{Err: store.ErrJSONDecode, Bucket: bucket}
 		}
-		item.TTL = &ttl
-		result[key] = item
+		if !expired {
+			result[r.id] = item
+		}
+		r = row{}
 	}
 	err := iter.Close()
 	if err != nil {
-		return result, store.GetAllItemsOperationErr{Err: store.ErrQueryExecution, Bucket: bucket}
+		return result, store.GetAllItemsOperationErr{Err: queryError(err), Bucket: bucket}
 	}
 	return result, nil
 }
 
+// queryError wraps the error of a failed query, flagging it as retryable
+// when gocql reports a transient condition.
+func queryError(err error) error {
+	return store.InternalError{
+		Reason:    fmt.Errorf("%w: %v", store.ErrQueryExecution, err),
+		Retryable: isTransient(err),
+		Unapplied: isUnapplied(err),
+	}
+}
+
+// isUnapplied returns true for the transient errors raised before the query
+// reached the replicas: no connections, unavailable replicas and overloaded
+// coordinators. Timeouts and closed connections leave the query outcome unknown.
+func isUnapplied(err error) bool {
+	if errors.Is(err, gocql.ErrNoConnections) {
+		return true
+	}
+	var reqErr gocql.RequestError
+	if errors.As(err, &reqErr) {
+		switch reqErr.Code() {
+		case gocql.ErrCodeUnavailable, gocql.ErrCodeOverloaded:
+			return true
+		}
+	}
+	return false
+}
+
+// isTransient returns true for timeouts, unavailable replicas and
+// overloaded coordinators.
+func isTransient(err error) bool {
+	if errors.Is(err, gocql.ErrTimeoutNoResponse) || errors.Is(err, gocql.ErrConnectionClosed) || errors.Is(err, gocql.ErrNoConnections) {
+		return true
+	}
+	var reqErr gocql.RequestError
+	if errors.As(err, &reqErr) {
+		switch reqErr.Code() {
+		case gocql.ErrCodeUnavailable, gocql.ErrCodeOverloaded, gocql.ErrCodeReadTimeout, gocql.ErrCodeWriteTimeout:
+			return true
+		}
+	}
+	return false
+}
+
 func (s *cassandraExecutor) Close() {
 	s.session.Close()
 }
 
-func (s *cassandraExecutor) Ping() error {
+func (s *cassandraExecutor) Ping(ctx context.Context) error {
 	if s.session.Closed() {
 		return errServerClosed
 	}
-	return nil
+	return s.session.Query("SELECT now() FROM system.local").WithContext(ctx).Exec()
 }
@@ -0,0 +1,245 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package cassandra
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.uber.org/zap"
+)
+
+// SchemaVersionTable records which migrations were applied to which table.
+// It is shared by all the Argus tables living in the same keyspace.
+const SchemaVersionTable = "schema_version"
+
+// minMigrationTimeout is the lowest query timeout used while migrating, as schema
+// changes are usually much slower than the item queries OpTimeout is tuned for.
+const minMigrationTimeout = time.Minute
+
+var (
+	errInvalidMigration = errors.New("invalid migration file")
+	errMigrationFailed  = errors.New("migration failed")
+)
+
+// migrationFiles holds the CQL migrations. Files are named <version>_<description>.cql,
+// are rendered with the table name available as {{.Table}} and may hold several
+// statements separated by semicolons. Statements should be idempotent (IF NOT EXISTS)
+// where CQL allows it as several instances may auto-migrate concurrently.
+//
+//go:embed migrations/*.cql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.cql$`)
+
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+// schemaExecutor runs the statements of the migrations and keeps track
+// of the versions applied.
+type schemaExecutor interface {
+	exec(ctx context.Context, stmt string, values ...interface{}) error
+	appliedVersions(ctx context.Context, table string) (map[int]bool, error)
+}
+
+type gocqlSchemaExecutor struct {
+	session *gocql.Session
+}
+
+func (e *gocqlSchemaExecutor) exec(ctx context.Context, stmt string, values ...interface{}) error {
+	return e.session.Query(stmt, values...).WithContext(ctx).Exec()
+}
+
+func (e *gocqlSchemaExecutor) appliedVersions(ctx context.Context, table string) (map[int]bool, error) {
+	versions := make(map[int]bool)
+	var version int
+	iter := e.session.Query("SELECT version FROM "+SchemaVersionTable+" WHERE table_name = ?", table).WithContext(ctx).Iter()
+	for iter.Scan(&version) {
+		versions[version] = true
+	}
+	return versions, iter.Close()
+}
+
+// dataStep rewrites existing rows after the statements of a migration were applied.
+type dataStep func(ctx context.Context) error
+
+type migrator struct {
+	executor   schemaExecutor
+	table      string
+	migrations []migration
+	// dataSteps holds the data step of a migration, if any, by version.
+	dataSteps map[int]dataStep
+	logger    *zap.Logger
+}
+
+// Migrate connects to the keyspace described by the config and applies the
+// migrations not yet recorded for the configured table. The keyspace itself
+// must already exist, as its replication settings are specific to each cluster.
+func Migrate(ctx context.Context, config Config, logger *zap.Logger) error {
+	validateConfig(&config)
+	if err := validateTable(config.Table); err != nil {
+		return err
+	}
+	if config.OpTimeout < minMigrationTimeout {
+		config.OpTimeout = minMigrationTimeout
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	migrations, err := loadMigrations(migrationFiles, config.Table)
+	if err != nil {
+		return err
+	}
+	session, err := createSession(config)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	m := &migrator{
+		executor:   &gocqlSchemaExecutor{session: session},
+		table:      config.Table,
+		migrations: migrations,
+		dataSteps: map[int]dataStep{
+			ownerColumnsVersion: func(ctx context.Context) error {
+				return migrateLegacyRows(ctx, session, config.Table, logger)
+			},
+		},
+		logger: logger,
+	}
+	return m.migrate(ctx)
+}
+
+func (m *migrator) migrate(ctx context.Context) error {
+	err := m.executor.exec(ctx, "CREATE TABLE IF NOT EXISTS "+SchemaVersionTable+` (
+    table_name VARCHAR,
+    version INT,
+    description VARCHAR,
+    applied_at TIMESTAMP,
+    PRIMARY KEY (table_name, version))`)
+	if err != nil {
+		return fmt.Errorf("%w: failed to create %s table: %v", errMigrationFailed, SchemaVersionTable, err)
+	}
+
+	applied, err := m.executor.appliedVersions(ctx, m.table)
+	if err != nil {
+		return fmt.Errorf("%w: failed to read applied versions: %v", errMigrationFailed, err)
+	}
+
+	for _, mig := range m.migrations {
+		if applied[mig.version] {
+			continue
+		}
+		m.logger.Info("applying migration", zap.String("table", m.table),
+			zap.Int("version", mig.version), zap.String("description", mig.description))
+		for _, stmt := range mig.statements {
+			if err := m.executor.exec(ctx, stmt); err != nil {
+				return fmt.Errorf("%w: version %d: %v", errMigrationFailed, mig.version, err)
+			}
+		}
+		if step, ok := m.dataSteps[mig.version]; ok {
+			if err := step(ctx); err != nil {
+				return fmt.Errorf("%w: version %d: data step: %v", errMigrationFailed, mig.version, err)
+			}
+		}
+		err = m.executor.exec(ctx, "INSERT INTO "+SchemaVersionTable+" (table_name, version, description, applied_at) VALUES (?,?,?,?)",
+			m.table, mig.version, mig.description, time.Now())
+		if err != nil {
+			return fmt.Errorf("%w: failed to record version %d: %v", errMigrationFailed, mig.version, err)
+		}
+	}
+	return nil
+}
+
+// loadMigrations reads the migrations from fsys, rendered for the given table,
+// sorted by version.
+func loadMigrations(fsys fs.FS, table string) ([]migration, error) {
+	names, err := fs.Glob(fsys, "migrations/*.cql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	seen := make(map[int]string)
+	for _, name := range names {
+		match := migrationFileName.FindStringSubmatch(path.Base(name))
+		if match == nil {
+			return nil, fmt.Errorf("%w: unexpected name %q", errInvalidMigration, name)
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", errInvalidMigration, name, err)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("%w: %q and %q share version %d", errInvalidMigration, other, name, version)
+		}
+		seen[version] = name
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		statements, err := renderStatements(string(content), table)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", errInvalidMigration, name, err)
+		}
+		migrations = append(migrations, migration{
+			version:     version,
+			description: match[2],
+			statements:  statements,
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// renderStatements fills the table name in and splits the content into
+// its statements, dropping comment lines.
+func renderStatements(content, table string) ([]string, error) {
+	tmpl, err := template.New("migration").Option("missingkey=error").Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, struct{ Table string }{Table: table}); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	var statements []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	if len(statements) == 0 {
+		return nil, errors.New("no statements")
+	}
+	return statements, nil
+}
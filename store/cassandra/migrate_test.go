@@ -0,0 +1,280 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package cassandra
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeSchemaExecutor struct {
+	applied    map[int]bool
+	statements []string
+	failOn     string
+}
+
+func (f *fakeSchemaExecutor) exec(_ context.Context, stmt string, values ...interface{}) error {
+	if f.failOn != "" && strings.Contains(stmt, f.failOn) {
+		return errors.New("query failed")
+	}
+	f.statements = append(f.statements, stmt)
+	if strings.HasPrefix(stmt, "INSERT INTO "+SchemaVersionTable) {
+		f.applied[values[1].(int)] = true
+	}
+	return nil
+}
+
+func (f *fakeSchemaExecutor) appliedVersions(context.Context, string) (map[int]bool, error) {
+	versions := make(map[int]bool, len(f.applied))
+	for v := range f.applied {
+		versions[v] = true
+	}
+	return versions, nil
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tcs := []struct {
+		Description        string
+		Files              fstest.MapFS
+		ExpectedErr        error
+		ExpectedMigrations []migration
+	}{
+		{
+			Description: "Sorted and rendered",
+			Files: fstest.MapFS{
+				"migrations/0010_add_column.cql": {Data: []byte("ALTER TABLE {{.Table}} ADD owner VARCHAR;")},
+				"migrations/0002_create.cql": {Data: []byte("-- comment; with a semicolon\nCREATE TABLE {{.Table}} (id VARCHAR PRIMARY KEY);\n" +
+					"CREATE INDEX IF NOT EXISTS ON {{.Table}} (id);\n")},
+			},
+			ExpectedMigrations: []migration{
+				{
+					version:     2,
+					description: "create",
+					statements: []string{
+						"CREATE TABLE tenant (id VARCHAR PRIMARY KEY)",
+						"CREATE INDEX IF NOT EXISTS ON tenant (id)",
+					},
+				},
+				{
+					version:     10,
+					description: "add_column",
+					statements:  []string{"ALTER TABLE tenant ADD owner VARCHAR"},
+				},
+			},
+		},
+		{
+			Description: "Bad name",
+			Files:       fstest.MapFS{"migrations/create.cql": {Data: []byte("SELECT 1;")}},
+			ExpectedErr: errInvalidMigration,
+		},
+		{
+			Description: "Duplicate version",
+			Files: fstest.MapFS{
+				"migrations/1_a.cql":  {Data: []byte("SELECT 1;")},
+				"migrations/01_b.cql": {Data: []byte("SELECT 1;")},
+			},
+			ExpectedErr: errInvalidMigration,
+		},
+		{
+			Description: "Unknown template field",
+			Files:       fstest.MapFS{"migrations/1_a.cql": {Data: []byte("DROP TABLE {{.Keyspace}};")}},
+			ExpectedErr: errInvalidMigration,
+		},
+		{
+			Description: "Empty",
+			Files:       fstest.MapFS{"migrations/1_a.cql": {Data: []byte("-- nothing\n")}},
+			ExpectedErr: errInvalidMigration,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			migrations, err := loadMigrations(tc.Files, "tenant")
+			if tc.ExpectedErr != nil {
+				assert.True(errors.Is(err, tc.ExpectedErr), "expected '%v' to match '%v'", err, tc.ExpectedErr)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.ExpectedMigrations, migrations)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	require := require.New(t)
+	migrations, err := loadMigrations(migrationFiles, defaultTable)
+	require.NoError(err)
+	require.NotEmpty(migrations)
+	assert.Equal(t, 1, migrations[0].version)
+	assert.Contains(t, migrations[0].statements[0], "CREATE TABLE IF NOT EXISTS gifnoc")
+}
+
+func TestMigrate(t *testing.T) {
+	migrations := []migration{
+		{version: 1, description: "create", statements: []string{"CREATE TABLE t"}},
+		{version: 2, description: "alter", statements: []string{"ALTER TABLE t ADD a", "ALTER TABLE t ADD b"}},
+	}
+
+	tcs := []struct {
+		Description        string
+		Applied            map[int]bool
+		FailOn             string
+		DataStepErr        error
+		ExpectedErr        error
+		ExpectedStatements []string
+		ExpectedApplied    map[int]bool
+
+		ExpectedDataStepRuns int
+	}{
+		{
+			Description:        "Fresh table",
+			Applied:            map[int]bool{},
+			ExpectedStatements: []string{"CREATE TABLE t", "ALTER TABLE t ADD a", "ALTER TABLE t ADD b"},
+			ExpectedApplied:    map[int]bool{1: true, 2: true},
+
+			ExpectedDataStepRuns: 1,
+		},
+		{
+			Description:        "Partially migrated",
+			Applied:            map[int]bool{1: true},
+			ExpectedStatements: []string{"ALTER TABLE t ADD a", "ALTER TABLE t ADD b"},
+			ExpectedApplied:    map[int]bool{1: true, 2: true},
+
+			ExpectedDataStepRuns: 1,
+		},
+		{
+			Description:     "Up to date",
+			Applied:         map[int]bool{1: true, 2: true},
+			ExpectedApplied: map[int]bool{1: true, 2: true},
+		},
+		{
+			Description:        "Failure stops before recording the version",
+			Applied:            map[int]bool{},
+			FailOn:             "ADD b",
+			ExpectedErr:        errMigrationFailed,
+			ExpectedStatements: []string{"CREATE TABLE t", "ALTER TABLE t ADD a"},
+			ExpectedApplied:    map[int]bool{1: true},
+		},
+		{
+			Description:        "Data step failure stops before recording the version",
+			Applied:            map[int]bool{1: true},
+			DataStepErr:        errors.New("rewrite failed"),
+			ExpectedErr:        errMigrationFailed,
+			ExpectedStatements: []string{"ALTER TABLE t ADD a", "ALTER TABLE t ADD b"},
+			ExpectedApplied:    map[int]bool{1: true},
+
+			ExpectedDataStepRuns: 1,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			executor := &fakeSchemaExecutor{applied: tc.Applied, failOn: tc.FailOn}
+			var dataStepRuns int
+			m := &migrator{
+				executor:   executor,
+				table:      "t",
+				migrations: migrations,
+				dataSteps: map[int]dataStep{
+					2: func(context.Context) error {
+						dataStepRuns++
+						return tc.DataStepErr
+					},
+				},
+				logger: zap.NewNop(),
+			}
+
+			err := m.migrate(context.Background())
+			if tc.ExpectedErr != nil {
+				assert.True(errors.Is(err, tc.ExpectedErr), "expected '%v' to match '%v'", err, tc.ExpectedErr)
+			} else {
+				assert.NoError(err)
+			}
+
+			var statements []string
+			for _, stmt := range executor.statements {
+				if !strings.Contains(stmt, SchemaVersionTable) {
+					statements = append(statements, stmt)
+				}
+			}
+			assert.Equal(tc.ExpectedStatements, statements)
+			assert.Equal(tc.ExpectedApplied, executor.applied)
+			assert.Equal(tc.ExpectedDataStepRuns, dataStepRuns)
+		})
+	}
+}
+
+func TestValidateTable(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError(validateTable("gifnoc"))
+	assert.NoError(validateTable("tenant_2"))
+	assert.Error(validateTable(""))
+	assert.Error(validateTable("2tenant"))
+	assert.Error(validateTable("gifnoc; DROP TABLE gifnoc"))
+	assert.Error(validateTable("argus.gifnoc"))
+}
+
+func TestMigratePreSeriesSchema(t *testing.T) {
+	tcs := []struct {
+		Description string
+		Applied     map[int]bool
+	}{
+		{
+			Description: "Table created before migrations",
+			Applied:     map[int]bool{},
+		},
+		{
+			Description: "Table created by the first migration",
+			Applied:     map[int]bool{1: true},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			migrations, err := loadMigrations(migrationFiles, defaultTable)
+			require.NoError(err)
+			require.Equal([]string{"CREATE TABLE IF NOT EXISTS " + defaultTable + " (\n    bucket VARCHAR,\n    id VARCHAR,\n    data blob,\n    PRIMARY KEY (bucket, id))\n    WITH default_time_to_live = 300"},
+				migrations[0].statements, "the first migration must be left as shipped")
+
+			executor := &fakeSchemaExecutor{applied: tc.Applied}
+			m := &migrator{
+				executor:   executor,
+				table:      defaultTable,
+				migrations: migrations,
+				dataSteps: map[int]dataStep{
+					ownerColumnsVersion: func(context.Context) error { return nil },
+				},
+				logger: zap.NewNop(),
+			}
+			require.NoError(m.migrate(context.Background()))
+
+			transactions, index := -1, -1
+			for i, stmt := range executor.statements {
+				switch {
+				case strings.Contains(stmt, "WITH transactions"):
+					transactions = i
+				case strings.HasPrefix(stmt, "CREATE INDEX"):
+					index = i
+				}
+			}
+			require.NotEqual(-1, transactions, "transactions must be enabled")
+			require.NotEqual(-1, index)
+			assert.Less(transactions, index, "transactions must be enabled before the index is created")
+			for _, mig := range migrations {
+				assert.True(executor.applied[mig.version])
+			}
+		})
+	}
+}
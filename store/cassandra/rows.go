@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package cassandra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"go.uber.org/zap"
+)
+
+// ownerColumnsVersion is the migration splitting owner and expires out of data.
+const ownerColumnsVersion = 3
+
+// rowColumns are the columns read into a row, in the order of row.dest.
+const rowColumns = ownerRowColumns + ", last_modified, created_at, version, modified_by"
+
+// ownerRowColumns are the columns of the layout of ownerColumnsVersion, which
+// rows are migrated to before last_modified exists. They're read with
+// row.ownerDest.
+const ownerRowColumns = "owner, expires, data, ttl(data)"
+
+// row is a stored item. Rows written before the owner and expires columns
+// existed have a null owner and hold the whole JSON encoded OwnableItem in data.
+// Newer rows only hold the item data there.
+type row struct {
+	id           string
+	owner        *string
+	expires      *time.Time
+	data         []byte
+	ttl          int64
+	lastModified *time.Time
+	createdAt    *time.Time
+	version      *int64
+	modifiedBy   *string
+}
+
+func (r *row) dest() []interface{} {
+	return append(r.ownerDest(), &r.lastModified, &r.createdAt, &r.version, &r.modifiedBy)
+}
+
+func (r *row) ownerDest() []interface{} {
+	return []interface{}{&r.owner, &r.expires, &r.data, &r.ttl}
+}
+
+func (r *row) legacy() bool {
+	return r.owner == nil
+}
+
+// item decodes the row. expired is true for rows past their expiry which
+// the database hasn't purged yet.
+func (r *row) item(now time.Time) (item store.OwnableItem, expired bool, err error) {
+	if r.legacy() {
+		if err = json.Unmarshal(r.data, &item); err != nil {
+			return store.OwnableItem{}, false, err
+		}
+		ttl := r.ttl
+		item.TTL = &ttl
+		return item, false, nil
+	}
+
+	item = store.OwnableItem{
+		Item:  model.Item{ID: r.id},
+		Owner: *r.owner,
+	}
+	if r.lastModified != nil {
+		item.LastModified = *r.lastModified
+	}
+	if r.createdAt != nil {
+		item.CreatedAt = *r.createdAt
+	}
+	if r.version != nil {
+		item.Version = *r.version
+	}
+	if r.modifiedBy != nil {
+		item.ModifiedBy = *r.modifiedBy
+	}
+	if err = json.Unmarshal(r.data, &item.Data); err != nil {
+		return store.OwnableItem{}, false, err
+	}
+	if r.expires != nil {
+		remainingTTLSeconds := int64(r.expires.Sub(now).Seconds())
+		if remainingTTLSeconds < 1 {
+			return store.OwnableItem{}, true, nil
+		}
+		item.TTL = &remainingTTLSeconds
+	}
+	return item, false, nil
+}
+
+// encodeItem returns the data and expires columns of an item.
+func encodeItem(item store.OwnableItem, now time.Time) ([]byte, *time.Time, error) {
+	data, err := json.Marshal(item.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var expires *time.Time
+	if item.TTL != nil && *item.TTL > 0 {
+		t := now.Add(time.Duration(*item.TTL) * time.Second)
+		expires = &t
+	}
+	return data, expires, nil
+}
+
+// createdAt returns the created_at column of an item written at now.
+func createdAt(item store.OwnableItem, now time.Time) time.Time {
+	if item.CreatedAt.IsZero() {
+		return now
+	}
+	return item.CreatedAt
+}
+
+// migrateLegacyRows rewrites the rows of the table still using the legacy
+// layout, keeping their remaining TTL. Rows which can't be decoded are left
+// untouched and logged.
+func migrateLegacyRows(ctx context.Context, session *gocql.Session, table string, logger *zap.Logger) error {
+	var (
+		update   = fmt.Sprintf("UPDATE %s USING TTL ? SET owner = ?, expires = ?, data = ? WHERE bucket = ? AND id = ?", table)
+		bucket   string
+		r        row
+		migrated int
+	)
+	iter := session.Query(fmt.Sprintf("SELECT bucket, id, %s FROM %s", ownerRowColumns, table)).WithContext(ctx).Iter()
+	dest := append([]interface{}{&bucket, &r.id}, r.ownerDest()...)
+	for iter.Scan(dest...) {
+		if r.legacy() {
+			item, data, expires, err := r.upgrade(time.Now())
+			if err != nil {
+				logger.Warn("skipping undecodable row", zap.String("bucket", bucket), zap.String("id", r.id), zap.Error(err))
+			} else {
+				err = session.Query(update, r.ttl, item.Owner, expires, data, bucket, r.id).WithContext(ctx).Exec()
+				if err != nil {
+					iter.Close()
+					return err
+				}
+				migrated++
+			}
+		}
+		r = row{}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	logger.Info("migrated legacy rows", zap.String("table", table), zap.Int("count", migrated))
+	return nil
+}
+
+// upgrade decodes a legacy row and returns the content of its columns in the current layout.
+func (r *row) upgrade(now time.Time) (store.OwnableItem, []byte, *time.Time, error) {
+	item, _, err := r.item(now)
+	if err != nil {
+		return store.OwnableItem{}, nil, nil, err
+	}
+	if r.ttl <= 0 {
+		item.TTL = nil
+	}
+	data, expires, err := encodeItem(item, now)
+	return item, data, expires, err
+}
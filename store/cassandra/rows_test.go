@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package cassandra
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+)
+
+func TestRowItem(t *testing.T) {
+	now := time.Now()
+	owner := "xmidt"
+	empty := ""
+	inAMinute := now.Add(time.Minute)
+	aSecondAgo := now.Add(-time.Second)
+	sixty := int64(60)
+	thirty := int64(30)
+
+	tcs := []struct {
+		Description     string
+		Row             row
+		ExpectedItem    store.OwnableItem
+		ExpectedExpired bool
+		ExpectedErr     bool
+	}{
+		{
+			Description: "Legacy",
+			Row: row{
+				id:   "a",
+				data: []byte(`{"id":"a","data":{"k":"v"},"owner":"xmidt"}`),
+				ttl:  30,
+			},
+			ExpectedItem: store.OwnableItem{
+				Item:  model.Item{ID: "a", Data: map[string]interface{}{"k": "v"}, TTL: &thirty},
+				Owner: owner,
+			},
+		},
+		{
+			Description: "Legacy bad data",
+			Row:         row{id: "a", data: []byte(`{`)},
+			ExpectedErr: true,
+		},
+		{
+			Description: "Current",
+			Row: row{
+				id:      "a",
+				owner:   &owner,
+				expires: &inAMinute,
+				data:    []byte(`{"k":"v"}`),
+			},
+			ExpectedItem: store.OwnableItem{
+				Item:  model.Item{ID: "a", Data: map[string]interface{}{"k": "v"}, TTL: &sixty},
+				Owner: owner,
+			},
+		},
+		{
+			Description: "Current with last modification time",
+			Row:         row{id: "a", owner: &owner, data: []byte(`{"k":"v"}`), lastModified: &aSecondAgo},
+			ExpectedItem: store.OwnableItem{
+				Item:         model.Item{ID: "a", Data: map[string]interface{}{"k": "v"}},
+				Owner:        owner,
+				LastModified: aSecondAgo,
+			},
+		},
+		{
+			Description: "Current without owner nor expiry",
+			Row:         row{id: "a", owner: &empty, data: []byte(`{"k":"v"}`)},
+			ExpectedItem: store.OwnableItem{
+				Item: model.Item{ID: "a", Data: map[string]interface{}{"k": "v"}},
+			},
+		},
+		{
+			Description:     "Current expired",
+			Row:             row{id: "a", owner: &owner, expires: &aSecondAgo, data: []byte(`{}`)},
+			ExpectedExpired: true,
+		},
+		{
+			Description: "Current bad data",
+			Row:         row{id: "a", owner: &owner, data: []byte(`[]`)},
+			ExpectedErr: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			item, expired, err := tc.Row.item(now)
+			if tc.ExpectedErr {
+				assert.Error(err)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal(tc.ExpectedExpired, expired)
+			assert.Equal(tc.ExpectedItem, item)
+		})
+	}
+}
+
+func TestEncodeItem(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	ttl := int64(120)
+
+	data, expires, err := encodeItem(store.OwnableItem{
+		Item:  model.Item{ID: "a", Data: map[string]interface{}{"k": "v"}, TTL: &ttl},
+		Owner: "xmidt",
+	}, now)
+	assert.NoError(err)
+	assert.JSONEq(`{"k":"v"}`, string(data))
+	if assert.NotNil(expires) {
+		assert.Equal(now.Add(2*time.Minute), *expires)
+	}
+
+	_, expires, err = encodeItem(store.OwnableItem{Item: model.Item{ID: "a"}}, now)
+	assert.NoError(err)
+	assert.Nil(expires)
+}
+
+func TestRowUpgrade(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	now := time.Now()
+
+	r := row{id: "a", data: []byte(`{"id":"a","data":{"k":"v"},"owner":"xmidt"}`), ttl: 30}
+	item, data, expires, err := r.upgrade(now)
+	require.NoError(err)
+	assert.Equal("xmidt", item.Owner)
+	assert.JSONEq(`{"k":"v"}`, string(data))
+	require.NotNil(expires)
+	assert.Equal(now.Add(30*time.Second), *expires)
+
+	upgraded := row{id: "a", owner: &item.Owner, expires: expires, data: data}
+	current, expired, err := upgraded.item(now)
+	require.NoError(err)
+	assert.False(expired)
+	assert.Equal(item.Data, current.Data)
+	assert.Equal(int64(30), *current.TTL)
+
+	r = row{id: "a", data: []byte(`{"id":"a","data":{},"owner":""}`)}
+	_, _, expires, err = r.upgrade(now)
+	require.NoError(err)
+	assert.Nil(expires)
+}
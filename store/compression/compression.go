@@ -0,0 +1,336 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package compression provides a store.S decorator which compresses the data
+// of large items before they reach the backend.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/httpaux/erraux"
+)
+
+// Compression is the path to the configuration structure of this package
+// under the store configuration block.
+const Compression = "compression"
+
+// Gzip is the name of the gzip algorithm, the only one supported so far.
+const Gzip = "gzip"
+
+const (
+	defaultThreshold    = 4 * 1024
+	defaultMaxDataBytes = 1024 * 1024
+
+	// markerKey is the only field of the data of compressed items.
+	markerKey = store.CompressedDataKey
+)
+
+var (
+	// ErrUnsupportedAlgorithm is returned by New for unknown algorithms.
+	ErrUnsupportedAlgorithm = errors.New("unsupported compression algorithm")
+
+	// ErrDecompress is returned when the data of an item can't be decompressed.
+	ErrDecompress = errors.New("failed to decompress item data")
+
+	// ErrTooLarge is returned by writes whose data is over MaxDataBytes, or
+	// still over the size limit of the backend once compressed.
+	ErrTooLarge = errors.New("item data is too large")
+)
+
+var errHTTPTooLarge = &erraux.Error{Err: errors.New("item data is too large"), Code: http.StatusRequestEntityTooLarge}
+
+// Config configures the compression of item data.
+type Config struct {
+	// Threshold is the size of item data, JSON encoded, over which it's
+	// compressed. Smaller data is stored as is.
+	// (Optional) defaults to 4096.
+	Threshold int
+
+	// Algorithm is the compression algorithm of new items. Items are read
+	// whatever the algorithm they were compressed with.
+	// (Optional) defaults to gzip, the only one supported so far.
+	Algorithm string
+
+	// MaxDataBytes is the size of the largest item data, JSON encoded, which
+	// is compressed. Data is never decompressed past it so corrupted items
+	// can't exhaust memory.
+	// (Optional) defaults to 1MB.
+	MaxDataBytes int64
+}
+
+type codec struct {
+	compress func([]byte) ([]byte, error)
+
+	// decompress fails once the decompressed data is over limit bytes.
+	decompress func(data []byte, limit int64) ([]byte, error)
+}
+
+var codecs = map[string]codec{
+	Gzip: {compress: gzipCompress, decompress: gzipDecompress},
+}
+
+// Store compresses the data of items over the threshold, replacing it with a
+// marker field holding the algorithm and the base64 encoded compressed data.
+// Items without the marker, such as the ones stored before compression was
+// enabled, are read as is.
+type Store struct {
+	store.S
+	threshold    int
+	algorithm    string
+	maxDataBytes int64
+	itemCodec    store.Codec
+}
+
+// New decorates s so the data of large items is compressed.
+func New(s store.S, config Config) (*Store, error) {
+	if config.Threshold <= 0 {
+		config.Threshold = defaultThreshold
+	}
+	if config.Algorithm == "" {
+		config.Algorithm = Gzip
+	}
+	if config.MaxDataBytes <= 0 {
+		config.MaxDataBytes = defaultMaxDataBytes
+	}
+	if _, ok := codecs[config.Algorithm]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, config.Algorithm)
+	}
+	c := &Store{
+		S:            s,
+		threshold:    config.Threshold,
+		algorithm:    config.Algorithm,
+		maxDataBytes: config.MaxDataBytes,
+	}
+	c.itemCodec = store.Codec{Encode: c.compress, Decode: c.decompress}
+	return c, nil
+}
+
+func (s *Store) Push(key model.Key, item store.OwnableItem) error {
+	item, err := s.compress(key, item)
+	if err != nil {
+		return err
+	}
+	return s.S.Push(key, item)
+}
+
+func (s *Store) PushIfAbsent(key model.Key, item store.OwnableItem) error {
+	item, err := s.compress(key, item)
+	if err != nil {
+		return err
+	}
+	return store.PushIfAbsent(s.S, key, item)
+}
+
+// CompareAndSwap compares old with the decompressed stored item, then swaps the
+// stored item as read so concurrent changes are still detected by the backend.
+func (s *Store) CompareAndSwap(key model.Key, old, item store.OwnableItem) error {
+	return s.itemCodec.CompareAndSwap(s.S, key, old, item)
+}
+
+// Increment can't be applied by the backend on compressed data, so it is
+// applied here and the updated item swapped in, retrying on concurrent changes.
+func (s *Store) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	return s.itemCodec.Increment(s.S, key, path, delta, modifiedBy)
+}
+
+// Transact compresses the items of the operations and, like CompareAndSwap,
+// conditions the operations on the stored items matching the expected ones.
+func (s *Store) Transact(ops []store.TransactionOp) error {
+	return s.itemCodec.Transact(s.S, ops, nil)
+}
+
+func (s *Store) Get(key model.Key) (store.OwnableItem, error) {
+	item, err := s.S.Get(key)
+	if err != nil {
+		return item, err
+	}
+	return s.decompress(key, item)
+}
+
+func (s *Store) Delete(key model.Key) (store.OwnableItem, error) {
+	item, err := s.S.Delete(key)
+	if err != nil {
+		return item, err
+	}
+	return s.decompress(key, item)
+}
+
+func (s *Store) GetAll(bucket string) (map[string]store.OwnableItem, error) {
+	items, err := s.S.GetAll(bucket)
+	if err != nil {
+		return items, err
+	}
+	return s.decompressAll(bucket, items)
+}
+
+func (s *Store) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, error) {
+	items, err := store.GetAllByOwner(s.S, bucket, owner)
+	if err != nil {
+		return items, err
+	}
+	return s.decompressAll(bucket, items)
+}
+
+// BucketDigest returns the digest kept by the wrapped store, which is computed
+// over the items as stored, compressed.
+func (s *Store) BucketDigest(bucket string) (store.Digest, error) {
+	return store.BucketDigest(s.S, bucket, "", true)
+}
+
+// OwnerDigest returns the digest kept by the wrapped store, which is computed
+// over the items as stored, compressed.
+func (s *Store) OwnerDigest(bucket, owner string) (store.Digest, error) {
+	return store.BucketDigest(s.S, bucket, owner, false)
+}
+
+// MaxItemDataBytes reports no limit as how much data fits the backend depends
+// on how well it compresses. Writes still over the limit of the backend once
+// compressed are rejected before reaching it.
+func (s *Store) MaxItemDataBytes() int64 {
+	return 0
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	if p, ok := s.S.(store.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (s *Store) decompressAll(bucket string, items map[string]store.OwnableItem) (map[string]store.OwnableItem, error) {
+	for id, item := range items {
+		decompressed, err := s.decompress(model.Key{Bucket: bucket, ID: id}, item)
+		if err != nil {
+			return nil, err
+		}
+		items[id] = decompressed
+	}
+	return items, nil
+}
+
+// compress returns a copy of the item whose data is compressed when it's over
+// the threshold.
+func (s *Store) compress(key model.Key, item store.OwnableItem) (store.OwnableItem, error) {
+	encoded, err := json.Marshal(item.Data)
+	if err != nil {
+		return item, store.SanitizeError(fmt.Errorf("%w: %v", store.ErrJSONEncode, err))
+	}
+	if int64(len(encoded)) > s.maxDataBytes {
+		return item, store.SanitizedError{
+			Err:     fmt.Errorf("%w: %s/%s is %d bytes, over the limit of %d", ErrTooLarge, key.Bucket, key.ID, len(encoded), s.maxDataBytes),
+			ErrHTTP: errHTTPTooLarge,
+		}
+	}
+	if len(encoded) > s.threshold {
+		compressed, err := codecs[s.algorithm].compress(encoded)
+		if err != nil {
+			return item, store.SanitizeError(store.ItemOperationError{Err: fmt.Errorf("failed to compress item data: %w", err), Key: key, Operation: "compress"})
+		}
+		item.Data = map[string]interface{}{
+			markerKey: map[string]interface{}{
+				"algorithm": s.algorithm,
+				"data":      base64.StdEncoding.EncodeToString(compressed),
+			},
+		}
+		if encoded, err = json.Marshal(item.Data); err != nil {
+			return item, store.SanitizeError(fmt.Errorf("%w: %v", store.ErrJSONEncode, err))
+		}
+	}
+	if limit := store.MaxItemDataBytes(s.S); limit > 0 && int64(len(encoded)) > limit {
+		return item, store.SanitizedError{
+			Err:     fmt.Errorf("%w: %s/%s is %d bytes, over the limit of %d", ErrTooLarge, key.Bucket, key.ID, len(encoded), limit),
+			ErrHTTP: errHTTPTooLarge,
+		}
+	}
+	return item, nil
+}
+
+// decompress returns the item with its data decompressed. Items without the
+// marker are returned as is.
+func (s *Store) decompress(key model.Key, item store.OwnableItem) (store.OwnableItem, error) {
+	m, ok := decodeMarker(item.Data)
+	if !ok {
+		return item, nil
+	}
+	c, ok := codecs[m.algorithm]
+	if !ok {
+		return item, decompressError(key, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, m.algorithm))
+	}
+	compressed, err := base64.StdEncoding.DecodeString(m.data)
+	if err != nil {
+		return item, decompressError(key, err)
+	}
+	encoded, err := c.decompress(compressed, s.maxDataBytes)
+	if err != nil {
+		return item, decompressError(key, err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return item, decompressError(key, err)
+	}
+	item.Data = data
+	return item, nil
+}
+
+type marker struct {
+	algorithm string
+	data      string
+}
+
+// decodeMarker returns the marker held by the data of a compressed item.
+func decodeMarker(data map[string]interface{}) (marker, bool) {
+	if len(data) != 1 {
+		return marker{}, false
+	}
+	fields, ok := data[markerKey].(map[string]interface{})
+	if !ok {
+		return marker{}, false
+	}
+	var m marker
+	m.algorithm, _ = fields["algorithm"].(string)
+	m.data, _ = fields["data"].(string)
+	return m, m.algorithm != "" && m.data != ""
+}
+
+func gzipCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gzipDecompress(data []byte, limit int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	decompressed, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decompressed)) > limit {
+		return nil, fmt.Errorf("decompressed data is over the limit of %d bytes", limit)
+	}
+	return decompressed, nil
+}
+
+func decompressError(key model.Key, err error) error {
+	return store.SanitizeError(store.ItemOperationError{Err: fmt.Errorf("%w: %v", ErrDecompress, err), Key: key, Operation: "decompress"})
+}
@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package compression
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/argus/store/inmem"
+)
+
+var (
+	largeKey = model.Key{Bucket: "configs", ID: "large"}
+	smallKey = model.Key{Bucket: "configs", ID: "small"}
+)
+
+func newTestItem(id string, data map[string]interface{}) store.OwnableItem {
+	return store.OwnableItem{Owner: "owner", Item: model.Item{ID: id, Data: data}}
+}
+
+func largeData() map[string]interface{} {
+	return map[string]interface{}{"document": strings.Repeat("compressible ", 100), "count": float64(1)}
+}
+
+func newTestStore(t *testing.T) (*Store, store.S) {
+	backend := inmem.NewSharded(inmem.Config{}, nil)
+	s, err := New(backend, Config{Threshold: 100})
+	require.NoError(t, err)
+	return s, backend
+}
+
+type sizeLimitedStore struct {
+	store.S
+	limit int64
+}
+
+func (s sizeLimitedStore) MaxItemDataBytes() int64 {
+	return s.limit
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(inmem.NewSharded(inmem.Config{}, nil), Config{Algorithm: "zip"})
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+}
+
+func TestCompressedItems(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, backend := newTestStore(t)
+	large := newTestItem("large", largeData())
+	small := newTestItem("small", map[string]interface{}{"k": "v"})
+
+	require.NoError(s.Push(largeKey, large))
+	require.NoError(s.Push(smallKey, small))
+
+	raw, err := backend.Get(largeKey)
+	require.NoError(err)
+	m, ok := decodeMarker(raw.Data)
+	require.True(ok)
+	assert.Equal(Gzip, m.algorithm)
+	assert.Less(len(m.data), 200)
+	raw, err = backend.Get(smallKey)
+	require.NoError(err)
+	assert.Equal(small.Data, raw.Data, "small items are stored as is")
+
+	got, err := s.Get(largeKey)
+	require.NoError(err)
+	assert.Equal(large.Data, got.Data)
+	items, err := s.GetAll("configs")
+	require.NoError(err)
+	assert.Equal(large.Data, items["large"].Data)
+	assert.Equal(small.Data, items["small"].Data)
+	items, err = s.GetAllByOwner("configs", "owner")
+	require.NoError(err)
+	assert.Equal(large.Data, items["large"].Data)
+	deleted, err := s.Delete(largeKey)
+	require.NoError(err)
+	assert.Equal(large.Data, deleted.Data)
+}
+
+func TestUncompressedItems(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, backend := newTestStore(t)
+	large := newTestItem("large", largeData())
+
+	require.NoError(backend.Push(largeKey, large))
+	got, err := s.Get(largeKey)
+	require.NoError(err)
+	assert.Equal(large.Data, got.Data, "items stored before compression are read as is")
+
+	value, err := s.Increment(largeKey, []string{"count"}, 1, "writer")
+	require.NoError(err)
+	assert.Equal(float64(2), value)
+	raw, err := backend.Get(largeKey)
+	require.NoError(err)
+	_, ok := decodeMarker(raw.Data)
+	assert.True(ok, "updated items are compressed")
+	assert.Equal(got.Version+1, raw.Version)
+	assert.Equal("writer", raw.ModifiedBy)
+}
+
+func TestConditionalWrites(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, _ := newTestStore(t)
+	large := newTestItem("large", largeData())
+
+	require.NoError(s.PushIfAbsent(largeKey, large))
+	assert.ErrorIs(s.PushIfAbsent(largeKey, large), store.ErrItemExists)
+
+	swapped := newTestItem("large", map[string]interface{}{"document": strings.Repeat("swapped ", 100)})
+	assert.ErrorIs(s.CompareAndSwap(largeKey, swapped, large), store.ErrItemChanged)
+	require.NoError(s.CompareAndSwap(largeKey, large, swapped))
+
+	value, err := s.Increment(largeKey, []string{"count"}, 1, "")
+	require.NoError(err)
+	assert.Equal(float64(1), value)
+
+	got, err := s.Get(largeKey)
+	require.NoError(err)
+	assert.Equal(float64(1), got.Data["count"])
+
+	err = s.Transact([]store.TransactionOp{
+		{Key: largeKey, Item: large, Condition: store.IfUnchanged, Expected: swapped},
+		{Key: smallKey, Item: newTestItem("small", map[string]interface{}{"k": "v"}), Condition: store.IfAbsent},
+	})
+	var conditionErr store.TransactionConditionError
+	require.True(errors.As(err, &conditionErr), "the swapped item was incremented since")
+	assert.Equal(0, conditionErr.Index)
+
+	require.NoError(s.Transact([]store.TransactionOp{
+		{Key: largeKey, Item: large, Condition: store.IfUnchanged, Expected: got},
+		{Key: smallKey, Item: newTestItem("small", map[string]interface{}{"k": "v"}), Condition: store.IfAbsent},
+	}))
+	got, err = s.Get(largeKey)
+	require.NoError(err)
+	assert.Equal(large.Data, got.Data)
+}
+
+func TestTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	backend := sizeLimitedStore{S: inmem.NewSharded(inmem.Config{}, nil), limit: 200}
+	s, err := New(backend, Config{Threshold: 50})
+	require.NoError(t, err)
+	assert.Zero(s.MaxItemDataBytes())
+
+	assert.NoError(s.Push(largeKey, newTestItem("large", largeData())), "compressed data fits")
+	random := make([]byte, 200)
+	rand.New(rand.NewSource(1)).Read(random)
+	incompressible := map[string]interface{}{"document": hex.EncodeToString(random)}
+	err = s.Push(smallKey, newTestItem("small", incompressible))
+	assert.ErrorIs(err, ErrTooLarge)
+	var statusCoder interface{ StatusCode() int }
+	require.True(t, errors.As(err, &statusCoder))
+	assert.Equal(http.StatusRequestEntityTooLarge, statusCoder.StatusCode())
+}
+
+func TestMaxDataBytes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	backend := inmem.NewSharded(inmem.Config{}, nil)
+	s, err := New(backend, Config{Threshold: 100, MaxDataBytes: 2048})
+	require.NoError(err)
+
+	huge := map[string]interface{}{"document": strings.Repeat("compressible ", 1000)}
+	assert.ErrorIs(s.Push(largeKey, newTestItem("large", huge)), ErrTooLarge)
+
+	// Corrupted data inflating past the limit isn't decompressed.
+	bomb, err := gzipCompress([]byte(`{"document":"` + strings.Repeat("0", 1024*1024) + `"}`))
+	require.NoError(err)
+	require.NoError(backend.Push(largeKey, newTestItem("large", map[string]interface{}{
+		markerKey: map[string]interface{}{
+			"algorithm": Gzip,
+			"data":      base64.StdEncoding.EncodeToString(bomb),
+		},
+	})))
+	_, err = s.Get(largeKey)
+	assert.ErrorIs(err, ErrDecompress)
+}
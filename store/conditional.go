@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+)
+
+// Conditional request and validator headers.
+const (
+	ETagHeaderKey            = "ETag"
+	LastModifiedHeaderKey    = "Last-Modified"
+	IfModifiedSinceHeaderKey = "If-Modified-Since"
+)
+
+type conditionsKey struct{}
+
+// conditions are the conditional headers of a read request.
+type conditions struct {
+	ifNoneMatch     string
+	ifModifiedSince string
+}
+
+// captureConditions is a kithttp.ServerBefore function saving the conditional
+// headers of read requests, for their endpoints and response encoders.
+func captureConditions(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, conditionsKey{}, conditions{
+		ifNoneMatch:     r.Header.Get(IfNoneMatchHeaderKey),
+		ifModifiedSince: r.Header.Get(IfModifiedSinceHeaderKey),
+	})
+}
+
+// validators identify the version of a response.
+type validators struct {
+	etag         string
+	lastModified time.Time
+
+	// modifiedSince is true when lastModified accounts for all the changes
+	// of the response, so If-Modified-Since can be evaluated against it.
+	modifiedSince bool
+}
+
+// newValidators returns the validators of a response built from the items
+// of digest. The ETag is weak as remaining TTLs change between responses. It
+// also depends on the negotiated media type and on what's redacted for the
+// caller.
+func newValidators(ctx context.Context, digest Digest, modifiedSince bool) validators {
+	h := sha256.New()
+	accept, _ := ctx.Value(kithttp.ContextKeyRequestAccept).(string)
+	fmt.Fprintf(h, "%s\n", negotiateContentType(accept))
+	if scope, ok := ctx.Value(redactionScopeKey{}).(*redactionScope); ok {
+		fmt.Fprintf(h, "%q %t %v\n", scope.owner, scope.privileged, scope.redactor.paths[scope.bucket])
+	}
+	h.Write(digest.Sum[:])
+	return validators{
+		etag:          `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`,
+		lastModified:  digest.LastModified,
+		modifiedSince: modifiedSince && !digest.LastModified.IsZero(),
+	}
+}
+
+// notModified evaluates the conditional headers of the request against v.
+// As with RFC 7232, If-Modified-Since is ignored when If-None-Match is set.
+func (v validators) notModified(ctx context.Context) bool {
+	c, _ := ctx.Value(conditionsKey{}).(conditions)
+	if c.ifNoneMatch != "" {
+		return etagMatches(c.ifNoneMatch, v.etag)
+	}
+	if c.ifModifiedSince == "" || !v.modifiedSince {
+		return false
+	}
+	since, err := http.ParseTime(c.ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	return !v.lastModified.Truncate(time.Second).After(since)
+}
+
+// write sets the validator and Vary headers of the response then, when the
+// request conditions hold, sends a 304 response and returns true.
+func (v validators) write(ctx context.Context, rw http.ResponseWriter) bool {
+	setVary(rw)
+	rw.Header().Set(ETagHeaderKey, v.etag)
+	if !v.lastModified.IsZero() {
+		rw.Header().Set(LastModifiedHeaderKey, v.lastModified.UTC().Format(http.TimeFormat))
+	}
+	if !v.notModified(ctx) {
+		return false
+	}
+	rw.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches weakly compares etag to the ones listed in an If-None-Match
+// header value.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+)
+
+func TestNotModified(t *testing.T) {
+	lastModified := time.Date(2021, time.March, 4, 10, 30, 15, 500, time.UTC)
+	v := validators{etag: `W/"abc"`, lastModified: lastModified, modifiedSince: true}
+	untracked := v
+	untracked.modifiedSince = false
+
+	tcs := []struct {
+		Description string
+		Validators  validators
+		Conditions  conditions
+		Expected    bool
+	}{
+		{Description: "No conditions", Validators: v},
+		{Description: "Matching ETag", Validators: v, Conditions: conditions{ifNoneMatch: `W/"abc"`}, Expected: true},
+		{Description: "Strong ETag compared weakly", Validators: v, Conditions: conditions{ifNoneMatch: `"abc"`}, Expected: true},
+		{Description: "ETag in list", Validators: v, Conditions: conditions{ifNoneMatch: `W/"xyz", W/"abc"`}, Expected: true},
+		{Description: "Any ETag", Validators: v, Conditions: conditions{ifNoneMatch: "*"}, Expected: true},
+		{Description: "Other ETag", Validators: v, Conditions: conditions{ifNoneMatch: `W/"xyz"`}},
+		{
+			Description: "ETag takes precedence",
+			Validators:  v,
+			Conditions:  conditions{ifNoneMatch: `W/"xyz"`, ifModifiedSince: lastModified.Add(time.Hour).Format(http.TimeFormat)},
+		},
+		{
+			Description: "Not modified since",
+			Validators:  v,
+			Conditions:  conditions{ifModifiedSince: lastModified.Format(http.TimeFormat)},
+			Expected:    true,
+		},
+		{
+			Description: "Modified since",
+			Validators:  v,
+			Conditions:  conditions{ifModifiedSince: lastModified.Add(-time.Second).Format(http.TimeFormat)},
+		},
+		{
+			Description: "Invalid date",
+			Validators:  v,
+			Conditions:  conditions{ifModifiedSince: "yesterday"},
+		},
+		{
+			Description: "Modification time not tracked",
+			Validators:  untracked,
+			Conditions:  conditions{ifModifiedSince: lastModified.Add(time.Hour).Format(http.TimeFormat)},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), conditionsKey{}, tc.Conditions)
+			assert.Equal(t, tc.Expected, tc.Validators.notModified(ctx))
+		})
+	}
+}
+
+func TestNewValidators(t *testing.T) {
+	assert := assert.New(t)
+	digest := Digest{Sum: [32]byte{1}}
+	jsonCtx := context.Background()
+	cborCtx := context.WithValue(jsonCtx, kithttp.ContextKeyRequestAccept, CBORContentType)
+
+	v := newValidators(jsonCtx, digest, true)
+	assert.Regexp(`^W/"[0-9a-f]{32}"$`, v.etag)
+	assert.False(v.modifiedSince, "If-Modified-Since can't be evaluated without a modification time")
+	assert.Equal(v.etag, newValidators(jsonCtx, digest, false).etag)
+	assert.NotEqual(v.etag, newValidators(cborCtx, digest, true).etag, "encodings should have their own ETag")
+	assert.NotEqual(v.etag, newValidators(jsonCtx, Digest{Sum: [32]byte{2}}, true).etag)
+}
+
+func TestEncodeGetItemResponseConditional(t *testing.T) {
+	lastModified := time.Date(2021, time.March, 4, 10, 30, 15, 0, time.UTC)
+	item := &OwnableItem{
+		Item:         model.Item{ID: "id", Data: map[string]interface{}{"k": "v"}, TTL: int64Ptr(60)},
+		Owner:        "owner",
+		LastModified: lastModified,
+	}
+
+	recorder := httptest.NewRecorder()
+	require.NoError(t, encodeGetItemResponse(context.Background(), recorder, item))
+	etag := recorder.Header().Get(ETagHeaderKey)
+	require.NotEmpty(t, etag)
+
+	tcs := []struct {
+		Description  string
+		Request      func(*http.Request)
+		Item         *OwnableItem
+		ExpectedCode int
+	}{
+		{
+			Description:  "Unconditional",
+			Request:      func(*http.Request) {},
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Description: "Matching ETag",
+			Request: func(r *http.Request) {
+				r.Header.Set(IfNoneMatchHeaderKey, etag)
+			},
+			ExpectedCode: http.StatusNotModified,
+		},
+		{
+			Description: "Remaining TTL changed",
+			Request: func(r *http.Request) {
+				r.Header.Set(IfNoneMatchHeaderKey, etag)
+			},
+			Item: &OwnableItem{
+				Item:         model.Item{ID: "id", Data: map[string]interface{}{"k": "v"}, TTL: int64Ptr(30)},
+				Owner:        "owner",
+				LastModified: lastModified,
+			},
+			ExpectedCode: http.StatusNotModified,
+		},
+		{
+			Description: "Data changed",
+			Request: func(r *http.Request) {
+				r.Header.Set(IfNoneMatchHeaderKey, etag)
+			},
+			Item: &OwnableItem{
+				Item:         model.Item{ID: "id", Data: map[string]interface{}{"k": "w"}},
+				Owner:        "owner",
+				LastModified: lastModified.Add(time.Minute),
+			},
+			ExpectedCode: http.StatusOK,
+		},
+		{
+			Description: "Not modified since",
+			Request: func(r *http.Request) {
+				r.Header.Set(IfModifiedSinceHeaderKey, lastModified.Format(http.TimeFormat))
+			},
+			ExpectedCode: http.StatusNotModified,
+		},
+		{
+			Description: "Modified since",
+			Request: func(r *http.Request) {
+				r.Header.Set(IfModifiedSinceHeaderKey, lastModified.Add(-time.Minute).Format(http.TimeFormat))
+			},
+			ExpectedCode: http.StatusOK,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			r := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+			tc.Request(r)
+			response := item
+			if tc.Item != nil {
+				response = tc.Item
+			}
+			ctx := captureConditions(context.Background(), r)
+			recorder := httptest.NewRecorder()
+			require.NoError(t, encodeGetItemResponse(ctx, recorder, response))
+
+			assert.Equal(tc.ExpectedCode, recorder.Code)
+			assert.Equal("Accept, Accept-Encoding", recorder.Header().Get("Vary"))
+			assert.NotEmpty(recorder.Header().Get(ETagHeaderKey))
+			assert.Equal(response.LastModified.Format(http.TimeFormat), recorder.Header().Get(LastModifiedHeaderKey))
+			if tc.ExpectedCode == http.StatusNotModified {
+				assert.Empty(recorder.Body.String())
+			} else {
+				assert.NotEmpty(recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestEncodeGetAllItemsResponseConditional(t *testing.T) {
+	lastModified := time.Date(2021, time.March, 4, 10, 30, 15, 0, time.UTC)
+	items := map[string]OwnableItem{
+		"a": {Owner: "owner", Item: model.Item{ID: "a", Data: map[string]interface{}{}}, LastModified: lastModified},
+	}
+	since := lastModified.Add(time.Minute).Format(http.TimeFormat)
+
+	tcs := []struct {
+		Description  string
+		Tracked      bool
+		ExpectedCode int
+	}{
+		{
+			Description:  "Tracked modification time",
+			Tracked:      true,
+			ExpectedCode: http.StatusNotModified,
+		},
+		{
+			Description:  "Deletions unaccounted for",
+			ExpectedCode: http.StatusOK,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			r := httptest.NewRequest(http.MethodGet, "http://localhost", nil)
+			r.Header.Set(IfModifiedSinceHeaderKey, since)
+			recorder := httptest.NewRecorder()
+			response := &getAllItemsResponse{items: items, digest: DigestItems(items), tracked: tc.Tracked}
+			require.NoError(t, encodeGetAllItemsResponse(captureConditions(context.Background(), r), recorder, response))
+
+			assert.Equal(tc.ExpectedCode, recorder.Code)
+			assert.Equal("Accept, Accept-Encoding", recorder.Header().Get("Vary"))
+			assert.Equal(lastModified.Format(http.TimeFormat), recorder.Header().Get(LastModifiedHeaderKey))
+		})
+	}
+}
@@ -15,6 +15,24 @@ const (
 	QueryDurationSecondsHistogram = "db_query_duration_seconds"
 	QueriesCounter                = "db_queries_total"
 
+	// Resilience layer metrics.
+	QueryRetriesCounter             = "db_query_retries_total"
+	QueryTimeoutsCounter            = "db_query_timeouts_total"
+	CircuitBreakerStateGauge        = "db_circuit_breaker_state"
+	CircuitBreakerRejectionsCounter = "db_circuit_breaker_rejections_total"
+
+	// Replication metrics.
+	ReplicationQueueSizeGauge         = "db_replication_queue_size"
+	ReplicationSecondaryWritesCounter = "db_replication_secondary_writes_total"
+	ReplicationReadFallbacksCounter   = "db_replication_read_fallbacks_total"
+	ReplicationDivergencesCounter     = "db_replication_divergences_total"
+
+	// Encryption metrics.
+	EncryptionRotationsCounter = "db_encryption_rotated_items_total"
+
+	// API metrics.
+	RedactedFieldsCounter = "redacted_fields_total"
+
 	// DynamoDB-specific metrics.
 	DynamodbConsumedCapacityCounter = "dynamodb_consumed_capacity_total"
 	DynamodbGetAllGauge             = "dynamodb_get_all_results"
@@ -25,6 +43,8 @@ const (
 	QueryOutcomeLabelKey     = "outcome"
 	QueryTypeLabelKey        = "type"
 	DynamoCapacityOpLabelKey = "op"
+	DivergenceReasonLabelKey = "reason"
+	BucketLabelKey           = "bucket"
 )
 
 // Metric label values for DAO operation types.
@@ -34,6 +54,21 @@ const (
 	DeleteQueryType = "delete"
 	PushQueryType   = "push"
 	PingQueryType   = "ping"
+
+	// GetAllByOwnerQueryType is a getall query filtered by owner on the backend side.
+	GetAllByOwnerQueryType = "getallbyowner"
+
+	// PushIfAbsentQueryType is a push only applied when the key isn't taken.
+	PushIfAbsentQueryType = "pushifabsent"
+
+	// CompareAndSwapQueryType is a push only applied while the item is unchanged.
+	CompareAndSwapQueryType = "compareandswap"
+
+	// IncrementQueryType is an atomic update of a numeric field of an item.
+	IncrementQueryType = "increment"
+
+	// TransactQueryType is an all-or-nothing group of writes to several items.
+	TransactQueryType = "transact"
 )
 
 // Metric label values for Query Outcomes.
@@ -42,6 +77,18 @@ const (
 	SuccessQueryOutcome = "success"
 )
 
+// Metric label values for the reasons the replicated backends diverged.
+const (
+	// DroppedWriteDivergence is a secondary write given up on after its retries
+	// or because the retry queue was full.
+	DroppedWriteDivergence = "write_dropped"
+
+	// The following are found when reconciling a bucket.
+	MissingInSecondaryDivergence = "missing_in_secondary"
+	MissingInPrimaryDivergence   = "missing_in_primary"
+	MismatchDivergence           = "mismatch"
+)
+
 // Metric label values for DynamoDB Consumed capacity type
 const (
 	DynamoCapacityReadOp  = "read"
@@ -69,6 +116,85 @@ func ProvideMetrics() fx.Option {
 			QueryTypeLabelKey,
 		),
 
+		touchstone.CounterVec(
+			prometheus.CounterOpts{
+				Name: QueryRetriesCounter,
+				Help: "The total number of DB queries retried after a transient failure.",
+			},
+			QueryTypeLabelKey,
+		),
+
+		touchstone.CounterVec(
+			prometheus.CounterOpts{
+				Name: QueryTimeoutsCounter,
+				Help: "The total number of DB queries abandoned for exceeding their timeout.",
+			},
+			QueryTypeLabelKey,
+		),
+
+		touchstone.Gauge(
+			prometheus.GaugeOpts{
+				Name: CircuitBreakerStateGauge,
+				Help: "State of the DB circuit breaker. 0 is closed, 1 is half-open and 2 is open.",
+			},
+		),
+
+		touchstone.CounterVec(
+			prometheus.CounterOpts{
+				Name: CircuitBreakerRejectionsCounter,
+				Help: "The total number of DB queries rejected while the circuit breaker was open.",
+			},
+			QueryTypeLabelKey,
+		),
+
+		touchstone.Gauge(
+			prometheus.GaugeOpts{
+				Name: ReplicationQueueSizeGauge,
+				Help: "The number of secondary writes waiting in the replication retry queue.",
+			},
+		),
+
+		touchstone.CounterVec(
+			prometheus.CounterOpts{
+				Name: ReplicationSecondaryWritesCounter,
+				Help: "The total number of write attempts against the secondary backend.",
+			},
+			QueryOutcomeLabelKey,
+			QueryTypeLabelKey,
+		),
+
+		touchstone.CounterVec(
+			prometheus.CounterOpts{
+				Name: ReplicationReadFallbacksCounter,
+				Help: "The total number of reads served by the secondary backend after the primary failed.",
+			},
+			QueryTypeLabelKey,
+		),
+
+		touchstone.CounterVec(
+			prometheus.CounterOpts{
+				Name: ReplicationDivergencesCounter,
+				Help: "The total number of items found or left different between the primary and secondary backends.",
+			},
+			DivergenceReasonLabelKey,
+		),
+
+		touchstone.CounterVec(
+			prometheus.CounterOpts{
+				Name: EncryptionRotationsCounter,
+				Help: "The total number of items whose data was rewrapped or encrypted with the current key.",
+			},
+			QueryOutcomeLabelKey,
+		),
+
+		touchstone.CounterVec(
+			prometheus.CounterOpts{
+				Name: RedactedFieldsCounter,
+				Help: "The total number of item data fields masked in API responses.",
+			},
+			BucketLabelKey,
+		),
+
 		touchstone.CounterVec(
 			prometheus.CounterOpts{
 				Name: DynamodbConsumedCapacityCounter,
@@ -91,6 +217,16 @@ type Measures struct {
 	fx.In
 	Queries                  *prometheus.CounterVec `name:"db_queries_total"`
 	QueryDurationSeconds     prometheus.ObserverVec `name:"db_query_duration_seconds"`
+	QueryRetries             *prometheus.CounterVec `name:"db_query_retries_total"`
+	QueryTimeouts            *prometheus.CounterVec `name:"db_query_timeouts_total"`
+	CircuitBreakerState      prometheus.Gauge       `name:"db_circuit_breaker_state"`
+	CircuitBreakerRejections *prometheus.CounterVec `name:"db_circuit_breaker_rejections_total"`
+	ReplicationQueueSize     prometheus.Gauge       `name:"db_replication_queue_size"`
+	ReplicationWrites        *prometheus.CounterVec `name:"db_replication_secondary_writes_total"`
+	ReplicationReadFallbacks *prometheus.CounterVec `name:"db_replication_read_fallbacks_total"`
+	ReplicationDivergences   *prometheus.CounterVec `name:"db_replication_divergences_total"`
+	EncryptionRotations      *prometheus.CounterVec `name:"db_encryption_rotated_items_total"`
+	RedactedFields           *prometheus.CounterVec `name:"redacted_fields_total"`
 	DynamodbConsumedCapacity *prometheus.CounterVec `name:"dynamodb_consumed_capacity_total"`
 	DynamodbGetAllGauge      prometheus.Gauge       `name:"dynamodb_get_all_results"`
 }
@@ -4,21 +4,64 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xmidt-org/argus/health"
 	"github.com/xmidt-org/argus/store"
 	"github.com/xmidt-org/argus/store/cassandra"
+	"github.com/xmidt-org/argus/store/compression"
 	"github.com/xmidt-org/argus/store/db/metric"
 	"github.com/xmidt-org/argus/store/dynamodb"
+	"github.com/xmidt-org/argus/store/encryption"
 	"github.com/xmidt-org/argus/store/inmem"
+	"github.com/xmidt-org/argus/store/quota"
+	"github.com/xmidt-org/argus/store/replication"
+	"github.com/xmidt-org/argus/store/resilience"
 	"github.com/xmidt-org/arrange"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
-const DynamoDB = "dynamo"
+// Names of the store backends, matching their configuration keys.
+const (
+	DynamoDB = "dynamo"
+	Yugabyte = "yugabyte"
+	InMem    = "inmem"
+)
+
+var errInvalidReplication = errors.New("invalid replication config")
 
 type Configs struct {
 	Dynamo   *dynamodb.Config
 	Yugabyte *cassandra.Config
+
+	// InMem configures the in-memory backend used when no database is configured.
+	InMem *inmem.Config
+
+	// Resilience wraps the chosen backend with timeouts, retries and a circuit breaker.
+	// (Optional) the backend is used as is when not set.
+	Resilience *resilience.Config
+
+	// Replication writes to two backends, reading from the primary one. Both must
+	// be configured above, save for inmem.
+	// (Optional) a single backend is used when not set.
+	Replication *replication.Config
+
+	// Compression compresses the data of large items before they are stored,
+	// and encrypted if need be.
+	// (Optional) items are stored as is when not set.
+	Compression *compression.Config
+
+	// Encryption encrypts the data of the items of some buckets before they are
+	// stored.
+	// (Optional) items are stored in plaintext when not set.
+	Encryption *encryption.Config
+
+	// Quota limits the number and size of the items of buckets and of their owners.
+	// (Optional) items are unlimited when not set.
+	Quota *quota.Config
 }
 
 type SetupIn struct {
@@ -27,6 +70,14 @@ type SetupIn struct {
 	Measures metric.Measures
 	LC       fx.Lifecycle
 	Logger   *zap.Logger
+
+	// UserInputValidation bounds the size of the item data the decorators
+	// process.
+	UserInputValidation store.UserInputValidationConfig `optional:"true"`
+
+	// KeyWrapper, such as a KMS client, wraps the data keys of encrypted items
+	// instead of the keyring file.
+	KeyWrapper encryption.KeyWrapper `optional:"true"`
 }
 
 func Provide() fx.Option {
@@ -34,20 +85,186 @@ func Provide() fx.Option {
 		fx.Provide(
 			arrange.UnmarshalKey("store", Configs{}),
 			SetupStore,
+			fx.Annotated{
+				Group:  health.ChecksGroup,
+				Target: newStoreCheck,
+			},
 		),
 	)
 }
 
-func SetupStore(in SetupIn) (store.S, error) {
-	if in.Configs.Dynamo != nil {
+type SetupOut struct {
+	fx.Out
+	Store store.S
+
+	// Reconciler is nil unless the store replicates its items.
+	Reconciler store.Reconciler
+
+	// UsageTracker is nil unless the store enforces quotas.
+	UsageTracker store.UsageTracker
+}
+
+func SetupStore(in SetupIn) (SetupOut, error) {
+	var out SetupOut
+	s, err := newStore(in, &out)
+	if err != nil {
+		return SetupOut{}, err
+	}
+	if s, err = decorate(in, s, &out); err != nil {
+		return SetupOut{}, err
+	}
+	out.Store = s
+	if in.Configs.Resilience != nil {
+		in.Logger.Info("using resilience policies for store operations")
+		out.Store = resilience.New(s, *in.Configs.Resilience, in.Measures)
+	}
+	return out, nil
+}
+
+// decorate wraps the backend with the configured encryption, compression and
+// quotas. Encryption is closest to the backend so item data is compressed
+// while still in plaintext, ciphertext not being compressible.
+func decorate(in SetupIn, s store.S, out *SetupOut) (store.S, error) {
+	var err error
+	if in.Configs.Encryption != nil {
+		if s, err = newEncryptedStore(in, s); err != nil {
+			return nil, err
+		}
+	}
+	if in.Configs.Compression != nil {
+		config := *in.Configs.Compression
+		if config.MaxDataBytes <= 0 {
+			config.MaxDataBytes = in.UserInputValidation.MaxItemDataBytes()
+		}
+		if s, err = compression.New(s, config); err != nil {
+			return nil, err
+		}
+		in.Logger.Info("compressing large item data")
+	}
+	if in.Configs.Quota != nil {
+		in.Logger.Info("enforcing item quotas")
+		q := quota.New(s, *in.Configs.Quota)
+		s, out.UsageTracker = q, q
+	}
+	return s, nil
+}
+
+func newStore(in SetupIn, out *SetupOut) (store.S, error) {
+	r := in.Configs.Replication
+	if r == nil {
+		return newBackend(in, defaultBackend(in.Configs))
+	}
+	if r.Primary == r.Secondary {
+		return nil, fmt.Errorf("%w: primary and secondary backends must differ", errInvalidReplication)
+	}
+	primary, err := newBackend(in, r.Primary)
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := newBackend(in, r.Secondary)
+	if err != nil {
+		return nil, err
+	}
+	in.Logger.Info("replicating store writes", zap.String("primary", r.Primary),
+		zap.String("secondary", r.Secondary), zap.Bool("async", r.Async))
+	s := replication.New(primary, secondary, *r, in.Measures, in.Logger)
+	in.LC.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			s.Start()
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			s.Stop()
+			return nil
+		},
+	})
+	out.Reconciler = s
+	return s, nil
+}
+
+func newEncryptedStore(in SetupIn, s store.S) (store.S, error) {
+	config := *in.Configs.Encryption
+	wrapper := in.KeyWrapper
+	if wrapper == nil {
+		keyring, err := encryption.NewKeyring(config.KeyringFile)
+		if err != nil {
+			return nil, err
+		}
+		wrapper = keyring
+	}
+	in.Logger.Info("encrypting item data", zap.Strings("buckets", config.Buckets),
+		zap.String("currentKeyID", wrapper.CurrentKeyID()))
+	e := encryption.New(s, config, wrapper, in.Measures, in.Logger)
+	in.LC.Append(fx.Hook{
+		OnStart: func(_ context.Context) error {
+			e.Start()
+			return nil
+		},
+		OnStop: func(_ context.Context) error {
+			e.Stop()
+			return nil
+		},
+	})
+	return e, nil
+}
+
+func defaultBackend(configs Configs) string {
+	if configs.Dynamo != nil {
+		return DynamoDB
+	}
+	if configs.Yugabyte != nil {
+		return Yugabyte
+	}
+	return InMem
+}
+
+func newBackend(in SetupIn, name string) (store.S, error) {
+	switch name {
+	case DynamoDB:
+		if in.Configs.Dynamo == nil {
+			return nil, fmt.Errorf("%w: %s backend isn't configured", errInvalidReplication, name)
+		}
 		in.Logger.Info("using dynamodb store implementation")
 		return dynamodb.NewDynamoDB(*in.Configs.Dynamo, in.Measures)
-	}
-	if in.Configs.Yugabyte != nil {
+	case Yugabyte:
+		if in.Configs.Yugabyte == nil {
+			return nil, fmt.Errorf("%w: %s backend isn't configured", errInvalidReplication, name)
+		}
 		in.Logger.Info("using yugabyte store implementation")
 		return cassandra.NewCassandra(*in.Configs.Yugabyte, in.Measures, in.LC,
 			in.Logger)
+	case InMem:
+		in.Logger.Info("using in memory store implementation")
+		var config inmem.Config
+		if in.Configs.InMem != nil {
+			config = *in.Configs.InMem
+		}
+		s := inmem.NewSharded(config, in.Logger)
+		in.LC.Append(fx.Hook{
+			OnStart: func(_ context.Context) error {
+				return s.Open()
+			},
+			OnStop: func(_ context.Context) error {
+				return s.Close()
+			},
+		})
+		return s, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown backend %q", errInvalidReplication, name)
+	}
+}
+
+// StoreCheckName is the name of the health check run against the store backend.
+const StoreCheckName = "store"
+
+func newStoreCheck(s store.S) health.Check {
+	return health.Check{
+		Name: StoreCheckName,
+		Func: func(ctx context.Context) error {
+			if p, ok := s.(store.Pinger); ok {
+				return p.Ping(ctx)
+			}
+			return nil
+		},
 	}
-	in.Logger.Info("using in memory store implementation")
-	return inmem.NewInMem(), nil
 }
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package db
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/argus/store/compression"
+	"github.com/xmidt-org/argus/store/db/metric"
+	"github.com/xmidt-org/argus/store/encryption"
+	"github.com/xmidt-org/argus/store/inmem"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap"
+)
+
+func TestDecorateCompressesBeforeEncrypting(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	require.NoError(os.WriteFile(path,
+		[]byte(`{"current": "k1", "keys": {"k1": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}}`), 0600))
+	in := SetupIn{
+		Configs: Configs{
+			Compression: &compression.Config{Threshold: 1024},
+			Encryption:  &encryption.Config{Buckets: []string{"secrets"}, KeyringFile: path},
+		},
+		Measures: metric.Measures{
+			EncryptionRotations: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "rotations"},
+				[]string{metric.QueryOutcomeLabelKey}),
+		},
+		LC:     fxtest.NewLifecycle(t),
+		Logger: zap.NewNop(),
+	}
+	backend := inmem.NewSharded(inmem.Config{}, nil)
+	var out SetupOut
+	s, err := decorate(in, backend, &out)
+	require.NoError(err)
+
+	key := model.Key{Bucket: "secrets", ID: "id"}
+	data := map[string]interface{}{"words": strings.Repeat("What a Wonderful World ", 1000)}
+	item := store.OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: data}}
+	require.NoError(s.Push(key, item))
+
+	plaintext, err := json.Marshal(data)
+	require.NoError(err)
+	raw, err := backend.Get(key)
+	require.NoError(err)
+	stored, err := json.Marshal(raw.Data)
+	require.NoError(err)
+	assert.Contains(string(stored), "$encrypted")
+	assert.Less(len(stored), len(plaintext)/4, "item data must be compressed before it's encrypted")
+
+	got, err := s.Get(key)
+	require.NoError(err)
+	assert.Equal(data, got.Data)
+}
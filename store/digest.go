@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+)
+
+// Digest summarizes a set of items, such as the items of a bucket.
+type Digest struct {
+	// Sum is the XOR of the ItemDigest of the items. It doesn't depend on
+	// their order and can be updated as items are added and removed.
+	Sum [sha256.Size]byte
+
+	// LastModified is when the set last changed, deletions included. Zero
+	// when unknown.
+	LastModified time.Time
+}
+
+// Toggle adds the item to the digest, or removes it when it's already in.
+func (d *Digest) Toggle(item OwnableItem) {
+	sum := ItemDigest(item)
+	for i := range d.Sum {
+		d.Sum[i] ^= sum[i]
+	}
+}
+
+// Touch moves LastModified forward to t.
+func (d *Digest) Touch(t time.Time) {
+	if t.After(d.LastModified) {
+		d.LastModified = t
+	}
+}
+
+// ItemDigest hashes the ID, owner, data and last modification time of an
+// item. TTLs are left out as they count down between reads.
+func ItemDigest(item OwnableItem) [sha256.Size]byte {
+	h := sha256.New()
+	for _, field := range []string{item.ID, item.Owner} {
+		binary.Write(h, binary.BigEndian, uint64(len(field)))
+		h.Write([]byte(field))
+	}
+	var lastModified int64
+	if !item.LastModified.IsZero() {
+		lastModified = item.LastModified.UnixNano()
+	}
+	binary.Write(h, binary.BigEndian, lastModified)
+	// Map keys are sorted by encoding/json so equal data hashes the same.
+	data, _ := json.Marshal(item.Data)
+	h.Write(data)
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// DigestItems returns the digest of items read from a store. Its LastModified
+// is the latest of the items', which doesn't account for deletions.
+func DigestItems(items map[string]OwnableItem) Digest {
+	var d Digest
+	for _, item := range items {
+		d.Toggle(item)
+		d.Touch(item.LastModified)
+	}
+	return d
+}
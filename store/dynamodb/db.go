@@ -27,6 +27,10 @@ const DynamoDB = "dynamo"
 const (
 	defaultTable      = "gifnoc"
 	defaultMaxRetries = 3
+
+	// DynamoDB rejects items over 400KB. 1KB is left for the keys, owner and
+	// expiration of items.
+	maxItemDataBytes = 399 * 1024
 )
 
 var validate *validator.Validate
@@ -36,6 +40,17 @@ var errHTTPBadRequest = &erraux.Error{
 	Code: http.StatusBadRequest,
 }
 
+// retryableErrorCodes are the AWS error codes which signal a transient failure
+// worth retrying once the sdk retries have been exhausted, by whether they show
+// the request was rejected before being applied.
+var retryableErrorCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ThrottlingException":                    true,
+	"RequestLimitExceeded":                   true,
+	"InternalServerError":                    false,
+	"ServiceUnavailable":                     false,
+}
+
 func init() {
 	validate = validator.New()
 }
@@ -78,12 +93,26 @@ type Config struct {
 
 	// Mechanically identical to RoleBasedAccess, but with descriptive name
 	UseDefaultCredentialChain bool
+
+	// OwnerIndex makes queries for the items of a single owner go through the
+	// bucket-owner GSI (hash key bucket, range key owner, all attributes projected)
+	// instead of reading the whole bucket. The index is verified and created along
+	// with the table when Schema is enabled.
+	// (Optional) defaults to false.
+	OwnerIndex bool
+
+	// Schema controls the verification and creation of the table at startup.
+	// (Optional) by default, the table is assumed to be set up.
+	Schema SchemaConfig
 }
 
 // dao adapts the underlying dynamodb data service to match
 // the store.DAO (currently named store.S but we should rename it) interface.
 type dao struct {
 	s service
+
+	// ownerIndex is true when the bucket-owner GSI can be queried.
+	ownerIndex bool
 }
 
 func NewDynamoDB(config Config, measures metric.Measures) (store.S, error) {
@@ -125,14 +154,31 @@ func NewDynamoDB(config Config, measures metric.Measures) (store.S, error) {
 		}
 	}
 
-	svc, err := newService(awsCfg, config, config.GetAllLimit, &measures)
+	client := newClient(awsCfg, config)
+	if config.Schema.Verify || config.Schema.CreateTableIfMissing {
+		if config.Schema.Timeout <= 0 {
+			config.Schema.Timeout = defaultSchemaTimeout
+		}
+		m := &schemaManager{
+			api:          client,
+			spec:         newTableSpec(config),
+			config:       config.Schema,
+			pollInterval: defaultTablePollInterval,
+		}
+		if err := m.ensureSchema(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	svc, err := newServiceWithClient(client, config.Table, config.GetAllLimit, &measures)
 	if err != nil {
 		return nil, err
 	}
 
 	svc = newInstrumentingService(&dynamoMeasuresUpdater{measures: &measures}, svc, time.Now)
 	return &dao{
-		s: svc,
+		s:          svc,
+		ownerIndex: config.OwnerIndex,
 	}, nil
 }
 
@@ -155,6 +201,26 @@ func (d dao) Push(key model.Key, item store.OwnableItem) error {
 	return sanitizeError(err)
 }
 
+func (d dao) PushIfAbsent(key model.Key, item store.OwnableItem) error {
+	_, err := d.s.PushIfAbsent(key, item)
+	return sanitizeError(err)
+}
+
+func (d dao) CompareAndSwap(key model.Key, old, item store.OwnableItem) error {
+	_, err := d.s.CompareAndSwap(key, old, item)
+	return sanitizeError(err)
+}
+
+func (d dao) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	value, _, err := d.s.Increment(key, path, delta, modifiedBy)
+	return value, sanitizeError(err)
+}
+
+func (d dao) Transact(ops []store.TransactionOp) error {
+	_, err := d.s.Transact(ops)
+	return sanitizeError(err)
+}
+
 func (d dao) Get(key model.Key) (store.OwnableItem, error) {
 	item, _, err := d.s.Get(key)
 	return item, sanitizeError(err)
@@ -170,6 +236,29 @@ func (d *dao) GetAll(bucket string) (map[string]store.OwnableItem, error) {
 	return items, sanitizeError(err)
 }
 
+// GetAllByOwner queries the bucket-owner index when enabled and filters
+// the whole bucket otherwise. Items without owner aren't indexed.
+func (d *dao) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, error) {
+	if !d.ownerIndex || owner == "" {
+		items, err := d.GetAll(bucket)
+		if err != nil {
+			return items, err
+		}
+		return store.FilterOwner(items, owner), nil
+	}
+	items, _, err := d.s.GetAllByOwner(bucket, owner)
+	return items, sanitizeError(err)
+}
+
+// MaxItemDataBytes returns the size limit of the item data DynamoDB accepts.
+func (d *dao) MaxItemDataBytes() int64 {
+	return maxItemDataBytes
+}
+
+func (d *dao) Ping(ctx context.Context) error {
+	return sanitizeError(d.s.Ping(ctx))
+}
+
 func sanitizeError(err error) error {
 	if err == nil {
 		return nil
@@ -183,6 +272,9 @@ func sanitizeError(err error) error {
 		if awsErr.ErrorCode() == "ValidationException" {
 			return store.SanitizedError{Err: err, ErrHTTP: errHTTPBadRequest}
 		}
+		if unapplied, ok := retryableErrorCodes[awsErr.ErrorCode()]; ok {
+			return store.SanitizedError{Err: store.InternalError{Reason: err, Retryable: true, Unapplied: unapplied}, ErrHTTP: store.ErrHTTPOpFailed}
+		}
 	}
 	return store.SanitizeError(err)
 }
@@ -154,6 +154,70 @@ func TestGetAllDAO(t *testing.T) {
 	}
 }
 
+func TestGetAllByOwnerDAO(t *testing.T) {
+	items := map[string]store.OwnableItem{
+		"a": {Owner: "xmidt", Item: model.Item{ID: "a"}},
+		"b": {Owner: "other", Item: model.Item{ID: "b"}},
+	}
+	xmidtItems := map[string]store.OwnableItem{
+		"a": {Owner: "xmidt", Item: model.Item{ID: "a"}},
+	}
+	tcs := []struct {
+		Description   string
+		OwnerIndex    bool
+		Owner         string
+		QueryErr      error
+		ExpectedQuery string
+		ExpectedItems map[string]store.OwnableItem
+		ExpectedErr   error
+	}{
+		{
+			Description:   "Index disabled",
+			Owner:         "xmidt",
+			ExpectedQuery: "GetAll",
+			ExpectedItems: xmidtItems,
+		},
+		{
+			Description:   "Index enabled",
+			OwnerIndex:    true,
+			Owner:         "xmidt",
+			ExpectedQuery: "GetAllByOwner",
+			ExpectedItems: xmidtItems,
+		},
+		{
+			Description:   "Index enabled without owner",
+			OwnerIndex:    true,
+			ExpectedQuery: "GetAll",
+			ExpectedItems: map[string]store.OwnableItem{},
+		},
+		{
+			Description:   "Index query error",
+			OwnerIndex:    true,
+			Owner:         "xmidt",
+			QueryErr:      errInternal,
+			ExpectedQuery: "GetAllByOwner",
+			ExpectedItems: map[string]store.OwnableItem{},
+			ExpectedErr: store.SanitizedError{
+				Err:     errInternal,
+				ErrHTTP: store.ErrHTTPOpFailed,
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			m := new(mockService)
+			m.On("GetAll", "testBucket").Return(items, &awsv2dynamodbTypes.ConsumedCapacity{}, nil)
+			m.On("GetAllByOwner", "testBucket", tc.Owner).Return(tc.ExpectedItems, &awsv2dynamodbTypes.ConsumedCapacity{}, tc.QueryErr)
+			d := dao{s: m, ownerIndex: tc.OwnerIndex}
+			result, err := d.GetAllByOwner("testBucket", tc.Owner)
+			assert.Equal(tc.ExpectedItems, result)
+			assert.Equal(tc.ExpectedErr, err)
+			m.AssertNumberOfCalls(t, tc.ExpectedQuery, 1)
+		})
+	}
+}
+
 type smithyValidationError struct {
 	error
 }
@@ -161,13 +225,24 @@ type smithyValidationError struct {
 func (e smithyValidationError) Error() string     { return "some dynamodb specific input validation error" }
 func (e smithyValidationError) ErrorCode() string { return "ValidationException" }
 
+type smithyThrottlingError struct {
+	error
+}
+
+func (e smithyThrottlingError) Error() string {
+	return "rate of requests exceeds the allowed throughput"
+}
+func (e smithyThrottlingError) ErrorCode() string { return "ThrottlingException" }
+
 func TestSanitizeError(t *testing.T) {
 	dynamodbValidationErr := smithyValidationError{errInternal}
+	dynamodbThrottlingErr := smithyThrottlingError{errInternal}
 	tcs := []struct {
-		Description     string
-		InputErr        error
-		ExpectedErr     error
-		ExpectedErrHTTP error
+		Description       string
+		InputErr          error
+		ExpectedErr       error
+		ExpectedErrHTTP   error
+		ExpectedRetryable bool
 	}{
 		{
 			Description:     "Validation error",
@@ -175,6 +250,19 @@ func TestSanitizeError(t *testing.T) {
 			ExpectedErr:     dynamodbValidationErr,
 			ExpectedErrHTTP: errHTTPBadRequest,
 		},
+		{
+			Description:       "Throttling error",
+			InputErr:          dynamodbThrottlingErr,
+			ExpectedErr:       store.InternalError{Reason: dynamodbThrottlingErr, Retryable: true, Unapplied: true},
+			ExpectedErrHTTP:   store.ErrHTTPOpFailed,
+			ExpectedRetryable: true,
+		},
+		{
+			Description:     "Item exists",
+			InputErr:        store.ErrItemExists,
+			ExpectedErr:     store.ErrItemExists,
+			ExpectedErrHTTP: store.ErrHTTPItemExists,
+		},
 		{
 			Description:     "Other error",
 			InputErr:        errInternal,
@@ -191,6 +279,7 @@ func TestSanitizeError(t *testing.T) {
 			assert.True(errors.As(err, &sErr))
 			assert.Equal(tc.ExpectedErr, sErr.Err)
 			assert.EqualValues(tc.ExpectedErrHTTP, sErr.ErrHTTP)
+			assert.Equal(tc.ExpectedRetryable, store.IsRetryable(err))
 		})
 	}
 }
@@ -3,6 +3,7 @@
 package dynamodb
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -44,6 +45,62 @@ func (s *instrumentingService) Push(key model.Key, item store.OwnableItem) (*aws
 	return consumedCapacity, err
 }
 
+func (s *instrumentingService) PushIfAbsent(key model.Key, item store.OwnableItem) (*awsv2dynamodbTypes.ConsumedCapacity, error) {
+	start := s.now()
+	consumedCapacity, err := s.service.PushIfAbsent(key, item)
+
+	s.measures.Update(&measureUpdateRequest{
+		err:              err,
+		consumedCapacity: consumedCapacity,
+		queryType:        metric.PushIfAbsentQueryType,
+		start:            start,
+	})
+
+	return consumedCapacity, err
+}
+
+func (s *instrumentingService) CompareAndSwap(key model.Key, old, item store.OwnableItem) (*awsv2dynamodbTypes.ConsumedCapacity, error) {
+	start := s.now()
+	consumedCapacity, err := s.service.CompareAndSwap(key, old, item)
+
+	s.measures.Update(&measureUpdateRequest{
+		err:              err,
+		consumedCapacity: consumedCapacity,
+		queryType:        metric.CompareAndSwapQueryType,
+		start:            start,
+	})
+
+	return consumedCapacity, err
+}
+
+func (s *instrumentingService) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, *awsv2dynamodbTypes.ConsumedCapacity, error) {
+	start := s.now()
+	value, consumedCapacity, err := s.service.Increment(key, path, delta, modifiedBy)
+
+	s.measures.Update(&measureUpdateRequest{
+		err:              err,
+		consumedCapacity: consumedCapacity,
+		queryType:        metric.IncrementQueryType,
+		start:            start,
+	})
+
+	return value, consumedCapacity, err
+}
+
+func (s *instrumentingService) Transact(ops []store.TransactionOp) (*awsv2dynamodbTypes.ConsumedCapacity, error) {
+	start := s.now()
+	consumedCapacity, err := s.service.Transact(ops)
+
+	s.measures.Update(&measureUpdateRequest{
+		err:              err,
+		consumedCapacity: consumedCapacity,
+		queryType:        metric.TransactQueryType,
+		start:            start,
+	})
+
+	return consumedCapacity, err
+}
+
 func (s *instrumentingService) Get(key model.Key) (store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error) {
 	start := s.now()
 	item, consumedCapacity, err := s.service.Get(key)
@@ -86,6 +143,33 @@ func (s *instrumentingService) GetAll(bucket string) (map[string]store.OwnableIt
 	return items, consumedCapacity, err
 }
 
+func (s *instrumentingService) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error) {
+	start := s.now()
+	items, consumedCapacity, err := s.service.GetAllByOwner(bucket, owner)
+
+	s.measures.Update(&measureUpdateRequest{
+		err:              err,
+		consumedCapacity: consumedCapacity,
+		queryType:        metric.GetAllByOwnerQueryType,
+		start:            start,
+	})
+
+	return items, consumedCapacity, err
+}
+
+func (s *instrumentingService) Ping(ctx context.Context) error {
+	start := s.now()
+	err := s.service.Ping(ctx)
+
+	s.measures.Update(&measureUpdateRequest{
+		err:       err,
+		queryType: metric.PingQueryType,
+		start:     start,
+	})
+
+	return err
+}
+
 type dynamoMeasuresUpdater struct {
 	measures *metric.Measures
 }
@@ -109,7 +193,9 @@ func (m *dynamoMeasuresUpdater) updateDynamoCapacityMeasures(consumedCapacity *a
 	}
 
 	capacityOp := metric.DynamoCapacityReadOp
-	if queryType == metric.PushQueryType || queryType == metric.DeleteQueryType {
+	if queryType == metric.PushQueryType || queryType == metric.PushIfAbsentQueryType ||
+		queryType == metric.CompareAndSwapQueryType || queryType == metric.IncrementQueryType || queryType == metric.TransactQueryType ||
+		queryType == metric.DeleteQueryType {
 		capacityOp = metric.DynamoCapacityWriteOp
 	}
 
@@ -120,7 +206,8 @@ func (m *dynamoMeasuresUpdater) updateDynamoCapacityMeasures(consumedCapacity *a
 }
 
 func (m *dynamoMeasuresUpdater) updateQueryMeasures(err error, queryType string) {
-	if err != nil && !errors.Is(err, store.ErrItemNotFound) {
+	if err != nil && !errors.Is(err, store.ErrItemNotFound) && !errors.Is(err, store.ErrItemExists) &&
+		!errors.Is(err, store.ErrItemChanged) && !errors.Is(err, store.ErrNotNumeric) {
 		m.measures.Queries.With(prometheus.Labels{
 			metric.QueryOutcomeLabelKey: metric.FailQueryOutcome,
 			metric.QueryTypeLabelKey:    queryType,
@@ -38,6 +38,12 @@ func setupUpdateCalls(u *mockMeasuresUpdater, consumedCapacity *awsv2dynamodbTyp
 		start:            now,
 	}
 
+	getAllByOwnerMeasureUpdateRequest := &measureUpdateRequest{
+		consumedCapacity: consumedCapacity,
+		queryType:        metric.GetAllByOwnerQueryType,
+		start:            now,
+	}
+
 	deleteMeasureUpdateRequest := &measureUpdateRequest{
 		consumedCapacity: consumedCapacity,
 		queryType:        metric.DeleteQueryType,
@@ -48,6 +54,7 @@ func setupUpdateCalls(u *mockMeasuresUpdater, consumedCapacity *awsv2dynamodbTyp
 	u.On("Update", getMeasureUpdateRequest).Once()
 	u.On("Update", pushMeasureUpdateRequest).Once()
 	u.On("Update", getAllMeasureUpdateRequest).Once()
+	u.On("Update", getAllByOwnerMeasureUpdateRequest).Once()
 }
 
 func TestInstrumentingService(t *testing.T) {
@@ -70,6 +77,7 @@ func TestInstrumentingService(t *testing.T) {
 	m.On("Get", key).Return(item, consumedCapacity, err).Once()
 	m.On("Delete", key).Return(item, consumedCapacity, nil).Once()
 	m.On("GetAll", "bucket").Return(items, consumedCapacity, nil).Once()
+	m.On("GetAllByOwner", "bucket", "owner").Return(items, consumedCapacity, nil).Once()
 
 	setupUpdateCalls(u, consumedCapacity, err, now)
 
@@ -92,6 +100,11 @@ func TestInstrumentingService(t *testing.T) {
 	assert.Equal(consumedCapacity, cc)
 	assert.Nil(e)
 
+	is, cc, e = svc.GetAllByOwner("bucket", "owner")
+	assert.Equal(items, is)
+	assert.Equal(consumedCapacity, cc)
+	assert.Nil(e)
+
 	m.AssertExpectations(t)
 	u.AssertExpectations(t)
 }
@@ -22,6 +22,26 @@ func (s *mockService) Push(key model.Key, item store.OwnableItem) (*awsv2dynamod
 	return args.Get(0).(*awsv2dynamodbTypes.ConsumedCapacity), args.Error(1)
 }
 
+func (s *mockService) PushIfAbsent(key model.Key, item store.OwnableItem) (*awsv2dynamodbTypes.ConsumedCapacity, error) {
+	args := s.Called(key, item)
+	return args.Get(0).(*awsv2dynamodbTypes.ConsumedCapacity), args.Error(1)
+}
+
+func (s *mockService) CompareAndSwap(key model.Key, old, item store.OwnableItem) (*awsv2dynamodbTypes.ConsumedCapacity, error) {
+	args := s.Called(key, old, item)
+	return args.Get(0).(*awsv2dynamodbTypes.ConsumedCapacity), args.Error(1)
+}
+
+func (s *mockService) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, *awsv2dynamodbTypes.ConsumedCapacity, error) {
+	args := s.Called(key, path, delta, modifiedBy)
+	return args.Get(0).(float64), args.Get(1).(*awsv2dynamodbTypes.ConsumedCapacity), args.Error(2)
+}
+
+func (s *mockService) Transact(ops []store.TransactionOp) (*awsv2dynamodbTypes.ConsumedCapacity, error) {
+	args := s.Called(ops)
+	return args.Get(0).(*awsv2dynamodbTypes.ConsumedCapacity), args.Error(1)
+}
+
 func (s *mockService) Get(key model.Key) (store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error) {
 	args := s.Called(key)
 	return args.Get(0).(store.OwnableItem), args.Get(1).(*awsv2dynamodbTypes.ConsumedCapacity), args.Error(2)
@@ -37,6 +57,16 @@ func (s *mockService) GetAll(bucket string) (map[string]store.OwnableItem, *awsv
 	return args.Get(0).(map[string]store.OwnableItem), args.Get(1).(*awsv2dynamodbTypes.ConsumedCapacity), args.Error(2)
 }
 
+func (s *mockService) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error) {
+	args := s.Called(bucket, owner)
+	return args.Get(0).(map[string]store.OwnableItem), args.Get(1).(*awsv2dynamodbTypes.ConsumedCapacity), args.Error(2)
+}
+
+func (s *mockService) Ping(ctx context.Context) error {
+	args := s.Called(ctx)
+	return args.Error(0)
+}
+
 type mockMeasuresUpdater struct {
 	mock.Mock
 }
@@ -58,6 +88,24 @@ func (m *mockClient) PutItem(ctx context.Context, params *awsv2dynamodb.PutItemI
 	return out, args.Error(1)
 }
 
+func (m *mockClient) UpdateItem(ctx context.Context, params *awsv2dynamodb.UpdateItemInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.UpdateItemOutput, error) {
+	args := m.Called(mock.Anything, mock.Anything, mock.Anything)
+	var out *awsv2dynamodb.UpdateItemOutput
+	if v := args.Get(0); v != nil {
+		out = v.(*awsv2dynamodb.UpdateItemOutput)
+	}
+	return out, args.Error(1)
+}
+
+func (m *mockClient) TransactWriteItems(ctx context.Context, params *awsv2dynamodb.TransactWriteItemsInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.TransactWriteItemsOutput, error) {
+	args := m.Called(mock.Anything, mock.Anything, mock.Anything)
+	var out *awsv2dynamodb.TransactWriteItemsOutput
+	if v := args.Get(0); v != nil {
+		out = v.(*awsv2dynamodb.TransactWriteItemsOutput)
+	}
+	return out, args.Error(1)
+}
+
 func (m *mockClient) GetItem(ctx context.Context, params *awsv2dynamodb.GetItemInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.GetItemOutput, error) {
 	// DEBUG: Print when GetItem is called and with what key
 	if params != nil && params.Key != nil {
@@ -96,3 +144,12 @@ func (m *mockClient) Query(ctx context.Context, params *awsv2dynamodb.QueryInput
 	}
 	return out, args.Error(1)
 }
+
+func (m *mockClient) DescribeTable(ctx context.Context, params *awsv2dynamodb.DescribeTableInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.DescribeTableOutput, error) {
+	args := m.Called(mock.Anything, mock.Anything, mock.Anything)
+	var out *awsv2dynamodb.DescribeTableOutput
+	if v := args.Get(0); v != nil {
+		out = v.(*awsv2dynamodb.DescribeTableOutput)
+	}
+	return out, args.Error(1)
+}
@@ -0,0 +1,329 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsv2dynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	awsv2dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// expiresIndexName is the global secondary index used to fetch all unexpired items of a bucket.
+	expiresIndexName = "Expires-index"
+
+	// ownerIndexName is the optional global secondary index used to fetch the items of a single owner.
+	ownerIndexName = "bucket-owner"
+)
+
+const (
+	defaultSchemaTimeout     = 5 * time.Minute
+	defaultTablePollInterval = 2 * time.Second
+)
+
+var (
+	errTableNotFound  = errors.New("table not found")
+	errSchemaMismatch = errors.New("table schema mismatch")
+)
+
+// tableAPI is the subset of the DynamoDB client needed to bootstrap and verify the table.
+type tableAPI interface {
+	DescribeTable(ctx context.Context, params *awsv2dynamodb.DescribeTableInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.DescribeTableOutput, error)
+	CreateTable(ctx context.Context, params *awsv2dynamodb.CreateTableInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.CreateTableOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *awsv2dynamodb.DescribeTimeToLiveInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *awsv2dynamodb.UpdateTimeToLiveInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.UpdateTimeToLiveOutput, error)
+}
+
+// SchemaConfig controls what Argus does about its table at startup.
+type SchemaConfig struct {
+	// Verify checks that the table, its key schema, the GSIs Argus queries and
+	// the TTL specification on the expires attribute are in place. Startup fails
+	// with a descriptive error when they aren't.
+	// (Optional) defaults to false.
+	Verify bool
+
+	// CreateTableIfMissing creates the table with the expected key schema and GSIs
+	// when it doesn't exist, and enables TTL on the expires attribute when it's off.
+	// It implies Verify.
+	// (Optional) defaults to false.
+	CreateTableIfMissing bool
+
+	// ReadCapacityUnits and WriteCapacityUnits set the provisioned throughput of
+	// a created table and its indexes. When either is not set, the table is
+	// created with on-demand billing.
+	// (Optional)
+	ReadCapacityUnits  int64
+	WriteCapacityUnits int64
+
+	// Timeout bounds the whole bootstrap, waiting for a new table to become active included.
+	// (Optional) defaults to 5m.
+	Timeout time.Duration
+}
+
+// indexSpec describes a global secondary index Argus depends on.
+type indexSpec struct {
+	name     string
+	hashKey  string
+	rangeKey string
+	// rangeKeyType is the scalar type of the range key attribute.
+	rangeKeyType awsv2dynamodbTypes.ScalarAttributeType
+}
+
+// tableSpec is the table layout Argus expects.
+type tableSpec struct {
+	name    string
+	indexes []indexSpec
+}
+
+func newTableSpec(config Config) tableSpec {
+	spec := tableSpec{
+		name: config.Table,
+		indexes: []indexSpec{
+			{
+				name:         expiresIndexName,
+				hashKey:      bucketAttributeKey,
+				rangeKey:     expirationAttributeKey,
+				rangeKeyType: awsv2dynamodbTypes.ScalarAttributeTypeN,
+			},
+		},
+	}
+	if config.OwnerIndex {
+		spec.indexes = append(spec.indexes, indexSpec{
+			name:         ownerIndexName,
+			hashKey:      bucketAttributeKey,
+			rangeKey:     ownerAttributeKey,
+			rangeKeyType: awsv2dynamodbTypes.ScalarAttributeTypeS,
+		})
+	}
+	return spec
+}
+
+type schemaManager struct {
+	api          tableAPI
+	spec         tableSpec
+	config       SchemaConfig
+	pollInterval time.Duration
+}
+
+// ensureSchema creates the table if configured to and it's missing, then
+// verifies it matches what Argus expects.
+func (m *schemaManager) ensureSchema(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+	defer cancel()
+
+	table, err := m.describeTable(ctx)
+	if errors.Is(err, errTableNotFound) && m.config.CreateTableIfMissing {
+		table, err = m.createTable(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = m.verifyTable(table); err != nil {
+		return err
+	}
+	return m.ensureTTL(ctx)
+}
+
+func (m *schemaManager) describeTable(ctx context.Context) (*awsv2dynamodbTypes.TableDescription, error) {
+	output, err := m.api.DescribeTable(ctx, &awsv2dynamodb.DescribeTableInput{
+		TableName: aws.String(m.spec.name),
+	})
+	var notFound *awsv2dynamodbTypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, fmt.Errorf("%w: %s", errTableNotFound, m.spec.name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe table %s: %w", m.spec.name, err)
+	}
+	if output.Table == nil {
+		return nil, fmt.Errorf("%w: %s", errTableNotFound, m.spec.name)
+	}
+	return output.Table, nil
+}
+
+func (m *schemaManager) createTable(ctx context.Context) (*awsv2dynamodbTypes.TableDescription, error) {
+	attributes := map[string]awsv2dynamodbTypes.ScalarAttributeType{
+		bucketAttributeKey: awsv2dynamodbTypes.ScalarAttributeTypeS,
+		idAttributeKey:     awsv2dynamodbTypes.ScalarAttributeTypeS,
+	}
+
+	input := &awsv2dynamodb.CreateTableInput{
+		TableName: aws.String(m.spec.name),
+		KeySchema: keySchema(bucketAttributeKey, idAttributeKey),
+	}
+
+	var throughput *awsv2dynamodbTypes.ProvisionedThroughput
+	if m.config.ReadCapacityUnits > 0 && m.config.WriteCapacityUnits > 0 {
+		throughput = &awsv2dynamodbTypes.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(m.config.ReadCapacityUnits),
+			WriteCapacityUnits: aws.Int64(m.config.WriteCapacityUnits),
+		}
+		input.BillingMode = awsv2dynamodbTypes.BillingModeProvisioned
+		input.ProvisionedThroughput = throughput
+	} else {
+		input.BillingMode = awsv2dynamodbTypes.BillingModePayPerRequest
+	}
+
+	for _, index := range m.spec.indexes {
+		attributes[index.hashKey] = awsv2dynamodbTypes.ScalarAttributeTypeS
+		attributes[index.rangeKey] = index.rangeKeyType
+		input.GlobalSecondaryIndexes = append(input.GlobalSecondaryIndexes, awsv2dynamodbTypes.GlobalSecondaryIndex{
+			IndexName:             aws.String(index.name),
+			KeySchema:             keySchema(index.hashKey, index.rangeKey),
+			Projection:            &awsv2dynamodbTypes.Projection{ProjectionType: awsv2dynamodbTypes.ProjectionTypeAll},
+			ProvisionedThroughput: throughput,
+		})
+	}
+
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, awsv2dynamodbTypes.AttributeDefinition{
+			AttributeName: aws.String(name),
+			AttributeType: attributes[name],
+		})
+	}
+
+	if _, err := m.api.CreateTable(ctx, input); err != nil {
+		var inUse *awsv2dynamodbTypes.ResourceInUseException
+		// another instance may have won the race to create the table.
+		if !errors.As(err, &inUse) {
+			return nil, fmt.Errorf("failed to create table %s: %w", m.spec.name, err)
+		}
+	}
+
+	return m.waitForActive(ctx)
+}
+
+func (m *schemaManager) waitForActive(ctx context.Context) (*awsv2dynamodbTypes.TableDescription, error) {
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+	for {
+		table, err := m.describeTable(ctx)
+		if err != nil && !errors.Is(err, errTableNotFound) {
+			return nil, err
+		}
+		if table != nil && table.TableStatus == awsv2dynamodbTypes.TableStatusActive {
+			return table, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("table %s did not become active: %w", m.spec.name, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// verifyTable checks the key schema of the table and of the indexes Argus queries.
+func (m *schemaManager) verifyTable(table *awsv2dynamodbTypes.TableDescription) error {
+	types := make(map[string]awsv2dynamodbTypes.ScalarAttributeType, len(table.AttributeDefinitions))
+	for _, d := range table.AttributeDefinitions {
+		types[aws.ToString(d.AttributeName)] = d.AttributeType
+	}
+
+	if err := verifyKeySchema(table.KeySchema, types, bucketAttributeKey, idAttributeKey, awsv2dynamodbTypes.ScalarAttributeTypeS); err != nil {
+		return fmt.Errorf("%w: table %s: %v", errSchemaMismatch, m.spec.name, err)
+	}
+
+	indexes := make(map[string]awsv2dynamodbTypes.GlobalSecondaryIndexDescription, len(table.GlobalSecondaryIndexes))
+	for _, index := range table.GlobalSecondaryIndexes {
+		indexes[aws.ToString(index.IndexName)] = index
+	}
+
+	for _, spec := range m.spec.indexes {
+		index, ok := indexes[spec.name]
+		if !ok {
+			return fmt.Errorf("%w: table %s: missing global secondary index %s", errSchemaMismatch, m.spec.name, spec.name)
+		}
+		if err := verifyKeySchema(index.KeySchema, types, spec.hashKey, spec.rangeKey, spec.rangeKeyType); err != nil {
+			return fmt.Errorf("%w: index %s: %v", errSchemaMismatch, spec.name, err)
+		}
+		if index.Projection == nil || index.Projection.ProjectionType != awsv2dynamodbTypes.ProjectionTypeAll {
+			return fmt.Errorf("%w: index %s: projection must be %s", errSchemaMismatch, spec.name, awsv2dynamodbTypes.ProjectionTypeAll)
+		}
+	}
+	return nil
+}
+
+// ensureTTL verifies TTL is enabled on the expires attribute, turning it on
+// when configured to create missing resources.
+func (m *schemaManager) ensureTTL(ctx context.Context) error {
+	output, err := m.api.DescribeTimeToLive(ctx, &awsv2dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(m.spec.name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe time to live of table %s: %w", m.spec.name, err)
+	}
+
+	ttl := output.TimeToLiveDescription
+	if ttl != nil {
+		switch ttl.TimeToLiveStatus {
+		case awsv2dynamodbTypes.TimeToLiveStatusEnabled, awsv2dynamodbTypes.TimeToLiveStatusEnabling:
+			if aws.ToString(ttl.AttributeName) != expirationAttributeKey {
+				return fmt.Errorf("%w: table %s: TTL is set on attribute %s instead of %s",
+					errSchemaMismatch, m.spec.name, aws.ToString(ttl.AttributeName), expirationAttributeKey)
+			}
+			return nil
+		}
+	}
+
+	if !m.config.CreateTableIfMissing {
+		return fmt.Errorf("%w: table %s: TTL is not enabled on attribute %s", errSchemaMismatch, m.spec.name, expirationAttributeKey)
+	}
+
+	_, err = m.api.UpdateTimeToLive(ctx, &awsv2dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(m.spec.name),
+		TimeToLiveSpecification: &awsv2dynamodbTypes.TimeToLiveSpecification{
+			AttributeName: aws.String(expirationAttributeKey),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable TTL on table %s: %w", m.spec.name, err)
+	}
+	return nil
+}
+
+func keySchema(hashKey, rangeKey string) []awsv2dynamodbTypes.KeySchemaElement {
+	return []awsv2dynamodbTypes.KeySchemaElement{
+		{AttributeName: aws.String(hashKey), KeyType: awsv2dynamodbTypes.KeyTypeHash},
+		{AttributeName: aws.String(rangeKey), KeyType: awsv2dynamodbTypes.KeyTypeRange},
+	}
+}
+
+func verifyKeySchema(elements []awsv2dynamodbTypes.KeySchemaElement, types map[string]awsv2dynamodbTypes.ScalarAttributeType,
+	hashKey, rangeKey string, rangeKeyType awsv2dynamodbTypes.ScalarAttributeType) error {
+	var actualHash, actualRange string
+	for _, e := range elements {
+		switch e.KeyType {
+		case awsv2dynamodbTypes.KeyTypeHash:
+			actualHash = aws.ToString(e.AttributeName)
+		case awsv2dynamodbTypes.KeyTypeRange:
+			actualRange = aws.ToString(e.AttributeName)
+		}
+	}
+
+	if actualHash != hashKey || actualRange != rangeKey {
+		return fmt.Errorf("expected key schema (%s HASH, %s RANGE) but found (%s HASH, %s RANGE)",
+			hashKey, rangeKey, actualHash, actualRange)
+	}
+	if t := types[hashKey]; t != awsv2dynamodbTypes.ScalarAttributeTypeS {
+		return fmt.Errorf("expected attribute %s to be of type %s but found %q", hashKey, awsv2dynamodbTypes.ScalarAttributeTypeS, t)
+	}
+	if t := types[rangeKey]; t != rangeKeyType {
+		return fmt.Errorf("expected attribute %s to be of type %s but found %q", rangeKey, rangeKeyType, t)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsv2dynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	awsv2dynamodbTypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTableAPI is a local stand-in for the DynamoDB control plane. Created
+// tables report CREATING for the first describeCallsUntilActive calls.
+type fakeTableAPI struct {
+	table                    *awsv2dynamodbTypes.TableDescription
+	ttl                      *awsv2dynamodbTypes.TimeToLiveDescription
+	describeCallsUntilActive int
+	createErr                error
+	created                  *awsv2dynamodb.CreateTableInput
+	ttlUpdated               bool
+}
+
+func (f *fakeTableAPI) DescribeTable(_ context.Context, params *awsv2dynamodb.DescribeTableInput, _ ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.DescribeTableOutput, error) {
+	if f.table == nil || aws.ToString(f.table.TableName) != aws.ToString(params.TableName) {
+		return nil, &awsv2dynamodbTypes.ResourceNotFoundException{Message: aws.String("not found")}
+	}
+	if f.describeCallsUntilActive > 0 {
+		f.describeCallsUntilActive--
+	} else {
+		f.table.TableStatus = awsv2dynamodbTypes.TableStatusActive
+	}
+	return &awsv2dynamodb.DescribeTableOutput{Table: f.table}, nil
+}
+
+func (f *fakeTableAPI) CreateTable(_ context.Context, params *awsv2dynamodb.CreateTableInput, _ ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.CreateTableOutput, error) {
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	f.created = params
+	table := &awsv2dynamodbTypes.TableDescription{
+		TableName:            params.TableName,
+		TableStatus:          awsv2dynamodbTypes.TableStatusCreating,
+		KeySchema:            params.KeySchema,
+		AttributeDefinitions: params.AttributeDefinitions,
+	}
+	for _, index := range params.GlobalSecondaryIndexes {
+		table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, awsv2dynamodbTypes.GlobalSecondaryIndexDescription{
+			IndexName:  index.IndexName,
+			KeySchema:  index.KeySchema,
+			Projection: index.Projection,
+		})
+	}
+	f.table = table
+	return &awsv2dynamodb.CreateTableOutput{TableDescription: table}, nil
+}
+
+func (f *fakeTableAPI) DescribeTimeToLive(context.Context, *awsv2dynamodb.DescribeTimeToLiveInput, ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.DescribeTimeToLiveOutput, error) {
+	ttl := f.ttl
+	if ttl == nil {
+		ttl = &awsv2dynamodbTypes.TimeToLiveDescription{TimeToLiveStatus: awsv2dynamodbTypes.TimeToLiveStatusDisabled}
+	}
+	return &awsv2dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: ttl}, nil
+}
+
+func (f *fakeTableAPI) UpdateTimeToLive(_ context.Context, params *awsv2dynamodb.UpdateTimeToLiveInput, _ ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.UpdateTimeToLiveOutput, error) {
+	f.ttlUpdated = true
+	f.ttl = &awsv2dynamodbTypes.TimeToLiveDescription{
+		AttributeName:    params.TimeToLiveSpecification.AttributeName,
+		TimeToLiveStatus: awsv2dynamodbTypes.TimeToLiveStatusEnabling,
+	}
+	return &awsv2dynamodb.UpdateTimeToLiveOutput{TimeToLiveSpecification: params.TimeToLiveSpecification}, nil
+}
+
+// validTable returns the description of a table set up the way Argus expects it.
+func validTable() *awsv2dynamodbTypes.TableDescription {
+	return &awsv2dynamodbTypes.TableDescription{
+		TableName:   aws.String(defaultTable),
+		TableStatus: awsv2dynamodbTypes.TableStatusActive,
+		KeySchema:   keySchema(bucketAttributeKey, idAttributeKey),
+		AttributeDefinitions: []awsv2dynamodbTypes.AttributeDefinition{
+			{AttributeName: aws.String(bucketAttributeKey), AttributeType: awsv2dynamodbTypes.ScalarAttributeTypeS},
+			{AttributeName: aws.String(idAttributeKey), AttributeType: awsv2dynamodbTypes.ScalarAttributeTypeS},
+			{AttributeName: aws.String(expirationAttributeKey), AttributeType: awsv2dynamodbTypes.ScalarAttributeTypeN},
+		},
+		GlobalSecondaryIndexes: []awsv2dynamodbTypes.GlobalSecondaryIndexDescription{
+			{
+				IndexName:  aws.String(expiresIndexName),
+				KeySchema:  keySchema(bucketAttributeKey, expirationAttributeKey),
+				Projection: &awsv2dynamodbTypes.Projection{ProjectionType: awsv2dynamodbTypes.ProjectionTypeAll},
+			},
+		},
+	}
+}
+
+func enabledTTL() *awsv2dynamodbTypes.TimeToLiveDescription {
+	return &awsv2dynamodbTypes.TimeToLiveDescription{
+		AttributeName:    aws.String(expirationAttributeKey),
+		TimeToLiveStatus: awsv2dynamodbTypes.TimeToLiveStatusEnabled,
+	}
+}
+
+func TestEnsureSchema(t *testing.T) {
+	wrongKeys := validTable()
+	wrongKeys.KeySchema = keySchema(idAttributeKey, bucketAttributeKey)
+
+	missingIndex := validTable()
+	missingIndex.GlobalSecondaryIndexes = nil
+
+	wrongIndexType := validTable()
+	wrongIndexType.AttributeDefinitions[2].AttributeType = awsv2dynamodbTypes.ScalarAttributeTypeS
+
+	keysOnlyIndex := validTable()
+	keysOnlyIndex.GlobalSecondaryIndexes[0].Projection.ProjectionType = awsv2dynamodbTypes.ProjectionTypeKeysOnly
+
+	tcs := []struct {
+		Description        string
+		Config             SchemaConfig
+		API                *fakeTableAPI
+		ExpectedErr        error
+		ExpectedCreate     bool
+		ExpectedTTLUpdated bool
+	}{
+		{
+			Description: "Valid table",
+			Config:      SchemaConfig{Verify: true},
+			API:         &fakeTableAPI{table: validTable(), ttl: enabledTTL()},
+		},
+		{
+			Description: "Missing table",
+			Config:      SchemaConfig{Verify: true},
+			API:         &fakeTableAPI{},
+			ExpectedErr: errTableNotFound,
+		},
+		{
+			Description:        "Missing table is created",
+			Config:             SchemaConfig{CreateTableIfMissing: true},
+			API:                &fakeTableAPI{describeCallsUntilActive: 2},
+			ExpectedCreate:     true,
+			ExpectedTTLUpdated: true,
+		},
+		{
+			Description: "Creation fails",
+			Config:      SchemaConfig{CreateTableIfMissing: true},
+			API:         &fakeTableAPI{createErr: errDynamoDB},
+			ExpectedErr: errDynamoDB,
+		},
+		{
+			Description: "Wrong key schema",
+			Config:      SchemaConfig{Verify: true},
+			API:         &fakeTableAPI{table: wrongKeys, ttl: enabledTTL()},
+			ExpectedErr: errSchemaMismatch,
+		},
+		{
+			Description: "Missing expires index",
+			Config:      SchemaConfig{CreateTableIfMissing: true},
+			API:         &fakeTableAPI{table: missingIndex, ttl: enabledTTL()},
+			ExpectedErr: errSchemaMismatch,
+		},
+		{
+			Description: "Wrong expires attribute type",
+			Config:      SchemaConfig{Verify: true},
+			API:         &fakeTableAPI{table: wrongIndexType, ttl: enabledTTL()},
+			ExpectedErr: errSchemaMismatch,
+		},
+		{
+			Description: "Index doesn't project data",
+			Config:      SchemaConfig{Verify: true},
+			API:         &fakeTableAPI{table: keysOnlyIndex, ttl: enabledTTL()},
+			ExpectedErr: errSchemaMismatch,
+		},
+		{
+			Description: "TTL disabled",
+			Config:      SchemaConfig{Verify: true},
+			API:         &fakeTableAPI{table: validTable()},
+			ExpectedErr: errSchemaMismatch,
+		},
+		{
+			Description: "TTL on another attribute",
+			Config:      SchemaConfig{CreateTableIfMissing: true},
+			API: &fakeTableAPI{table: validTable(), ttl: &awsv2dynamodbTypes.TimeToLiveDescription{
+				AttributeName:    aws.String("ttl"),
+				TimeToLiveStatus: awsv2dynamodbTypes.TimeToLiveStatusEnabled,
+			}},
+			ExpectedErr: errSchemaMismatch,
+		},
+		{
+			Description:        "TTL disabled is enabled",
+			Config:             SchemaConfig{CreateTableIfMissing: true},
+			API:                &fakeTableAPI{table: validTable()},
+			ExpectedTTLUpdated: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			tc.Config.Timeout = time.Second
+			m := &schemaManager{
+				api:          tc.API,
+				spec:         newTableSpec(Config{Table: defaultTable}),
+				config:       tc.Config,
+				pollInterval: time.Millisecond,
+			}
+
+			err := m.ensureSchema(context.Background())
+			if tc.ExpectedErr != nil {
+				require.Error(err)
+				assert.True(errors.Is(err, tc.ExpectedErr), "expected '%v' to match '%v'", err, tc.ExpectedErr)
+			} else {
+				assert.NoError(err)
+			}
+			assert.Equal(tc.ExpectedCreate, tc.API.created != nil)
+			assert.Equal(tc.ExpectedTTLUpdated, tc.API.ttlUpdated)
+		})
+	}
+}
+
+func TestCreateTableInput(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	api := &fakeTableAPI{}
+	m := &schemaManager{
+		api:  api,
+		spec: newTableSpec(Config{Table: defaultTable}),
+		config: SchemaConfig{
+			CreateTableIfMissing: true,
+			ReadCapacityUnits:    10,
+			WriteCapacityUnits:   5,
+			Timeout:              time.Second,
+		},
+		pollInterval: time.Millisecond,
+	}
+	require.NoError(m.ensureSchema(context.Background()))
+
+	input := api.created
+	require.NotNil(input)
+	assert.Equal(awsv2dynamodbTypes.BillingModeProvisioned, input.BillingMode)
+	assert.Equal(int64(10), aws.ToInt64(input.ProvisionedThroughput.ReadCapacityUnits))
+	assert.Equal(keySchema(bucketAttributeKey, idAttributeKey), input.KeySchema)
+	assert.Equal([]awsv2dynamodbTypes.AttributeDefinition{
+		{AttributeName: aws.String(bucketAttributeKey), AttributeType: awsv2dynamodbTypes.ScalarAttributeTypeS},
+		{AttributeName: aws.String(expirationAttributeKey), AttributeType: awsv2dynamodbTypes.ScalarAttributeTypeN},
+		{AttributeName: aws.String(idAttributeKey), AttributeType: awsv2dynamodbTypes.ScalarAttributeTypeS},
+	}, input.AttributeDefinitions)
+	require.Len(input.GlobalSecondaryIndexes, 1)
+	assert.Equal(expiresIndexName, aws.ToString(input.GlobalSecondaryIndexes[0].IndexName))
+	assert.Equal(int64(5), aws.ToInt64(input.GlobalSecondaryIndexes[0].ProvisionedThroughput.WriteCapacityUnits))
+}
+
+func TestCreateTableWithOwnerIndex(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	api := &fakeTableAPI{}
+	m := &schemaManager{
+		api:          api,
+		spec:         newTableSpec(Config{Table: defaultTable, OwnerIndex: true}),
+		config:       SchemaConfig{CreateTableIfMissing: true, Timeout: time.Second},
+		pollInterval: time.Millisecond,
+	}
+	require.NoError(m.ensureSchema(context.Background()))
+
+	input := api.created
+	require.NotNil(input)
+	require.Len(input.GlobalSecondaryIndexes, 2)
+	index := input.GlobalSecondaryIndexes[1]
+	assert.Equal(ownerIndexName, aws.ToString(index.IndexName))
+	assert.Equal(keySchema(bucketAttributeKey, ownerAttributeKey), index.KeySchema)
+	assert.Contains(input.AttributeDefinitions, awsv2dynamodbTypes.AttributeDefinition{
+		AttributeName: aws.String(ownerAttributeKey),
+		AttributeType: awsv2dynamodbTypes.ScalarAttributeTypeS,
+	})
+
+	// a table created before the index was enabled doesn't pass verification.
+	m = &schemaManager{
+		api:          &fakeTableAPI{table: validTable(), ttl: enabledTTL()},
+		spec:         newTableSpec(Config{Table: defaultTable, OwnerIndex: true}),
+		config:       SchemaConfig{Verify: true, Timeout: time.Second},
+		pollInterval: time.Millisecond,
+	}
+	assert.ErrorIs(m.ensureSchema(context.Background()), errSchemaMismatch)
+}
@@ -6,6 +6,7 @@ package dynamodb
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -19,24 +20,34 @@ import (
 )
 
 var (
-	errNilMeasures = errors.New("measures cannot be nil")
+	errNilMeasures    = errors.New("measures cannot be nil")
+	errTableNotActive = errors.New("table is not active")
 )
 
 // DynamoDBAPI defines the subset of the DynamoDB client used by executor, for mocking/testing.
 type DynamoDBAPI interface {
 	PutItem(ctx context.Context, params *awsv2dynamodb.PutItemInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.PutItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *awsv2dynamodb.TransactWriteItemsInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.TransactWriteItemsOutput, error)
+	UpdateItem(ctx context.Context, params *awsv2dynamodb.UpdateItemInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.UpdateItemOutput, error)
 	GetItem(ctx context.Context, params *awsv2dynamodb.GetItemInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.GetItemOutput, error)
 	DeleteItem(ctx context.Context, params *awsv2dynamodb.DeleteItemInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.DeleteItemOutput, error)
 	Query(ctx context.Context, params *awsv2dynamodb.QueryInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.QueryOutput, error)
+	DescribeTable(ctx context.Context, params *awsv2dynamodb.DescribeTableInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.DescribeTableOutput, error)
 }
 
 // service defines the dynamodb specific DAO interface. It helps keeping middleware
 // such as logging and instrumentation orthogonal to business logic.
 type service interface {
 	Push(key model.Key, item store.OwnableItem) (*awsv2dynamodbTypes.ConsumedCapacity, error)
+	PushIfAbsent(key model.Key, item store.OwnableItem) (*awsv2dynamodbTypes.ConsumedCapacity, error)
+	CompareAndSwap(key model.Key, old, item store.OwnableItem) (*awsv2dynamodbTypes.ConsumedCapacity, error)
+	Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, *awsv2dynamodbTypes.ConsumedCapacity, error)
+	Transact(ops []store.TransactionOp) (*awsv2dynamodbTypes.ConsumedCapacity, error)
 	Get(key model.Key) (store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error)
 	Delete(key model.Key) (store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error)
 	GetAll(bucket string) (map[string]store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error)
+	GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error)
+	Ping(ctx context.Context) error
 }
 
 // executor satisfies the service interface so dao can then adapt the outputs to match
@@ -55,35 +66,338 @@ type executor struct {
 	measures *metric.Measures
 }
 
+// storableItem is the layout of an item in the table. Owner is omitted when
+// empty as index key attributes can't hold empty strings.
 type storableItem struct {
 	Bucket  string                 `json:"bucket" dynamodbav:"bucket"`
 	ID      string                 `json:"id" dynamodbav:"id"`
-	Owner   string                 `json:"owner" dynamodbav:"owner"`
+	Owner   string                 `json:"owner" dynamodbav:"owner,omitempty"`
 	Expires *int64                 `json:"expires,omitempty" dynamodbav:"expires"`
 	Data    map[string]interface{} `json:"data" dynamodbav:"data"`
 	TTL     *int64                 `json:"ttl,omitempty" dynamodbav:"ttl"`
+
+	// LastModified is the time of the last write in Unix milliseconds.
+	LastModified *int64 `json:"lastModified,omitempty" dynamodbav:"lastModified,omitempty"`
+
+	// CreatedAt is the creation time of the item in Unix milliseconds.
+	CreatedAt *int64 `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	Version   int64  `json:"version,omitempty" dynamodbav:"version,omitempty"`
+
+	// ModifiedBy is the principal of the last writer, omitted when empty.
+	ModifiedBy string `json:"modifiedBy,omitempty" dynamodbav:"modifiedBy,omitempty"`
+}
+
+// ownableItem returns the stored item with its remaining TTL.
+func (s *storableItem) ownableItem() store.OwnableItem {
+	item := store.OwnableItem{
+		Owner: s.Owner,
+		Item: model.Item{
+			ID:   s.ID,
+			Data: s.Data,
+			TTL:  s.TTL,
+		},
+	}
+	if s.LastModified != nil {
+		item.LastModified = time.UnixMilli(*s.LastModified)
+	}
+	if s.CreatedAt != nil {
+		item.CreatedAt = time.UnixMilli(*s.CreatedAt)
+	}
+	item.Version = s.Version
+	item.ModifiedBy = s.ModifiedBy
+	return item
 }
 
 // Dynamo DB attribute keys
 const (
-	bucketAttributeKey     = "bucket"
-	idAttributeKey         = "id"
-	expirationAttributeKey = "expires"
+	bucketAttributeKey       = "bucket"
+	idAttributeKey           = "id"
+	expirationAttributeKey   = "expires"
+	ownerAttributeKey        = "owner"
+	dataAttributeKey         = "data"
+	lastModifiedAttributeKey = "lastModified"
+	versionAttributeKey      = "version"
+	modifiedByAttributeKey   = "modifiedBy"
 )
 
 func (d *executor) Push(key model.Key, item store.OwnableItem) (*awsv2dynamodbTypes.ConsumedCapacity, error) {
+	return d.put(key, item, nil)
+}
+
+// PushIfAbsent only writes the item when no item exists at key or when the
+// existing one expired but wasn't purged by DynamoDB yet.
+func (d *executor) PushIfAbsent(key model.Key, item store.OwnableItem) (*awsv2dynamodbTypes.ConsumedCapacity, error) {
+	return d.put(key, item, d.absentCondition())
+}
+
+// CompareAndSwap only writes the item when a live item with the owner and
+// data of old exists at key.
+func (d *executor) CompareAndSwap(key model.Key, old, item store.OwnableItem) (*awsv2dynamodbTypes.ConsumedCapacity, error) {
+	cond, err := d.unchangedCondition(old)
+	if err != nil {
+		return nil, err
+	}
+	return d.put(key, item, cond)
+}
+
+// Transact runs the operations as a single TransactWriteItems request. The
+// cancellation reasons tell which condition failed.
+func (d *executor) Transact(ops []store.TransactionOp) (*awsv2dynamodbTypes.ConsumedCapacity, error) {
+	items := make([]awsv2dynamodbTypes.TransactWriteItem, len(ops))
+	conds := make([]*putCondition, len(ops))
+	for i, op := range ops {
+		var err error
+		switch op.Condition {
+		case store.IfAbsent:
+			conds[i] = d.absentCondition()
+		case store.IfUnchanged:
+			conds[i], err = d.unchangedCondition(op.Expected)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Delete {
+			del := &awsv2dynamodbTypes.Delete{
+				TableName: &d.tableName,
+				Key:       d.itemKey(op.Key),
+			}
+			if cond := conds[i]; cond != nil {
+				del.ConditionExpression = aws.String(cond.expression)
+				del.ExpressionAttributeNames = cond.names
+				del.ExpressionAttributeValues = cond.values
+				del.ReturnValuesOnConditionCheckFailure = awsv2dynamodbTypes.ReturnValuesOnConditionCheckFailureAllOld
+			}
+			items[i].Delete = del
+			continue
+		}
+
+		av, err := d.marshalItem(op.Key, op.Item)
+		if err != nil {
+			return nil, err
+		}
+		put := &awsv2dynamodbTypes.Put{
+			TableName: &d.tableName,
+			Item:      av,
+		}
+		if cond := conds[i]; cond != nil {
+			put.ConditionExpression = aws.String(cond.expression)
+			put.ExpressionAttributeNames = cond.names
+			put.ExpressionAttributeValues = cond.values
+			put.ReturnValuesOnConditionCheckFailure = awsv2dynamodbTypes.ReturnValuesOnConditionCheckFailureAllOld
+		}
+		items[i].Put = put
+	}
+
+	result, err := d.c.TransactWriteItems(context.Background(), &awsv2dynamodb.TransactWriteItemsInput{
+		TransactItems:          items,
+		ReturnConsumedCapacity: awsv2dynamodbTypes.ReturnConsumedCapacityTotal,
+	})
+	var consumedCapacity *awsv2dynamodbTypes.ConsumedCapacity
+	if result != nil && len(result.ConsumedCapacity) > 0 {
+		consumedCapacity = &result.ConsumedCapacity[0]
+	}
+	if err != nil {
+		var canceledErr *awsv2dynamodbTypes.TransactionCanceledException
+		if errors.As(err, &canceledErr) {
+			for i, reason := range canceledErr.CancellationReasons {
+				if i < len(conds) && conds[i] != nil && aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+					return consumedCapacity, store.TransactionConditionError{Index: i, Err: fmt.Errorf("%w: %v", conds[i].failed(reason.Item), err)}
+				}
+			}
+		}
+		return consumedCapacity, err
+	}
+	return consumedCapacity, nil
+}
+
+// absentCondition holds when no item exists or the existing one expired.
+func (d *executor) absentCondition() *putCondition {
+	return &putCondition{
+		expression: "attribute_not_exists(#id) OR #expires <= :now",
+		names: map[string]string{
+			"#id":      idAttributeKey,
+			"#expires": expirationAttributeKey,
+		},
+		values: map[string]awsv2dynamodbTypes.AttributeValue{
+			":now": d.nowValue(),
+		},
+		failed: func(map[string]awsv2dynamodbTypes.AttributeValue) error {
+			return store.ErrItemExists
+		},
+	}
+}
+
+// unchangedCondition holds when a live item with the owner and data of old
+// exists. Items without owner don't store the attribute.
+func (d *executor) unchangedCondition(old store.OwnableItem) (*putCondition, error) {
+	data, err := awsv2attr.Marshal(old.Data)
+	if err != nil {
+		return nil, err
+	}
+	cond := &putCondition{
+		expression: "attribute_exists(#id) AND (attribute_type(#expires, :null) OR #expires > :now) AND #data = :data",
+		names: map[string]string{
+			"#id":      idAttributeKey,
+			"#expires": expirationAttributeKey,
+			"#data":    dataAttributeKey,
+			"#owner":   ownerAttributeKey,
+		},
+		values: map[string]awsv2dynamodbTypes.AttributeValue{
+			":now":  d.nowValue(),
+			":null": &awsv2dynamodbTypes.AttributeValueMemberS{Value: "NULL"},
+			":data": data,
+		},
+		failed: func(existing map[string]awsv2dynamodbTypes.AttributeValue) error {
+			if d.live(existing) {
+				return store.ErrItemChanged
+			}
+			return store.ErrItemNotFound
+		},
+	}
+	if old.Owner == "" {
+		cond.expression += " AND attribute_not_exists(#owner)"
+	} else {
+		cond.expression += " AND #owner = :owner"
+		cond.values[":owner"] = &awsv2dynamodbTypes.AttributeValueMemberS{Value: old.Owner}
+	}
+	return cond, nil
+}
+
+func (d *executor) itemKey(key model.Key) map[string]awsv2dynamodbTypes.AttributeValue {
+	return map[string]awsv2dynamodbTypes.AttributeValue{
+		bucketAttributeKey: &awsv2dynamodbTypes.AttributeValueMemberS{Value: key.Bucket},
+		idAttributeKey:     &awsv2dynamodbTypes.AttributeValueMemberS{Value: key.ID},
+	}
+}
+
+// Increment updates the field in place with a SET action adding the delta, as
+// ADD actions only apply to top level attributes while fields are nested in the
+// data attribute. DynamoDB rejects paths going through missing objects or
+// non numeric fields with a validation error.
+func (d *executor) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, *awsv2dynamodbTypes.ConsumedCapacity, error) {
+	names := map[string]string{
+		"#id":           idAttributeKey,
+		"#expires":      expirationAttributeKey,
+		"#data":         dataAttributeKey,
+		"#lastModified": lastModifiedAttributeKey,
+		"#version":      versionAttributeKey,
+		"#modifiedBy":   modifiedByAttributeKey,
+	}
+	fieldPath := "#data"
+	for i, field := range path {
+		name := fmt.Sprintf("#p%d", i)
+		names[name] = field
+		fieldPath += "." + name
+	}
+	input := &awsv2dynamodb.UpdateItemInput{
+		TableName:                &d.tableName,
+		Key:                      d.itemKey(key),
+		UpdateExpression:         aws.String(fmt.Sprintf("SET %s = if_not_exists(%s, :zero) + :delta, #lastModified = :lastModified, #version = if_not_exists(#version, :zero) + :one, #modifiedBy = :modifiedBy", fieldPath, fieldPath)),
+		ConditionExpression:      aws.String("attribute_exists(#id) AND (attribute_type(#expires, :null) OR #expires > :now)"),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]awsv2dynamodbTypes.AttributeValue{
+			":zero":         &awsv2dynamodbTypes.AttributeValueMemberN{Value: "0"},
+			":delta":        &awsv2dynamodbTypes.AttributeValueMemberN{Value: strconv.FormatFloat(delta, 'f', -1, 64)},
+			":one":          &awsv2dynamodbTypes.AttributeValueMemberN{Value: "1"},
+			":null":         &awsv2dynamodbTypes.AttributeValueMemberS{Value: "NULL"},
+			":now":          d.nowValue(),
+			":lastModified": &awsv2dynamodbTypes.AttributeValueMemberN{Value: strconv.FormatInt(d.now().UnixMilli(), 10)},
+			":modifiedBy":   &awsv2dynamodbTypes.AttributeValueMemberS{Value: modifiedBy},
+		},
+		ReturnValues:           awsv2dynamodbTypes.ReturnValueUpdatedNew,
+		ReturnConsumedCapacity: awsv2dynamodbTypes.ReturnConsumedCapacityTotal,
+	}
+	result, err := d.c.UpdateItem(context.Background(), input)
+	var consumedCapacity *awsv2dynamodbTypes.ConsumedCapacity
+	if result != nil {
+		consumedCapacity = result.ConsumedCapacity
+	}
+	if err != nil {
+		var conditionErr *awsv2dynamodbTypes.ConditionalCheckFailedException
+		if errors.As(err, &conditionErr) {
+			return 0, consumedCapacity, fmt.Errorf("%w: %v", store.ErrItemNotFound, err)
+		}
+		var codeErr interface{ ErrorCode() string }
+		if errors.As(err, &codeErr) && codeErr.ErrorCode() == "ValidationException" {
+			return 0, consumedCapacity, fmt.Errorf("%w: %v", store.ErrNotNumeric, err)
+		}
+		return 0, consumedCapacity, err
+	}
+
+	value, err := updatedNumber(result.Attributes, path)
+	return value, consumedCapacity, err
+}
+
+// updatedNumber reads the number at path in the data attribute returned by an update.
+func updatedNumber(attributes map[string]awsv2dynamodbTypes.AttributeValue, path []string) (float64, error) {
+	value := attributes[dataAttributeKey]
+	for _, field := range path {
+		m, ok := value.(*awsv2dynamodbTypes.AttributeValueMemberM)
+		if !ok {
+			return 0, fmt.Errorf("%w: updated field missing from the response", store.ErrJSONDecode)
+		}
+		value = m.Value[field]
+	}
+	n, ok := value.(*awsv2dynamodbTypes.AttributeValueMemberN)
+	if !ok {
+		return 0, fmt.Errorf("%w: updated field isn't a number", store.ErrJSONDecode)
+	}
+	return strconv.ParseFloat(n.Value, 64)
+}
+
+// putCondition guards a put. failed maps the item which failed the condition,
+// empty when there was none, to the error returned.
+type putCondition struct {
+	expression string
+	names      map[string]string
+	values     map[string]awsv2dynamodbTypes.AttributeValue
+	failed     func(existing map[string]awsv2dynamodbTypes.AttributeValue) error
+}
+
+func (d *executor) nowValue() awsv2dynamodbTypes.AttributeValue {
+	return &awsv2dynamodbTypes.AttributeValueMemberN{Value: strconv.FormatInt(d.now().Unix(), 10)}
+}
+
+// live returns true if the attributes hold an item which hasn't expired.
+func (d *executor) live(attributes map[string]awsv2dynamodbTypes.AttributeValue) bool {
+	if len(attributes) == 0 {
+		return false
+	}
+	expires, ok := attributes[expirationAttributeKey].(*awsv2dynamodbTypes.AttributeValueMemberN)
+	if !ok {
+		return true
+	}
+	seconds, err := strconv.ParseInt(expires.Value, 10, 64)
+	return err != nil || seconds > d.now().Unix()
+}
+
+func (d *executor) marshalItem(key model.Key, item store.OwnableItem) (map[string]awsv2dynamodbTypes.AttributeValue, error) {
+	lastModified := d.now().UnixMilli()
+	createdAt := lastModified
+	if !item.CreatedAt.IsZero() {
+		createdAt = item.CreatedAt.UnixMilli()
+	}
 	storingItem := storableItem{
-		Bucket: key.Bucket,
-		ID:     key.ID,
-		Owner:  item.Owner,
-		Data:   item.Data,
-		TTL:    item.TTL,
+		Bucket:       key.Bucket,
+		ID:           key.ID,
+		Owner:        item.Owner,
+		Data:         item.Data,
+		TTL:          item.TTL,
+		LastModified: &lastModified,
+		CreatedAt:    &createdAt,
+		Version:      item.Version,
+		ModifiedBy:   item.ModifiedBy,
 	}
 	if item.TTL != nil {
 		unixExpSeconds := time.Now().Unix() + *item.TTL
 		storingItem.Expires = &unixExpSeconds
 	}
-	av, err := awsv2attr.MarshalMap(storingItem)
+	return awsv2attr.MarshalMap(storingItem)
+}
+
+func (d *executor) put(key model.Key, item store.OwnableItem, cond *putCondition) (*awsv2dynamodbTypes.ConsumedCapacity, error) {
+	av, err := d.marshalItem(key, item)
 	if err != nil {
 		return nil, err
 	}
@@ -92,12 +406,22 @@ func (d *executor) Push(key model.Key, item store.OwnableItem) (*awsv2dynamodbTy
 		TableName:              &d.tableName,
 		ReturnConsumedCapacity: awsv2dynamodbTypes.ReturnConsumedCapacityTotal,
 	}
+	if cond != nil {
+		input.ConditionExpression = aws.String(cond.expression)
+		input.ExpressionAttributeNames = cond.names
+		input.ExpressionAttributeValues = cond.values
+		input.ReturnValuesOnConditionCheckFailure = awsv2dynamodbTypes.ReturnValuesOnConditionCheckFailureAllOld
+	}
 	result, err := d.c.PutItem(context.Background(), input)
 	var consumedCapacity *awsv2dynamodbTypes.ConsumedCapacity
 	if result != nil {
 		consumedCapacity = result.ConsumedCapacity
 	}
 	if err != nil {
+		var conditionErr *awsv2dynamodbTypes.ConditionalCheckFailedException
+		if cond != nil && errors.As(err, &conditionErr) {
+			return consumedCapacity, fmt.Errorf("%w: %v", cond.failed(conditionErr.Item), err)
+		}
 		return consumedCapacity, err
 	}
 	return consumedCapacity, nil
@@ -159,14 +483,7 @@ func (d *executor) getOrDelete(key model.Key, delete bool) (store.OwnableItem, *
 		}
 		item.TTL = &remainingTTLSeconds
 	}
-	return store.OwnableItem{
-		Owner: item.Owner,
-		Item: model.Item{
-			ID:   item.ID,
-			Data: item.Data,
-			TTL:  item.TTL,
-		},
-	}, consumedCapacity, nil
+	return item.ownableItem(), consumedCapacity, nil
 }
 
 func (d *executor) Get(key model.Key) (store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error) {
@@ -178,11 +495,10 @@ func (d *executor) Delete(key model.Key) (store.OwnableItem, *awsv2dynamodbTypes
 }
 
 func (d *executor) GetAll(bucket string) (map[string]store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error) {
-	result := map[string]store.OwnableItem{}
 	now := strconv.FormatInt(d.now().Unix(), 10)
 	input := &awsv2dynamodb.QueryInput{
 		TableName: &d.tableName,
-		IndexName: aws.String("Expires-index"),
+		IndexName: aws.String(expiresIndexName),
 		KeyConditions: map[string]awsv2dynamodbTypes.Condition{
 			"bucket": {
 				ComparisonOperator: awsv2dynamodbTypes.ComparisonOperatorEq,
@@ -199,6 +515,45 @@ func (d *executor) GetAll(bucket string) (map[string]store.OwnableItem, *awsv2dy
 		},
 		ReturnConsumedCapacity: awsv2dynamodbTypes.ReturnConsumedCapacityTotal,
 	}
+	return d.queryItems(input)
+}
+
+// GetAllByOwner queries the bucket-owner index so only the items of the owner
+// are read. Expired items not yet purged are filtered out by DynamoDB.
+func (d *executor) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error) {
+	now := strconv.FormatInt(d.now().Unix(), 10)
+	input := &awsv2dynamodb.QueryInput{
+		TableName: &d.tableName,
+		IndexName: aws.String(ownerIndexName),
+		KeyConditions: map[string]awsv2dynamodbTypes.Condition{
+			bucketAttributeKey: {
+				ComparisonOperator: awsv2dynamodbTypes.ComparisonOperatorEq,
+				AttributeValueList: []awsv2dynamodbTypes.AttributeValue{
+					&awsv2dynamodbTypes.AttributeValueMemberS{Value: bucket},
+				},
+			},
+			ownerAttributeKey: {
+				ComparisonOperator: awsv2dynamodbTypes.ComparisonOperatorEq,
+				AttributeValueList: []awsv2dynamodbTypes.AttributeValue{
+					&awsv2dynamodbTypes.AttributeValueMemberS{Value: owner},
+				},
+			},
+		},
+		QueryFilter: map[string]awsv2dynamodbTypes.Condition{
+			expirationAttributeKey: {
+				ComparisonOperator: awsv2dynamodbTypes.ComparisonOperatorGt,
+				AttributeValueList: []awsv2dynamodbTypes.AttributeValue{
+					&awsv2dynamodbTypes.AttributeValueMemberN{Value: now},
+				},
+			},
+		},
+		ReturnConsumedCapacity: awsv2dynamodbTypes.ReturnConsumedCapacityTotal,
+	}
+	return d.queryItems(input)
+}
+
+func (d *executor) queryItems(input *awsv2dynamodb.QueryInput) (map[string]store.OwnableItem, *awsv2dynamodbTypes.ConsumedCapacity, error) {
+	result := map[string]store.OwnableItem{}
 	if d.getAllLimit > 0 {
 		input.Limit = &d.getAllLimit
 	}
@@ -228,18 +583,30 @@ func (d *executor) GetAll(bucket string) (map[string]store.OwnableItem, *awsv2dy
 			}
 			item.TTL = &remainingTTLSeconds
 		}
-		result[item.ID] = store.OwnableItem{
-			Owner: item.Owner,
-			Item: model.Item{
-				ID:   item.ID,
-				Data: item.Data,
-				TTL:  item.TTL,
-			},
-		}
+		result[item.ID] = item.ownableItem()
 	}
 	return result, consumedCapacity, nil
 }
 
+// Ping verifies the table can be described and is usable.
+func (d *executor) Ping(ctx context.Context) error {
+	output, err := d.c.DescribeTable(ctx, &awsv2dynamodb.DescribeTableInput{
+		TableName: &d.tableName,
+	})
+	if err != nil {
+		return err
+	}
+	if output.Table == nil {
+		return fmt.Errorf("%w: %s", errTableNotActive, d.tableName)
+	}
+	switch output.Table.TableStatus {
+	case awsv2dynamodbTypes.TableStatusActive, awsv2dynamodbTypes.TableStatusUpdating:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s is %s", errTableNotActive, d.tableName, output.Table.TableStatus)
+	}
+}
+
 func itemNotFound(item *storableItem) bool {
 	return item.Bucket == "" || item.ID == ""
 }
@@ -257,16 +624,12 @@ func newServiceWithClient(client DynamoDBAPI, tableName string, getAllLimit int3
 	}, nil
 }
 
-func newService(awsCfg aws.Config, config Config, getAllLimit int32, measures *metric.Measures) (service, error) {
-	if measures == nil {
-		return nil, errNilMeasures
-	}
-
-	client := awsv2dynamodb.NewFromConfig(awsCfg, func(o *awsv2dynamodb.Options) {
+func newClient(awsCfg aws.Config, config Config) *awsv2dynamodb.Client {
+	return awsv2dynamodb.NewFromConfig(awsCfg, func(o *awsv2dynamodb.Options) {
 		if config.Endpoint != "" {
 			o.BaseEndpoint = &config.Endpoint
 		}
+		// the sdk counts the first attempt as well.
+		o.RetryMaxAttempts = config.MaxRetries + 1
 	})
-
-	return newServiceWithClient(client, config.Table, getAllLimit, measures)
 }
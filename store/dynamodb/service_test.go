@@ -3,6 +3,7 @@
 package dynamodb
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"testing"
@@ -16,6 +17,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/argus/model"
 	"github.com/xmidt-org/argus/store"
 	"github.com/xmidt-org/argus/store/db/metric"
@@ -500,3 +502,417 @@ func getGetItemOutputExpired(nowRef time.Time, consumedCapacity *awsv2dynamodbTy
 		ConsumedCapacity: consumedCapacity,
 	}
 }
+
+func TestPing(t *testing.T) {
+	tcs := []struct {
+		Description      string
+		Output           *awsv2dynamodb.DescribeTableOutput
+		DescribeTableErr error
+		ExpectedErr      error
+	}{
+		{
+			Description:      "DescribeTable fails",
+			DescribeTableErr: errDynamoDB,
+			ExpectedErr:      errDynamoDB,
+		},
+		{
+			Description: "Table being created",
+			Output: &awsv2dynamodb.DescribeTableOutput{
+				Table: &awsv2dynamodbTypes.TableDescription{TableStatus: awsv2dynamodbTypes.TableStatusCreating},
+			},
+			ExpectedErr: errTableNotActive,
+		},
+		{
+			Description: "Table active",
+			Output: &awsv2dynamodb.DescribeTableOutput{
+				Table: &awsv2dynamodbTypes.TableDescription{TableStatus: awsv2dynamodbTypes.TableStatusActive},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			m := new(mockClient)
+			sv, err := newServiceWithClient(m, "testTable", 0, &metric.Measures{})
+			assert.NoError(err)
+			m.On("DescribeTable", mock.Anything, mock.Anything, mock.Anything).Return(tc.Output, tc.DescribeTableErr)
+
+			err = sv.Ping(context.Background())
+			assert.True(errors.Is(err, tc.ExpectedErr), "expected '%v' to match '%v'", err, tc.ExpectedErr)
+			if tc.ExpectedErr == nil {
+				assert.NoError(err)
+			}
+			m.AssertExpectations(t)
+		})
+	}
+}
+
+// queryCaptureClient records the input of the queries it runs.
+type queryCaptureClient struct {
+	*mockClient
+	input *awsv2dynamodb.QueryInput
+}
+
+func (c *queryCaptureClient) Query(ctx context.Context, params *awsv2dynamodb.QueryInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.QueryOutput, error) {
+	c.input = params
+	return c.mockClient.Query(ctx, params, optFns...)
+}
+
+func TestGetAllByOwner(t *testing.T) {
+	assert := assert.New(t)
+	client := &queryCaptureClient{mockClient: new(mockClient)}
+	measures := &metric.Measures{
+		DynamodbGetAllGauge: prometheus.NewGauge(prometheus.GaugeOpts{Name: "testGetAllGauge"}),
+	}
+	svc, err := newServiceWithClient(client, "testTable", 0, measures)
+	assert.NoError(err)
+	svc.(*executor).now = func() time.Time { return nowRef }
+
+	expires := strconv.FormatInt(nowRef.Add(time.Minute).Unix(), 10)
+	lastModified := nowRef.Add(-time.Minute).UnixMilli()
+	client.On("Query", mock.Anything, mock.Anything, mock.Anything).Return(&awsv2dynamodb.QueryOutput{
+		ConsumedCapacity: consumedCapacity,
+		Items: []map[string]awsv2dynamodbTypes.AttributeValue{
+			{
+				bucketAttributeKey:       &awsv2dynamodbTypes.AttributeValueMemberS{Value: "testBucket"},
+				idAttributeKey:           &awsv2dynamodbTypes.AttributeValueMemberS{Value: "a"},
+				ownerAttributeKey:        &awsv2dynamodbTypes.AttributeValueMemberS{Value: "xmidt"},
+				expirationAttributeKey:   &awsv2dynamodbTypes.AttributeValueMemberN{Value: expires},
+				lastModifiedAttributeKey: &awsv2dynamodbTypes.AttributeValueMemberN{Value: strconv.FormatInt(lastModified, 10)},
+				modifiedByAttributeKey:   &awsv2dynamodbTypes.AttributeValueMemberS{Value: "writer"},
+			},
+		},
+	}, nil)
+
+	items, cc, err := svc.GetAllByOwner("testBucket", "xmidt")
+	assert.NoError(err)
+	assert.Equal(consumedCapacity, cc)
+	assert.Equal(map[string]store.OwnableItem{
+		"a": {Owner: "xmidt", Item: model.Item{ID: "a", TTL: aws.Int64(60)}, LastModified: time.UnixMilli(lastModified), ModifiedBy: "writer"},
+	}, items)
+
+	if assert.NotNil(client.input) {
+		assert.Equal(ownerIndexName, aws.ToString(client.input.IndexName))
+		assert.Equal(&awsv2dynamodbTypes.AttributeValueMemberS{Value: "xmidt"},
+			client.input.KeyConditions[ownerAttributeKey].AttributeValueList[0])
+		assert.Equal(&awsv2dynamodbTypes.AttributeValueMemberN{Value: strconv.FormatInt(nowRef.Unix(), 10)},
+			client.input.QueryFilter[expirationAttributeKey].AttributeValueList[0])
+	}
+}
+
+// putCaptureClient records the input of the puts it runs.
+type putCaptureClient struct {
+	*mockClient
+	input *awsv2dynamodb.PutItemInput
+}
+
+func (c *putCaptureClient) PutItem(ctx context.Context, params *awsv2dynamodb.PutItemInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.PutItemOutput, error) {
+	c.input = params
+	return c.mockClient.PutItem(ctx, params, optFns...)
+}
+
+func TestPushIfAbsent(t *testing.T) {
+	tcs := []struct {
+		Description   string
+		PutItemErr    error
+		ExpectedError error
+	}{
+		{
+			Description: "Created",
+		},
+		{
+			Description:   "Item exists",
+			PutItemErr:    &awsv2dynamodbTypes.ConditionalCheckFailedException{},
+			ExpectedError: store.ErrItemExists,
+		},
+		{
+			Description:   "PutItem fails",
+			PutItemErr:    errDynamoDB,
+			ExpectedError: errDynamoDB,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			client := &putCaptureClient{mockClient: new(mockClient)}
+			measures := &metric.Measures{
+				DynamodbGetAllGauge: prometheus.NewGauge(prometheus.GaugeOpts{Name: "testGetAllGauge"}),
+			}
+			svc, err := newServiceWithClient(client, "testTable", 0, measures)
+			assert.NoError(err)
+			svc.(*executor).now = func() time.Time { return nowRef }
+			client.On("PutItem", mock.Anything, mock.Anything, mock.Anything).Return(&awsv2dynamodb.PutItemOutput{ConsumedCapacity: consumedCapacity}, tc.PutItemErr)
+
+			cc, err := svc.PushIfAbsent(key, store.OwnableItem{Owner: "xmidt", Item: model.Item{ID: key.ID}})
+			assert.Equal(consumedCapacity, cc)
+			assert.ErrorIs(err, tc.ExpectedError)
+			if tc.ExpectedError == nil {
+				assert.NoError(err)
+			}
+			if assert.NotNil(client.input) {
+				assert.Equal("attribute_not_exists(#id) OR #expires <= :now", aws.ToString(client.input.ConditionExpression))
+				assert.Equal(&awsv2dynamodbTypes.AttributeValueMemberN{Value: strconv.FormatInt(nowRef.Unix(), 10)},
+					client.input.ExpressionAttributeValues[":now"])
+			}
+		})
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	liveItem := map[string]awsv2dynamodbTypes.AttributeValue{
+		idAttributeKey:         &awsv2dynamodbTypes.AttributeValueMemberS{Value: key.ID},
+		expirationAttributeKey: &awsv2dynamodbTypes.AttributeValueMemberN{Value: strconv.FormatInt(nowRef.Unix()+60, 10)},
+	}
+	expiredItem := map[string]awsv2dynamodbTypes.AttributeValue{
+		idAttributeKey:         &awsv2dynamodbTypes.AttributeValueMemberS{Value: key.ID},
+		expirationAttributeKey: &awsv2dynamodbTypes.AttributeValueMemberN{Value: strconv.FormatInt(nowRef.Unix(), 10)},
+	}
+	tcs := []struct {
+		Description        string
+		OldOwner           string
+		PutItemErr         error
+		ExpectedExpression string
+		ExpectedError      error
+	}{
+		{
+			Description:        "Swapped",
+			OldOwner:           "xmidt",
+			ExpectedExpression: "attribute_exists(#id) AND (attribute_type(#expires, :null) OR #expires > :now) AND #data = :data AND #owner = :owner",
+		},
+		{
+			Description:        "Swapped without owner",
+			ExpectedExpression: "attribute_exists(#id) AND (attribute_type(#expires, :null) OR #expires > :now) AND #data = :data AND attribute_not_exists(#owner)",
+		},
+		{
+			Description:        "Item changed",
+			OldOwner:           "xmidt",
+			PutItemErr:         &awsv2dynamodbTypes.ConditionalCheckFailedException{Item: liveItem},
+			ExpectedExpression: "attribute_exists(#id) AND (attribute_type(#expires, :null) OR #expires > :now) AND #data = :data AND #owner = :owner",
+			ExpectedError:      store.ErrItemChanged,
+		},
+		{
+			Description:        "Item expired",
+			OldOwner:           "xmidt",
+			PutItemErr:         &awsv2dynamodbTypes.ConditionalCheckFailedException{Item: expiredItem},
+			ExpectedExpression: "attribute_exists(#id) AND (attribute_type(#expires, :null) OR #expires > :now) AND #data = :data AND #owner = :owner",
+			ExpectedError:      store.ErrItemNotFound,
+		},
+		{
+			Description:        "Item missing",
+			OldOwner:           "xmidt",
+			PutItemErr:         &awsv2dynamodbTypes.ConditionalCheckFailedException{},
+			ExpectedExpression: "attribute_exists(#id) AND (attribute_type(#expires, :null) OR #expires > :now) AND #data = :data AND #owner = :owner",
+			ExpectedError:      store.ErrItemNotFound,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			client := &putCaptureClient{mockClient: new(mockClient)}
+			measures := &metric.Measures{
+				DynamodbGetAllGauge: prometheus.NewGauge(prometheus.GaugeOpts{Name: "testGetAllGauge"}),
+			}
+			svc, err := newServiceWithClient(client, "testTable", 0, measures)
+			assert.NoError(err)
+			svc.(*executor).now = func() time.Time { return nowRef }
+			client.On("PutItem", mock.Anything, mock.Anything, mock.Anything).Return(&awsv2dynamodb.PutItemOutput{ConsumedCapacity: consumedCapacity}, tc.PutItemErr)
+
+			old := store.OwnableItem{Owner: tc.OldOwner, Item: model.Item{ID: key.ID, Data: map[string]interface{}{"k": "v"}}}
+			cc, err := svc.CompareAndSwap(key, old, store.OwnableItem{Owner: "xmidt", Item: model.Item{ID: key.ID}})
+			assert.Equal(consumedCapacity, cc)
+			if tc.ExpectedError != nil {
+				assert.ErrorIs(err, tc.ExpectedError)
+			} else {
+				assert.NoError(err)
+			}
+			if assert.NotNil(client.input) {
+				assert.Equal(tc.ExpectedExpression, aws.ToString(client.input.ConditionExpression))
+				assert.Equal(&awsv2dynamodbTypes.AttributeValueMemberM{Value: map[string]awsv2dynamodbTypes.AttributeValue{
+					"k": &awsv2dynamodbTypes.AttributeValueMemberS{Value: "v"},
+				}}, client.input.ExpressionAttributeValues[":data"])
+				assert.Equal(awsv2dynamodbTypes.ReturnValuesOnConditionCheckFailureAllOld, client.input.ReturnValuesOnConditionCheckFailure)
+			}
+		})
+	}
+}
+
+// updateCaptureClient records the input of the updates it runs.
+type updateCaptureClient struct {
+	*mockClient
+	input *awsv2dynamodb.UpdateItemInput
+}
+
+func (c *updateCaptureClient) UpdateItem(ctx context.Context, params *awsv2dynamodb.UpdateItemInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.UpdateItemOutput, error) {
+	c.input = params
+	return c.mockClient.UpdateItem(ctx, params, optFns...)
+}
+
+func TestIncrement(t *testing.T) {
+	updated := map[string]awsv2dynamodbTypes.AttributeValue{
+		"data": &awsv2dynamodbTypes.AttributeValueMemberM{Value: map[string]awsv2dynamodbTypes.AttributeValue{
+			"counters": &awsv2dynamodbTypes.AttributeValueMemberM{Value: map[string]awsv2dynamodbTypes.AttributeValue{
+				"requests": &awsv2dynamodbTypes.AttributeValueMemberN{Value: "42"},
+			}},
+		}},
+	}
+	tcs := []struct {
+		Description   string
+		Attributes    map[string]awsv2dynamodbTypes.AttributeValue
+		UpdateItemErr error
+		ExpectedValue float64
+		ExpectedError error
+	}{
+		{
+			Description:   "Incremented",
+			Attributes:    updated,
+			ExpectedValue: 42,
+		},
+		{
+			Description:   "Item missing",
+			UpdateItemErr: &awsv2dynamodbTypes.ConditionalCheckFailedException{},
+			ExpectedError: store.ErrItemNotFound,
+		},
+		{
+			Description:   "Invalid path",
+			UpdateItemErr: smithyValidationError{errDynamoDB},
+			ExpectedError: store.ErrNotNumeric,
+		},
+		{
+			Description:   "UpdateItem fails",
+			UpdateItemErr: errDynamoDB,
+			ExpectedError: errDynamoDB,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			client := &updateCaptureClient{mockClient: new(mockClient)}
+			measures := &metric.Measures{
+				DynamodbGetAllGauge: prometheus.NewGauge(prometheus.GaugeOpts{Name: "testGetAllGauge"}),
+			}
+			svc, err := newServiceWithClient(client, "testTable", 0, measures)
+			assert.NoError(err)
+			svc.(*executor).now = func() time.Time { return nowRef }
+			client.On("UpdateItem", mock.Anything, mock.Anything, mock.Anything).Return(&awsv2dynamodb.UpdateItemOutput{
+				Attributes:       tc.Attributes,
+				ConsumedCapacity: consumedCapacity,
+			}, tc.UpdateItemErr)
+
+			value, cc, err := svc.Increment(key, []string{"counters", "requests"}, 1.5, "writer")
+			assert.Equal(consumedCapacity, cc)
+			assert.Equal(tc.ExpectedValue, value)
+			if tc.ExpectedError != nil {
+				assert.ErrorIs(err, tc.ExpectedError)
+			} else {
+				assert.NoError(err)
+			}
+			if assert.NotNil(client.input) {
+				assert.Equal("SET #data.#p0.#p1 = if_not_exists(#data.#p0.#p1, :zero) + :delta, #lastModified = :lastModified, #version = if_not_exists(#version, :zero) + :one, #modifiedBy = :modifiedBy", aws.ToString(client.input.UpdateExpression))
+				assert.Equal(&awsv2dynamodbTypes.AttributeValueMemberN{Value: strconv.FormatInt(nowRef.UnixMilli(), 10)}, client.input.ExpressionAttributeValues[":lastModified"])
+				assert.Equal(&awsv2dynamodbTypes.AttributeValueMemberS{Value: "writer"}, client.input.ExpressionAttributeValues[":modifiedBy"])
+				assert.Equal("counters", client.input.ExpressionAttributeNames["#p0"])
+				assert.Equal("requests", client.input.ExpressionAttributeNames["#p1"])
+				assert.Equal(&awsv2dynamodbTypes.AttributeValueMemberN{Value: "1.5"}, client.input.ExpressionAttributeValues[":delta"])
+			}
+		})
+	}
+}
+
+// transactCaptureClient records the input of the transactions it runs.
+type transactCaptureClient struct {
+	*mockClient
+	input *awsv2dynamodb.TransactWriteItemsInput
+}
+
+func (c *transactCaptureClient) TransactWriteItems(ctx context.Context, params *awsv2dynamodb.TransactWriteItemsInput, optFns ...func(*awsv2dynamodb.Options)) (*awsv2dynamodb.TransactWriteItemsOutput, error) {
+	c.input = params
+	return c.mockClient.TransactWriteItems(ctx, params, optFns...)
+}
+
+func TestTransact(t *testing.T) {
+	secretKey := model.Key{Bucket: "secrets", ID: "secret"}
+	ops := []store.TransactionOp{
+		{Key: key, Item: store.OwnableItem{Owner: "xmidt", Item: model.Item{ID: key.ID}}, Condition: store.IfAbsent},
+		{Key: secretKey, Delete: true, Condition: store.IfUnchanged, Expected: store.OwnableItem{Owner: "xmidt"}},
+	}
+	canceled := func(codes ...string) error {
+		reasons := make([]awsv2dynamodbTypes.CancellationReason, len(codes))
+		for i, code := range codes {
+			reasons[i].Code = aws.String(code)
+		}
+		return &awsv2dynamodbTypes.TransactionCanceledException{CancellationReasons: reasons}
+	}
+	tcs := []struct {
+		Description   string
+		TransactErr   error
+		ExpectedIndex int
+		ExpectedError error
+	}{
+		{
+			Description: "Applied",
+		},
+		{
+			Description:   "Item exists",
+			TransactErr:   canceled("ConditionalCheckFailed", "None"),
+			ExpectedIndex: 0,
+			ExpectedError: store.ErrItemExists,
+		},
+		{
+			Description:   "Item missing",
+			TransactErr:   canceled("None", "ConditionalCheckFailed"),
+			ExpectedIndex: 1,
+			ExpectedError: store.ErrItemNotFound,
+		},
+		{
+			Description:   "Conflict",
+			TransactErr:   canceled("TransactionConflict", "None"),
+			ExpectedIndex: -1,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			client := &transactCaptureClient{mockClient: new(mockClient)}
+			measures := &metric.Measures{
+				DynamodbGetAllGauge: prometheus.NewGauge(prometheus.GaugeOpts{Name: "testGetAllGauge"}),
+			}
+			svc, err := newServiceWithClient(client, "testTable", 0, measures)
+			require.NoError(err)
+			svc.(*executor).now = func() time.Time { return nowRef }
+			client.On("TransactWriteItems", mock.Anything, mock.Anything, mock.Anything).Return(&awsv2dynamodb.TransactWriteItemsOutput{
+				ConsumedCapacity: []awsv2dynamodbTypes.ConsumedCapacity{*consumedCapacity},
+			}, tc.TransactErr)
+
+			cc, err := svc.Transact(ops)
+			assert.Equal(consumedCapacity, cc)
+			var conditionErr store.TransactionConditionError
+			switch {
+			case tc.ExpectedIndex < 0:
+				assert.Error(err)
+				assert.False(errors.As(err, &conditionErr))
+			case tc.ExpectedError != nil:
+				require.ErrorAs(err, &conditionErr)
+				assert.Equal(tc.ExpectedIndex, conditionErr.Index)
+				assert.ErrorIs(err, tc.ExpectedError)
+			default:
+				assert.NoError(err)
+			}
+
+			require.NotNil(client.input)
+			require.Len(client.input.TransactItems, 2)
+			put, del := client.input.TransactItems[0].Put, client.input.TransactItems[1].Delete
+			require.NotNil(put)
+			require.NotNil(del)
+			assert.Equal("attribute_not_exists(#id) OR #expires <= :now", aws.ToString(put.ConditionExpression))
+			assert.Equal("attribute_exists(#id) AND (attribute_type(#expires, :null) OR #expires > :now) AND #data = :data AND #owner = :owner",
+				aws.ToString(del.ConditionExpression))
+			assert.Equal(&awsv2dynamodbTypes.AttributeValueMemberS{Value: "secrets"}, del.Key[bucketAttributeKey])
+		})
+	}
+}
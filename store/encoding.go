@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/ugorji/go/codec"
+)
+
+// Media types items can be encoded with. JSON is the default one.
+const (
+	JSONContentType    = "application/json"
+	CBORContentType    = "application/cbor"
+	MsgpackContentType = "application/msgpack"
+)
+
+// binaryHandles holds the codecs of the binary media types, aliases included.
+var binaryHandles = newBinaryHandles()
+
+func newBinaryHandles() map[string]codec.Handle {
+	mapType := reflect.TypeOf(map[string]interface{}(nil))
+
+	cbor := new(codec.CborHandle)
+	cbor.MapType = mapType
+	cbor.SkipUnexpectedTags = true
+
+	msgpack := new(codec.MsgpackHandle)
+	msgpack.MapType = mapType
+	msgpack.RawToString = true
+	msgpack.WriteExt = true
+
+	return map[string]codec.Handle{
+		CBORContentType:           cbor,
+		MsgpackContentType:        msgpack,
+		"application/x-msgpack":   msgpack,
+		"application/vnd.msgpack": msgpack,
+	}
+}
+
+// parseMediaType returns the lowercase media type of a Content-Type or Accept
+// entry, without its parameters.
+func parseMediaType(value string) string {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(value, ";")[0]))
+	}
+	return mediaType
+}
+
+// decodeBody returns the body of r as JSON, transcoding it when its Content-Type
+// is a binary media type so it goes through the same validation as JSON
+// bodies. Other content types are read as JSON, as they always were.
+func decodeBody(r *http.Request, data []byte) ([]byte, error) {
+	h, ok := binaryHandles[parseMediaType(r.Header.Get("Content-Type"))]
+	if !ok {
+		return data, nil
+	}
+	var v interface{}
+	if err := codec.NewDecoderBytes(data, h).Decode(&v); err != nil {
+		return nil, fmt.Errorf("%w: %v", errPayloadUnmarshalFailure, err)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errPayloadUnmarshalFailure, err)
+	}
+	return data, nil
+}
+
+// negotiateContentType returns the media type of a response from the value of
+// the Accept header of its request, JSON unless a binary media type is
+// preferred.
+func negotiateContentType(accept string) string {
+	type candidate struct {
+		mediaType string
+		quality   float64
+	}
+	var candidates []candidate
+	for _, entry := range strings.Split(accept, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		c := candidate{mediaType: parseMediaType(entry), quality: 1}
+		if _, params, err := mime.ParseMediaType(entry); err == nil {
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+				c.quality = q
+			}
+		}
+		candidates = append(candidates, c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+	for _, c := range candidates {
+		if c.quality <= 0 {
+			continue
+		}
+		if c.mediaType == JSONContentType {
+			return JSONContentType
+		}
+		if _, ok := binaryHandles[c.mediaType]; ok {
+			return c.mediaType
+		}
+	}
+	return JSONContentType
+}
+
+// writeResponse writes v, encoded with the media type negotiated through the
+// Accept header saved in ctx by kithttp.PopulateRequestContext. Binary
+// encodings are transcoded from the JSON one so they hold the same fields.
+func writeResponse(ctx context.Context, rw http.ResponseWriter, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	accept, _ := ctx.Value(kithttp.ContextKeyRequestAccept).(string)
+	contentType := negotiateContentType(accept)
+	if h, ok := binaryHandles[contentType]; ok {
+		if data, err = transcodeJSON(data, h); err != nil {
+			return err
+		}
+	}
+
+	rw.Header().Add("Content-Type", contentType)
+	setVary(rw)
+	rw.Write(data)
+	return nil
+}
+
+// setVary lists the request headers negotiated responses depend on in their
+// Vary header: Accept for their media type and Accept-Encoding for their
+// compression. It replaces the Vary header of the compression middleware
+// rather than repeating Accept-Encoding.
+func setVary(rw http.ResponseWriter) {
+	rw.Header().Set("Vary", "Accept, Accept-Encoding")
+}
+
+func transcodeJSON(data []byte, h codec.Handle) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	var encoded []byte
+	if err := codec.NewEncoderBytes(&encoded, h).Encode(convertNumbers(v)); err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
+
+// convertNumbers replaces the JSON numbers of v with integers when they're
+// integral, floats otherwise, for the binary encodings to use the most compact
+// representation.
+func convertNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = convertNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = convertNumbers(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+	"github.com/xmidt-org/argus/model"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	tcs := []struct {
+		Description string
+		Accept      string
+		Expected    string
+	}{
+		{Description: "Missing", Expected: JSONContentType},
+		{Description: "Any", Accept: "*/*", Expected: JSONContentType},
+		{Description: "Unsupported", Accept: "text/html", Expected: JSONContentType},
+		{Description: "CBOR", Accept: "application/cbor", Expected: CBORContentType},
+		{Description: "Msgpack alias", Accept: "application/x-msgpack", Expected: "application/x-msgpack"},
+		{Description: "First supported", Accept: "text/html, application/msgpack, application/json", Expected: MsgpackContentType},
+		{Description: "Quality", Accept: "application/json;q=0.5, application/cbor", Expected: CBORContentType},
+		{Description: "Refused", Accept: "application/cbor;q=0", Expected: JSONContentType},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert.Equal(t, tc.Expected, negotiateContentType(tc.Accept))
+		})
+	}
+}
+
+func encodeBinary(t *testing.T, contentType string, v interface{}) []byte {
+	var data []byte
+	require.NoError(t, codec.NewEncoderBytes(&data, binaryHandles[contentType]).Encode(v))
+	return data
+}
+
+func TestSetItemRequestDecoderBinary(t *testing.T) {
+	const id = "4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b"
+	item := map[string]interface{}{
+		"id":   id,
+		"data": map[string]interface{}{"name": "argus", "count": 3, "ratio": 0.5, "tags": []interface{}{"a"}},
+		"ttl":  60,
+	}
+	tcs := []struct {
+		Description string
+		ContentType string
+		Body        []byte
+		ExpectedErr error
+	}{
+		{
+			Description: "CBOR",
+			ContentType: CBORContentType,
+			Body:        encodeBinary(t, CBORContentType, item),
+		},
+		{
+			Description: "Msgpack",
+			ContentType: MsgpackContentType + "; charset=binary",
+			Body:        encodeBinary(t, MsgpackContentType, item),
+		},
+		{
+			Description: "Validation rules apply",
+			ContentType: CBORContentType,
+			Body:        encodeBinary(t, CBORContentType, map[string]interface{}{"id": id}),
+			ExpectedErr: errDataFieldMissing,
+		},
+		{
+			Description: "Malformed body",
+			ContentType: MsgpackContentType,
+			Body:        []byte{0xc1},
+			ExpectedErr: errPayloadUnmarshalFailure,
+		},
+	}
+
+	decoder := setItemRequestDecoder(getTestTransportConfig())
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			r := httptest.NewRequest(http.MethodPut, "http://localhost", bytes.NewReader(tc.Body))
+			r = mux.SetURLVars(r, map[string]string{bucketVarKey: "variables", idVarKey: id})
+			r.Header.Set("Content-Type", tc.ContentType)
+
+			request, err := decoder(context.Background(), r)
+			assert.ErrorIs(err, tc.ExpectedErr)
+			if tc.ExpectedErr != nil {
+				return
+			}
+			assert.Equal(map[string]interface{}{
+				"name": "argus", "count": float64(3), "ratio": 0.5, "tags": []interface{}{"a"},
+			}, request.(*setItemRequest).item.Data)
+			assert.Equal(int64(60), *request.(*setItemRequest).item.TTL)
+		})
+	}
+}
+
+func TestEncodeGetOrDeleteItemResponseBinary(t *testing.T) {
+	item := &OwnableItem{
+		Item: model.Item{
+			ID:   "id",
+			Data: map[string]interface{}{"count": float64(3), "ratio": 0.5},
+			TTL:  int64Ptr(60),
+		},
+	}
+	for _, contentType := range []string{JSONContentType, CBORContentType, MsgpackContentType} {
+		t.Run(contentType, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			ctx := context.WithValue(context.Background(), kithttp.ContextKeyRequestAccept, contentType)
+			rec := httptest.NewRecorder()
+			require.NoError(encodeGetOrDeleteItemResponse(ctx, rec, item))
+
+			assert.Equal(contentType, rec.Header().Get("Content-Type"))
+			assert.Equal("Accept, Accept-Encoding", rec.Header().Get("Vary"))
+			var decoded map[string]interface{}
+			if contentType == JSONContentType {
+				assert.JSONEq(`{"id": "id", "data": {"count": 3, "ratio": 0.5}, "ttl": 60}`, rec.Body.String())
+				return
+			}
+			require.NoError(codec.NewDecoderBytes(rec.Body.Bytes(), binaryHandles[contentType]).Decode(&decoded))
+			assert.Equal("id", decoded["id"])
+			assert.EqualValues(60, decoded["ttl"])
+			data := decoded["data"].(map[string]interface{})
+			assert.EqualValues(3, data["count"], "integral numbers are encoded as integers")
+			assert.Equal(0.5, data["ratio"])
+		})
+	}
+}
@@ -0,0 +1,486 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package encryption provides a store.S decorator which encrypts the data of
+// items before they reach the backend, using envelope encryption: each item is
+// encrypted with its own AES-GCM data key, itself wrapped by a key encryption
+// key from a keyring file or a KMS. Rotations either rewrap the data keys with
+// the current key encryption key or re-encrypt the data with new data keys.
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/argus/store/db/metric"
+	"go.uber.org/zap"
+)
+
+// Encryption is the path to the configuration structure of this package
+// under the store configuration block.
+const Encryption = "encryption"
+
+const (
+	defaultRotationInterval = time.Hour
+
+	// envelopeKey is the only field of the data of encrypted items.
+	envelopeKey = store.EncryptedDataKey
+
+	// envelopeOverheadBytes bounds the size of the envelope fields besides the
+	// encrypted data, the wrapped data key included.
+	envelopeOverheadBytes = 1024
+
+	// sealOverheadBytes is the size of the AES-GCM nonce and tag.
+	sealOverheadBytes = 12 + 16
+)
+
+// ErrDecrypt is returned when the data of an item can't be decrypted.
+var ErrDecrypt = errors.New("failed to decrypt item data")
+
+// Config configures the encryption of item data.
+type Config struct {
+	// Buckets lists the buckets whose item data is encrypted. Items stored in
+	// them in plaintext before are still read as is until the next rotation
+	// encrypts them.
+	Buckets []string
+
+	// KeyringFile is the path to the keyring holding the key encryption keys.
+	// It is ignored when the application provides a KeyWrapper, such as a KMS client.
+	KeyringFile string
+
+	// RotationInterval is how often the keys are reloaded and the items whose
+	// data key is wrapped with a key other than the current one are rotated.
+	// (Optional) defaults to 1h.
+	RotationInterval time.Duration
+
+	// ReencryptData makes rotations re-encrypt the data of the items with new
+	// data keys rather than only rewrap their data keys. It costs a decryption
+	// and an encryption per item but, once the key encryption key changed, the
+	// data keys used before no longer open the items.
+	// (Optional) defaults to false.
+	ReencryptData bool
+}
+
+// envelope is the encrypted form of the data of an item. All its fields are
+// strings so it survives the JSON and DynamoDB encodings of the backends.
+type envelope struct {
+	// KeyID is the ID of the key encryption key wrapping DataKey.
+	KeyID string `json:"keyId"`
+
+	// DataKey is the wrapped AES-GCM key of the item.
+	DataKey string `json:"dataKey"`
+
+	// Data is the sealed JSON encoding of the item data.
+	Data string `json:"data"`
+}
+
+// Store encrypts the data of the items of the configured buckets with
+// AES-GCM, binding the ciphertext to the bucket and ID of the item so it can't
+// be moved to another item. Owners and TTLs are left in plaintext.
+type Store struct {
+	store.S
+	wrapper  KeyWrapper
+	buckets  map[string]bool
+	config   Config
+	measures metric.Measures
+	logger   *zap.Logger
+	stop     chan struct{}
+	wg       sync.WaitGroup
+
+	itemCodec store.Codec
+}
+
+// New decorates s so the data of the items of the configured buckets is
+// encrypted with data keys wrapped by wrapper.
+func New(s store.S, config Config, wrapper KeyWrapper, measures metric.Measures, logger *zap.Logger) *Store {
+	if config.RotationInterval <= 0 {
+		config.RotationInterval = defaultRotationInterval
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	buckets := make(map[string]bool, len(config.Buckets))
+	for _, bucket := range config.Buckets {
+		buckets[bucket] = true
+	}
+	e := &Store{
+		S:        s,
+		wrapper:  wrapper,
+		buckets:  buckets,
+		config:   config,
+		measures: measures,
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}
+	e.itemCodec = store.Codec{Encode: e.encrypt, Decode: e.decrypt}
+	return e
+}
+
+// Start starts rotating the key encryption keys of the items in the
+// background.
+func (s *Store) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.RotationInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.rotateAll()
+			}
+		}
+	}()
+}
+
+// Stop stops the rotations, waiting for the current one to be done.
+func (s *Store) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *Store) rotateAll() {
+	if r, ok := s.wrapper.(Reloader); ok {
+		if err := r.Reload(); err != nil {
+			s.logger.Error("failed to reload encryption keys", zap.Error(err))
+		}
+	}
+	for bucket := range s.buckets {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		if err := s.rotate(bucket, s.config.ReencryptData); err != nil {
+			s.logger.Error("failed to rotate item encryption keys", zap.String("bucket", bucket), zap.Error(err))
+		}
+	}
+}
+
+// RewrapDataKeys rewraps the data keys of the items of the bucket which aren't
+// wrapped with the current key, and encrypts the items still in plaintext.
+// It's the cheap rotation: the data of encrypted items stays sealed with its
+// data key, so a leaked data key exposes its item until the item is written
+// again or re-encrypted.
+func (s *Store) RewrapDataKeys(bucket string) error {
+	return s.rotate(bucket, false)
+}
+
+// ReencryptData seals the data of the items of the bucket whose data key isn't
+// wrapped with the current key with new data keys, and encrypts the items still
+// in plaintext.
+func (s *Store) ReencryptData(bucket string) error {
+	return s.rotate(bucket, true)
+}
+
+// rotate rewraps the data keys of the items not using the current key or, when
+// reencrypt is set, re-encrypts them. Items are swapped so concurrent writes
+// win over the rotation.
+func (s *Store) rotate(bucket string, reencrypt bool) error {
+	if !s.buckets[bucket] {
+		return nil
+	}
+	items, err := s.S.GetAll(bucket)
+	if err != nil {
+		return err
+	}
+	current := s.wrapper.CurrentKeyID()
+	for id, raw := range items {
+		key := model.Key{Bucket: bucket, ID: id}
+		e, encrypted := decodeEnvelope(raw.Data)
+		if encrypted && e.KeyID == current {
+			continue
+		}
+
+		var rotated store.OwnableItem
+		switch {
+		case encrypted && reencrypt:
+			rotated, err = s.reencrypt(key, raw)
+		case encrypted:
+			rotated, err = s.rewrap(raw, e)
+		default:
+			rotated, err = s.encrypt(key, raw)
+		}
+		if err == nil {
+			err = store.CompareAndSwap(s.S, key, raw, rotated)
+		}
+		if errors.Is(err, store.ErrItemChanged) || errors.Is(err, store.ErrItemNotFound) {
+			continue
+		}
+		outcome := metric.SuccessQueryOutcome
+		if err != nil {
+			outcome = metric.FailQueryOutcome
+			s.logger.Warn("failed to rotate item encryption key", zap.String("bucket", bucket), zap.String("id", id), zap.Error(err))
+		}
+		s.measures.EncryptionRotations.With(prometheus.Labels{metric.QueryOutcomeLabelKey: outcome}).Inc()
+	}
+	return nil
+}
+
+func (s *Store) Push(key model.Key, item store.OwnableItem) error {
+	item, err := s.encrypt(key, item)
+	if err != nil {
+		return err
+	}
+	return s.S.Push(key, item)
+}
+
+func (s *Store) PushIfAbsent(key model.Key, item store.OwnableItem) error {
+	item, err := s.encrypt(key, item)
+	if err != nil {
+		return err
+	}
+	return store.PushIfAbsent(s.S, key, item)
+}
+
+// CompareAndSwap compares old with the decrypted stored item, then swaps the
+// stored item as read so concurrent changes are still detected by the backend.
+func (s *Store) CompareAndSwap(key model.Key, old, item store.OwnableItem) error {
+	if !s.buckets[key.Bucket] {
+		return store.CompareAndSwap(s.S, key, old, item)
+	}
+	return s.itemCodec.CompareAndSwap(s.S, key, old, item)
+}
+
+// Increment can't be applied by the backend on encrypted data, so it is
+// applied here and the updated item swapped in, retrying on concurrent changes.
+func (s *Store) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	if !s.buckets[key.Bucket] {
+		return store.Increment(s.S, key, path, delta, modifiedBy)
+	}
+	return s.itemCodec.Increment(s.S, key, path, delta, modifiedBy)
+}
+
+// Transact encrypts the items of the operations and, like CompareAndSwap,
+// conditions the operations on the stored items matching the expected ones.
+func (s *Store) Transact(ops []store.TransactionOp) error {
+	return s.itemCodec.Transact(s.S, ops, func(op store.TransactionOp) bool {
+		return !s.buckets[op.Key.Bucket]
+	})
+}
+
+func (s *Store) Get(key model.Key) (store.OwnableItem, error) {
+	item, err := s.S.Get(key)
+	if err != nil {
+		return item, err
+	}
+	return s.decrypt(key, item)
+}
+
+func (s *Store) Delete(key model.Key) (store.OwnableItem, error) {
+	item, err := s.S.Delete(key)
+	if err != nil {
+		return item, err
+	}
+	return s.decrypt(key, item)
+}
+
+func (s *Store) GetAll(bucket string) (map[string]store.OwnableItem, error) {
+	items, err := s.S.GetAll(bucket)
+	if err != nil {
+		return items, err
+	}
+	return s.decryptAll(bucket, items)
+}
+
+func (s *Store) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, error) {
+	items, err := store.GetAllByOwner(s.S, bucket, owner)
+	if err != nil {
+		return items, err
+	}
+	return s.decryptAll(bucket, items)
+}
+
+// BucketDigest returns the digest kept by the wrapped store, which is computed
+// over the items as stored, encrypted.
+func (s *Store) BucketDigest(bucket string) (store.Digest, error) {
+	return store.BucketDigest(s.S, bucket, "", true)
+}
+
+// OwnerDigest returns the digest kept by the wrapped store, which is computed
+// over the items as stored, encrypted.
+func (s *Store) OwnerDigest(bucket, owner string) (store.Digest, error) {
+	return store.BucketDigest(s.S, bucket, owner, false)
+}
+
+// MaxItemDataBytes returns the size limit of the plaintext data which still
+// fits the backend once encrypted and base64 encoded. envelopeOverheadBytes is
+// left for the other fields of the envelope.
+func (s *Store) MaxItemDataBytes() int64 {
+	limit := store.MaxItemDataBytes(s.S)
+	if limit == 0 {
+		return 0
+	}
+	return (limit-envelopeOverheadBytes)*3/4 - sealOverheadBytes
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	if p, ok := s.S.(store.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (s *Store) decryptAll(bucket string, items map[string]store.OwnableItem) (map[string]store.OwnableItem, error) {
+	if !s.buckets[bucket] {
+		return items, nil
+	}
+	for id, item := range items {
+		decrypted, err := s.decrypt(model.Key{Bucket: bucket, ID: id}, item)
+		if err != nil {
+			return nil, err
+		}
+		items[id] = decrypted
+	}
+	return items, nil
+}
+
+// encrypt returns a copy of the item whose data is sealed with a new data key.
+func (s *Store) encrypt(key model.Key, item store.OwnableItem) (store.OwnableItem, error) {
+	if !s.buckets[key.Bucket] {
+		return item, nil
+	}
+	plaintext, err := json.Marshal(item.Data)
+	if err != nil {
+		return item, store.SanitizeError(fmt.Errorf("%w: %v", store.ErrJSONEncode, err))
+	}
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return item, encryptError(key, err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return item, encryptError(key, err)
+	}
+	sealed, err := seal(aead, plaintext, additionalData(key))
+	if err != nil {
+		return item, encryptError(key, err)
+	}
+	keyID, wrapped, err := s.wrapper.WrapKey(dataKey)
+	if err != nil {
+		return item, encryptError(key, err)
+	}
+	item.Data = envelope{
+		KeyID:   keyID,
+		DataKey: base64.StdEncoding.EncodeToString(wrapped),
+		Data:    base64.StdEncoding.EncodeToString(sealed),
+	}.encode()
+	return item, nil
+}
+
+// rewrap returns a copy of the item whose data key is wrapped with the
+// current key, the sealed data being left as is.
+func (s *Store) rewrap(item store.OwnableItem, e envelope) (store.OwnableItem, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(e.DataKey)
+	if err != nil {
+		return item, err
+	}
+	dataKey, err := s.wrapper.UnwrapKey(e.KeyID, wrapped)
+	if err != nil {
+		return item, err
+	}
+	if e.KeyID, wrapped, err = s.wrapper.WrapKey(dataKey); err != nil {
+		return item, err
+	}
+	e.DataKey = base64.StdEncoding.EncodeToString(wrapped)
+	item.Data = e.encode()
+	return item, nil
+}
+
+// reencrypt returns a copy of the item whose data is sealed with a new data
+// key.
+func (s *Store) reencrypt(key model.Key, item store.OwnableItem) (store.OwnableItem, error) {
+	item, err := s.decrypt(key, item)
+	if err != nil {
+		return item, err
+	}
+	return s.encrypt(key, item)
+}
+
+// decrypt returns the item with its data opened. Items in plaintext are
+// returned as is.
+func (s *Store) decrypt(key model.Key, item store.OwnableItem) (store.OwnableItem, error) {
+	if !s.buckets[key.Bucket] {
+		return item, nil
+	}
+	e, ok := decodeEnvelope(item.Data)
+	if !ok {
+		return item, nil
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(e.DataKey)
+	if err != nil {
+		return item, decryptError(key, err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(e.Data)
+	if err != nil {
+		return item, decryptError(key, err)
+	}
+	dataKey, err := s.wrapper.UnwrapKey(e.KeyID, wrapped)
+	if err != nil {
+		return item, decryptError(key, err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return item, decryptError(key, err)
+	}
+	plaintext, err := open(aead, sealed, additionalData(key))
+	if err != nil {
+		return item, decryptError(key, err)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return item, decryptError(key, err)
+	}
+	item.Data = data
+	return item, nil
+}
+
+func (e envelope) encode() map[string]interface{} {
+	return map[string]interface{}{
+		envelopeKey: map[string]interface{}{
+			"keyId":   e.KeyID,
+			"dataKey": e.DataKey,
+			"data":    e.Data,
+		},
+	}
+}
+
+// decodeEnvelope returns the envelope held by the data of an encrypted item.
+func decodeEnvelope(data map[string]interface{}) (envelope, bool) {
+	if len(data) != 1 {
+		return envelope{}, false
+	}
+	fields, ok := data[envelopeKey].(map[string]interface{})
+	if !ok {
+		return envelope{}, false
+	}
+	var e envelope
+	e.KeyID, _ = fields["keyId"].(string)
+	e.DataKey, _ = fields["dataKey"].(string)
+	e.Data, _ = fields["data"].(string)
+	return e, e.KeyID != "" && e.DataKey != "" && e.Data != ""
+}
+
+// additionalData binds the ciphertext of an item to its key.
+func additionalData(key model.Key) []byte {
+	return []byte(key.Bucket + "/" + key.ID)
+}
+
+func encryptError(key model.Key, err error) error {
+	return store.SanitizeError(store.ItemOperationError{Err: fmt.Errorf("failed to encrypt item data: %w", err), Key: key, Operation: "encrypt"})
+}
+
+func decryptError(key model.Key, err error) error {
+	return store.SanitizeError(store.ItemOperationError{Err: fmt.Errorf("%w: %v", ErrDecrypt, err), Key: key, Operation: "decrypt"})
+}
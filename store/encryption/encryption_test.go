@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package encryption
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/argus/store/db/metric"
+	"github.com/xmidt-org/argus/store/inmem"
+)
+
+var (
+	secretKey = model.Key{Bucket: "secrets", ID: "id"}
+	publicKey = model.Key{Bucket: "public", ID: "id"}
+)
+
+func newTestItem(data map[string]interface{}) store.OwnableItem {
+	return store.OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: data}}
+}
+
+func newTestMeasures() metric.Measures {
+	return metric.Measures{
+		EncryptionRotations: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "rotations"},
+			[]string{metric.QueryOutcomeLabelKey}),
+	}
+}
+
+// newTestStore returns an encrypted store of the secrets bucket, its backend
+// and the path to its keyring.
+func newTestStore(t *testing.T) (*Store, store.S, string) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	writeKeyring(t, path, `{"current": "k1", "keys": {"k1": "`+testKey1+`"}}`)
+	keyring, err := NewKeyring(path)
+	require.NoError(t, err)
+	backend := inmem.NewSharded(inmem.Config{}, nil)
+	return New(backend, Config{Buckets: []string{"secrets"}}, keyring, newTestMeasures(), nil), backend, path
+}
+
+func TestEncryptedItems(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, backend, _ := newTestStore(t)
+	item := newTestItem(map[string]interface{}{"secret": "hunter2"})
+
+	require.NoError(s.Push(secretKey, item))
+	require.NoError(s.Push(publicKey, item))
+
+	raw, err := backend.Get(secretKey)
+	require.NoError(err)
+	e, ok := decodeEnvelope(raw.Data)
+	require.True(ok)
+	assert.Equal("k1", e.KeyID)
+	assert.NotContains(e.Data, "hunter2")
+	assert.Equal("owner", raw.Owner, "owners are stored in plaintext")
+	raw, err = backend.Get(publicKey)
+	require.NoError(err)
+	assert.Equal(item.Data, raw.Data, "other buckets are stored in plaintext")
+
+	got, err := s.Get(secretKey)
+	require.NoError(err)
+	assert.Equal(item.Data, got.Data)
+	items, err := s.GetAll("secrets")
+	require.NoError(err)
+	assert.Equal(item.Data, items["id"].Data)
+	items, err = s.GetAllByOwner("secrets", "owner")
+	require.NoError(err)
+	assert.Equal(item.Data, items["id"].Data)
+	deleted, err := s.Delete(secretKey)
+	require.NoError(err)
+	assert.Equal(item.Data, deleted.Data)
+}
+
+func TestMovedCiphertext(t *testing.T) {
+	s, backend, _ := newTestStore(t)
+	require.NoError(t, s.Push(secretKey, newTestItem(map[string]interface{}{"secret": "hunter2"})))
+	raw, err := backend.Get(secretKey)
+	require.NoError(t, err)
+
+	movedKey := model.Key{Bucket: "secrets", ID: "other"}
+	require.NoError(t, backend.Push(movedKey, raw))
+	_, err = s.Get(movedKey)
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestConditionalWrites(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, _, _ := newTestStore(t)
+	item := newTestItem(map[string]interface{}{"count": 1.0})
+
+	require.NoError(s.PushIfAbsent(secretKey, item))
+	assert.ErrorIs(s.PushIfAbsent(secretKey, item), store.ErrItemExists)
+
+	swapped := newTestItem(map[string]interface{}{"count": 2.0})
+	assert.ErrorIs(s.CompareAndSwap(secretKey, swapped, swapped), store.ErrItemChanged)
+	require.NoError(s.CompareAndSwap(secretKey, item, swapped))
+
+	value, err := s.Increment(secretKey, []string{"count"}, 3, "writer")
+	require.NoError(err)
+	assert.Equal(5.0, value)
+
+	current, err := s.Get(secretKey)
+	require.NoError(err)
+	assert.Equal(swapped.Version+1, current.Version)
+	assert.Equal("writer", current.ModifiedBy)
+	otherKey := model.Key{Bucket: "secrets", ID: "other"}
+	err = s.Transact([]store.TransactionOp{
+		{Key: secretKey, Delete: true, Condition: store.IfUnchanged, Expected: swapped},
+		{Key: otherKey, Item: item, Condition: store.IfAbsent},
+	})
+	var conditionErr store.TransactionConditionError
+	require.ErrorAs(err, &conditionErr)
+	assert.Equal(0, conditionErr.Index)
+	assert.ErrorIs(err, store.ErrItemChanged)
+
+	require.NoError(s.Transact([]store.TransactionOp{
+		{Key: secretKey, Delete: true, Condition: store.IfUnchanged, Expected: current},
+		{Key: otherKey, Item: item, Condition: store.IfAbsent},
+	}))
+	_, err = s.Get(secretKey)
+	assert.ErrorIs(err, store.ErrItemNotFound)
+	got, err := s.Get(otherKey)
+	require.NoError(err)
+	assert.Equal(item.Data, got.Data)
+}
+
+func TestRewrapDataKeys(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, backend, path := newTestStore(t)
+	item := newTestItem(map[string]interface{}{"secret": "hunter2"})
+	legacyKey := model.Key{Bucket: "secrets", ID: "legacy"}
+	require.NoError(s.Push(secretKey, item))
+	require.NoError(backend.Push(legacyKey, item))
+	before, err := backend.Get(secretKey)
+	require.NoError(err)
+	sealed, _ := decodeEnvelope(before.Data)
+
+	writeKeyring(t, path, `{"current": "k2", "keys": {"k1": "`+testKey1+`", "k2": "`+testKey2+`"}}`)
+	s.rotateAll()
+	assert.Equal(2.0, testutil.ToFloat64(s.measures.EncryptionRotations.With(prometheus.Labels{metric.QueryOutcomeLabelKey: metric.SuccessQueryOutcome})))
+
+	// Once rotated, the previous key is no longer needed.
+	writeKeyring(t, path, `{"current": "k2", "keys": {"k2": "`+testKey2+`"}}`)
+	require.NoError(s.wrapper.(Reloader).Reload())
+	for _, key := range []model.Key{secretKey, legacyKey} {
+		raw, err := backend.Get(key)
+		require.NoError(err)
+		e, ok := decodeEnvelope(raw.Data)
+		require.True(ok, key.ID)
+		assert.Equal("k2", e.KeyID, key.ID)
+		if key == secretKey {
+			assert.Equal(sealed.Data, e.Data, "only the data key is rewrapped")
+		}
+
+		got, err := s.Get(key)
+		require.NoError(err)
+		assert.Equal(item.Data, got.Data, key.ID)
+	}
+}
+
+func TestReencryptData(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s, backend, path := newTestStore(t)
+	item := newTestItem(map[string]interface{}{"secret": "hunter2"})
+	require.NoError(s.Push(secretKey, item))
+	before, err := backend.Get(secretKey)
+	require.NoError(err)
+	sealed, _ := decodeEnvelope(before.Data)
+	wrapped, err := base64.StdEncoding.DecodeString(sealed.DataKey)
+	require.NoError(err)
+	leaked, err := s.wrapper.UnwrapKey(sealed.KeyID, wrapped)
+	require.NoError(err)
+
+	writeKeyring(t, path, `{"current": "k2", "keys": {"k1": "`+testKey1+`", "k2": "`+testKey2+`"}}`)
+	require.NoError(s.wrapper.(Reloader).Reload())
+	require.NoError(s.ReencryptData(secretKey.Bucket))
+
+	raw, err := backend.Get(secretKey)
+	require.NoError(err)
+	e, ok := decodeEnvelope(raw.Data)
+	require.True(ok)
+	assert.Equal("k2", e.KeyID)
+	resealed, err := base64.StdEncoding.DecodeString(e.Data)
+	require.NoError(err)
+	aead, err := newAEAD(leaked)
+	require.NoError(err)
+	_, err = open(aead, resealed, additionalData(secretKey))
+	assert.Error(err, "the previous data key no longer opens the item")
+
+	got, err := s.Get(secretKey)
+	require.NoError(err)
+	assert.Equal(item.Data, got.Data)
+}
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// keySize is the size of the keys in bytes, selecting AES-256.
+const keySize = 32
+
+// Sentinel errors.
+var (
+	ErrInvalidKeyring = errors.New("invalid keyring")
+	ErrUnknownKey     = errors.New("unknown key encryption key")
+)
+
+// KeyWrapper encrypts the data keys of items with the key encryption keys it
+// holds, such as the keys of a KMS. The ID of the key used is stored with the
+// items so they can still be decrypted once the current key has changed.
+type KeyWrapper interface {
+	// CurrentKeyID returns the ID of the key new data keys are wrapped with.
+	CurrentKeyID() string
+
+	// WrapKey encrypts dataKey with the current key.
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+
+	// UnwrapKey decrypts a data key wrapped with the key of the given ID.
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Reloader is implemented by the key wrappers whose keys can change while
+// running. Reload is called before each rotation.
+type Reloader interface {
+	Reload() error
+}
+
+// keyringFile is the format of the keyring file. Keys are base64 encoded
+// 32 byte AES keys, by ID.
+type keyringFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// Keyring is a KeyWrapper whose keys are read from a local JSON file such as:
+//
+//	{"current": "2024-01", "keys": {"2023-06": "<base64>", "2024-01": "<base64>"}}
+//
+// Keys are rotated by adding a new key to the file and making it current. The
+// previous keys must be kept until the next rotation has rewrapped the data
+// keys using them, or re-encrypted the data sealed with those data keys.
+type Keyring struct {
+	path    string
+	lock    sync.RWMutex
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring loads the keyring file at path.
+func NewKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload reads the keyring file again. The keyring is left as is when the file
+// is invalid.
+func (k *Keyring) Reload() error {
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidKeyring, err)
+	}
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidKeyring, err)
+	}
+	if _, ok := file.Keys[file.Current]; !ok {
+		return fmt.Errorf("%w: current key %q isn't in the keyring", ErrInvalidKeyring, file.Current)
+	}
+
+	keys := make(map[string]cipher.AEAD, len(file.Keys))
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("%w: key %q: %v", ErrInvalidKeyring, id, err)
+		}
+		if len(key) != keySize {
+			return fmt.Errorf("%w: key %q must be %d bytes long", ErrInvalidKeyring, id, keySize)
+		}
+		if keys[id], err = newAEAD(key); err != nil {
+			return fmt.Errorf("%w: key %q: %v", ErrInvalidKeyring, id, err)
+		}
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.current, k.keys = file.Current, keys
+	return nil
+}
+
+func (k *Keyring) CurrentKeyID() string {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return k.current
+}
+
+// WrapKey seals dataKey with the current key, authenticating the key ID.
+func (k *Keyring) WrapKey(dataKey []byte) (string, []byte, error) {
+	k.lock.RLock()
+	id, aead := k.current, k.keys[k.current]
+	k.lock.RUnlock()
+	wrapped, err := seal(aead, dataKey, []byte(id))
+	return id, wrapped, err
+}
+
+func (k *Keyring) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	k.lock.RLock()
+	aead, ok := k.keys[keyID]
+	k.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	return open(aead, wrapped, []byte(keyID))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, which is prepended to the
+// returned ciphertext.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, additionalData)
+}
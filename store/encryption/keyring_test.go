@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package encryption
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKey1 = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+	testKey2 = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210fedcba9876543210"))
+)
+
+func writeKeyring(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+}
+
+func TestNewKeyring(t *testing.T) {
+	tcs := []struct {
+		Description string
+		Content     string
+		ExpectedErr error
+	}{
+		{
+			Description: "Valid",
+			Content:     `{"current": "k2", "keys": {"k1": "` + testKey1 + `", "k2": "` + testKey2 + `"}}`,
+		},
+		{
+			Description: "Missing current key",
+			Content:     `{"current": "k3", "keys": {"k1": "` + testKey1 + `"}}`,
+			ExpectedErr: ErrInvalidKeyring,
+		},
+		{
+			Description: "Bad encoding",
+			Content:     `{"current": "k1", "keys": {"k1": "not base64!"}}`,
+			ExpectedErr: ErrInvalidKeyring,
+		},
+		{
+			Description: "Short key",
+			Content:     `{"current": "k1", "keys": {"k1": "` + base64.StdEncoding.EncodeToString([]byte("short")) + `"}}`,
+			ExpectedErr: ErrInvalidKeyring,
+		},
+		{
+			Description: "Bad JSON",
+			Content:     `{`,
+			ExpectedErr: ErrInvalidKeyring,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keyring.json")
+			writeKeyring(t, path, tc.Content)
+			_, err := NewKeyring(path)
+			assert.ErrorIs(t, err, tc.ExpectedErr)
+		})
+	}
+}
+
+func TestKeyringWrap(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	writeKeyring(t, path, `{"current": "k1", "keys": {"k1": "`+testKey1+`"}}`)
+	k, err := NewKeyring(path)
+	require.NoError(err)
+
+	dataKey := []byte("data key")
+	keyID, wrapped, err := k.WrapKey(dataKey)
+	require.NoError(err)
+	assert.Equal("k1", keyID)
+	assert.NotContains(string(wrapped), string(dataKey))
+
+	writeKeyring(t, path, `{"current": "k2", "keys": {"k1": "`+testKey1+`", "k2": "`+testKey2+`"}}`)
+	require.NoError(k.Reload())
+	assert.Equal("k2", k.CurrentKeyID())
+	unwrapped, err := k.UnwrapKey("k1", wrapped)
+	require.NoError(err)
+	assert.Equal(dataKey, unwrapped)
+
+	_, err = k.UnwrapKey("k2", wrapped)
+	assert.Error(err, "the key ID is authenticated")
+	_, err = k.UnwrapKey("k3", wrapped)
+	assert.ErrorIs(err, ErrUnknownKey)
+
+	writeKeyring(t, path, `{"current": "k3"}`)
+	assert.ErrorIs(k.Reload(), ErrInvalidKeyring)
+	assert.Equal("k2", k.CurrentKeyID(), "invalid keyrings are ignored")
+}
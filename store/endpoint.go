@@ -8,11 +8,26 @@ package store
 import (
 	"context"
 	"errors"
+	"net/http"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/xmidt-org/httpaux/erraux"
 )
 
-var accessDeniedErr = &ForbiddenRequestErr{Message: "resource owner mismatch"}
+// maxSetItemAttempts bounds the number of times an item write is retried when
+// a concurrent write to the item wins.
+const maxSetItemAttempts = 3
+
+var (
+	accessDeniedErr   = &ForbiddenRequestErr{Message: "resource owner mismatch", Code: "owner_mismatch"}
+	errItemContention = &erraux.Error{Err: errors.New("item changed concurrently, try again"), Code: http.StatusConflict}
+
+	errCreateUnsupported = &erraux.Error{Err: errors.New("create-only writes are not supported by the store"), Code: http.StatusNotImplemented}
+	errSwapUnsupported   = &erraux.Error{Err: errors.New("compare-and-swap writes are not supported by the store"), Code: http.StatusNotImplemented}
+
+	errIncrementUnsupported   = &erraux.Error{Err: errors.New("increments are not supported by the store"), Code: http.StatusNotImplemented}
+	errTransactionUnsupported = &erraux.Error{Err: errors.New("transactions are not supported by the store"), Code: http.StatusNotImplemented}
+)
 
 func newGetItemEndpoint(s S) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
@@ -49,51 +64,100 @@ func newDeleteItemEndpoint(s S) endpoint.Endpoint {
 	}
 }
 
+// newGetAllItemsEndpoint checks the digest kept by the store, when it keeps
+// one, before reading the bucket so unchanged listings aren't read at all.
 func newGetAllItemsEndpoint(s S) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		itemsRequest := request.(*getAllItemsRequest)
-		items, err := s.GetAll(itemsRequest.bucket)
+		all := itemsRequest.adminMode && itemsRequest.owner == ""
+		digest, err := BucketDigest(s, itemsRequest.bucket, itemsRequest.owner, all)
+		tracked := err == nil
+		if err != nil && !errors.Is(err, ErrDigestUnsupported) {
+			return nil, err
+		}
+		if tracked && newValidators(ctx, digest, true).notModified(ctx) {
+			return &getAllItemsResponse{digest: digest, tracked: true}, nil
+		}
+
+		var items map[string]OwnableItem
+		if all {
+			items, err = s.GetAll(itemsRequest.bucket)
+		} else {
+			items, err = GetAllByOwner(s, itemsRequest.bucket, itemsRequest.owner)
+		}
 		if err != nil {
 			return nil, err
 		}
-		if itemsRequest.adminMode && itemsRequest.owner == "" {
-			return items, nil
+		if !tracked {
+			digest = DigestItems(items)
 		}
-		return FilterOwner(items, itemsRequest.owner), nil
+		return &getAllItemsResponse{items: items, digest: digest, tracked: tracked}, nil
 	}
 }
 
 func newSetItemEndpoint(s S) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		setItemRequest := request.(*setItemRequest)
-		itemResponse, err := s.Get(setItemRequest.key)
-
-		if err != nil {
-			if errors.Is(err, ErrItemNotFound) {
-				err = s.Push(setItemRequest.key, setItemRequest.item)
-				if err != nil {
-					return nil, err
-				}
-				return &setItemResponse{}, nil
+		if setItemRequest.createOnly {
+			return createItem(s, setItemRequest)
+		}
+		for attempt := 0; attempt < maxSetItemAttempts; attempt++ {
+			response, err := setItem(s, setItemRequest)
+			if !errors.Is(err, ErrItemExists) && !errors.Is(err, ErrItemChanged) && !errors.Is(err, ErrItemNotFound) {
+				return response, err
 			}
-			return nil, err
 		}
+		return nil, errItemContention
+	}
+}
 
-		if !authorized(setItemRequest.adminMode, itemResponse.Owner, setItemRequest.item.Owner) {
-			return nil, accessDeniedErr
+// setItem creates or replaces the item, revising the one read. The write only
+// applies while that item is still current, so concurrent writers can't both
+// write its next version, unless the store doesn't support conditional writes.
+func setItem(s S, setItemRequest *setItemRequest) (interface{}, error) {
+	existing, err := s.Get(setItemRequest.key)
+	if errors.Is(err, ErrItemNotFound) {
+		item := Revise(setItemRequest.item, nil)
+		err = PushIfAbsent(s, setItemRequest.key, item)
+		if errors.Is(err, errCreateUnsupported) {
+			err = s.Push(setItemRequest.key, item)
 		}
-
-		setItemRequest.item.Owner = itemResponse.Owner
-
-		err = s.Push(setItemRequest.key, setItemRequest.item)
 		if err != nil {
 			return nil, err
 		}
+		return &setItemResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !authorized(setItemRequest.adminMode, existing.Owner, setItemRequest.item.Owner) {
+		return nil, accessDeniedErr
+	}
+
+	item := setItemRequest.item
+	item.Owner = existing.Owner
+	item = Revise(item, &existing)
+	err = CompareAndSwap(s, setItemRequest.key, existing, item)
+	if errors.Is(err, errSwapUnsupported) {
+		err = s.Push(setItemRequest.key, item)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &setItemResponse{
+		existingResource: true,
+	}, nil
+}
 
-		return &setItemResponse{
-			existingResource: true,
-		}, nil
+// createItem atomically creates the item, failing with ErrItemExists when its key
+// is taken. Ownership doesn't need checking as no item is overwritten.
+func createItem(s S, setItemRequest *setItemRequest) (interface{}, error) {
+	if err := PushIfAbsent(s, setItemRequest.key, Revise(setItemRequest.item, nil)); err != nil {
+		return nil, err
 	}
+	return &setItemResponse{}, nil
 }
 
 func authorized(adminMode bool, resourceOwner, requestOwner string) bool {
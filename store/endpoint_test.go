@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xmidt-org/argus/model"
@@ -279,7 +280,9 @@ func TestSetItemEndpoint(t *testing.T) {
 				adminMode: true,
 			},
 			GetDAOResponse: OwnableItem{
-				Owner: "cable",
+				Owner:     "cable",
+				CreatedAt: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC),
+				Version:   3,
 			},
 			PushDAOResponse: OwnableItem{
 				Owner: "cable",
@@ -329,6 +332,13 @@ func TestSetItemEndpoint(t *testing.T) {
 			if testCase.ItemRequest.adminMode {
 				pushItem.Owner = testCase.GetDAOResponse.Owner
 			}
+			// The creation time and version are carried over from the
+			// replaced item.
+			pushItem.Version = 1
+			if testCase.GetDAOResponseErr == nil {
+				pushItem.CreatedAt = testCase.GetDAOResponse.CreatedAt
+				pushItem.Version = testCase.GetDAOResponse.Version + 1
+			}
 
 			m.On("Push", testCase.ItemRequest.key, pushItem).Return(testCase.PushDAOResponseErr).Once()
 			m.On("Get", testCase.ItemRequest.key).Return(testCase.GetDAOResponse, testCase.GetDAOResponseErr).Once()
@@ -347,6 +357,147 @@ func TestSetItemEndpoint(t *testing.T) {
 	}
 }
 
+// racingStore runs race after every read, as if another writer changed the
+// item in between the read and the write.
+type racingStore struct {
+	*swapStore
+	race func(*swapStore)
+}
+
+func (s *racingStore) Get(key model.Key) (OwnableItem, error) {
+	item, err := s.swapStore.Get(key)
+	if s.race != nil {
+		s.race(s.swapStore)
+	}
+	return item, err
+}
+
+func TestSetItemEndpointConcurrentWrites(t *testing.T) {
+	var (
+		key     = model.Key{Bucket: "fruits", ID: "XnN_iR2xF1RCo5_ec-UdeBpUVQbXHJVHem3rWYi9f5o"}
+		request = OwnableItem{Item: model.Item{ID: key.ID, Data: map[string]interface{}{"writer": "request"}}, Owner: "cable", ModifiedBy: "writer"}
+		other   = OwnableItem{Item: model.Item{ID: key.ID, Data: map[string]interface{}{"writer": "other"}}, Owner: "cable", ModifiedBy: "other"}
+	)
+	testCases := []struct {
+		Name             string
+		Items            map[model.Key]OwnableItem
+		Races            int
+		ExpectedResponse interface{}
+		ExpectedVersion  int64
+		ExpectedErr      error
+	}{
+		{
+			Name:             "Concurrent update",
+			Items:            map[model.Key]OwnableItem{key: Revise(other, nil)},
+			Races:            1,
+			ExpectedResponse: &setItemResponse{existingResource: true},
+			ExpectedVersion:  3,
+		},
+		{
+			Name:             "Concurrent creation",
+			Items:            map[model.Key]OwnableItem{},
+			Races:            1,
+			ExpectedResponse: &setItemResponse{existingResource: true},
+			ExpectedVersion:  2,
+		},
+		{
+			Name:        "Contention",
+			Items:       map[model.Key]OwnableItem{},
+			Races:       maxSetItemAttempts,
+			ExpectedErr: errItemContention,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+			races := 0
+			s := &racingStore{
+				swapStore: &swapStore{items: testCase.Items},
+				race: func(s *swapStore) {
+					if races < testCase.Races {
+						races++
+						current, err := s.Get(key)
+						if err != nil {
+							s.Push(key, Revise(other, nil))
+							return
+						}
+						changed := other
+						changed.Data = map[string]interface{}{"writer": "other", "race": races}
+						s.Push(key, Revise(changed, &current))
+					}
+				},
+			}
+
+			endpoint := newSetItemEndpoint(s)
+			resp, err := endpoint(context.Background(), &setItemRequest{key: key, item: request})
+			assert.Equal(testCase.ExpectedErr, err)
+			if testCase.ExpectedErr != nil {
+				return
+			}
+			assert.Equal(testCase.ExpectedResponse, resp)
+			item, err := s.Get(key)
+			assert.NoError(err)
+			assert.Equal(request.Data, item.Data)
+			assert.Equal(testCase.ExpectedVersion, item.Version, "concurrent writes never write the same version")
+			assert.Equal("writer", item.ModifiedBy)
+		})
+	}
+}
+
+func TestCreateItemEndpoint(t *testing.T) {
+	var (
+		key  = model.Key{Bucket: "fruits", ID: "XnN_iR2xF1RCo5_ec-UdeBpUVQbXHJVHem3rWYi9f5o"}
+		item = OwnableItem{Owner: "cable"}
+	)
+	testCases := []struct {
+		Name             string
+		Unsupported      bool
+		PushErr          error
+		ExpectedResponse interface{}
+		ExpectedErr      error
+	}{
+		{
+			Name:             "Created",
+			ExpectedResponse: &setItemResponse{},
+		},
+		{
+			Name:        "Item exists",
+			PushErr:     SanitizeError(ErrItemExists),
+			ExpectedErr: ErrItemExists,
+		},
+		{
+			Name:        "Unsupported store",
+			Unsupported: true,
+			ExpectedErr: errCreateUnsupported,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+			request := &setItemRequest{key: key, item: item, createOnly: true}
+			var s S
+			if testCase.Unsupported {
+				s = new(MockDAO)
+			} else {
+				m := new(MockCreatorDAO)
+				created := item
+				created.Version = 1
+				m.On("PushIfAbsent", key, created).Return(testCase.PushErr).Once()
+				defer m.AssertExpectations(t)
+				s = m
+			}
+
+			resp, err := newSetItemEndpoint(s)(context.Background(), request)
+			assert.ErrorIs(err, testCase.ExpectedErr)
+			if testCase.ExpectedErr == nil {
+				assert.Equal(testCase.ExpectedResponse, resp)
+			}
+		})
+	}
+}
+
 func TestGetAllItemsEndpoint(t *testing.T) {
 	testCases := []struct {
 		Name                 string
@@ -497,10 +648,84 @@ func TestGetAllItemsEndpoint(t *testing.T) {
 			resp, err := endpoint(context.Background(), testCase.ItemRequest)
 			if testCase.ExpectedErr == nil {
 				assert.Nil(err)
-				assert.Equal(testCase.ExpectedResponse, resp)
+				assert.Equal(&getAllItemsResponse{
+					items:  testCase.ExpectedResponse,
+					digest: DigestItems(testCase.ExpectedResponse),
+				}, resp)
 			} else {
 				assert.Equal(testCase.ExpectedErr, err)
 			}
 		})
 	}
 }
+
+func TestGetAllItemsEndpointDigest(t *testing.T) {
+	var (
+		items = map[string]OwnableItem{
+			"giulia":  {Owner: "alfa-romeo", Item: model.Item{ID: "giulia"}},
+			"mustang": {Owner: "ford", Item: model.Item{ID: "mustang"}},
+		}
+		digest    = Digest{Sum: [32]byte{1}, LastModified: time.Unix(1700000000, 0)}
+		errDigest = errors.New("digest failure")
+	)
+	etag := newValidators(context.Background(), digest, true).etag
+
+	testCases := []struct {
+		Name             string
+		ItemRequest      *getAllItemsRequest
+		IfNoneMatch      string
+		DigestErr        error
+		ExpectedRead     bool
+		ExpectedResponse *getAllItemsResponse
+		ExpectedErr      error
+	}{
+		{
+			Name:             "Unchanged bucket",
+			ItemRequest:      &getAllItemsRequest{bucket: "cars", adminMode: true},
+			IfNoneMatch:      etag,
+			ExpectedResponse: &getAllItemsResponse{digest: digest, tracked: true},
+		},
+		{
+			Name:             "Changed bucket",
+			ItemRequest:      &getAllItemsRequest{bucket: "cars", adminMode: true},
+			IfNoneMatch:      `W/"stale"`,
+			ExpectedRead:     true,
+			ExpectedResponse: &getAllItemsResponse{items: items, digest: digest, tracked: true},
+		},
+		{
+			Name:             "Unchanged owner items",
+			ItemRequest:      &getAllItemsRequest{bucket: "cars", owner: "ford"},
+			IfNoneMatch:      etag,
+			ExpectedResponse: &getAllItemsResponse{digest: digest, tracked: true},
+		},
+		{
+			Name:        "Digest failure",
+			ItemRequest: &getAllItemsRequest{bucket: "cars", adminMode: true},
+			DigestErr:   errDigest,
+			ExpectedErr: errDigest,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.Name, func(t *testing.T) {
+			assert := assert.New(t)
+			m := new(MockDigesterDAO)
+			if testCase.ItemRequest.owner == "" {
+				m.On("BucketDigest", "cars").Return(digest, testCase.DigestErr).Once()
+			} else {
+				m.On("OwnerDigest", "cars", testCase.ItemRequest.owner).Return(digest, testCase.DigestErr).Once()
+			}
+			if testCase.ExpectedRead {
+				m.On("GetAll", "cars").Return(items, nil).Once()
+			}
+			ctx := context.WithValue(context.Background(), conditionsKey{}, conditions{ifNoneMatch: testCase.IfNoneMatch})
+
+			resp, err := newGetAllItemsEndpoint(m)(ctx, testCase.ItemRequest)
+			assert.Equal(testCase.ExpectedErr, err)
+			if testCase.ExpectedErr == nil {
+				assert.Equal(testCase.ExpectedResponse, resp)
+			}
+			m.AssertExpectations(t)
+		})
+	}
+}
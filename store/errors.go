@@ -14,15 +14,25 @@ import (
 // Sentinel internal errors.
 var (
 	ErrItemNotFound   = errors.New("item at resource path not found")
+	ErrItemExists     = errors.New("item at resource path already exists")
+	ErrItemChanged    = errors.New("item at resource path changed")
+	ErrNotNumeric     = errors.New("item data field is not numeric")
 	ErrJSONDecode     = errors.New("error decoding JSON data from DB")
 	ErrJSONEncode     = errors.New("error encoding JSON data to send to DB")
 	ErrQueryExecution = errors.New("error occurred during DB query execution")
+
+	// ErrDigestUnsupported is returned when bucket digests are requested from
+	// a store which doesn't keep them.
+	ErrDigestUnsupported = errors.New("item digests are not kept by the store")
 )
 
 // Sentinel errors to be used by the HTTP response error encoder.
 var (
 	ErrHTTPItemNotFound = &erraux.Error{Err: errors.New("item not found"), Code: http.StatusNotFound}
 	ErrHTTPOpFailed     = &erraux.Error{Err: errors.New("DB operation failed"), Code: http.StatusInternalServerError}
+	ErrHTTPItemExists   = &erraux.Error{Err: errors.New("item already exists"), Code: http.StatusPreconditionFailed}
+	ErrHTTPItemChanged  = &erraux.Error{Err: errors.New("item changed"), Code: http.StatusPreconditionFailed}
+	ErrHTTPNotNumeric   = &erraux.Error{Err: errors.New("item data field is not numeric"), Code: http.StatusBadRequest}
 )
 
 type sanitizedErrorer interface {
@@ -65,8 +75,13 @@ func (s SanitizedError) Headers() http.Header {
 	return s.ErrHTTP.Headers()
 }
 
+// BadRequestErr is returned for invalid requests. Code is the stable
+// identifier of the error in problem details and Field the part of the request
+// which is invalid, if any.
 type BadRequestErr struct {
 	Message string
+	Code    string
+	Field   string
 }
 
 func (bre BadRequestErr) Error() string {
@@ -81,8 +96,45 @@ func (bre BadRequestErr) StatusCode() int {
 	return http.StatusBadRequest
 }
 
+func (bre BadRequestErr) ErrorCode() string {
+	return bre.Code
+}
+
+func (bre BadRequestErr) ErrorField() string {
+	return bre.Field
+}
+
+// PayloadTooLargeErr is returned for request bodies and item data over their
+// size limits.
+type PayloadTooLargeErr struct {
+	Message string
+	Code    string
+	Field   string
+}
+
+func (e PayloadTooLargeErr) Error() string {
+	return e.Message
+}
+
+func (e PayloadTooLargeErr) SanitizedError() string {
+	return e.Message
+}
+
+func (e PayloadTooLargeErr) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+func (e PayloadTooLargeErr) ErrorCode() string {
+	return e.Code
+}
+
+func (e PayloadTooLargeErr) ErrorField() string {
+	return e.Field
+}
+
 type ForbiddenRequestErr struct {
 	Message string
+	Code    string
 }
 
 func (f ForbiddenRequestErr) Error() string {
@@ -93,6 +145,14 @@ func (f ForbiddenRequestErr) StatusCode() int {
 	return http.StatusForbidden
 }
 
+func (f ForbiddenRequestErr) ErrorCode() string {
+	return f.Code
+}
+
+func (f ForbiddenRequestErr) ErrorField() string {
+	return ""
+}
+
 type KeyNotFoundError struct {
 	Key model.Key
 }
@@ -114,6 +174,11 @@ func (knfe KeyNotFoundError) StatusCode() int {
 type InternalError struct {
 	Reason    interface{}
 	Retryable bool
+
+	// Unapplied is set on retryable errors which show the operation was
+	// rejected before being applied, such as throttling errors, so writes
+	// which can't be repeated are retried as well. Timeouts can't tell.
+	Unapplied bool
 }
 
 func (ie InternalError) Error() string {
@@ -124,6 +189,34 @@ func (ie InternalError) StatusCode() int {
 	return http.StatusInternalServerError
 }
 
+// Unwrap returns the Reason when it is an error so callers can still
+// match on sentinel errors wrapped by an InternalError.
+func (ie InternalError) Unwrap() error {
+	err, _ := ie.Reason.(error)
+	return err
+}
+
+// IsRetryable returns true if a DB implementation marked the given error
+// as transient through InternalError.Retryable. False otherwise.
+func IsRetryable(err error) bool {
+	var ie InternalError
+	if errors.As(err, &ie) {
+		return ie.Retryable
+	}
+	return false
+}
+
+// IsUnapplied returns true if a DB implementation marked the given error as
+// showing the operation was not applied through InternalError.Unapplied.
+// False otherwise.
+func IsUnapplied(err error) bool {
+	var ie InternalError
+	if errors.As(err, &ie) {
+		return ie.Unapplied
+	}
+	return false
+}
+
 // ItemOperationError is a simple error wrapper for DB operations
 // that apply to specific items. It provides a formatted message with
 // context around the error.
@@ -141,6 +234,25 @@ func (e ItemOperationError) Unwrap() error {
 	return e.Err
 }
 
+// TransactionConditionError reports the operation of a transaction whose
+// condition didn't hold, causing the whole transaction to be aborted. Index is
+// -1 when the store can't tell which operation it was.
+type TransactionConditionError struct {
+	Index int
+	Err   error
+}
+
+func (e TransactionConditionError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("transaction aborted: %v", e.Err)
+	}
+	return fmt.Sprintf("transaction aborted by operation %d: %v", e.Index, e.Err)
+}
+
+func (e TransactionConditionError) Unwrap() error {
+	return e.Err
+}
+
 // GetAllItemsOperationError is the ItemOperation counterpart for
 // the getAllItems operation which applies to a group of items.
 type GetAllItemsOperationErr struct {
@@ -169,6 +281,12 @@ func SanitizeError(err error) error {
 	var errHTTP = ErrHTTPOpFailed
 	if errors.Is(err, ErrItemNotFound) {
 		errHTTP = ErrHTTPItemNotFound
+	} else if errors.Is(err, ErrItemExists) {
+		errHTTP = ErrHTTPItemExists
+	} else if errors.Is(err, ErrItemChanged) {
+		errHTTP = ErrHTTPItemChanged
+	} else if errors.Is(err, ErrNotNumeric) {
+		errHTTP = ErrHTTPNotNumeric
 	}
 	return SanitizedError{Err: err, ErrHTTP: errHTTP}
 }
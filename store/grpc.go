@@ -0,0 +1,509 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/xmidt-org/argus/auth"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store/storepb"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultGRPCMaxPageSize   = 1000
+	defaultGRPCWatchInterval = 5 * time.Second
+	defaultGRPCMaxWatches    = 10
+)
+
+var errInvalidPageToken = BadRequestErr{Message: "Invalid page token.", Code: "invalid_page_token", Field: "page_token"}
+
+// GRPCConfig configures the ArgusStore gRPC service.
+type GRPCConfig struct {
+	// MaxPageSize bounds the number of items of List pages. It doesn't bound
+	// the reads of List, as each page reads the whole bucket.
+	// (Optional) default: 1000
+	MaxPageSize int
+
+	// WatchInterval is how often the buckets watched through Watch are checked
+	// for changes. On backends which don't keep bucket digests, each check
+	// reads the whole bucket.
+	// (Optional) default: 5s
+	WatchInterval time.Duration
+
+	// MaxWatchesPerPrincipal bounds the number of Watch streams a principal
+	// keeps open at once, as each of them polls its bucket until it's closed.
+	// (Optional) default: 10
+	MaxWatchesPerPrincipal int
+}
+
+type grpcStoreIn struct {
+	fx.In
+	GetLogger    func(context.Context) *zap.Logger
+	Store        S
+	Config       *transportConfig
+	Redactor     *redactor
+	GRPC         GRPCConfig `optional:"true"`
+	Authenticate auth.GRPCAuthenticator
+	APIBase      string `name:"api_base"`
+}
+
+// grpcStore serves the ArgusStore gRPC service through the endpoints of the
+// HTTP store API. Calls are authorized as their HTTP equivalents, so the
+// same capabilities, access levels and owner checks apply.
+type grpcStore struct {
+	storepb.UnimplementedArgusStoreServer
+
+	authenticate  auth.GRPCAuthenticator
+	apiBase       string
+	config        *transportConfig
+	redactor      *redactor
+	getLogger     func(context.Context) *zap.Logger
+	store         S
+	maxPageSize   int
+	watchInterval time.Duration
+	maxWatches    int
+
+	watchesLock sync.Mutex
+	watches     map[string]int
+
+	put, get, delete, list kitgrpc.Handler
+}
+
+func newGRPCStore(in grpcStoreIn) storepb.ArgusStoreServer {
+	s := &grpcStore{
+		authenticate:  in.Authenticate,
+		apiBase:       in.APIBase,
+		config:        in.Config,
+		redactor:      in.Redactor,
+		getLogger:     in.GetLogger,
+		store:         in.Store,
+		maxPageSize:   in.GRPC.MaxPageSize,
+		watchInterval: in.GRPC.WatchInterval,
+		maxWatches:    in.GRPC.MaxWatchesPerPrincipal,
+		watches:       make(map[string]int),
+	}
+	if s.maxPageSize <= 0 {
+		s.maxPageSize = defaultGRPCMaxPageSize
+	}
+	if s.watchInterval <= 0 {
+		s.watchInterval = defaultGRPCWatchInterval
+	}
+	if s.maxWatches <= 0 {
+		s.maxWatches = defaultGRPCMaxWatches
+	}
+
+	s.put = kitgrpc.NewServer(newSetItemEndpoint(in.Store), decodeGRPCPutRequest(in.Config), encodeGRPCPutResponse)
+	s.get = kitgrpc.NewServer(newGetItemEndpoint(in.Store), decodeGRPCGetRequest(in.Config), encodeGRPCItemResponse)
+	s.delete = kitgrpc.NewServer(newDeleteItemEndpoint(in.Store), decodeGRPCDeleteRequest(in.Config), encodeGRPCItemResponse)
+	s.list = kitgrpc.NewServer(newGetAllItemsEndpoint(in.Store), decodeGRPCListRequest(in.Config), encodeGRPCListResponse)
+	return s
+}
+
+func (s *grpcStore) Put(ctx context.Context, req *storepb.PutRequest) (*storepb.PutResponse, error) {
+	ctx, err := s.authorize(ctx, http.MethodPut, req.GetBucket(), req.GetItem().GetId(), req.GetOwner())
+	if err != nil {
+		return nil, err
+	}
+	_, response, err := s.put.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, s.grpcError(ctx, err)
+	}
+	return response.(*storepb.PutResponse), nil
+}
+
+func (s *grpcStore) Get(ctx context.Context, req *storepb.GetRequest) (*storepb.Item, error) {
+	ctx, err := s.authorize(ctx, http.MethodGet, req.GetBucket(), req.GetId(), req.GetOwner())
+	if err != nil {
+		return nil, err
+	}
+	ctx = s.redactor.withScope(ctx, req.GetBucket(), req.GetOwner())
+	_, response, err := s.get.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, s.grpcError(ctx, err)
+	}
+	return response.(*storepb.Item), nil
+}
+
+func (s *grpcStore) Delete(ctx context.Context, req *storepb.DeleteRequest) (*storepb.Item, error) {
+	ctx, err := s.authorize(ctx, http.MethodDelete, req.GetBucket(), req.GetId(), req.GetOwner())
+	if err != nil {
+		return nil, err
+	}
+	ctx = s.redactor.withScope(ctx, req.GetBucket(), req.GetOwner())
+	_, response, err := s.delete.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, s.grpcError(ctx, err)
+	}
+	return response.(*storepb.Item), nil
+}
+
+// List pages through the items of a bucket ordered by ID, page tokens holding
+// the last ID of their page. Pages are read from the bucket as it is when
+// they're requested: each of them reads and sorts the whole bucket and only
+// bounds the size of the response.
+func (s *grpcStore) List(ctx context.Context, req *storepb.ListRequest) (*storepb.ListResponse, error) {
+	ctx, err := s.authorize(ctx, http.MethodGet, req.GetBucket(), "", req.GetOwner())
+	if err != nil {
+		return nil, err
+	}
+	after, err := decodePageToken(req.GetPageToken())
+	if err != nil {
+		return nil, s.grpcError(ctx, err)
+	}
+	ctx = s.redactor.withScope(ctx, req.GetBucket(), req.GetOwner())
+	_, response, err := s.list.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, s.grpcError(ctx, err)
+	}
+
+	items := response.([]OwnableItem)
+	start := sort.Search(len(items), func(i int) bool {
+		return items[i].ID > after
+	})
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 || pageSize > s.maxPageSize {
+		pageSize = s.maxPageSize
+	}
+	end := min(start+pageSize, len(items))
+
+	page := &storepb.ListResponse{Items: make([]*storepb.Item, 0, end-start)}
+	for _, item := range items[start:end] {
+		pbItem, err := newProtoItem(item)
+		if err != nil {
+			return nil, s.grpcError(ctx, err)
+		}
+		page.Items = append(page.Items, pbItem)
+	}
+	if end < len(items) {
+		page.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(items[end-1].ID))
+	}
+	return page, nil
+}
+
+// Watch sends the items of a bucket as puts and then polls it, sending the
+// items which changed since the previous poll as puts and the ones which are
+// gone, expired ones included, as deletes. Polls are skipped while the digest
+// kept by the store, if any, is unchanged. Only opening the stream is rate
+// limited, so principals are allowed a bounded number of open streams.
+func (s *grpcStore) Watch(req *storepb.WatchRequest, stream grpc.ServerStreamingServer[storepb.WatchEvent]) error {
+	ctx, err := s.authorize(stream.Context(), http.MethodGet, req.GetBucket(), "", req.GetOwner())
+	if err != nil {
+		return err
+	}
+	done, err := s.startWatch(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	itemsRequest, err := newGetAllItemsRequest(ctx, s.config, req.GetBucket(), req.GetOwner())
+	if err != nil {
+		return s.grpcError(ctx, err)
+	}
+	ctx = s.redactor.withScope(ctx, req.GetBucket(), req.GetOwner())
+
+	var (
+		all     = itemsRequest.adminMode && itemsRequest.owner == ""
+		ticker  = time.NewTicker(s.watchInterval)
+		digests map[string][32]byte
+		last    Digest
+	)
+	defer ticker.Stop()
+	for {
+		digest, err := BucketDigest(s.store, itemsRequest.bucket, itemsRequest.owner, all)
+		tracked := err == nil
+		if err != nil && !errors.Is(err, ErrDigestUnsupported) {
+			return s.grpcError(ctx, err)
+		}
+		if !tracked || digests == nil || digest.Sum != last.Sum {
+			if digests, err = s.sendChanges(ctx, stream, itemsRequest, all, digests); err != nil {
+				return err
+			}
+			last = digest
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendChanges reads the watched bucket and sends the differences with the
+// item digests of the previous read. It returns the digests of this one.
+func (s *grpcStore) sendChanges(ctx context.Context, stream grpc.ServerStreamingServer[storepb.WatchEvent], itemsRequest *getAllItemsRequest, all bool, previous map[string][32]byte) (map[string][32]byte, error) {
+	var (
+		items map[string]OwnableItem
+		err   error
+	)
+	if all {
+		items, err = s.store.GetAll(itemsRequest.bucket)
+	} else {
+		items, err = GetAllByOwner(s.store, itemsRequest.bucket, itemsRequest.owner)
+	}
+	if err != nil {
+		return nil, s.grpcError(ctx, err)
+	}
+
+	digests := make(map[string][32]byte, len(items))
+	for _, item := range sortItems(ctx, items) {
+		digests[item.ID] = ItemDigest(item)
+		if sum, ok := previous[item.ID]; ok && sum == digests[item.ID] {
+			continue
+		}
+		pbItem, err := newProtoItem(item)
+		if err != nil {
+			return nil, s.grpcError(ctx, err)
+		}
+		if err := stream.Send(&storepb.WatchEvent{Type: storepb.WatchEvent_TYPE_PUT, Item: pbItem}); err != nil {
+			return nil, err
+		}
+	}
+
+	deleted := make([]string, 0)
+	for id := range previous {
+		if _, ok := digests[id]; !ok {
+			deleted = append(deleted, id)
+		}
+	}
+	sort.Strings(deleted)
+	for _, id := range deleted {
+		if err := stream.Send(&storepb.WatchEvent{Type: storepb.WatchEvent_TYPE_DELETE, Item: &storepb.Item{Id: id}}); err != nil {
+			return nil, err
+		}
+	}
+	return digests, nil
+}
+
+// startWatch counts a Watch stream of the principal of ctx, failing when it
+// already has as many open as allowed. done ends the stream.
+func (s *grpcStore) startWatch(ctx context.Context) (done func(), err error) {
+	principal := tokenPrincipal(ctx)
+
+	s.watchesLock.Lock()
+	defer s.watchesLock.Unlock()
+	if s.watches[principal] >= s.maxWatches {
+		return nil, status.Error(codes.ResourceExhausted, "Too many open watch streams.")
+	}
+	s.watches[principal]++
+	return func() {
+		s.watchesLock.Lock()
+		defer s.watchesLock.Unlock()
+		if s.watches[principal]--; s.watches[principal] == 0 {
+			delete(s.watches, principal)
+		}
+	}, nil
+}
+
+// authorize runs the call through the auth and rate limiting chain as the HTTP
+// request on the item with the given ID, or on the bucket when it's empty.
+func (s *grpcStore) authorize(ctx context.Context, method, bucket, id, owner string) (context.Context, error) {
+	call := auth.GRPCCall{
+		Method: method,
+		Path:   fmt.Sprintf("/%s/store/%s", s.apiBase, url.PathEscape(bucket)),
+		Vars:   map[string]string{bucketVarKey: bucket},
+		Header: make(http.Header),
+	}
+	if id != "" {
+		call.Path = fmt.Sprintf("%s/%s", call.Path, url.PathEscape(id))
+		call.Vars[idVarKey] = id
+	}
+	if owner != "" {
+		call.Header.Set(ItemOwnerHeaderKey, owner)
+	}
+	return s.authenticate(ctx, call)
+}
+
+// grpcError converts errors to the gRPC status matching the HTTP status code
+// they'd get through the HTTP API, with the same sanitized message.
+func (s *grpcStore) grpcError(ctx context.Context, err error) error {
+	code := http.StatusInternalServerError
+	var statusCoder kithttp.StatusCoder
+	if errors.As(err, &statusCoder) {
+		code = statusCoder.StatusCode()
+	}
+
+	message := http.StatusText(code)
+	var sErrorer sanitizedErrorer
+	if errors.As(err, &sErrorer) {
+		message = sErrorer.SanitizedError()
+	}
+
+	logger := s.getLogger(ctx)
+	if logger != nil && code != http.StatusNotFound {
+		logger.Error("sending non-OK gRPC response", zap.Error(err), zap.Int("code", code))
+	}
+
+	grpcCode := grpcCodes[code]
+	if errors.Is(err, ErrItemExists) {
+		grpcCode = codes.AlreadyExists
+	} else if grpcCode == codes.OK {
+		grpcCode = codes.Internal
+	}
+	return status.Error(grpcCode, message)
+}
+
+// grpcCodes maps the HTTP status codes of errors to gRPC codes.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.Aborted,
+	http.StatusPreconditionFailed:    codes.FailedPrecondition,
+	http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusInsufficientStorage:   codes.ResourceExhausted,
+	http.StatusNotImplemented:        codes.Unimplemented,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+	http.StatusGatewayTimeout:        codes.DeadlineExceeded,
+}
+
+func decodeGRPCPutRequest(config *transportConfig) kitgrpc.DecodeRequestFunc {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*storepb.PutRequest)
+		var (
+			bucket = req.GetBucket()
+			id     = req.GetItem().GetId()
+			owner  = req.GetOwner()
+		)
+		if err := validateItemRequestVars(config, owner, bucket, id); err != nil {
+			return nil, err
+		}
+
+		// items go through the same validation as HTTP request bodies.
+		data, err := json.Marshal(model.Item{
+			ID:   id,
+			Data: req.GetItem().GetData().AsMap(),
+			TTL:  req.GetItem().Ttl,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errPayloadUnmarshalFailure, err)
+		}
+		if config.MaxBodyBytes > 0 && int64(len(data)) > config.MaxBodyBytes {
+			return nil, errBodyTooLarge
+		}
+		item, err := decodeItem(config, bucket, id, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return &setItemRequest{
+			item: OwnableItem{
+				Item:       item,
+				Owner:      owner,
+				ModifiedBy: tokenPrincipal(ctx),
+			},
+			key: model.Key{
+				Bucket: bucket,
+				ID:     id,
+			},
+			adminMode:  hasElevatedAccess(ctx, config.AccessLevelAttributeKey),
+			createOnly: req.GetCreateOnly(),
+		}, nil
+	}
+}
+
+func decodeGRPCGetRequest(config *transportConfig) kitgrpc.DecodeRequestFunc {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*storepb.GetRequest)
+		itemRequest, err := newGetOrDeleteItemRequest(ctx, config, req.GetBucket(), req.GetId(), req.GetOwner())
+		if err != nil {
+			return nil, err
+		}
+		return itemRequest, nil
+	}
+}
+
+func decodeGRPCDeleteRequest(config *transportConfig) kitgrpc.DecodeRequestFunc {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*storepb.DeleteRequest)
+		itemRequest, err := newGetOrDeleteItemRequest(ctx, config, req.GetBucket(), req.GetId(), req.GetOwner())
+		if err != nil {
+			return nil, err
+		}
+		return itemRequest, nil
+	}
+}
+
+func decodeGRPCListRequest(config *transportConfig) kitgrpc.DecodeRequestFunc {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(*storepb.ListRequest)
+		itemsRequest, err := newGetAllItemsRequest(ctx, config, req.GetBucket(), req.GetOwner())
+		if err != nil {
+			return nil, err
+		}
+		return itemsRequest, nil
+	}
+}
+
+func encodeGRPCPutResponse(_ context.Context, response interface{}) (interface{}, error) {
+	r := response.(*setItemResponse)
+	return &storepb.PutResponse{Created: !r.existingResource}, nil
+}
+
+func encodeGRPCItemResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return newProtoItem(redactItem(ctx, *response.(*OwnableItem)))
+}
+
+// encodeGRPCListResponse returns the redacted items of the bucket sorted by ID
+// for List to page through.
+func encodeGRPCListResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return sortItems(ctx, response.(*getAllItemsResponse).items), nil
+}
+
+// sortItems returns the redacted items sorted by ID.
+func sortItems(ctx context.Context, items map[string]OwnableItem) []OwnableItem {
+	list := make([]OwnableItem, 0, len(items))
+	for _, item := range items {
+		list = append(list, redactItem(ctx, item))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func decodePageToken(token string) (string, error) {
+	after, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", errInvalidPageToken
+	}
+	return string(after), nil
+}
+
+func newProtoItem(item OwnableItem) (*storepb.Item, error) {
+	data, err := structpb.NewStruct(item.Data)
+	if err != nil {
+		return nil, SanitizeError(fmt.Errorf("%w: %v", ErrJSONEncode, err))
+	}
+	pbItem := &storepb.Item{
+		Id:   item.ID,
+		Data: data,
+		Ttl:  item.TTL,
+	}
+	if !item.LastModified.IsZero() {
+		pbItem.LastModified = timestamppb.New(item.LastModified)
+	}
+	return pbItem, nil
+}
@@ -0,0 +1,479 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/auth"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store/storepb"
+	"github.com/xmidt-org/bascule"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	grpcTestBucket = "bucket"
+	grpcTestOwner  = "owner-name"
+	grpcTestID     = "7e8c5f378b4addbaebc70897c4478cca06009e3e360208ebd073dbee4b3774e7"
+)
+
+// grpcTestStore is a map backed store safe for concurrent use. It ignores TTLs.
+type grpcTestStore struct {
+	lock  sync.Mutex
+	items map[model.Key]OwnableItem
+}
+
+func (s *grpcTestStore) Push(key model.Key, item OwnableItem) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.items[key] = item
+	return nil
+}
+
+func (s *grpcTestStore) PushIfAbsent(key model.Key, item OwnableItem) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.items[key]; ok {
+		return SanitizeError(ErrItemExists)
+	}
+	s.items[key] = item
+	return nil
+}
+
+func (s *grpcTestStore) Get(key model.Key) (OwnableItem, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	item, ok := s.items[key]
+	if !ok {
+		return item, SanitizeError(ErrItemNotFound)
+	}
+	return item, nil
+}
+
+func (s *grpcTestStore) Delete(key model.Key) (OwnableItem, error) {
+	item, err := s.Get(key)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.items, key)
+	return item, err
+}
+
+func (s *grpcTestStore) GetAll(bucket string) (map[string]OwnableItem, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	items := make(map[string]OwnableItem)
+	for key, item := range s.items {
+		if key.Bucket == bucket {
+			items[key.ID] = item
+		}
+	}
+	return items, nil
+}
+
+// testAuthChain stands in for the bascule chain: "Bearer admin" gets elevated
+// access, "Bearer user" doesn't and other requests are unauthorized.
+func testAuthChain(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var accessLevel int
+		switch r.Header.Get("Authorization") {
+		case "Bearer admin":
+			accessLevel = auth.ElevatedAccessLevelAttributeValue
+		case "Bearer user":
+			accessLevel = auth.DefaultAccessLevelAttributeValue
+		default:
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/api/v1/store/") {
+			rw.WriteHeader(http.StatusForbidden)
+			return
+		}
+		attributes := bascule.NewAttributes(map[string]interface{}{
+			auth.DefaultAccessLevelAttributeKey: accessLevel,
+		})
+		ctx := bascule.WithAuthentication(r.Context(), bascule.Authentication{
+			Authorization: bascule.Authorization("Bearer"),
+			Token:         bascule.NewToken("Bearer", "testUser", attributes),
+		})
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// testRateLimitChain stands in for the rate limiting chain, limiting the
+// requests on the limited bucket or for the limited owner.
+func testRateLimitChain(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)[bucketVarKey] == "limited" || r.Header.Get(ItemOwnerHeaderKey) == "limited" {
+			rw.Header().Set("Retry-After", "3")
+			rw.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func newTestGRPCClient(t *testing.T, s S) storepb.ArgusStoreClient {
+	return newTestGRPCClientWithConfig(t, s, GRPCConfig{MaxPageSize: 2, WatchInterval: 10 * time.Millisecond})
+}
+
+func newTestGRPCClientWithConfig(t *testing.T, s S, config GRPCConfig) storepb.ArgusStoreClient {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	storepb.RegisterArgusStoreServer(server, newGRPCStore(grpcStoreIn{
+		GetLogger:    func(context.Context) *zap.Logger { return nil },
+		Store:        s,
+		Config:       getTestTransportConfig(),
+		Redactor:     newRedactor(redactorIn{}),
+		GRPC:         config,
+		Authenticate: auth.NewGRPCAuthenticator(alice.New(testAuthChain, testRateLimitChain)),
+		APIBase:      "api/v1",
+	}))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return storepb.NewArgusStoreClient(conn)
+}
+
+func withCredentials(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func newTestPBItem(t *testing.T, id string, data map[string]interface{}) *storepb.Item {
+	pbData, err := structpb.NewStruct(data)
+	require.NoError(t, err)
+	return &storepb.Item{Id: id, Data: pbData, Ttl: int64Ptr(60)}
+}
+
+func TestGRPCStore(t *testing.T) {
+	key := model.Key{Bucket: grpcTestBucket, ID: grpcTestID}
+	stored := OwnableItem{
+		Item:  model.Item{ID: grpcTestID, Data: map[string]interface{}{"k": "v"}, TTL: int64Ptr(60)},
+		Owner: grpcTestOwner,
+	}
+
+	tcs := []struct {
+		Description  string
+		Token        string
+		Call         func(context.Context, storepb.ArgusStoreClient) (interface{}, error)
+		ExpectedCode codes.Code
+		Expected     interface{}
+	}{
+		{
+			Description: "Unauthenticated",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				return c.Get(ctx, &storepb.GetRequest{Bucket: grpcTestBucket, Id: grpcTestID, Owner: grpcTestOwner})
+			},
+			ExpectedCode: codes.Unauthenticated,
+		},
+		{
+			Description: "Get",
+			Token:       "user",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				item, err := c.Get(ctx, &storepb.GetRequest{Bucket: grpcTestBucket, Id: grpcTestID, Owner: grpcTestOwner})
+				return item.GetData().AsMap(), err
+			},
+			Expected: map[string]interface{}{"k": "v"},
+		},
+		{
+			Description: "Get of another owner",
+			Token:       "user",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				return c.Get(ctx, &storepb.GetRequest{Bucket: grpcTestBucket, Id: grpcTestID, Owner: "otherOwner"})
+			},
+			ExpectedCode: codes.PermissionDenied,
+		},
+		{
+			Description: "Get of another owner with elevated access",
+			Token:       "admin",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				item, err := c.Get(ctx, &storepb.GetRequest{Bucket: grpcTestBucket, Id: grpcTestID, Owner: "otherOwner"})
+				return item.GetData().AsMap(), err
+			},
+			Expected: map[string]interface{}{"k": "v"},
+		},
+		{
+			Description: "Get of a missing item",
+			Token:       "user",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				return c.Get(ctx, &storepb.GetRequest{Bucket: "other", Id: grpcTestID, Owner: grpcTestOwner})
+			},
+			ExpectedCode: codes.NotFound,
+		},
+		{
+			Description: "Invalid ID",
+			Token:       "user",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				return c.Get(ctx, &storepb.GetRequest{Bucket: grpcTestBucket, Id: "id", Owner: grpcTestOwner})
+			},
+			ExpectedCode: codes.InvalidArgument,
+		},
+		{
+			Description: "Put replacing an item",
+			Token:       "user",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				response, err := c.Put(ctx, &storepb.PutRequest{
+					Bucket: grpcTestBucket,
+					Owner:  grpcTestOwner,
+					Item:   newTestPBItem(t, grpcTestID, map[string]interface{}{"k": "w"}),
+				})
+				return response.GetCreated(), err
+			},
+			Expected: false,
+		},
+		{
+			Description: "Put creating an item",
+			Token:       "user",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				response, err := c.Put(ctx, &storepb.PutRequest{
+					Bucket:     "other",
+					Owner:      grpcTestOwner,
+					Item:       newTestPBItem(t, grpcTestID, map[string]interface{}{"k": "w"}),
+					CreateOnly: true,
+				})
+				return response.GetCreated(), err
+			},
+			Expected: true,
+		},
+		{
+			Description: "Create-only put of an existing item",
+			Token:       "user",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				return c.Put(ctx, &storepb.PutRequest{
+					Bucket:     grpcTestBucket,
+					Owner:      grpcTestOwner,
+					Item:       newTestPBItem(t, grpcTestID, map[string]interface{}{"k": "w"}),
+					CreateOnly: true,
+				})
+			},
+			ExpectedCode: codes.AlreadyExists,
+		},
+		{
+			Description: "Put of another owner's item",
+			Token:       "user",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				return c.Put(ctx, &storepb.PutRequest{
+					Bucket: grpcTestBucket,
+					Owner:  "otherOwner",
+					Item:   newTestPBItem(t, grpcTestID, map[string]interface{}{"k": "w"}),
+				})
+			},
+			ExpectedCode: codes.PermissionDenied,
+		},
+		{
+			Description: "Put of data too deep",
+			Token:       "user",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				return c.Put(ctx, &storepb.PutRequest{
+					Bucket: grpcTestBucket,
+					Owner:  grpcTestOwner,
+					Item:   newTestPBItem(t, grpcTestID, map[string]interface{}{"k": map[string]interface{}{"k": "v"}}),
+				})
+			},
+			ExpectedCode: codes.InvalidArgument,
+		},
+		{
+			Description: "Delete",
+			Token:       "user",
+			Call: func(ctx context.Context, c storepb.ArgusStoreClient) (interface{}, error) {
+				item, err := c.Delete(ctx, &storepb.DeleteRequest{Bucket: grpcTestBucket, Id: grpcTestID, Owner: grpcTestOwner})
+				return item.GetId(), err
+			},
+			Expected: grpcTestID,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			s := &grpcTestStore{items: map[model.Key]OwnableItem{key: stored}}
+			ctx := context.Background()
+			if tc.Token != "" {
+				ctx = withCredentials(ctx, tc.Token)
+			}
+
+			response, err := tc.Call(ctx, newTestGRPCClient(t, s))
+			assert.Equal(tc.ExpectedCode, status.Code(err))
+			if tc.ExpectedCode == codes.OK {
+				assert.Equal(tc.Expected, response)
+			}
+		})
+	}
+}
+
+func TestGRPCStoreList(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := &grpcTestStore{items: map[model.Key]OwnableItem{}}
+	ids := []string{"a", "b", "c", "d", "e"}
+	for _, id := range ids {
+		s.items[model.Key{Bucket: grpcTestBucket, ID: id}] = OwnableItem{
+			Item:  model.Item{ID: id, Data: map[string]interface{}{"id": id}},
+			Owner: grpcTestOwner,
+		}
+	}
+	s.items[model.Key{Bucket: grpcTestBucket, ID: "f"}] = OwnableItem{
+		Item:  model.Item{ID: "f", Data: map[string]interface{}{}},
+		Owner: "otherOwner",
+	}
+	client := newTestGRPCClient(t, s)
+	ctx := withCredentials(context.Background(), "user")
+
+	var (
+		listed []string
+		token  string
+		pages  int
+	)
+	for {
+		page, err := client.List(ctx, &storepb.ListRequest{Bucket: grpcTestBucket, Owner: grpcTestOwner, PageToken: token})
+		require.NoError(err)
+		pages++
+		for _, item := range page.GetItems() {
+			listed = append(listed, item.GetId())
+		}
+		if token = page.GetNextPageToken(); token == "" {
+			break
+		}
+	}
+	assert.Equal(ids, listed)
+	assert.Equal(3, pages)
+
+	_, err := client.List(ctx, &storepb.ListRequest{Bucket: grpcTestBucket, Owner: grpcTestOwner, PageToken: "!"})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCStoreWatch(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := &grpcTestStore{items: map[model.Key]OwnableItem{
+		{Bucket: grpcTestBucket, ID: "a"}: {Item: model.Item{ID: "a", Data: map[string]interface{}{"v": 1.0}}, Owner: grpcTestOwner},
+		{Bucket: grpcTestBucket, ID: "b"}: {Item: model.Item{ID: "b", Data: map[string]interface{}{"v": 1.0}}, Owner: grpcTestOwner},
+	}}
+	client := newTestGRPCClient(t, s)
+	ctx, cancel := context.WithTimeout(withCredentials(context.Background(), "user"), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &storepb.WatchRequest{Bucket: grpcTestBucket, Owner: grpcTestOwner})
+	require.NoError(err)
+	next := func() (storepb.WatchEvent_Type, string) {
+		event, err := stream.Recv()
+		require.NoError(err)
+		return event.GetType(), event.GetItem().GetId()
+	}
+
+	for _, id := range []string{"a", "b"} {
+		eventType, eventID := next()
+		assert.Equal(storepb.WatchEvent_TYPE_PUT, eventType)
+		assert.Equal(id, eventID)
+	}
+
+	require.NoError(s.Push(model.Key{Bucket: grpcTestBucket, ID: "a"}, OwnableItem{
+		Item:  model.Item{ID: "a", Data: map[string]interface{}{"v": 2.0}},
+		Owner: grpcTestOwner,
+	}))
+	eventType, eventID := next()
+	assert.Equal(storepb.WatchEvent_TYPE_PUT, eventType)
+	assert.Equal("a", eventID)
+
+	_, err = s.Delete(model.Key{Bucket: grpcTestBucket, ID: "b"})
+	require.NoError(err)
+	eventType, eventID = next()
+	assert.Equal(storepb.WatchEvent_TYPE_DELETE, eventType)
+	assert.Equal("b", eventID)
+}
+
+func TestGRPCStoreRateLimit(t *testing.T) {
+	tcs := []struct {
+		Description string
+		Bucket      string
+		Owner       string
+		ExpectedErr codes.Code
+	}{
+		{
+			Description: "Not limited",
+			Bucket:      grpcTestBucket,
+			Owner:       grpcTestOwner,
+			ExpectedErr: codes.NotFound,
+		},
+		{
+			Description: "Limited bucket",
+			Bucket:      "limited",
+			Owner:       grpcTestOwner,
+			ExpectedErr: codes.ResourceExhausted,
+		},
+		{
+			Description: "Limited owner",
+			Bucket:      grpcTestBucket,
+			Owner:       "limited",
+			ExpectedErr: codes.ResourceExhausted,
+		},
+	}
+
+	client := newTestGRPCClient(t, &grpcTestStore{items: map[model.Key]OwnableItem{}})
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			var header metadata.MD
+			_, err := client.Get(withCredentials(context.Background(), "user"),
+				&storepb.GetRequest{Bucket: tc.Bucket, Id: grpcTestID, Owner: tc.Owner},
+				grpc.Header(&header))
+			assert.Equal(tc.ExpectedErr, status.Code(err))
+			if tc.ExpectedErr == codes.ResourceExhausted {
+				assert.Equal([]string{"3"}, header.Get("retry-after"))
+			}
+		})
+	}
+}
+
+func TestGRPCStoreWatchLimit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := &grpcTestStore{items: map[model.Key]OwnableItem{
+		{Bucket: grpcTestBucket, ID: "a"}: {Item: model.Item{ID: "a", Data: map[string]interface{}{"v": 1.0}}, Owner: grpcTestOwner},
+	}}
+	client := newTestGRPCClientWithConfig(t, s, GRPCConfig{WatchInterval: 10 * time.Millisecond, MaxWatchesPerPrincipal: 1})
+	watch := func(ctx context.Context) error {
+		stream, err := client.Watch(withCredentials(ctx, "user"), &storepb.WatchRequest{Bucket: grpcTestBucket, Owner: grpcTestOwner})
+		if err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	first, cancelFirst := context.WithCancel(ctx)
+	require.NoError(watch(first))
+	assert.Equal(codes.ResourceExhausted, status.Code(watch(ctx)))
+
+	cancelFirst()
+	require.Eventually(func() bool {
+		return watch(ctx) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
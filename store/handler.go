@@ -28,14 +28,16 @@ type handlerIn struct {
 	GetLogger func(context.Context) *zap.Logger
 	Store     S
 	Config    *transportConfig
+	Redactor  *redactor
 }
 
 func newGetItemHandler(in handlerIn) Handler {
 	return kithttp.NewServer(
 		newGetItemEndpoint(in.Store),
 		getOrDeleteItemRequestDecoder(in.Config),
-		encodeGetOrDeleteItemResponse,
-		kithttp.ServerErrorEncoder(encodeError(in.GetLogger)),
+		encodeGetItemResponse,
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
+		kithttp.ServerBefore(kithttp.PopulateRequestContext, in.Redactor.captureScope, captureConditions),
 	)
 }
 
@@ -44,7 +46,8 @@ func newDeleteItemHandler(in handlerIn) Handler {
 		newDeleteItemEndpoint(in.Store),
 		getOrDeleteItemRequestDecoder(in.Config),
 		encodeGetOrDeleteItemResponse,
-		kithttp.ServerErrorEncoder(encodeError(in.GetLogger)),
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
+		kithttp.ServerBefore(kithttp.PopulateRequestContext, in.Redactor.captureScope),
 	)
 }
 
@@ -53,7 +56,8 @@ func newGetAllItemsHandler(in handlerIn) Handler {
 		newGetAllItemsEndpoint(in.Store),
 		getAllItemsRequestDecoder(in.Config),
 		encodeGetAllItemsResponse,
-		kithttp.ServerErrorEncoder(encodeError(in.GetLogger)),
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
+		kithttp.ServerBefore(kithttp.PopulateRequestContext, in.Redactor.captureScope, captureConditions),
 	)
 }
 
@@ -62,6 +66,6 @@ func newSetItemHandler(in handlerIn) Handler {
 		newSetItemEndpoint(in.Store),
 		setItemRequestDecoder(in.Config),
 		encodeSetItemResponse,
-		kithttp.ServerErrorEncoder(encodeError(in.GetLogger)),
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
 	)
 }
@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/xmidt-org/argus/model"
+)
+
+var (
+	errIncrementPathMissing = BadRequestErr{Message: "Increment path must be set.", Code: "increment_path_missing", Field: "path"}
+	errInvalidIncrementPath = BadRequestErr{Message: "Increment path must be dot separated field names within the max item data depth.", Code: "invalid_increment_path", Field: "path"}
+)
+
+// IncrementData adds delta to the number at path in data, a missing field
+// counting as 0, and returns the new value. Each path element is a field name,
+// all but the last one naming existing objects. Errors wrap ErrNotNumeric.
+// data is modified in place so stores should pass a copy they own.
+func IncrementData(data map[string]interface{}, path []string, delta float64) (float64, error) {
+	if len(path) == 0 {
+		return 0, fmt.Errorf("%w: empty path", ErrNotNumeric)
+	}
+	if data == nil {
+		return 0, fmt.Errorf("%w: item has no data", ErrNotNumeric)
+	}
+	parent := data
+	for i, field := range path[:len(path)-1] {
+		child, ok := parent[field].(map[string]interface{})
+		if !ok {
+			return 0, fmt.Errorf("%w: %s isn't an object", ErrNotNumeric, strings.Join(path[:i+1], "."))
+		}
+		parent = child
+	}
+
+	field := path[len(path)-1]
+	var current float64
+	switch v := parent[field].(type) {
+	case nil:
+		if _, ok := parent[field]; ok {
+			return 0, fmt.Errorf("%w: %s is null", ErrNotNumeric, strings.Join(path, "."))
+		}
+	case float64:
+		current = v
+	case float32:
+		current = float64(v)
+	case int:
+		current = float64(v)
+	case int64:
+		current = float64(v)
+	case int32:
+		current = float64(v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrNotNumeric, err)
+		}
+		current = f
+	default:
+		return 0, fmt.Errorf("%w: %s is a %T", ErrNotNumeric, strings.Join(path, "."), v)
+	}
+	parent[field] = current + delta
+	return current + delta, nil
+}
+
+type incrementItemRequest struct {
+	key       model.Key
+	owner     string
+	principal string
+	adminMode bool
+	path      []string
+	delta     float64
+}
+
+type incrementBody struct {
+	Path  string   `json:"path"`
+	Delta *float64 `json:"delta"`
+}
+
+type incrementItemResponse struct {
+	Value float64 `json:"value"`
+}
+
+func newIncrementItemHandler(in handlerIn) Handler {
+	return kithttp.NewServer(
+		newIncrementItemEndpoint(in.Store),
+		incrementItemRequestDecoder(in.Config),
+		encodeIncrementItemResponse,
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
+	)
+}
+
+func newIncrementItemEndpoint(s S) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		incrementRequest := request.(*incrementItemRequest)
+		itemResponse, err := s.Get(incrementRequest.key)
+		if err != nil {
+			return nil, err
+		}
+		if !authorized(incrementRequest.adminMode, itemResponse.Owner, incrementRequest.owner) {
+			return nil, accessDeniedErr
+		}
+
+		value, err := Increment(s, incrementRequest.key, incrementRequest.path, incrementRequest.delta, incrementRequest.principal)
+		if err != nil {
+			return nil, err
+		}
+		return &incrementItemResponse{Value: value}, nil
+	}
+}
+
+// incrementItemRequestDecoder reads the dot separated path of the field and
+// the delta, which defaults to 1.
+func incrementItemRequestDecoder(config *transportConfig) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		var (
+			URLVars = mux.Vars(r)
+			id      = URLVars[idVarKey]
+			bucket  = URLVars[bucketVarKey]
+			owner   = r.Header.Get(ItemOwnerHeaderKey)
+		)
+
+		if err := validateItemRequestVars(config, owner, bucket, id); err != nil {
+			return nil, err
+		}
+
+		data, err := readBody(config, r)
+		if err != nil {
+			return nil, err
+		}
+		var body incrementBody
+		if err := json.Unmarshal(data, &body); err != nil {
+			return nil, fmt.Errorf("%w: %v", errPayloadUnmarshalFailure, err)
+		}
+		if body.Path == "" {
+			return nil, errIncrementPathMissing
+		}
+		path := strings.Split(body.Path, ".")
+		if uint(len(path)) > config.ItemDataMaxDepth+1 {
+			return nil, errInvalidIncrementPath
+		}
+		for _, field := range path {
+			if field == "" {
+				return nil, errInvalidIncrementPath
+			}
+		}
+		if isReservedDataKey(path[0]) {
+			return nil, errReservedDataField
+		}
+
+		delta := 1.0
+		if body.Delta != nil {
+			delta = *body.Delta
+		}
+
+		return &incrementItemRequest{
+			key: model.Key{
+				Bucket: bucket,
+				ID:     id,
+			},
+			owner:     owner,
+			principal: tokenPrincipal(ctx),
+			adminMode: hasElevatedAccess(ctx, config.AccessLevelAttributeKey),
+			path:      path,
+			delta:     delta,
+		}, nil
+	}
+}
+
+func encodeIncrementItemResponse(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
+	data, err := json.Marshal(response.(*incrementItemResponse))
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.Write(data)
+	return nil
+}
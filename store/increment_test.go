@@ -0,0 +1,216 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/xmidt-org/argus/model"
+)
+
+func TestIncrementData(t *testing.T) {
+	tcs := []struct {
+		Description   string
+		Data          map[string]interface{}
+		Path          []string
+		ExpectedValue float64
+		ExpectedErr   error
+	}{
+		{
+			Description:   "Float",
+			Data:          map[string]interface{}{"count": 1.5},
+			Path:          []string{"count"},
+			ExpectedValue: 3.5,
+		},
+		{
+			Description:   "Integer",
+			Data:          map[string]interface{}{"count": int64(1)},
+			Path:          []string{"count"},
+			ExpectedValue: 3,
+		},
+		{
+			Description:   "JSON number",
+			Data:          map[string]interface{}{"count": json.Number("4")},
+			Path:          []string{"count"},
+			ExpectedValue: 6,
+		},
+		{
+			Description:   "Missing field",
+			Data:          map[string]interface{}{"counters": map[string]interface{}{}},
+			Path:          []string{"counters", "requests"},
+			ExpectedValue: 2,
+		},
+		{
+			Description: "Missing parent",
+			Data:        map[string]interface{}{},
+			Path:        []string{"counters", "requests"},
+			ExpectedErr: ErrNotNumeric,
+		},
+		{
+			Description: "String",
+			Data:        map[string]interface{}{"count": "1"},
+			Path:        []string{"count"},
+			ExpectedErr: ErrNotNumeric,
+		},
+		{
+			Description: "Null",
+			Data:        map[string]interface{}{"count": nil},
+			Path:        []string{"count"},
+			ExpectedErr: ErrNotNumeric,
+		},
+		{
+			Description: "No data",
+			Path:        []string{"count"},
+			ExpectedErr: ErrNotNumeric,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			value, err := IncrementData(tc.Data, tc.Path, 2)
+			assert.ErrorIs(err, tc.ExpectedErr)
+			assert.Equal(tc.ExpectedValue, value)
+			if tc.ExpectedErr == nil {
+				parent := tc.Data
+				for _, field := range tc.Path[:len(tc.Path)-1] {
+					parent = parent[field].(map[string]interface{})
+				}
+				assert.Equal(tc.ExpectedValue, parent[tc.Path[len(tc.Path)-1]])
+			}
+		})
+	}
+}
+
+func TestIncrementItemEndpoint(t *testing.T) {
+	key := model.Key{Bucket: "counters", ID: "id"}
+	path := []string{"count"}
+	tcs := []struct {
+		Description   string
+		Store         func() S
+		Owner         string
+		ExpectedValue interface{}
+		ExpectedErr   error
+	}{
+		{
+			Description: "Incremented",
+			Store: func() S {
+				m := new(MockIncrementerDAO)
+				m.On("Get", key).Return(OwnableItem{Owner: "owner"}, nil)
+				m.On("Increment", key, path, float64(1), "writer").Return(float64(5), nil)
+				return m
+			},
+			Owner:         "owner",
+			ExpectedValue: &incrementItemResponse{Value: 5},
+		},
+		{
+			Description: "Owner mismatch",
+			Store: func() S {
+				m := new(MockIncrementerDAO)
+				m.On("Get", key).Return(OwnableItem{Owner: "owner"}, nil)
+				return m
+			},
+			Owner:       "other",
+			ExpectedErr: accessDeniedErr,
+		},
+		{
+			Description: "Missing item",
+			Store: func() S {
+				m := new(MockIncrementerDAO)
+				m.On("Get", key).Return(OwnableItem{}, ErrItemNotFound)
+				return m
+			},
+			ExpectedErr: ErrItemNotFound,
+		},
+		{
+			Description: "Increments unsupported",
+			Store: func() S {
+				m := new(MockDAO)
+				m.On("Get", key).Return(OwnableItem{}, nil)
+				return m
+			},
+			ExpectedErr: errIncrementUnsupported,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			endpoint := newIncrementItemEndpoint(tc.Store())
+			value, err := endpoint(context.Background(), &incrementItemRequest{key: key, owner: tc.Owner, principal: "writer", path: path, delta: 1})
+			assert.ErrorIs(err, tc.ExpectedErr)
+			if tc.ExpectedErr == nil {
+				assert.Equal(tc.ExpectedValue, value)
+			}
+		})
+	}
+}
+
+func TestIncrementItemRequestDecoder(t *testing.T) {
+	key := model.Key{Bucket: "counters", ID: "7e8c5f378b4addbaebc70897c4478cca06009e3e360208ebd073dbee4b3774e7"}
+	tcs := []struct {
+		Description     string
+		Body            string
+		ExpectedRequest interface{}
+		ExpectedErr     error
+	}{
+		{
+			Description:     "Default delta",
+			Body:            `{"path": "counters.requests"}`,
+			ExpectedRequest: &incrementItemRequest{key: key, path: []string{"counters", "requests"}, delta: 1},
+		},
+		{
+			Description:     "Negative delta",
+			Body:            `{"path": "count", "delta": -2.5}`,
+			ExpectedRequest: &incrementItemRequest{key: key, path: []string{"count"}, delta: -2.5},
+		},
+		{
+			Description: "Missing path",
+			Body:        `{"delta": 1}`,
+			ExpectedErr: errIncrementPathMissing,
+		},
+		{
+			Description: "Empty field",
+			Body:        `{"path": "counters..requests"}`,
+			ExpectedErr: errInvalidIncrementPath,
+		},
+		{
+			Description: "Too deep",
+			Body:        `{"path": "a.b.c"}`,
+			ExpectedErr: errInvalidIncrementPath,
+		},
+		{
+			Description: "Reserved field",
+			Body:        `{"path": "$compressed.data"}`,
+			ExpectedErr: errReservedDataField,
+		},
+		{
+			Description: "Bad payload",
+			Body:        `{`,
+			ExpectedErr: errPayloadUnmarshalFailure,
+		},
+	}
+
+	decoder := incrementItemRequestDecoder(getTestTransportConfig())
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			r := httptest.NewRequest(http.MethodPost, "http://localhost/test", bytes.NewBufferString(tc.Body))
+			r = mux.SetURLVars(r, map[string]string{bucketVarKey: key.Bucket, idVarKey: key.ID})
+
+			request, err := decoder(context.Background(), r)
+			assert.ErrorIs(err, tc.ExpectedErr)
+			if tc.ExpectedErr == nil {
+				assert.Equal(tc.ExpectedRequest, request)
+			}
+		})
+	}
+}
@@ -3,7 +3,11 @@
 /*
 Package inmem implements the store DAO interface. This implementation is meant
 to help get an instance of Argus up and running quickly without a need to setup
-a dedicated DB. Since the current implementation is not scalable, it is recommended
-for test environments only.
+a dedicated DB. Items can be persisted to a local directory through snapshots and a
+write log but aren't shared between instances, so it is recommended for test and
+single node environments only.
+
+Sharded is the implementation used by Argus. InMem, guarding all buckets with a
+single lock, is kept as a baseline for its benchmarks.
 */
 package inmem
@@ -0,0 +1,371 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package inmem
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSnapshotInterval = 5 * time.Minute
+
+	snapshotFile  = "snapshot.json"
+	logFilePrefix = "writes-"
+	logFileSuffix = ".log"
+
+	pushOp   = "push"
+	deleteOp = "delete"
+	batchOp  = "batch"
+)
+
+// PersistenceConfig configures the snapshots and write log which let the
+// in-memory store survive restarts.
+type PersistenceConfig struct {
+	// Dir is the directory holding the snapshot and the write logs. It's
+	// created when missing.
+	Dir string
+
+	// SnapshotInterval is the time between two snapshots. Each snapshot
+	// replaces the write log covering the period before it.
+	// (Optional) defaults to 5m.
+	SnapshotInterval time.Duration
+}
+
+// record is a write log entry. Snapshots are made of push records. Batch
+// records hold the writes of a transaction.
+type record struct {
+	Op      string             `json:"op"`
+	Bucket  string             `json:"bucket,omitempty"`
+	ID      string             `json:"id,omitempty"`
+	Item    *store.OwnableItem `json:"item,omitempty"`
+	Expires *time.Time         `json:"expires,omitempty"`
+	Records []record           `json:"records,omitempty"`
+}
+
+type snapshot struct {
+	// Seq is the sequence number of the first write log not covered by the snapshot.
+	Seq     int      `json:"seq"`
+	Records []record `json:"records"`
+}
+
+// persister appends the writes of the store to a log and periodically rotates
+// it, saving a snapshot of the store covering the rotated logs.
+type persister struct {
+	config PersistenceConfig
+	logger *zap.Logger
+
+	// lock guards the log. Writers take it while holding their shard lock
+	// so the log keeps the order of the writes to a key.
+	lock sync.Mutex
+	log  *os.File
+	seq  int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newPersister(config PersistenceConfig, logger *zap.Logger) *persister {
+	if config.SnapshotInterval <= 0 {
+		config.SnapshotInterval = defaultSnapshotInterval
+	}
+	return &persister{
+		config: config,
+		logger: logger,
+	}
+}
+
+func (p *persister) logPath(seq int) string {
+	return filepath.Join(p.config.Dir, fmt.Sprintf("%s%d%s", logFilePrefix, seq, logFileSuffix))
+}
+
+// append writes a record to the log.
+func (p *persister) append(r record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.log == nil {
+		return errors.New("write log is closed")
+	}
+	_, err = p.log.Write(append(data, '\n'))
+	return err
+}
+
+// Open restores the items of the last snapshot and write logs, dropping the
+// expired ones, and starts taking snapshots. It's a no-op without persistence.
+func (s *Sharded) Open() error {
+	p := s.persister
+	if p == nil {
+		return nil
+	}
+	if err := os.MkdirAll(p.config.Dir, 0o750); err != nil {
+		return err
+	}
+	seq, err := s.restore()
+	if err != nil {
+		return err
+	}
+
+	// Save what was restored so older logs, possibly with a torn last line,
+	// are never appended to nor replayed again.
+	p.seq = seq
+	if err := s.snapshot(); err != nil {
+		return err
+	}
+
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go s.snapshotLoop()
+	return nil
+}
+
+// Close stops taking snapshots and saves a final one. It's a no-op without persistence.
+func (s *Sharded) Close() error {
+	p := s.persister
+	if p == nil || p.stop == nil {
+		return nil
+	}
+	close(p.stop)
+	<-p.done
+	err := s.snapshot()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if closeErr := p.log.Close(); err == nil {
+		err = closeErr
+	}
+	p.log = nil
+	return err
+}
+
+func (s *Sharded) snapshotLoop() {
+	p := s.persister
+	defer close(p.done)
+	ticker := time.NewTicker(p.config.SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			if err := s.snapshot(); err != nil {
+				p.logger.Error("failed to snapshot in-memory store", zap.Error(err))
+			}
+		}
+	}
+}
+
+// snapshot switches writes to a new log then saves the live items, which
+// include every write of the previous logs, and removes those logs.
+func (s *Sharded) snapshot() error {
+	p := s.persister
+	for _, sh := range s.shards {
+		sh.lock.RLock()
+	}
+	now := s.now()
+	snap := snapshot{Records: []record{}}
+	for _, sh := range s.shards {
+		for bucketName, bucket := range sh.buckets {
+			for id, item := range bucket {
+				if item.live(now) {
+					snap.Records = append(snap.Records, newPushRecord(model.Key{Bucket: bucketName, ID: id}, item))
+				}
+			}
+		}
+	}
+
+	p.lock.Lock()
+	log, err := os.OpenFile(p.logPath(p.seq+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err == nil {
+		if p.log != nil {
+			p.log.Close()
+		}
+		p.log = log
+		p.seq++
+	}
+	snap.Seq = p.seq
+	p.lock.Unlock()
+	for _, sh := range s.shards {
+		sh.lock.RUnlock()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(filepath.Join(p.config.Dir, snapshotFile), snap); err != nil {
+		return err
+	}
+	seqs, err := p.logSeqs()
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		if seq < snap.Seq {
+			if err := os.Remove(p.logPath(seq)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restore loads the snapshot then replays the logs written after it. It
+// returns the sequence number of the last log.
+func (s *Sharded) restore() (int, error) {
+	p := s.persister
+	var snap snapshot
+	data, err := os.ReadFile(filepath.Join(p.config.Dir, snapshotFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return 0, err
+	default:
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return 0, fmt.Errorf("failed to decode snapshot: %w", err)
+		}
+	}
+
+	now := s.now()
+	for _, r := range snap.Records {
+		s.replay(r, now)
+	}
+
+	seqs, err := p.logSeqs()
+	if err != nil {
+		return 0, err
+	}
+	last := snap.Seq
+	for _, seq := range seqs {
+		if seq < snap.Seq {
+			continue
+		}
+		if err := s.replayLog(p.logPath(seq), now); err != nil {
+			return 0, err
+		}
+		last = seq
+	}
+	return last, nil
+}
+
+// replayLog applies the records of a log. A last line which can't be decoded
+// is a write interrupted by a crash and is ignored.
+func (s *Sharded) replayLog(path string, now time.Time) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(data) > 0 {
+				s.persister.logger.Warn("ignoring incomplete write log entry", zap.String("path", path), zap.Int("line", line))
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var r record
+		if err := json.Unmarshal(data, &r); err != nil {
+			return fmt.Errorf("failed to decode %s line %d: %w", path, line, err)
+		}
+		s.replay(r, now)
+	}
+}
+
+// replay applies a record, skipping items which expired since.
+func (s *Sharded) replay(r record, now time.Time) {
+	if r.Op == batchOp {
+		for _, batched := range r.Records {
+			s.replay(batched, now)
+		}
+		return
+	}
+	sh := s.shard(r.Bucket)
+	bucket := sh.buckets[r.Bucket]
+	switch r.Op {
+	case pushOp:
+		item := expireableItem{expiration: r.Expires}
+		if r.Item != nil {
+			item.OwnableItem = *r.Item
+		}
+		if !item.live(now) {
+			if bucket != nil {
+				deleteItem(sh, r.Bucket, r.ID, bucket, now)
+			}
+			return
+		}
+		setItem(sh, r.Bucket, r.ID, item)
+	case deleteOp:
+		if bucket != nil {
+			deleteItem(sh, r.Bucket, r.ID, bucket, now)
+		}
+	}
+}
+
+func (p *persister) logSeqs() ([]int, error) {
+	entries, err := os.ReadDir(p.config.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []int
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, logFilePrefix) || !strings.HasSuffix(name, logFileSuffix) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, logFilePrefix), logFileSuffix))
+		if err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Ints(seqs)
+	return seqs, nil
+}
+
+func newPushRecord(key model.Key, item expireableItem) record {
+	stored := item.OwnableItem
+	stored.TTL = nil
+	return record{Op: pushOp, Bucket: key.Bucket, ID: key.ID, Item: &stored, Expires: item.expiration}
+}
+
+func writeFileAtomic(path string, v interface{}) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := json.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package inmem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+)
+
+func newPersistentSharded(t *testing.T, dir string, now *time.Time) *Sharded {
+	s := NewSharded(Config{Shards: 2, Persistence: &PersistenceConfig{Dir: dir, SnapshotInterval: time.Hour}}, nil)
+	s.now = func() time.Time { return *now }
+	require.NoError(t, s.Open())
+	return s
+}
+
+func TestPersistence(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		now     = time.Now()
+		ttl     = int64(60)
+		kept    = model.Key{Bucket: "bucket", ID: "kept"}
+		deleted = model.Key{Bucket: "bucket", ID: "deleted"}
+		expired = model.Key{Bucket: "other", ID: "expired"}
+		item    = func(id string, ttl *int64) store.OwnableItem {
+			return store.OwnableItem{Owner: "owner", Item: model.Item{ID: id, Data: map[string]interface{}{"k": "v"}, TTL: ttl}}
+		}
+	)
+
+	tcs := []struct {
+		Description string
+		Restart     func(t *testing.T, s *Sharded)
+	}{
+		{
+			Description: "Clean shutdown",
+			Restart: func(t *testing.T, s *Sharded) {
+				require.NoError(t, s.Close())
+			},
+		},
+		{
+			Description: "Crash",
+			Restart: func(t *testing.T, s *Sharded) {
+				close(s.persister.stop)
+				<-s.persister.done
+				require.NoError(t, s.persister.log.Close())
+			},
+		},
+		{
+			Description: "Crash mid write",
+			Restart: func(t *testing.T, s *Sharded) {
+				close(s.persister.stop)
+				<-s.persister.done
+				_, err := s.persister.log.WriteString(`{"op":"push","bucket":"bucket","id":"torn"`)
+				require.NoError(t, err)
+				require.NoError(t, s.persister.log.Close())
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			dir := filepath.Join(dir, tc.Description)
+			current := now
+			s := newPersistentSharded(t, dir, &current)
+			require.NoError(s.Push(kept, item(kept.ID, &ttl)))
+			require.NoError(s.Push(deleted, item(deleted.ID, nil)))
+			require.NoError(s.Push(expired, item(expired.ID, new(int64))))
+			require.NoError(s.snapshot())
+			_, err := s.Delete(deleted)
+			require.NoError(err)
+			tc.Restart(t, s)
+
+			current = now.Add(10 * time.Second)
+			s = newPersistentSharded(t, dir, &current)
+			defer s.Close()
+
+			got, err := s.Get(kept)
+			require.NoError(err)
+			assert.Equal(int64(50), *got.TTL)
+			assert.Equal(item(kept.ID, nil).Data, got.Data)
+			_, err = s.Get(deleted)
+			assert.ErrorIs(err, store.ErrItemNotFound)
+			all, err := s.GetAll(expired.Bucket)
+			require.NoError(err)
+			assert.Empty(all)
+
+			logs, err := s.persister.logSeqs()
+			require.NoError(err)
+			assert.Len(logs, 1, "replayed logs should be folded into the snapshot")
+		})
+	}
+}
+
+func TestPersistenceCorruptedLog(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "writes-1.log"), []byte("{\n{}\n"), 0o600))
+	s := NewSharded(Config{Persistence: &PersistenceConfig{Dir: dir}}, nil)
+	assert.Error(t, s.Open())
+}
+
+func TestWithoutPersistence(t *testing.T) {
+	s := NewSharded(Config{}, nil)
+	assert.NoError(t, s.Open())
+	assert.NoError(t, s.Close())
+}
+
+func TestPersistenceTransaction(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	dir := t.TempDir()
+	now := time.Now()
+	created := model.Key{Bucket: "webhooks", ID: "created"}
+	removed := model.Key{Bucket: "secrets", ID: "removed"}
+	s := newPersistentSharded(t, dir, &now)
+	require.NoError(s.Push(removed, store.OwnableItem{Item: model.Item{ID: removed.ID}}))
+	require.NoError(s.snapshot())
+	require.NoError(s.Transact([]store.TransactionOp{
+		{Key: created, Item: store.OwnableItem{Item: model.Item{ID: created.ID, Data: map[string]interface{}{"k": "v"}}}, Condition: store.IfAbsent},
+		{Key: removed, Delete: true},
+	}))
+	close(s.persister.stop)
+	<-s.persister.done
+	require.NoError(s.persister.log.Close())
+
+	s = newPersistentSharded(t, dir, &now)
+	defer s.Close()
+	got, err := s.Get(created)
+	require.NoError(err)
+	assert.Equal("v", got.Data["k"])
+	_, err = s.Get(removed)
+	assert.ErrorIs(err, store.ErrItemNotFound)
+}
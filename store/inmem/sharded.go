@@ -0,0 +1,485 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"go.uber.org/zap"
+)
+
+const defaultShards = 32
+
+// Config configures the in-memory store.
+type Config struct {
+	// Shards is the number of independently locked partitions the buckets are
+	// spread across. All the items of a bucket live in the same shard.
+	// (Optional) defaults to 32.
+	Shards int
+
+	// Persistence keeps the items across restarts in a local directory.
+	// (Optional) items only live in memory when not set.
+	Persistence *PersistenceConfig
+}
+
+// shard holds the buckets hashed to it behind a single RWMutex.
+type shard struct {
+	lock    sync.RWMutex
+	buckets map[string]map[string]expireableItem
+	digests map[string]*bucketDigests
+}
+
+// bucketDigests are the digests of the items of a bucket, as a whole and by
+// owner. Expired items are counted in until they're purged.
+type bucketDigests struct {
+	all    store.Digest
+	owners map[string]*ownerDigest
+}
+
+type ownerDigest struct {
+	store.Digest
+	items int
+}
+
+// Sharded is an in-memory store whose buckets are spread across shards so
+// requests against different buckets don't contend. Reads only take a read
+// lock; the expired items they come across are deleted afterwards under the
+// write lock. Items are copied in and out so callers can't mutate stored state.
+type Sharded struct {
+	shards    []*shard
+	now       func() time.Time
+	persister *persister
+}
+
+// NewSharded returns a sharded in-memory store. With persistence configured,
+// Open must be called before use and Close on shutdown.
+func NewSharded(config Config, logger *zap.Logger) *Sharded {
+	if config.Shards <= 0 {
+		config.Shards = defaultShards
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	shards := make([]*shard, config.Shards)
+	for i := range shards {
+		shards[i] = &shard{
+			buckets: map[string]map[string]expireableItem{},
+			digests: map[string]*bucketDigests{},
+		}
+	}
+	s := &Sharded{
+		shards: shards,
+		now:    time.Now,
+	}
+	if config.Persistence != nil {
+		s.persister = newPersister(*config.Persistence, logger)
+	}
+	return s
+}
+
+func (s *Sharded) shard(bucket string) *shard {
+	return s.shards[s.shardIndex(bucket)]
+}
+
+// shardIndex hashes the bucket name with 32-bit FNV-1a, inlined to avoid allocating a hash.Hash.
+func (s *Sharded) shardIndex(bucket string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(bucket); i++ {
+		h ^= uint32(bucket[i])
+		h *= 16777619
+	}
+	return int(h % uint32(len(s.shards)))
+}
+
+func (s *Sharded) Push(key model.Key, item store.OwnableItem) error {
+	return s.push(key, item, "push", nil)
+}
+
+// PushIfAbsent stores the item unless a live item exists at key.
+func (s *Sharded) PushIfAbsent(key model.Key, item store.OwnableItem) error {
+	return s.push(key, item, "push", func(_ expireableItem, live bool) error {
+		if live {
+			return store.ErrItemExists
+		}
+		return nil
+	})
+}
+
+// CompareAndSwap replaces the live item at key with item while it still has
+// the owner and data of old.
+func (s *Sharded) CompareAndSwap(key model.Key, old, item store.OwnableItem) error {
+	return s.push(key, item, "compareandswap", func(existing expireableItem, live bool) error {
+		if !live {
+			return store.ErrItemNotFound
+		}
+		if !sameItem(existing.OwnableItem, old) {
+			return store.ErrItemChanged
+		}
+		return nil
+	})
+}
+
+// push stores the item once check, when given, accepts the item currently at
+// key. check is called under the shard lock.
+func (s *Sharded) push(key model.Key, item store.OwnableItem, operation string, check func(existing expireableItem, live bool) error) error {
+	now := s.now()
+	storingItem := expireableItem{OwnableItem: copyItem(item)}
+	storingItem.LastModified = now
+	if storingItem.CreatedAt.IsZero() {
+		storingItem.CreatedAt = now
+	}
+	if item.TTL != nil {
+		expiration := now.Add(time.Second * time.Duration(*item.TTL))
+		storingItem.expiration = &expiration
+	}
+
+	sh := s.shard(key.Bucket)
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+	if check != nil {
+		existing, ok := sh.buckets[key.Bucket][key.ID]
+		if err := check(existing, ok && existing.live(now)); err != nil {
+			return store.SanitizeError(store.ItemOperationError{Err: err, Key: key, Operation: operation})
+		}
+	}
+	if s.persister != nil {
+		if err := s.persister.append(newPushRecord(key, storingItem)); err != nil {
+			return store.SanitizeError(store.ItemOperationError{Err: err, Key: key, Operation: operation})
+		}
+	}
+	setItem(sh, key.Bucket, key.ID, storingItem)
+	return nil
+}
+
+// Increment adds delta to the field at path in the data of the live item at
+// key, keeping its expiration.
+func (s *Sharded) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	now := s.now()
+	sh := s.shard(key.Bucket)
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+	existing, ok := sh.buckets[key.Bucket][key.ID]
+	if !ok || !existing.live(now) {
+		return 0, store.SanitizeError(store.ItemOperationError{Err: store.ErrItemNotFound, Key: key, Operation: "increment"})
+	}
+	updated := expireableItem{OwnableItem: copyItem(existing.OwnableItem), expiration: existing.expiration}
+	updated.LastModified = now
+	updated.Version++
+	updated.ModifiedBy = modifiedBy
+	value, err := store.IncrementData(updated.Data, path, delta)
+	if err != nil {
+		return 0, store.SanitizeError(store.ItemOperationError{Err: err, Key: key, Operation: "increment"})
+	}
+	if s.persister != nil {
+		if err := s.persister.append(newPushRecord(key, updated)); err != nil {
+			return 0, store.SanitizeError(store.ItemOperationError{Err: err, Key: key, Operation: "increment"})
+		}
+	}
+	setItem(sh, key.Bucket, key.ID, updated)
+	return value, nil
+}
+
+func (s *Sharded) Get(key model.Key) (store.OwnableItem, error) {
+	now := s.now()
+	sh := s.shard(key.Bucket)
+	sh.lock.RLock()
+	item, ok := sh.buckets[key.Bucket][key.ID]
+	var result store.OwnableItem
+	live := ok && item.live(now)
+	if live {
+		result = item.current(now)
+	}
+	sh.lock.RUnlock()
+
+	if !live {
+		if ok {
+			s.purge(sh, key.Bucket, []string{key.ID})
+		}
+		return store.OwnableItem{}, store.SanitizeError(store.ItemOperationError{Err: store.ErrItemNotFound, Key: key, Operation: "get"})
+	}
+	return result, nil
+}
+
+func (s *Sharded) GetAll(bucket string) (map[string]store.OwnableItem, error) {
+	now := s.now()
+	sh := s.shard(bucket)
+	sh.lock.RLock()
+	items := sh.buckets[bucket]
+	result := make(map[string]store.OwnableItem, len(items))
+	var expired []string
+	for id, item := range items {
+		if item.live(now) {
+			result[id] = item.current(now)
+		} else {
+			expired = append(expired, id)
+		}
+	}
+	sh.lock.RUnlock()
+
+	if len(expired) > 0 {
+		s.purge(sh, bucket, expired)
+	}
+	return result, nil
+}
+
+func (s *Sharded) Delete(key model.Key) (store.OwnableItem, error) {
+	now := s.now()
+	sh := s.shard(key.Bucket)
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+	bucket := sh.buckets[key.Bucket]
+	item, ok := bucket[key.ID]
+	if ok {
+		if s.persister != nil {
+			if err := s.persister.append(record{Op: deleteOp, Bucket: key.Bucket, ID: key.ID}); err != nil {
+				return store.OwnableItem{}, store.SanitizeError(store.ItemOperationError{Err: err, Key: key, Operation: "delete"})
+			}
+		}
+		deleteItem(sh, key.Bucket, key.ID, bucket, now)
+	}
+	if !ok || !item.live(now) {
+		return store.OwnableItem{}, store.SanitizeError(store.ItemOperationError{Err: store.ErrItemNotFound, Key: key, Operation: "delete"})
+	}
+	return item.current(now), nil
+}
+
+// Transact locks the shards of all the operations, in index order to avoid
+// deadlocks, checks the conditions then applies the operations. They are
+// persisted as a single log record so they are restored all-or-nothing.
+func (s *Sharded) Transact(ops []store.TransactionOp) error {
+	now := s.now()
+	indexes := make([]int, 0, len(ops))
+	for _, op := range ops {
+		indexes = append(indexes, s.shardIndex(op.Key.Bucket))
+	}
+	sort.Ints(indexes)
+	var locked []*shard
+	for i, index := range indexes {
+		if i == 0 || index != indexes[i-1] {
+			sh := s.shards[index]
+			sh.lock.Lock()
+			locked = append(locked, sh)
+		}
+	}
+	defer func() {
+		for _, sh := range locked {
+			sh.lock.Unlock()
+		}
+	}()
+
+	items := make([]expireableItem, len(ops))
+	batch := record{Op: batchOp}
+	for idx, op := range ops {
+		var current *store.OwnableItem
+		if existing, ok := s.shard(op.Key.Bucket).buckets[op.Key.Bucket][op.Key.ID]; ok && existing.live(now) {
+			current = &existing.OwnableItem
+		}
+		if err := store.CheckCondition(op, current); err != nil {
+			return store.SanitizeError(store.TransactionConditionError{Index: idx, Err: err})
+		}
+		if op.Delete {
+			batch.Records = append(batch.Records, record{Op: deleteOp, Bucket: op.Key.Bucket, ID: op.Key.ID})
+			continue
+		}
+		items[idx] = expireableItem{OwnableItem: copyItem(op.Item)}
+		items[idx].LastModified = now
+		if items[idx].CreatedAt.IsZero() {
+			items[idx].CreatedAt = now
+		}
+		if op.Item.TTL != nil {
+			expiration := now.Add(time.Second * time.Duration(*op.Item.TTL))
+			items[idx].expiration = &expiration
+		}
+		batch.Records = append(batch.Records, newPushRecord(op.Key, items[idx]))
+	}
+	if s.persister != nil {
+		if err := s.persister.append(batch); err != nil {
+			return store.SanitizeError(fmt.Errorf("failed to persist transaction: %w", err))
+		}
+	}
+
+	for idx, op := range ops {
+		sh := s.shard(op.Key.Bucket)
+		bucket := sh.buckets[op.Key.Bucket]
+		if op.Delete {
+			if bucket != nil {
+				deleteItem(sh, op.Key.Bucket, op.Key.ID, bucket, now)
+			}
+			continue
+		}
+		setItem(sh, op.Key.Bucket, op.Key.ID, items[idx])
+	}
+	return nil
+}
+
+// BucketDigest returns the digest of the live items of the bucket.
+func (s *Sharded) BucketDigest(bucket string) (store.Digest, error) {
+	return s.digest(bucket, func(d *bucketDigests) store.Digest {
+		return d.all
+	}), nil
+}
+
+// OwnerDigest returns the digest of the live items of the bucket belonging to owner.
+func (s *Sharded) OwnerDigest(bucket, owner string) (store.Digest, error) {
+	return s.digest(bucket, func(d *bucketDigests) store.Digest {
+		if o, ok := d.owners[owner]; ok {
+			return o.Digest
+		}
+		return store.Digest{}
+	}), nil
+}
+
+// digest purges the expired items of the bucket so they no longer count in its
+// digests, then returns the one picked. Finding expired items takes a scan of
+// the bucket, but unlike reading it, nothing is copied.
+func (s *Sharded) digest(bucket string, pick func(*bucketDigests) store.Digest) store.Digest {
+	now := s.now()
+	sh := s.shard(bucket)
+	sh.lock.RLock()
+	var expired []string
+	for id, item := range sh.buckets[bucket] {
+		if !item.live(now) {
+			expired = append(expired, id)
+		}
+	}
+	sh.lock.RUnlock()
+	if len(expired) > 0 {
+		s.purge(sh, bucket, expired)
+	}
+
+	sh.lock.RLock()
+	defer sh.lock.RUnlock()
+	d, ok := sh.digests[bucket]
+	if !ok {
+		return store.Digest{}
+	}
+	return pick(d)
+}
+
+// Ping always succeeds as there is no backend to reach.
+func (s *Sharded) Ping(context.Context) error {
+	return nil
+}
+
+// purge deletes the given items of the bucket which are still expired, as
+// they may have been pushed again since they were read.
+func (s *Sharded) purge(sh *shard, bucketName string, ids []string) {
+	now := s.now()
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+	bucket := sh.buckets[bucketName]
+	for _, id := range ids {
+		if item, ok := bucket[id]; ok && !item.live(now) {
+			deleteItem(sh, bucketName, id, bucket, *item.expiration)
+		}
+	}
+}
+
+// setItem stores the item in the bucket, replacing the one at id, and
+// updates the digests of the bucket.
+func setItem(sh *shard, bucketName, id string, item expireableItem) {
+	bucket := sh.buckets[bucketName]
+	if bucket == nil {
+		bucket = map[string]expireableItem{}
+		sh.buckets[bucketName] = bucket
+	}
+	d := sh.digests[bucketName]
+	if d == nil {
+		d = &bucketDigests{owners: map[string]*ownerDigest{}}
+		sh.digests[bucketName] = d
+	}
+	if existing, ok := bucket[id]; ok {
+		d.toggle(existing.OwnableItem, item.LastModified, -1)
+	}
+	bucket[id] = item
+	d.toggle(item.OwnableItem, item.LastModified, 1)
+}
+
+// deleteItem removes the item at id from the bucket, which changed at the
+// given time as far as its digests are concerned.
+func deleteItem(sh *shard, bucketName, id string, bucket map[string]expireableItem, at time.Time) {
+	if existing, ok := bucket[id]; ok {
+		if d := sh.digests[bucketName]; d != nil {
+			d.toggle(existing.OwnableItem, at, -1)
+		}
+	}
+	delete(bucket, id)
+	if len(bucket) == 0 {
+		delete(sh.buckets, bucketName)
+		delete(sh.digests, bucketName)
+	}
+}
+
+// toggle adds the item to the digests, or removes it, as told by count.
+func (d *bucketDigests) toggle(item store.OwnableItem, at time.Time, count int) {
+	d.all.Toggle(item)
+	d.all.Touch(at)
+	o := d.owners[item.Owner]
+	if o == nil {
+		o = &ownerDigest{}
+		d.owners[item.Owner] = o
+	}
+	o.Toggle(item)
+	o.Touch(at)
+	if o.items += count; o.items == 0 {
+		delete(d.owners, item.Owner)
+	}
+}
+
+func (e expireableItem) live(now time.Time) bool {
+	return e.expiration == nil || int64(e.expiration.Sub(now).Seconds()) > 0
+}
+
+// current returns a copy of the item with its remaining TTL.
+func (e expireableItem) current(now time.Time) store.OwnableItem {
+	item := copyItem(e.OwnableItem)
+	if e.expiration != nil {
+		secondsBeforeExpiry := int64(e.expiration.Sub(now).Seconds())
+		item.TTL = &secondsBeforeExpiry
+	}
+	return item
+}
+
+// sameItem compares the owner and data of two items, ignoring their TTLs.
+func sameItem(a, b store.OwnableItem) bool {
+	return a.Owner == b.Owner && reflect.DeepEqual(a.Data, b.Data)
+}
+
+func copyItem(item store.OwnableItem) store.OwnableItem {
+	if item.TTL != nil {
+		ttl := *item.TTL
+		item.TTL = &ttl
+	}
+	if item.Data != nil {
+		item.Data = copyValue(item.Data).(map[string]interface{})
+	}
+	return item
+}
+
+// copyValue deep copies the maps and slices item data decodes into.
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = copyValue(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = copyValue(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
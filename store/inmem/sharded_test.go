@@ -0,0 +1,531 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package inmem
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+)
+
+func newTestSharded(now *time.Time) *Sharded {
+	s := NewSharded(Config{Shards: 4}, nil)
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestShardedOperations(t *testing.T) {
+	var (
+		now     = time.Now()
+		ttl     = int64(60)
+		key     = model.Key{Bucket: "bucket", ID: "id"}
+		item    = store.OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: map[string]interface{}{"k": "v"}, TTL: &ttl}}
+		noTTL   = store.OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: map[string]interface{}{"k": "v"}}}
+		elapsed = int64(50)
+	)
+
+	tcs := []struct {
+		Description  string
+		Item         *store.OwnableItem
+		Elapsed      time.Duration
+		ExpectedItem store.OwnableItem
+		ExpectedErr  error
+	}{
+		{
+			Description: "Missing",
+			ExpectedErr: store.ErrItemNotFound,
+		},
+		{
+			Description:  "Without TTL",
+			Item:         &noTTL,
+			Elapsed:      time.Hour,
+			ExpectedItem: noTTL,
+		},
+		{
+			Description: "Remaining TTL",
+			Item:        &item,
+			Elapsed:     10 * time.Second,
+			ExpectedItem: store.OwnableItem{
+				Owner: "owner",
+				Item:  model.Item{ID: "id", Data: map[string]interface{}{"k": "v"}, TTL: &elapsed},
+			},
+		},
+		{
+			Description: "Expired",
+			Item:        &item,
+			Elapsed:     time.Minute,
+			ExpectedErr: store.ErrItemNotFound,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			current := now
+			expected := tc.ExpectedItem
+			expected.LastModified = now
+			expected.CreatedAt = now
+			s := newTestSharded(&current)
+			if tc.Item != nil {
+				require.NoError(s.Push(key, *tc.Item))
+			}
+			current = now.Add(tc.Elapsed)
+
+			got, err := s.Get(key)
+			all, allErr := s.GetAll(key.Bucket)
+			require.NoError(allErr)
+			if tc.ExpectedErr != nil {
+				assert.True(errors.Is(err, tc.ExpectedErr))
+				assert.Empty(all)
+				assert.Empty(s.shard(key.Bucket).buckets, "expired items should be purged")
+			} else {
+				assert.NoError(err)
+				assert.Equal(expected, got)
+				assert.Equal(map[string]store.OwnableItem{key.ID: expected}, all)
+			}
+
+			deleted, err := s.Delete(key)
+			if tc.ExpectedErr != nil {
+				assert.True(errors.Is(err, tc.ExpectedErr))
+			} else {
+				assert.NoError(err)
+				assert.Equal(expected, deleted)
+			}
+			assert.Empty(s.shard(key.Bucket).buckets)
+		})
+	}
+}
+
+func TestShardedCopies(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := NewSharded(Config{}, nil)
+	key := model.Key{Bucket: "bucket", ID: "id"}
+	item := store.OwnableItem{Item: model.Item{ID: "id", Data: map[string]interface{}{
+		"nested": map[string]interface{}{"k": "v"},
+		"list":   []interface{}{"a"},
+	}}}
+	require.NoError(s.Push(key, item))
+
+	item.Data["nested"].(map[string]interface{})["k"] = "pushed"
+	got, err := s.Get(key)
+	require.NoError(err)
+	assert.Equal("v", got.Data["nested"].(map[string]interface{})["k"])
+
+	got.Data["list"].([]interface{})[0] = "read"
+	all, err := s.GetAll(key.Bucket)
+	require.NoError(err)
+	assert.Equal("a", all[key.ID].Data["list"].([]interface{})[0])
+}
+
+func TestShardedPurgeKeepsPushedAgain(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	s := newTestSharded(&now)
+	key := model.Key{Bucket: "bucket", ID: "id"}
+	ttl := int64(1)
+	assert.NoError(s.Push(key, store.OwnableItem{Item: model.Item{ID: "id", TTL: &ttl}}))
+	now = now.Add(time.Minute)
+	assert.NoError(s.Push(key, store.OwnableItem{Item: model.Item{ID: "id"}}))
+
+	s.purge(s.shard(key.Bucket), key.Bucket, []string{key.ID})
+	_, err := s.Get(key)
+	assert.NoError(err)
+}
+
+func TestShardedConcurrent(t *testing.T) {
+	s := NewSharded(Config{Shards: 2}, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ttl := int64(i % 2)
+			key := model.Key{Bucket: fmt.Sprintf("bucket-%d", i%3), ID: "id"}
+			s.Push(key, store.OwnableItem{Item: model.Item{ID: "id", Data: map[string]interface{}{"k": "v"}, TTL: &ttl}})
+			s.GetAll(key.Bucket)
+			s.Get(key)
+			s.Delete(key)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// benchmarkStore runs a read heavy workload, 9 reads per write, spread over
+// buckets of 100 items from parallel goroutines. Compare the implementations
+// across core counts with: go test -run NONE -bench . -cpu 1,4,16 ./store/inmem
+func benchmarkStore(b *testing.B, s store.S, buckets int) {
+	ttl := int64(3600)
+	for bucket := 0; bucket < buckets; bucket++ {
+		for id := 0; id < 100; id++ {
+			key := model.Key{Bucket: fmt.Sprintf("bucket-%d", bucket), ID: fmt.Sprintf("id-%d", id)}
+			s.Push(key, store.OwnableItem{Item: model.Item{ID: key.ID, Data: map[string]interface{}{"k": "v"}, TTL: &ttl}})
+		}
+	}
+
+	var seq uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			n := atomic.AddUint64(&seq, 1)
+			key := model.Key{Bucket: fmt.Sprintf("bucket-%d", n%uint64(buckets)), ID: fmt.Sprintf("id-%d", n%100)}
+			if n%10 == 0 {
+				s.Push(key, store.OwnableItem{Item: model.Item{ID: key.ID, Data: map[string]interface{}{"k": "v"}, TTL: &ttl}})
+			} else {
+				s.Get(key)
+			}
+		}
+	})
+}
+
+func BenchmarkInMem(b *testing.B) {
+	for _, buckets := range []int{1, 64} {
+		b.Run(fmt.Sprintf("buckets=%d", buckets), func(b *testing.B) {
+			benchmarkStore(b, NewInMem(), buckets)
+		})
+	}
+}
+
+func BenchmarkSharded(b *testing.B) {
+	for _, buckets := range []int{1, 64} {
+		b.Run(fmt.Sprintf("buckets=%d", buckets), func(b *testing.B) {
+			benchmarkStore(b, NewSharded(Config{}, nil), buckets)
+		})
+	}
+}
+
+func TestPushIfAbsent(t *testing.T) {
+	var (
+		now = time.Now()
+		key = model.Key{Bucket: "bucket", ID: "id"}
+		ttl = int64(1)
+	)
+	tcs := []struct {
+		Description string
+		Existing    *store.OwnableItem
+		ExpectedErr error
+	}{
+		{
+			Description: "Absent",
+		},
+		{
+			Description: "Live item",
+			Existing:    &store.OwnableItem{Owner: "other", Item: model.Item{ID: "id"}},
+			ExpectedErr: store.ErrItemExists,
+		},
+		{
+			Description: "Expired item",
+			Existing:    &store.OwnableItem{Owner: "other", Item: model.Item{ID: "id", TTL: &ttl}},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			current := now
+			var s store.S = newTestSharded(&current)
+			if tc.Existing != nil {
+				assert.NoError(s.Push(key, *tc.Existing))
+			}
+			current = now.Add(time.Minute)
+
+			err := s.(store.Creator).PushIfAbsent(key, store.OwnableItem{Owner: "me", Item: model.Item{ID: "id"}})
+			got, getErr := s.Get(key)
+			assert.NoError(getErr)
+			if tc.ExpectedErr != nil {
+				assert.ErrorIs(err, tc.ExpectedErr)
+				assert.Equal("other", got.Owner)
+				return
+			}
+			assert.NoError(err)
+			assert.Equal("me", got.Owner)
+		})
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	var (
+		now  = time.Now()
+		key  = model.Key{Bucket: "bucket", ID: "id"}
+		ttl  = int64(1)
+		old  = store.OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: map[string]interface{}{"k": "v"}}}
+		item = store.OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: map[string]interface{}{"k": "swapped"}}}
+	)
+	tcs := []struct {
+		Description string
+		Existing    *store.OwnableItem
+		ExpectedErr error
+	}{
+		{
+			Description: "Unchanged",
+			Existing:    &old,
+		},
+		{
+			Description: "Missing",
+			ExpectedErr: store.ErrItemNotFound,
+		},
+		{
+			Description: "Expired",
+			Existing:    &store.OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: map[string]interface{}{"k": "v"}, TTL: &ttl}},
+			ExpectedErr: store.ErrItemNotFound,
+		},
+		{
+			Description: "Changed data",
+			Existing:    &store.OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: map[string]interface{}{"k": "other"}}},
+			ExpectedErr: store.ErrItemChanged,
+		},
+		{
+			Description: "Changed owner",
+			Existing:    &store.OwnableItem{Owner: "other", Item: model.Item{ID: "id", Data: map[string]interface{}{"k": "v"}}},
+			ExpectedErr: store.ErrItemChanged,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			current := now
+			var s store.S = newTestSharded(&current)
+			if tc.Existing != nil {
+				assert.NoError(s.Push(key, *tc.Existing))
+			}
+			current = now.Add(time.Minute)
+
+			err := s.(store.Swapper).CompareAndSwap(key, old, item)
+			got, getErr := s.Get(key)
+			if tc.ExpectedErr != nil {
+				assert.ErrorIs(err, tc.ExpectedErr)
+				if getErr == nil {
+					assert.Equal(tc.Existing.Data, got.Data)
+				}
+				return
+			}
+			assert.NoError(err)
+			assert.NoError(getErr)
+			assert.Equal(item.Data, got.Data)
+		})
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	var (
+		now  = time.Now()
+		key  = model.Key{Bucket: "bucket", ID: "id"}
+		ttl  = int64(120)
+		item = store.OwnableItem{Owner: "owner", Item: model.Item{ID: "id", TTL: &ttl, Data: map[string]interface{}{
+			"count":    float64(1),
+			"name":     "n",
+			"counters": map[string]interface{}{},
+		}}}
+	)
+	tcs := []struct {
+		Description   string
+		Path          []string
+		Expired       bool
+		ExpectedValue float64
+		ExpectedErr   error
+	}{
+		{
+			Description:   "Existing field",
+			Path:          []string{"count"},
+			ExpectedValue: 3,
+		},
+		{
+			Description:   "Missing nested field",
+			Path:          []string{"counters", "requests"},
+			ExpectedValue: 2,
+		},
+		{
+			Description: "Not a number",
+			Path:        []string{"name"},
+			ExpectedErr: store.ErrNotNumeric,
+		},
+		{
+			Description: "Missing parent",
+			Path:        []string{"other", "requests"},
+			ExpectedErr: store.ErrNotNumeric,
+		},
+		{
+			Description: "Expired item",
+			Path:        []string{"count"},
+			Expired:     true,
+			ExpectedErr: store.ErrItemNotFound,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			current := now
+			var s store.S = newTestSharded(&current)
+			require.NoError(s.Push(key, copyItem(item)))
+			before, err := s.Get(key)
+			require.NoError(err)
+			if tc.Expired {
+				current = now.Add(time.Hour)
+			}
+
+			_, err = s.(store.Incrementer).Increment(key, tc.Path, 1, "")
+			require.ErrorIs(err, tc.ExpectedErr)
+			if tc.ExpectedErr != nil {
+				return
+			}
+			current = now.Add(time.Minute)
+			value, err := s.(store.Incrementer).Increment(key, tc.Path, 1, "writer")
+			require.NoError(err)
+			assert.Equal(tc.ExpectedValue, value)
+
+			got, err := s.Get(key)
+			require.NoError(err)
+			assert.Equal(int64(60), *got.TTL, "increments keep the expiration")
+			assert.Equal("writer", got.ModifiedBy)
+			assert.Equal(float64(1), before.Data["count"], "items read before aren't modified")
+		})
+	}
+}
+
+func TestTransact(t *testing.T) {
+	var (
+		now      = time.Now()
+		webhook  = model.Key{Bucket: "webhooks", ID: "webhook"}
+		secret   = model.Key{Bucket: "secrets", ID: "secret"}
+		existing = store.OwnableItem{Owner: "owner", Item: model.Item{ID: "secret", Data: map[string]interface{}{"k": "v"}}}
+		item     = store.OwnableItem{Owner: "owner", Item: model.Item{ID: "webhook", Data: map[string]interface{}{"k": "new"}}}
+	)
+	tcs := []struct {
+		Description   string
+		Ops           []store.TransactionOp
+		ExpectedIndex int
+		ExpectedErr   error
+	}{
+		{
+			Description: "Applied",
+			Ops: []store.TransactionOp{
+				{Key: webhook, Item: item, Condition: store.IfAbsent},
+				{Key: secret, Delete: true, Condition: store.IfUnchanged, Expected: existing},
+			},
+		},
+		{
+			Description: "Item exists",
+			Ops: []store.TransactionOp{
+				{Key: webhook, Item: item},
+				{Key: secret, Item: item, Condition: store.IfAbsent},
+			},
+			ExpectedIndex: 1,
+			ExpectedErr:   store.ErrItemExists,
+		},
+		{
+			Description: "Item changed",
+			Ops: []store.TransactionOp{
+				{Key: secret, Delete: true, Condition: store.IfUnchanged, Expected: item},
+				{Key: webhook, Item: item},
+			},
+			ExpectedErr: store.ErrItemChanged,
+		},
+		{
+			Description: "Item missing",
+			Ops: []store.TransactionOp{
+				{Key: webhook, Item: item, Condition: store.IfUnchanged, Expected: item},
+			},
+			ExpectedErr: store.ErrItemNotFound,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			current := now
+			var s store.S = newTestSharded(&current)
+			require.NoError(s.Push(secret, existing))
+
+			err := s.(store.Transactor).Transact(tc.Ops)
+			_, webhookErr := s.Get(webhook)
+			_, secretErr := s.Get(secret)
+			if tc.ExpectedErr != nil {
+				var conditionErr store.TransactionConditionError
+				require.ErrorAs(err, &conditionErr)
+				assert.Equal(tc.ExpectedIndex, conditionErr.Index)
+				assert.ErrorIs(err, tc.ExpectedErr)
+				assert.ErrorIs(webhookErr, store.ErrItemNotFound, "no operation should be applied")
+				assert.NoError(secretErr)
+				return
+			}
+			require.NoError(err)
+			assert.NoError(webhookErr)
+			assert.ErrorIs(secretErr, store.ErrItemNotFound)
+		})
+	}
+}
+
+func TestShardedDigests(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	var (
+		start   = time.Now()
+		current = start
+		ttl     = int64(60)
+		s       = newTestSharded(&current)
+	)
+	item := func(id, owner string, ttl *int64) store.OwnableItem {
+		return store.OwnableItem{Owner: owner, Item: model.Item{ID: id, Data: map[string]interface{}{"n": float64(0)}, TTL: ttl}}
+	}
+	// check compares the digests kept with the ones of the items read.
+	check := func(lastModified time.Time, ownerLastModified map[string]time.Time) {
+		items, err := s.GetAll("bucket")
+		require.NoError(err)
+		d, err := s.BucketDigest("bucket")
+		require.NoError(err)
+		assert.Equal(store.DigestItems(items).Sum, d.Sum)
+		assert.Equal(lastModified, d.LastModified)
+		for owner, expected := range ownerLastModified {
+			d, err := s.OwnerDigest("bucket", owner)
+			require.NoError(err)
+			assert.Equal(store.DigestItems(store.FilterOwner(items, owner)).Sum, d.Sum, owner)
+			assert.Equal(expected, d.LastModified, owner)
+		}
+	}
+
+	d, err := s.BucketDigest("bucket")
+	require.NoError(err)
+	assert.Equal(store.Digest{}, d)
+
+	require.NoError(s.Push(model.Key{Bucket: "bucket", ID: "a"}, item("a", "alice", &ttl)))
+	require.NoError(s.Push(model.Key{Bucket: "bucket", ID: "b"}, item("b", "bob", nil)))
+	require.NoError(s.Push(model.Key{Bucket: "bucket", ID: "c"}, item("c", "carol", nil)))
+	check(start, map[string]time.Time{"alice": start, "bob": start, "carol": start})
+
+	current = start.Add(time.Second)
+	_, err = s.Increment(model.Key{Bucket: "bucket", ID: "b"}, []string{"n"}, 1, "")
+	require.NoError(err)
+	check(current, map[string]time.Time{"alice": start, "bob": current})
+
+	current = start.Add(2 * time.Second)
+	require.NoError(s.Push(model.Key{Bucket: "bucket", ID: "b"}, item("b", "alice", nil)))
+	check(current, map[string]time.Time{"alice": current, "bob": {}})
+
+	current = start.Add(3 * time.Second)
+	_, err = s.Delete(model.Key{Bucket: "bucket", ID: "b"})
+	require.NoError(err)
+	check(current, map[string]time.Time{"alice": current})
+
+	// a expires, which changes the bucket at its expiration time.
+	current = start.Add(2 * time.Minute)
+	check(start.Add(time.Minute), map[string]time.Time{"alice": {}, "carol": start})
+
+	require.NoError(s.Transact([]store.TransactionOp{{Key: model.Key{Bucket: "bucket", ID: "c"}, Delete: true}}))
+	d, err = s.BucketDigest("bucket")
+	require.NoError(err)
+	assert.Equal(store.Digest{}, d, "digests of emptied buckets should be dropped")
+}
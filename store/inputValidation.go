@@ -4,6 +4,7 @@ package store
 
 import (
 	"encoding/json"
+	"fmt"
 	"regexp"
 	"time"
 
@@ -23,12 +24,14 @@ const (
 )
 
 var (
-	errInvalidID            = BadRequestErr{Message: "Invalid ID format. Expecting the format of a SHA-256 message digest."}
-	errIDMismatch           = BadRequestErr{Message: "IDs must match between the URL and payload."}
-	errDataFieldMissing     = BadRequestErr{Message: "Data field must be set in payload."}
-	errInvalidBucket        = BadRequestErr{Message: "Invalid bucket format."}
-	errInvalidOwner         = BadRequestErr{Message: "Invalid Owner format."}
-	errInvalidItemDataDepth = BadRequestErr{Message: "Depth of item data JSON is too large."}
+	errInvalidID            = BadRequestErr{Message: "Invalid ID format. Expecting the format of a SHA-256 message digest.", Code: "invalid_id", Field: "id"}
+	errIDMismatch           = BadRequestErr{Message: "IDs must match between the URL and payload.", Code: "id_mismatch", Field: "id"}
+	errDataFieldMissing     = BadRequestErr{Message: "Data field must be set in payload.", Code: "data_missing", Field: "data"}
+	errInvalidBucket        = BadRequestErr{Message: "Invalid bucket format.", Code: "invalid_bucket", Field: "bucket"}
+	errInvalidOwner         = BadRequestErr{Message: "Invalid Owner format.", Code: "invalid_owner", Field: "owner"}
+	errInvalidItemDataDepth = BadRequestErr{Message: "Depth of item data JSON is too large.", Code: "item_data_too_deep", Field: "data"}
+	errItemDataTooLarge     = PayloadTooLargeErr{Message: "Item data is too large.", Code: "item_data_too_large", Field: "data"}
+	errReservedDataField    = BadRequestErr{Message: "Item data can't hold fields reserved for the store.", Code: "reserved_data_field", Field: "data"}
 )
 
 func validateItemTTL(item *model.Item, maxTTL time.Duration) {
@@ -76,6 +79,23 @@ func validateItemRequestVars(config *transportConfig, owner, bucket, normalizedI
 	return nil
 }
 
+// validateItemDataSize returns an error when data, JSON encoded, is over the size
+// limit of the item data of bucket.
+func validateItemDataSize(config *transportConfig, bucket string, data map[string]interface{}) error {
+	limit := config.itemDataMaxBytes(bucket)
+	if limit <= 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPayloadUnmarshalFailure, err)
+	}
+	if int64(len(encoded)) > limit {
+		return errItemDataTooLarge
+	}
+	return nil
+}
+
 // validItemUnmarshaler ensures that the unmarshaled item based on
 // the URL ID and configuration constraints.
 type validItemUnmarshaler struct {
@@ -105,9 +125,26 @@ func (v *validItemUnmarshaler) UnmarshalJSON(data []byte) error {
 		return errInvalidItemDataDepth
 	}
 
+	for _, key := range reservedDataKeys {
+		if _, ok := v.item.Data[key]; ok {
+			return errReservedDataField
+		}
+	}
+
 	return nil
 }
 
+// isReservedDataKey returns true if key is a top level field of item data
+// reserved for the stores.
+func isReservedDataKey(key string) bool {
+	for _, reserved := range reservedDataKeys {
+		if key == reserved {
+			return true
+		}
+	}
+	return false
+}
+
 // validDepth returns true if the maximum depth in data is at
 // most maxDepth. False otherwise.
 func validDepth(data map[string]interface{}, maxDepth uint) bool {
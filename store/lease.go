@@ -0,0 +1,368 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/httpaux/erraux"
+)
+
+// maxLeaseAttempts bounds the number of times a lease change is retried when
+// a concurrent write to the lease item wins.
+const maxLeaseAttempts = 3
+
+// Lease query parameters used to release a lease.
+const (
+	leaseHolderParamKey = "holder"
+	leaseTokenParamKey  = "token"
+)
+
+var (
+	errLeaseHeld       = &erraux.Error{Err: errors.New("lease is held by another holder"), Code: http.StatusConflict}
+	errLeaseLost       = &erraux.Error{Err: errors.New("lease isn't held with the given holder and token"), Code: http.StatusConflict}
+	errLeaseContention = &erraux.Error{Err: errors.New("lease changed concurrently, try again"), Code: http.StatusConflict}
+	errNotALease       = &erraux.Error{Err: errors.New("item isn't a lease"), Code: http.StatusConflict}
+	errNoLease         = &erraux.Error{Err: errors.New("lease isn't held"), Code: http.StatusNotFound}
+
+	errLeaseHolderMissing = BadRequestErr{Message: "Lease holder must be set.", Code: "lease_holder_missing", Field: "holder"}
+	errInvalidLeaseTTL    = BadRequestErr{Message: "Lease TTL must be positive and within the item max TTL.", Code: "invalid_lease_ttl", Field: "ttl"}
+	errInvalidLeaseToken  = BadRequestErr{Message: "Lease token must be set to the one returned when acquiring the lease.", Code: "invalid_lease_token", Field: "token"}
+)
+
+// Lease is a time bound exclusive claim on a key. Token is a fencing token
+// which increases every time the lease changes holder, so resources guarded by
+// the lease can reject writes from holders which lost it.
+type Lease struct {
+	Bucket    string    `json:"bucket"`
+	ID        string    `json:"id"`
+	Holder    string    `json:"holder"`
+	Token     int64     `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// leaseState is the data of the item holding a lease. A released lease has no
+// holder but keeps its token.
+type leaseState struct {
+	Holder    string    `json:"holder"`
+	Token     int64     `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (l leaseState) held(now time.Time) bool {
+	return l.Holder != "" && now.Before(l.ExpiresAt)
+}
+
+// nextToken returns a token greater than the previous one. It's never lower
+// than the current time in milliseconds so tokens keep increasing after the
+// lease item expires.
+func nextToken(previous int64, now time.Time) int64 {
+	if token := now.UnixMilli(); token > previous {
+		return token
+	}
+	return previous + 1
+}
+
+func decodeLeaseState(item OwnableItem) (leaseState, error) {
+	var state leaseState
+	if _, ok := item.Data["holder"]; !ok {
+		return state, errNotALease
+	}
+	data, err := json.Marshal(item.Data)
+	if err != nil {
+		return state, fmt.Errorf("%w: %v", errNotALease, err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("%w: %v", errNotALease, err)
+	}
+	return state, nil
+}
+
+type leaseRequest struct {
+	key       model.Key
+	owner     string
+	principal string
+	adminMode bool
+	holder    string
+	ttl       time.Duration
+	token     int64
+}
+
+type leaseBody struct {
+	Holder string `json:"holder"`
+	TTL    int64  `json:"ttl"`
+	Token  int64  `json:"token"`
+}
+
+// leases implements the lease operations on top of the atomic writes of a store.
+// Lease items live as long as the max item TTL so their token outlives the lease.
+type leases struct {
+	store   S
+	now     func() time.Time
+	itemTTL int64
+}
+
+func newLeases(s S, config *transportConfig) *leases {
+	return &leases{
+		store:   s,
+		now:     time.Now,
+		itemTTL: int64(config.ItemMaxTTL.Seconds()),
+	}
+}
+
+func (l *leases) item(request *leaseRequest, owner string, state leaseState) OwnableItem {
+	ttl := l.itemTTL
+	return OwnableItem{
+		Owner:      owner,
+		ModifiedBy: request.principal,
+		Item: model.Item{
+			ID: request.key.ID,
+			Data: map[string]interface{}{
+				"holder":    state.Holder,
+				"token":     state.Token,
+				"expiresAt": state.ExpiresAt.UTC().Format(time.RFC3339Nano),
+			},
+			TTL: &ttl,
+		},
+	}
+}
+
+// update applies change to the current lease, nil when its item doesn't
+// exist, and writes the result only if the item wasn't modified meanwhile.
+func (l *leases) update(request *leaseRequest, change func(current *leaseState, now time.Time) (leaseState, error)) (*Lease, error) {
+	for attempt := 0; attempt < maxLeaseAttempts; attempt++ {
+		now := l.now()
+		existing, err := l.store.Get(request.key)
+		var current *leaseState
+		if err == nil {
+			if !authorized(request.adminMode, existing.Owner, request.owner) {
+				return nil, accessDeniedErr
+			}
+			state, err := decodeLeaseState(existing)
+			if err != nil {
+				return nil, err
+			}
+			current = &state
+		} else if !errors.Is(err, ErrItemNotFound) {
+			return nil, err
+		}
+
+		next, err := change(current, now)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			err = PushIfAbsent(l.store, request.key, Revise(l.item(request, request.owner, next), nil))
+		} else {
+			err = CompareAndSwap(l.store, request.key, existing, Revise(l.item(request, existing.Owner, next), &existing))
+		}
+		if err == nil {
+			return &Lease{
+				Bucket:    request.key.Bucket,
+				ID:        request.key.ID,
+				Holder:    next.Holder,
+				Token:     next.Token,
+				ExpiresAt: next.ExpiresAt,
+			}, nil
+		}
+		if !errors.Is(err, ErrItemExists) && !errors.Is(err, ErrItemChanged) && !errors.Is(err, ErrItemNotFound) {
+			return nil, err
+		}
+	}
+	return nil, errLeaseContention
+}
+
+// acquire grants the lease when it's free or expired, with a new token. The
+// current holder acquiring it again renews it and keeps its token.
+func (l *leases) acquire(request *leaseRequest) (*Lease, error) {
+	return l.update(request, func(current *leaseState, now time.Time) (leaseState, error) {
+		next := leaseState{Holder: request.holder, ExpiresAt: now.Add(request.ttl)}
+		switch {
+		case current == nil:
+			next.Token = nextToken(0, now)
+		case !current.held(now):
+			next.Token = nextToken(current.Token, now)
+		case current.Holder == request.holder:
+			next.Token = current.Token
+		default:
+			return next, errLeaseHeld
+		}
+		return next, nil
+	})
+}
+
+// renew extends the lease while it's still held with the given token.
+func (l *leases) renew(request *leaseRequest) (*Lease, error) {
+	return l.update(request, func(current *leaseState, now time.Time) (leaseState, error) {
+		if !l.holds(current, request, now) {
+			return leaseState{}, errLeaseLost
+		}
+		return leaseState{Holder: current.Holder, Token: current.Token, ExpiresAt: now.Add(request.ttl)}, nil
+	})
+}
+
+// release frees the lease while it's still held with the given token.
+func (l *leases) release(request *leaseRequest) (*Lease, error) {
+	return l.update(request, func(current *leaseState, now time.Time) (leaseState, error) {
+		if !l.holds(current, request, now) {
+			return leaseState{}, errLeaseLost
+		}
+		return leaseState{Token: current.Token, ExpiresAt: now}, nil
+	})
+}
+
+func (l *leases) holds(current *leaseState, request *leaseRequest, now time.Time) bool {
+	return current != nil && current.held(now) && current.Holder == request.holder && current.Token == request.token
+}
+
+// get reports the lease, failing with a 404 when nobody holds it.
+func (l *leases) get(request *leaseRequest) (*Lease, error) {
+	item, err := l.store.Get(request.key)
+	if err != nil {
+		if errors.Is(err, ErrItemNotFound) {
+			return nil, errNoLease
+		}
+		return nil, err
+	}
+	if !authorized(request.adminMode, item.Owner, request.owner) {
+		return nil, accessDeniedErr
+	}
+	state, err := decodeLeaseState(item)
+	if err != nil {
+		return nil, err
+	}
+	if !state.held(l.now()) {
+		return nil, errNoLease
+	}
+	return &Lease{
+		Bucket:    request.key.Bucket,
+		ID:        request.key.ID,
+		Holder:    state.Holder,
+		Token:     state.Token,
+		ExpiresAt: state.ExpiresAt,
+	}, nil
+}
+
+func newLeaseEndpoint(op func(*leaseRequest) (*Lease, error)) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return op(request.(*leaseRequest))
+	}
+}
+
+func newAcquireLeaseHandler(in handlerIn) Handler {
+	return newLeaseHandler(in, (*leases).acquire, encodeLeaseResponse)
+}
+
+func newRenewLeaseHandler(in handlerIn) Handler {
+	return newLeaseHandler(in, (*leases).renew, encodeLeaseResponse)
+}
+
+func newReleaseLeaseHandler(in handlerIn) Handler {
+	return newLeaseHandler(in, (*leases).release, encodeReleaseLeaseResponse)
+}
+
+func newGetLeaseHandler(in handlerIn) Handler {
+	return newLeaseHandler(in, (*leases).get, encodeLeaseResponse)
+}
+
+func newLeaseHandler(in handlerIn, op func(*leases, *leaseRequest) (*Lease, error), encode kithttp.EncodeResponseFunc) Handler {
+	l := newLeases(in.Store, in.Config)
+	return kithttp.NewServer(
+		newLeaseEndpoint(func(request *leaseRequest) (*Lease, error) {
+			return op(l, request)
+		}),
+		leaseRequestDecoder(in.Config),
+		encode,
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
+	)
+}
+
+// leaseRequestDecoder reads the holder, TTL and token from the body of POST
+// and PUT requests and the holder and token from the query of DELETE ones.
+func leaseRequestDecoder(config *transportConfig) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		var (
+			URLVars = mux.Vars(r)
+			id      = URLVars[idVarKey]
+			bucket  = URLVars[bucketVarKey]
+			owner   = r.Header.Get(ItemOwnerHeaderKey)
+		)
+
+		if err := validateItemRequestVars(config, owner, bucket, id); err != nil {
+			return nil, err
+		}
+
+		request := &leaseRequest{
+			key: model.Key{
+				Bucket: bucket,
+				ID:     id,
+			},
+			owner:     owner,
+			principal: tokenPrincipal(ctx),
+			adminMode: hasElevatedAccess(ctx, config.AccessLevelAttributeKey),
+		}
+
+		switch r.Method {
+		case http.MethodPost, http.MethodPut:
+			data, err := readBody(config, r)
+			if err != nil {
+				return nil, err
+			}
+			var body leaseBody
+			if err := json.Unmarshal(data, &body); err != nil {
+				return nil, fmt.Errorf("%w: %v", errPayloadUnmarshalFailure, err)
+			}
+			request.holder = body.Holder
+			request.ttl = time.Duration(body.TTL) * time.Second
+			request.token = body.Token
+			if request.ttl <= 0 || request.ttl > config.ItemMaxTTL {
+				return nil, errInvalidLeaseTTL
+			}
+		case http.MethodDelete:
+			query := r.URL.Query()
+			request.holder = query.Get(leaseHolderParamKey)
+			token, err := strconv.ParseInt(query.Get(leaseTokenParamKey), 10, 64)
+			if err != nil {
+				return nil, errInvalidLeaseToken
+			}
+			request.token = token
+		default:
+			return request, nil
+		}
+
+		if request.holder == "" {
+			return nil, errLeaseHolderMissing
+		}
+		if r.Method != http.MethodPost && request.token <= 0 {
+			return nil, errInvalidLeaseToken
+		}
+		return request, nil
+	}
+}
+
+func encodeLeaseResponse(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
+	data, err := json.Marshal(response.(*Lease))
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.Write(data)
+	return nil
+}
+
+func encodeReleaseLeaseResponse(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
+	rw.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,271 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+)
+
+// swapStore is a map backed store supporting conditional writes. It ignores TTLs.
+type swapStore struct {
+	items map[model.Key]OwnableItem
+}
+
+func (s *swapStore) Push(key model.Key, item OwnableItem) error {
+	s.items[key] = item
+	return nil
+}
+
+func (s *swapStore) PushIfAbsent(key model.Key, item OwnableItem) error {
+	if _, ok := s.items[key]; ok {
+		return ErrItemExists
+	}
+	return s.Push(key, item)
+}
+
+func (s *swapStore) CompareAndSwap(key model.Key, old, item OwnableItem) error {
+	existing, ok := s.items[key]
+	if !ok {
+		return ErrItemNotFound
+	}
+	if existing.Owner != old.Owner || !reflect.DeepEqual(existing.Data, old.Data) {
+		return ErrItemChanged
+	}
+	return s.Push(key, item)
+}
+
+func (s *swapStore) Get(key model.Key) (OwnableItem, error) {
+	item, ok := s.items[key]
+	if !ok {
+		return item, ErrItemNotFound
+	}
+	return item, nil
+}
+
+func (s *swapStore) Delete(key model.Key) (OwnableItem, error) {
+	item, err := s.Get(key)
+	delete(s.items, key)
+	return item, err
+}
+
+func (s *swapStore) GetAll(bucket string) (map[string]OwnableItem, error) {
+	return nil, nil
+}
+
+func TestLeaseLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	now := time.UnixMilli(1000000)
+	key := model.Key{Bucket: "locks", ID: "id"}
+	l := newLeases(&swapStore{items: map[model.Key]OwnableItem{}}, getTestTransportConfig())
+	l.now = func() time.Time { return now }
+	request := func(holder string, token int64) *leaseRequest {
+		return &leaseRequest{key: key, owner: "owner", holder: holder, token: token, ttl: time.Minute}
+	}
+
+	_, err := l.get(request("", 0))
+	assert.ErrorIs(err, errNoLease)
+
+	lease, err := l.acquire(request("a", 0))
+	require.NoError(err)
+	assert.Equal(&Lease{Bucket: "locks", ID: "id", Holder: "a", Token: now.UnixMilli(), ExpiresAt: now.Add(time.Minute)}, lease)
+	first := lease.Token
+
+	_, err = l.acquire(request("b", 0))
+	assert.ErrorIs(err, errLeaseHeld)
+	_, err = l.renew(request("a", first+1))
+	assert.ErrorIs(err, errLeaseLost)
+
+	now = now.Add(30 * time.Second)
+	lease, err = l.acquire(request("a", 0))
+	require.NoError(err)
+	assert.Equal(first, lease.Token, "acquiring a held lease again keeps its token")
+	lease, err = l.renew(request("a", first))
+	require.NoError(err)
+	assert.Equal(now.Add(time.Minute), lease.ExpiresAt.Local())
+
+	current, err := l.get(request("", 0))
+	require.NoError(err)
+	assert.Equal("a", current.Holder)
+
+	_, err = l.release(request("a", first))
+	require.NoError(err)
+	_, err = l.get(request("", 0))
+	assert.ErrorIs(err, errNoLease)
+	_, err = l.release(request("a", first))
+	assert.ErrorIs(err, errLeaseLost)
+
+	lease, err = l.acquire(request("b", 0))
+	require.NoError(err)
+	assert.Equal(now.UnixMilli(), lease.Token)
+	second := lease.Token
+
+	now = now.Add(2 * time.Minute)
+	_, err = l.renew(request("b", second))
+	assert.ErrorIs(err, errLeaseLost, "expired leases can't be renewed")
+	lease, err = l.acquire(request("c", 0))
+	require.NoError(err)
+	assert.Equal("c", lease.Holder)
+	assert.Equal(now.UnixMilli(), lease.Token)
+}
+
+func TestNextToken(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(int64(5000), nextToken(10, time.UnixMilli(5000)))
+	assert.Equal(int64(11), nextToken(10, time.UnixMilli(5)), "tokens increase when the clock goes back")
+}
+
+func TestLeaseErrors(t *testing.T) {
+	key := model.Key{Bucket: "locks", ID: "id"}
+	tcs := []struct {
+		Description string
+		Store       func() S
+		Request     leaseRequest
+		ExpectedErr error
+	}{
+		{
+			Description: "Owner mismatch",
+			Store: func() S {
+				l := newLeases(&swapStore{items: map[model.Key]OwnableItem{}}, getTestTransportConfig())
+				l.store.Push(key, l.item(&leaseRequest{key: key}, "owner", leaseState{Holder: "a", Token: 1}))
+				return l.store
+			},
+			Request:     leaseRequest{key: key, owner: "other", holder: "b", ttl: time.Minute},
+			ExpectedErr: accessDeniedErr,
+		},
+		{
+			Description: "Not a lease",
+			Store: func() S {
+				return &swapStore{items: map[model.Key]OwnableItem{
+					key: {Owner: "owner", Item: model.Item{ID: "id", Data: map[string]interface{}{"k": "v"}}},
+				}}
+			},
+			Request:     leaseRequest{key: key, owner: "owner", holder: "b", ttl: time.Minute},
+			ExpectedErr: errNotALease,
+		},
+		{
+			Description: "Conditional writes unsupported",
+			Store: func() S {
+				m := new(MockDAO)
+				m.On("Get", key).Return(OwnableItem{}, ErrItemNotFound)
+				return m
+			},
+			Request:     leaseRequest{key: key, owner: "owner", holder: "b", ttl: time.Minute},
+			ExpectedErr: errCreateUnsupported,
+		},
+		{
+			Description: "Contention",
+			Store: func() S {
+				m := new(MockCreatorDAO)
+				m.On("Get", key).Return(OwnableItem{}, ErrItemNotFound)
+				m.On("PushIfAbsent", key, mock.Anything).Return(ErrItemExists)
+				return m
+			},
+			Request:     leaseRequest{key: key, owner: "owner", holder: "b", ttl: time.Minute},
+			ExpectedErr: errLeaseContention,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			l := newLeases(tc.Store(), getTestTransportConfig())
+			_, err := l.acquire(&tc.Request)
+			assert.ErrorIs(t, err, tc.ExpectedErr)
+		})
+	}
+}
+
+func TestLeaseRequestDecoder(t *testing.T) {
+	id := "7e8c5f378b4addbaebc70897c4478cca06009e3e360208ebd073dbee4b3774e7"
+	key := model.Key{Bucket: "locks", ID: id}
+	tcs := []struct {
+		Description     string
+		Method          string
+		Query           string
+		Body            string
+		ExpectedRequest interface{}
+		ExpectedErr     error
+	}{
+		{
+			Description:     "Acquire",
+			Method:          http.MethodPost,
+			Body:            `{"holder": "a", "ttl": 30}`,
+			ExpectedRequest: &leaseRequest{key: key, holder: "a", ttl: 30 * time.Second},
+		},
+		{
+			Description: "Acquire without holder",
+			Method:      http.MethodPost,
+			Body:        `{"ttl": 30}`,
+			ExpectedErr: errLeaseHolderMissing,
+		},
+		{
+			Description: "TTL too large",
+			Method:      http.MethodPost,
+			Body:        `{"holder": "a", "ttl": 86401}`,
+			ExpectedErr: errInvalidLeaseTTL,
+		},
+		{
+			Description: "Bad payload",
+			Method:      http.MethodPost,
+			Body:        `{`,
+			ExpectedErr: errPayloadUnmarshalFailure,
+		},
+		{
+			Description:     "Renew",
+			Method:          http.MethodPut,
+			Body:            `{"holder": "a", "ttl": 30, "token": 7}`,
+			ExpectedRequest: &leaseRequest{key: key, holder: "a", ttl: 30 * time.Second, token: 7},
+		},
+		{
+			Description: "Renew without token",
+			Method:      http.MethodPut,
+			Body:        `{"holder": "a", "ttl": 30}`,
+			ExpectedErr: errInvalidLeaseToken,
+		},
+		{
+			Description:     "Release",
+			Method:          http.MethodDelete,
+			Query:           "?holder=a&token=7",
+			ExpectedRequest: &leaseRequest{key: key, holder: "a", token: 7},
+		},
+		{
+			Description: "Release with bad token",
+			Method:      http.MethodDelete,
+			Query:       "?holder=a&token=x",
+			ExpectedErr: errInvalidLeaseToken,
+		},
+		{
+			Description:     "Get",
+			Method:          http.MethodGet,
+			ExpectedRequest: &leaseRequest{key: key},
+		},
+	}
+
+	decoder := leaseRequestDecoder(getTestTransportConfig())
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			r := httptest.NewRequest(tc.Method, "http://localhost/test"+tc.Query, bytes.NewBufferString(tc.Body))
+			r = mux.SetURLVars(r, map[string]string{bucketVarKey: key.Bucket, idVarKey: key.ID})
+
+			request, err := decoder(context.Background(), r)
+			assert.ErrorIs(err, tc.ExpectedErr)
+			if tc.ExpectedErr == nil {
+				assert.Equal(tc.ExpectedRequest, request)
+			}
+		})
+	}
+}
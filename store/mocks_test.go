@@ -33,3 +33,68 @@ func (m *MockDAO) GetAll(bucket string) (map[string]OwnableItem, error) {
 	args := m.Called(bucket)
 	return args.Get(0).(map[string]OwnableItem), args.Error(1)
 }
+
+// MockOwnerQuerierDAO is a MockDAO which filters items by owner itself.
+type MockOwnerQuerierDAO struct {
+	MockDAO
+}
+
+func (m *MockOwnerQuerierDAO) GetAllByOwner(bucket, owner string) (map[string]OwnableItem, error) {
+	args := m.Called(bucket, owner)
+	return args.Get(0).(map[string]OwnableItem), args.Error(1)
+}
+
+// MockCreatorDAO is a MockDAO which supports create-only writes.
+type MockCreatorDAO struct {
+	MockDAO
+}
+
+func (m *MockCreatorDAO) PushIfAbsent(key model.Key, item OwnableItem) error {
+	args := m.Called(key, item)
+	return args.Error(0)
+}
+
+// MockIncrementerDAO is a MockDAO which supports atomic increments.
+type MockIncrementerDAO struct {
+	MockDAO
+}
+
+func (m *MockIncrementerDAO) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	args := m.Called(key, path, delta, modifiedBy)
+	return args.Get(0).(float64), args.Error(1)
+}
+
+// MockTransactorDAO is a MockDAO which supports transactions.
+type MockTransactorDAO struct {
+	MockDAO
+}
+
+func (m *MockTransactorDAO) Transact(ops []TransactionOp) error {
+	args := m.Called(ops)
+	return args.Error(0)
+}
+
+// MockSizeLimiterDAO is a MockDAO whose backend bounds the size of item data.
+type MockSizeLimiterDAO struct {
+	MockDAO
+	maxItemDataBytes int64
+}
+
+func (m *MockSizeLimiterDAO) MaxItemDataBytes() int64 {
+	return m.maxItemDataBytes
+}
+
+// MockDigesterDAO is a MockDAO keeping bucket digests.
+type MockDigesterDAO struct {
+	MockDAO
+}
+
+func (m *MockDigesterDAO) BucketDigest(bucket string) (Digest, error) {
+	args := m.Called(bucket)
+	return args.Get(0).(Digest), args.Error(1)
+}
+
+func (m *MockDigesterDAO) OwnerDigest(bucket, owner string) (Digest, error) {
+	args := m.Called(bucket, owner)
+	return args.Get(0).(Digest), args.Error(1)
+}
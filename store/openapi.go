@@ -0,0 +1,642 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/fx"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification the store API is
+// described with.
+const OpenAPIVersion = "3.0.3"
+
+type openAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       openAPIInfo                `json:"info"`
+	Servers    []openAPIServer            `json:"servers"`
+	Security   []map[string][]string      `json:"security"`
+	Paths      map[string]openAPIPathItem `json:"paths"`
+	Components openAPIComponents          `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type openAPIServer struct {
+	URL string `json:"url"`
+}
+
+// openAPIPathItem maps the lowercase HTTP methods of a path to their operation.
+type openAPIPathItem map[string]*openAPIOperation
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Ref         string         `json:"$ref,omitempty"`
+	Name        string         `json:"name,omitempty"`
+	In          string         `json:"in,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *openAPISchema `json:"schema,omitempty"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+
+	// MaxBytes is the size limit of request bodies.
+	MaxBytes int64 `json:"x-max-bytes,omitempty"`
+}
+
+type openAPIResponse struct {
+	Ref         string                      `json:"$ref,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Headers     map[string]openAPIHeader    `json:"headers,omitempty"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIHeader struct {
+	Ref         string         `json:"$ref,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      *openAPISchema `json:"schema,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Minimum              *int64                    `json:"minimum,omitempty"`
+	Maximum              *int64                    `json:"maximum,omitempty"`
+	Default              interface{}               `json:"default,omitempty"`
+	MinItems             *int                      `json:"minItems,omitempty"`
+	MaxItems             *int                      `json:"maxItems,omitempty"`
+	ReadOnly             bool                      `json:"readOnly,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	AdditionalProperties interface{}               `json:"additionalProperties,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+
+	// MaxDepth and MaxBytes describe the limits of item data, which JSON
+	// Schema can't express. BucketMaxBytes holds the bucket overrides of
+	// MaxBytes.
+	MaxDepth       uint             `json:"x-max-depth,omitempty"`
+	MaxBytes       int64            `json:"x-max-bytes,omitempty"`
+	BucketMaxBytes map[string]int64 `json:"x-bucket-max-bytes,omitempty"`
+}
+
+type openAPIComponents struct {
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+	Parameters      map[string]openAPIParameter      `json:"parameters"`
+	Headers         map[string]openAPIHeader         `json:"headers"`
+	Responses       map[string]openAPIResponse       `json:"responses"`
+	Schemas         map[string]*openAPISchema        `json:"schemas"`
+}
+
+type openAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+type openAPIIn struct {
+	fx.In
+	Config  *transportConfig
+	APIBase string `name:"api_base"`
+
+	// Reconcile and Quota are nil when their routes aren't served.
+	Reconcile Handler `name:"reconcile_handler"`
+	Quota     Handler `name:"quota_handler"`
+}
+
+// newOpenAPIHandler serves the OpenAPI document of the store API, built from
+// the active validation config.
+func newOpenAPIHandler(in openAPIIn) (Handler, error) {
+	data, err := json.Marshal(newOpenAPIDocument(in.Config, in.APIBase, in.Reconcile != nil, in.Quota != nil))
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Header().Set("Content-Type", JSONContentType)
+		rw.Write(data)
+	}), nil
+}
+
+func ref(kind, name string) string {
+	return fmt.Sprintf("#/components/%s/%s", kind, name)
+}
+
+func schemaRef(name string) *openAPISchema {
+	return &openAPISchema{Ref: ref("schemas", name)}
+}
+
+func paramRefs(names ...string) []openAPIParameter {
+	parameters := make([]openAPIParameter, 0, len(names))
+	for _, name := range names {
+		parameters = append(parameters, openAPIParameter{Ref: ref("parameters", name)})
+	}
+	return parameters
+}
+
+// itemContent lists the media types items are encoded with.
+func itemContent(schema *openAPISchema) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{
+		JSONContentType:    {Schema: schema},
+		CBORContentType:    {Schema: schema},
+		MsgpackContentType: {Schema: schema},
+	}
+}
+
+func jsonContent(schema *openAPISchema) map[string]openAPIMediaType {
+	return map[string]openAPIMediaType{JSONContentType: {Schema: schema}}
+}
+
+// responses returns the responses of an operation, along with the error
+// responses any operation can get.
+func responses(specific map[string]openAPIResponse, errorCodes ...int) map[string]openAPIResponse {
+	all := map[string]openAPIResponse{}
+	for _, code := range append(errorCodes,
+		http.StatusBadRequest,
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusServiceUnavailable,
+	) {
+		all[strconv.Itoa(code)] = openAPIResponse{Ref: ref("responses", errorResponseName(code))}
+	}
+	for code, response := range specific {
+		all[code] = response
+	}
+	return all
+}
+
+func errorResponseName(code int) string {
+	return strings.ReplaceAll(http.StatusText(code), " ", "")
+}
+
+// errorResponse describes an error response, whose problem details are sent
+// along with their sanitized message in the X-Xmidt-Error header.
+func errorResponse(code int, description string, headers ...string) openAPIResponse {
+	r := openAPIResponse{
+		Description: description,
+		Headers: map[string]openAPIHeader{
+			XmidtErrorHeaderKey: {Ref: ref("headers", XmidtErrorHeaderKey)},
+		},
+		Content: map[string]openAPIMediaType{ProblemContentType: {Schema: schemaRef("Problem")}},
+	}
+	for _, header := range headers {
+		r.Headers[header] = openAPIHeader{Ref: ref("headers", header)}
+	}
+	return r
+}
+
+func int64Pointer(i int64) *int64 { return &i }
+
+func intPointer(i int) *int { return &i }
+
+func newOpenAPIDocument(config *transportConfig, apiBase string, reconcile, quota bool) *openAPIDocument {
+	maxTTL := int64(config.ItemMaxTTL.Seconds())
+	var bucketMaxBytes map[string]int64
+	if len(config.BucketItemDataMaxBytes) > 0 {
+		bucketMaxBytes = config.BucketItemDataMaxBytes
+	}
+
+	doc := &openAPIDocument{
+		OpenAPI: OpenAPIVersion,
+		Info: openAPIInfo{
+			Title:       "Argus",
+			Description: "Argus stores JSON items in buckets, each of them belonging to an owner.",
+			Version:     "1",
+		},
+		Servers:  []openAPIServer{{URL: "/" + apiBase}},
+		Security: []map[string][]string{{"basicAuth": {}}, {"bearerAuth": {}}},
+		Paths:    map[string]openAPIPathItem{},
+		Components: openAPIComponents{
+			SecuritySchemes: map[string]openAPISecurityScheme{
+				"basicAuth":  {Type: "http", Scheme: "basic"},
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+			Parameters: map[string]openAPIParameter{
+				"bucket": {
+					Name:     bucketVarKey,
+					In:       "path",
+					Required: true,
+					Schema:   &openAPISchema{Type: "string", Pattern: config.BucketFormatRegex.String()},
+				},
+				"id": {
+					Name:        idVarKey,
+					In:          "path",
+					Required:    true,
+					Description: "SHA-256 hex digest identifying the item in its bucket.",
+					Schema:      &openAPISchema{Type: "string", Pattern: config.IDFormatRegex.String()},
+				},
+				"owner": {
+					Name:        ItemOwnerHeaderKey,
+					In:          "header",
+					Description: "Owner of the items. Only owners can read and write their items, save for callers with elevated access.",
+					Schema:      &openAPISchema{Type: "string", Pattern: config.OwnerFormatRegex.String()},
+				},
+				"ifNoneMatch": {
+					Name:        IfNoneMatchHeaderKey,
+					In:          "header",
+					Description: "ETag of the caller's copy on reads. Only * is supported on writes, which then only create the item.",
+					Schema:      &openAPISchema{Type: "string"},
+				},
+				"ifModifiedSince": {
+					Name:   IfModifiedSinceHeaderKey,
+					In:     "header",
+					Schema: &openAPISchema{Type: "string"},
+				},
+			},
+			Headers: map[string]openAPIHeader{
+				XmidtErrorHeaderKey: {
+					Description: "Sanitized message of the error.",
+					Schema:      &openAPISchema{Type: "string"},
+				},
+				ETagHeaderKey: {
+					Description: "Weak ETag of the response, to be sent back in If-None-Match.",
+					Schema:      &openAPISchema{Type: "string"},
+				},
+				LastModifiedHeaderKey: {
+					Description: "Last time the items were written, to be sent back in If-Modified-Since.",
+					Schema:      &openAPISchema{Type: "string"},
+				},
+				"Retry-After": {
+					Description: "Number of seconds to wait before retrying.",
+					Schema:      &openAPISchema{Type: "integer"},
+				},
+			},
+			Responses: map[string]openAPIResponse{},
+			Schemas: map[string]*openAPISchema{
+				"Item": {
+					Type:     "object",
+					Required: []string{"id", "data"},
+					Properties: map[string]*openAPISchema{
+						"id": {Type: "string", Pattern: config.IDFormatRegex.String()},
+						"data": {
+							Type:           "object",
+							Description:    "Item data, nested at most x-max-depth levels and at most x-max-bytes bytes long once JSON encoded.",
+							MaxDepth:       config.ItemDataMaxDepth,
+							MaxBytes:       config.ItemDataMaxBytes,
+							BucketMaxBytes: bucketMaxBytes,
+						},
+						"ttl": {
+							Type:        "integer",
+							Description: fmt.Sprintf("Seconds the item has left to live. Greater values are lowered to %d.", maxTTL),
+							Minimum:     int64Pointer(0),
+							Default:     maxTTL,
+						},
+						"lastModified": {Type: "string", Format: "date-time", ReadOnly: true},
+					},
+				},
+				"IncrementRequest": {
+					Type:     "object",
+					Required: []string{"path"},
+					Properties: map[string]*openAPISchema{
+						"path":  {Type: "string", Description: "Dot separated fields leading to the number."},
+						"delta": {Type: "number", Default: 1},
+					},
+				},
+				"IncrementResponse": {
+					Type:       "object",
+					Properties: map[string]*openAPISchema{"value": {Type: "number"}},
+				},
+				"LeaseRequest": {
+					Type:     "object",
+					Required: []string{"holder", "ttl"},
+					Properties: map[string]*openAPISchema{
+						"holder": {Type: "string"},
+						"ttl":    {Type: "integer", Minimum: int64Pointer(1), Maximum: int64Pointer(maxTTL)},
+						"token":  {Type: "integer", Description: "Fencing token of the lease, required to renew it."},
+					},
+				},
+				"Lease": {
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"bucket":    {Type: "string"},
+						"id":        {Type: "string"},
+						"holder":    {Type: "string"},
+						"token":     {Type: "integer"},
+						"expiresAt": {Type: "string", Format: "date-time"},
+					},
+				},
+				"TransactionRequest": {
+					Type:     "object",
+					Required: []string{"operations"},
+					Properties: map[string]*openAPISchema{
+						"operations": {
+							Type:     "array",
+							MinItems: intPointer(1),
+							MaxItems: intPointer(maxTransactionOps),
+							Items: &openAPISchema{
+								Type:     "object",
+								Required: []string{"op", "bucket", "id"},
+								Properties: map[string]*openAPISchema{
+									"op":        {Type: "string", Enum: []string{putOpType, deleteOpType}},
+									"bucket":    {Type: "string", Pattern: config.BucketFormatRegex.String()},
+									"id":        {Type: "string", Pattern: config.IDFormatRegex.String()},
+									"item":      schemaRef("Item"),
+									"condition": {Type: "string", Enum: []string{absentCondition, existsCondition}},
+								},
+							},
+						},
+					},
+				},
+				"Problem": {
+					Type:        "object",
+					Description: "RFC 7807 problem details of an error.",
+					Required:    []string{"type", "title", "status", "code"},
+					Properties: map[string]*openAPISchema{
+						"type":    {Type: "string"},
+						"title":   {Type: "string"},
+						"status":  {Type: "integer"},
+						"detail":  {Type: "string", Description: "Sanitized message of the error, not set for internal errors."},
+						"code":    {Type: "string", Description: "Stable identifier of the error."},
+						"field":   {Type: "string", Description: "Part of the request which is invalid."},
+						"format":  {Type: "string", Description: "Regex the field must match."},
+						"traceId": {Type: "string"},
+					},
+				},
+				"TransactionResponse": {
+					Type: "object",
+					Properties: map[string]*openAPISchema{
+						"committed": {Type: "boolean"},
+						"operations": {
+							Type: "array",
+							Items: &openAPISchema{
+								Type: "object",
+								Properties: map[string]*openAPISchema{
+									"bucket":  {Type: "string"},
+									"id":      {Type: "string"},
+									"status":  {Type: "integer"},
+									"message": {Type: "string"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for code, description := range map[int]string{
+		http.StatusBadRequest:            "The request is invalid.",
+		http.StatusForbidden:             "The caller isn't allowed to access the resource.",
+		http.StatusNotFound:              "There is no such item.",
+		http.StatusConflict:              "The item changed concurrently, or the lease is held by another holder, or was lost.",
+		http.StatusPreconditionFailed:    "The item already exists.",
+		http.StatusRequestEntityTooLarge: "The request body or the item data is too large.",
+		http.StatusInternalServerError:   "The store failed.",
+		http.StatusNotImplemented:        "The store doesn't support the operation.",
+		http.StatusInsufficientStorage:   "The storage quota of the bucket or owner is exceeded.",
+	} {
+		doc.Components.Responses[errorResponseName(code)] = errorResponse(code, description)
+	}
+	doc.Components.Responses[errorResponseName(http.StatusTooManyRequests)] = errorResponse(http.StatusTooManyRequests,
+		"The request was rate limited, or the item quota of the bucket or owner is exceeded.", "Retry-After")
+	doc.Components.Responses[errorResponseName(http.StatusServiceUnavailable)] = errorResponse(http.StatusServiceUnavailable,
+		"The store is unavailable.", "Retry-After")
+	// Requests without valid credentials are rejected before reaching the API.
+	doc.Components.Responses[errorResponseName(http.StatusUnauthorized)] = openAPIResponse{
+		Description: "The request has no valid credentials.",
+	}
+
+	var (
+		bucketPath  = "/store/{bucket}"
+		itemPath    = bucketPath + "/{id}"
+		leasePath   = "/leases/{bucket}/{id}"
+		notModified = openAPIResponse{
+			Description: "The caller's copy is current.",
+			Headers: map[string]openAPIHeader{
+				ETagHeaderKey:         {Ref: ref("headers", ETagHeaderKey)},
+				LastModifiedHeaderKey: {Ref: ref("headers", LastModifiedHeaderKey)},
+			},
+		}
+		readHeaders   = notModified.Headers
+		itemBody      = &openAPIRequestBody{Required: true, Content: itemContent(schemaRef("Item")), MaxBytes: config.MaxBodyBytes}
+		leaseBody     = &openAPIRequestBody{Required: true, Content: jsonContent(schemaRef("LeaseRequest")), MaxBytes: config.MaxBodyBytes}
+		leaseResponse = openAPIResponse{Description: "The lease.", Content: jsonContent(schemaRef("Lease"))}
+	)
+
+	doc.Paths["/openapi.json"] = openAPIPathItem{
+		"get": {
+			OperationID: "getOpenAPI",
+			Summary:     "Get this document.",
+			Responses: responses(map[string]openAPIResponse{
+				"200": {Description: "The OpenAPI document of the API.", Content: jsonContent(&openAPISchema{Type: "object"})},
+			}),
+		},
+	}
+	doc.Paths[bucketPath] = openAPIPathItem{
+		"get": {
+			OperationID: "listItems",
+			Summary:     "List the items of a bucket.",
+			Description: "Lists the items of the owner, or of the whole bucket for callers with elevated access and no owner.",
+			Parameters:  paramRefs("bucket", "owner", "ifNoneMatch", "ifModifiedSince"),
+			Responses: responses(map[string]openAPIResponse{
+				"200": {Description: "The items, sorted by ID.", Headers: readHeaders, Content: itemContent(&openAPISchema{Type: "array", Items: schemaRef("Item")})},
+				"304": notModified,
+			}),
+		},
+	}
+	doc.Paths[itemPath] = openAPIPathItem{
+		"put": {
+			OperationID: "putItem",
+			Summary:     "Create or replace an item.",
+			Parameters:  paramRefs("bucket", "id", "owner", "ifNoneMatch"),
+			RequestBody: itemBody,
+			Responses: responses(map[string]openAPIResponse{
+				"200": {Description: "The item was replaced."},
+				"201": {Description: "The item was created."},
+			}, http.StatusConflict, http.StatusPreconditionFailed, http.StatusRequestEntityTooLarge, http.StatusNotImplemented, http.StatusInsufficientStorage),
+		},
+		"get": {
+			OperationID: "getItem",
+			Summary:     "Get an item.",
+			Parameters:  paramRefs("bucket", "id", "owner", "ifNoneMatch", "ifModifiedSince"),
+			Responses: responses(map[string]openAPIResponse{
+				"200": {Description: "The item.", Headers: readHeaders, Content: itemContent(schemaRef("Item"))},
+				"304": notModified,
+			}, http.StatusNotFound),
+		},
+		"delete": {
+			OperationID: "deleteItem",
+			Summary:     "Delete an item.",
+			Parameters:  paramRefs("bucket", "id", "owner"),
+			Responses: responses(map[string]openAPIResponse{
+				"200": {Description: "The deleted item.", Content: itemContent(schemaRef("Item"))},
+			}, http.StatusNotFound),
+		},
+	}
+	doc.Paths[itemPath+":increment"] = openAPIPathItem{
+		"post": {
+			OperationID: "incrementItem",
+			Summary:     "Atomically add a delta to a numeric field of the data of an item.",
+			Parameters:  paramRefs("bucket", "id", "owner"),
+			RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(schemaRef("IncrementRequest")), MaxBytes: config.MaxBodyBytes},
+			Responses: responses(map[string]openAPIResponse{
+				"200": {Description: "The new value of the field.", Content: jsonContent(schemaRef("IncrementResponse"))},
+			}, http.StatusNotFound, http.StatusNotImplemented),
+		},
+	}
+	doc.Paths["/transactions"] = openAPIPathItem{
+		"post": {
+			OperationID: "transact",
+			Summary:     "Apply puts and deletes all-or-nothing.",
+			Parameters:  paramRefs("owner"),
+			RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(schemaRef("TransactionRequest")), MaxBytes: config.MaxBodyBytes},
+			Responses: responses(map[string]openAPIResponse{
+				"200": {Description: "The transaction was committed.", Content: jsonContent(schemaRef("TransactionResponse"))},
+				"409": {Description: "The transaction was aborted.", Content: jsonContent(schemaRef("TransactionResponse"))},
+			}, http.StatusRequestEntityTooLarge, http.StatusNotImplemented),
+		},
+	}
+	doc.Paths[leasePath] = openAPIPathItem{
+		"post": {
+			OperationID: "acquireLease",
+			Summary:     "Acquire a lease.",
+			Parameters:  paramRefs("bucket", "id", "owner"),
+			RequestBody: leaseBody,
+			Responses:   responses(map[string]openAPIResponse{"200": leaseResponse}, http.StatusConflict, http.StatusNotImplemented),
+		},
+		"put": {
+			OperationID: "renewLease",
+			Summary:     "Renew a lease.",
+			Parameters:  paramRefs("bucket", "id", "owner"),
+			RequestBody: leaseBody,
+			Responses:   responses(map[string]openAPIResponse{"200": leaseResponse}, http.StatusConflict, http.StatusNotImplemented),
+		},
+		"delete": {
+			OperationID: "releaseLease",
+			Summary:     "Release a lease.",
+			Parameters: append(paramRefs("bucket", "id", "owner"),
+				openAPIParameter{Name: leaseHolderParamKey, In: "query", Required: true, Schema: &openAPISchema{Type: "string"}},
+				openAPIParameter{Name: leaseTokenParamKey, In: "query", Required: true, Schema: &openAPISchema{Type: "integer", Minimum: int64Pointer(1)}},
+			),
+			Responses: responses(map[string]openAPIResponse{
+				"204": {Description: "The lease was released."},
+			}, http.StatusConflict, http.StatusNotImplemented),
+		},
+		"get": {
+			OperationID: "getLease",
+			Summary:     "Get the current holder of a lease.",
+			Parameters:  paramRefs("bucket", "id", "owner"),
+			Responses:   responses(map[string]openAPIResponse{"200": leaseResponse}, http.StatusNotFound, http.StatusConflict),
+		},
+	}
+
+	if reconcile {
+		addReconcilePath(doc)
+	}
+	if quota {
+		addQuotaPath(doc, config)
+	}
+	return doc
+}
+
+// addReconcilePath describes the reconcile route, served when the store is
+// replicated.
+func addReconcilePath(doc *openAPIDocument) {
+	doc.Components.Schemas["ReconcileReport"] = &openAPISchema{
+		Type: "object",
+		Properties: map[string]*openAPISchema{
+			"bucket":             {Type: "string"},
+			"primaryCount":       {Type: "integer"},
+			"secondaryCount":     {Type: "integer"},
+			"missingInSecondary": {Type: "array", Items: &openAPISchema{Type: "string"}},
+			"missingInPrimary":   {Type: "array", Items: &openAPISchema{Type: "string"}},
+			"mismatched":         {Type: "array", Items: &openAPISchema{Type: "string"}},
+			"repaired":           {Type: "boolean"},
+		},
+	}
+	report := map[string]openAPIResponse{
+		"200": {Description: "The differences between the backends.", Content: jsonContent(schemaRef("ReconcileReport"))},
+	}
+	doc.Paths["/reconcile/{bucket}"] = openAPIPathItem{
+		"get": {
+			OperationID: "reportReplication",
+			Summary:     "Compare the items of a bucket on both backends. Requires elevated access.",
+			Parameters:  paramRefs("bucket"),
+			Responses:   responses(report),
+		},
+		"post": {
+			OperationID: "repairReplication",
+			Summary:     "Update the secondary backend to match the primary one. Requires elevated access.",
+			Parameters:  paramRefs("bucket"),
+			Responses:   responses(report),
+		},
+	}
+}
+
+// addQuotaPath describes the quota route, served when the store enforces
+// quotas.
+func addQuotaPath(doc *openAPIDocument, config *transportConfig) {
+	usage := &openAPISchema{
+		Type: "object",
+		Properties: map[string]*openAPISchema{
+			"items": {Type: "integer", Minimum: int64Pointer(0)},
+			"bytes": {Type: "integer", Minimum: int64Pointer(0)},
+		},
+	}
+	doc.Components.Schemas["Usage"] = usage
+	doc.Components.Schemas["BucketUsage"] = &openAPISchema{
+		Type: "object",
+		Properties: map[string]*openAPISchema{
+			"bucket":      {Type: "string"},
+			"usage":       schemaRef("Usage"),
+			"owners":      {Type: "object", AdditionalProperties: schemaRef("Usage")},
+			"bucketLimit": schemaRef("Usage"),
+			"ownerLimit":  schemaRef("Usage"),
+		},
+	}
+	doc.Components.Schemas["UsageAdjustment"] = &openAPISchema{
+		Type: "object",
+		Properties: map[string]*openAPISchema{
+			"owner": {Type: "string", Pattern: config.OwnerFormatRegex.String(), Description: "Owner whose usage is adjusted, the bucket's when not set."},
+			"items": {Type: "integer", Minimum: int64Pointer(0)},
+			"bytes": {Type: "integer", Minimum: int64Pointer(0)},
+		},
+	}
+	bucketUsage := map[string]openAPIResponse{
+		"200": {Description: "The usage of the bucket and its owners.", Content: jsonContent(schemaRef("BucketUsage"))},
+	}
+	doc.Paths["/quotas/{bucket}"] = openAPIPathItem{
+		"get": {
+			OperationID: "getUsage",
+			Summary:     "Get the usage of a bucket. Requires elevated access.",
+			Parameters:  paramRefs("bucket"),
+			Responses:   responses(bucketUsage),
+		},
+		"put": {
+			OperationID: "adjustUsage",
+			Summary:     "Override the usage of a bucket or owner until it's next counted. Requires elevated access.",
+			Parameters:  paramRefs("bucket"),
+			RequestBody: &openAPIRequestBody{Required: true, Content: jsonContent(schemaRef("UsageAdjustment")), MaxBytes: config.MaxBodyBytes},
+			Responses:   responses(bucketUsage),
+		},
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/xmidt-org/candlelight"
+)
+
+// ProblemContentType is the media type of the bodies of error responses.
+const ProblemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 body of error responses.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+
+	// Detail is the sanitized message of the error, also sent in the
+	// X-Xmidt-Error header. It's not set for internal errors.
+	Detail string `json:"detail,omitempty"`
+
+	// Code identifies the error. Unlike Detail, it's stable so clients can
+	// rely on it.
+	Code string `json:"code"`
+
+	// Field is the part of the request which is invalid and Format, when the
+	// field has one, the regex it must match.
+	Field  string `json:"field,omitempty"`
+	Format string `json:"format,omitempty"`
+
+	// TraceID is the ID of the trace of the request when it's traced.
+	TraceID string `json:"traceId,omitempty"`
+}
+
+// problemDetailer is implemented by errors which know their problem code and
+// the request field they're about.
+type problemDetailer interface {
+	ErrorCode() string
+	ErrorField() string
+}
+
+// newProblem returns the problem details of err, sent with the code status.
+func newProblem(ctx context.Context, config *transportConfig, err error, code int) Problem {
+	problem := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(code),
+		Status: code,
+		Code:   strings.ToLower(strings.ReplaceAll(http.StatusText(code), " ", "_")),
+	}
+
+	var sErrorer sanitizedErrorer
+	if errors.As(err, &sErrorer) {
+		problem.Detail = sErrorer.SanitizedError()
+	}
+
+	var detailer problemDetailer
+	if errors.As(err, &detailer) {
+		if code := detailer.ErrorCode(); code != "" {
+			problem.Code = code
+		}
+		problem.Field = detailer.ErrorField()
+		problem.Format = config.fieldFormat(problem.Field)
+	}
+
+	if traceID, _, ok := candlelight.ExtractTraceInfo(ctx); ok {
+		problem.TraceID = traceID
+	}
+	return problem
+}
+
+// WriteProblem sends an error response with the problem details of an error
+// raised outside of the store handlers, such as by middleware. code is the
+// stable identifier of the error and detail its message, also sent in the
+// X-Xmidt-Error header.
+func WriteProblem(ctx context.Context, w http.ResponseWriter, status int, code, detail string) {
+	problem := newProblem(ctx, nil, nil, status)
+	problem.Code = code
+	problem.Detail = detail
+	w.Header().Set(XmidtErrorHeaderKey, detail)
+	writeProblem(w, problem)
+}
+
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	body, err := json.Marshal(problem)
+	if err != nil {
+		w.WriteHeader(problem.Status)
+		return
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(body)
+}
+
+// fieldFormat returns the regex the values of field must match, if any.
+func (c *transportConfig) fieldFormat(field string) string {
+	switch field {
+	case bucketVarKey:
+		return c.BucketFormatRegex.String()
+	case idVarKey:
+		return c.IDFormatRegex.String()
+	case "owner":
+		return c.OwnerFormatRegex.String()
+	}
+	return ""
+}
@@ -15,16 +15,27 @@ import (
 	"go.uber.org/fx"
 )
 
-var errRegexCompilation = errors.New("regex could not be compiled")
+var (
+	errRegexCompilation     = errors.New("regex could not be compiled")
+	errItemDataMaxBytesHigh = errors.New("item data size limit is over the limit of the store")
+)
 
 // allow up to 31 nested objects in item data by default
 const defaultItemDataMaxDepth uint = 30
 
-// ProvideHandlers fetches all dependencies and builds the four main handlers for this store.
+const defaultMaxBodyBytes int64 = 1024 * 1024
+
+// ProvideHandlers fetches all dependencies and builds the four main handlers for this store,
+// the lease handlers, the reconcile handler which is nil unless the store is replicated and
+// the quota handler which is nil unless the store enforces quotas, and the handler serving
+// the OpenAPI document of these, as well as the v2 handlers sending items along with their
+// metadata. It also provides the ArgusStore gRPC service, served through the same endpoints.
 func ProvideHandlers() fx.Option {
 	return fx.Provide(
 		newAccessLevelAttributeKeyAnnotated(),
 		newTransportConfig,
+		newRedactor,
+		newGRPCStore,
 
 		fx.Annotated{
 			Name:   "set_handler",
@@ -42,6 +53,54 @@ func ProvideHandlers() fx.Option {
 			Name:   "delete_handler",
 			Target: newDeleteItemHandler,
 		},
+		fx.Annotated{
+			Name:   "get_v2_handler",
+			Target: newGetItemV2Handler,
+		},
+		fx.Annotated{
+			Name:   "get_all_v2_handler",
+			Target: newGetAllItemsV2Handler,
+		},
+		fx.Annotated{
+			Name:   "delete_v2_handler",
+			Target: newDeleteItemV2Handler,
+		},
+		fx.Annotated{
+			Name:   "increment_handler",
+			Target: newIncrementItemHandler,
+		},
+		fx.Annotated{
+			Name:   "transaction_handler",
+			Target: newTransactionHandler,
+		},
+		fx.Annotated{
+			Name:   "acquire_lease_handler",
+			Target: newAcquireLeaseHandler,
+		},
+		fx.Annotated{
+			Name:   "renew_lease_handler",
+			Target: newRenewLeaseHandler,
+		},
+		fx.Annotated{
+			Name:   "release_lease_handler",
+			Target: newReleaseLeaseHandler,
+		},
+		fx.Annotated{
+			Name:   "get_lease_handler",
+			Target: newGetLeaseHandler,
+		},
+		fx.Annotated{
+			Name:   "reconcile_handler",
+			Target: newReconcileHandler,
+		},
+		fx.Annotated{
+			Name:   "quota_handler",
+			Target: newQuotaHandler,
+		},
+		fx.Annotated{
+			Name:   "openapi_handler",
+			Target: newOpenAPIHandler,
+		},
 	)
 }
 
@@ -64,12 +123,53 @@ type UserInputValidationConfig struct {
 	BucketFormatRegex string
 	OwnerFormatRegex  string
 	ItemDataMaxDepth  uint
+
+	// MaxBodyBytes bounds the size of request bodies.
+	// (Optional) defaults to 1MB.
+	MaxBodyBytes int64
+
+	// ItemDataMaxBytes bounds the size of item data, JSON encoded. It can't be
+	// over the limit of the store backend.
+	// (Optional) defaults to the limit of the store backend, if any.
+	ItemDataMaxBytes int64
+
+	// BucketItemDataMaxBytes overrides ItemDataMaxBytes for some buckets.
+	// (Optional)
+	BucketItemDataMaxBytes map[string]int64
+}
+
+// MaxItemDataBytes returns the size of the largest item data, JSON encoded,
+// which can be written through the API, bounded by the size of request bodies.
+func (v UserInputValidationConfig) MaxItemDataBytes() int64 {
+	limit := v.MaxBodyBytes
+	if limit <= 0 {
+		limit = defaultMaxBodyBytes
+	}
+	if v.ItemDataMaxBytes <= 0 {
+		return limit
+	}
+	largest := v.ItemDataMaxBytes
+	for _, value := range v.BucketItemDataMaxBytes {
+		if value <= 0 {
+			return limit
+		}
+		if value > largest {
+			largest = value
+		}
+	}
+	if largest < limit {
+		return largest
+	}
+	return limit
 }
 
 type transportConfigIn struct {
 	fx.In
 	UserInputValidation     UserInputValidationConfig
 	AccessLevelAttributeKey string `name:"access_level_attribute_key"`
+
+	// Store bounds the item data size limits.
+	Store S `optional:"true"`
 }
 
 func newTransportConfig(in transportConfigIn) (*transportConfig, error) {
@@ -83,16 +183,57 @@ func newTransportConfig(in transportConfigIn) (*transportConfig, error) {
 		v.ItemDataMaxDepth = defaultItemDataMaxDepth
 	}
 
+	if v.MaxBodyBytes <= 0 {
+		v.MaxBodyBytes = defaultMaxBodyBytes
+	}
+
 	config := &transportConfig{
 		AccessLevelAttributeKey: in.AccessLevelAttributeKey,
 		ItemMaxTTL:              v.ItemMaxTTL,
 		ItemDataMaxDepth:        v.ItemDataMaxDepth,
+		MaxBodyBytes:            v.MaxBodyBytes,
 	}
 
+	if err := buildItemDataSizeLimits(v, in.Store, config); err != nil {
+		return nil, err
+	}
 	err := buildInputRegexValidators(v, config)
 	return config, err
 }
 
+// buildItemDataSizeLimits defaults the item data size limits to the one of the
+// store backend and makes sure none of them is over it.
+func buildItemDataSizeLimits(userInputValidation UserInputValidationConfig, s S, config *transportConfig) error {
+	var storeLimit int64
+	if s != nil {
+		storeLimit = MaxItemDataBytes(s)
+	}
+	limit := func(scope string, value int64) (int64, error) {
+		if value <= 0 {
+			return storeLimit, nil
+		}
+		if storeLimit > 0 && value > storeLimit {
+			return 0, fmt.Errorf("%s %w: %d > %d bytes", scope, errItemDataMaxBytesHigh, value, storeLimit)
+		}
+		return value, nil
+	}
+
+	var err error
+	if config.ItemDataMaxBytes, err = limit("default", userInputValidation.ItemDataMaxBytes); err != nil {
+		return err
+	}
+	if len(userInputValidation.BucketItemDataMaxBytes) == 0 {
+		return nil
+	}
+	config.BucketItemDataMaxBytes = make(map[string]int64, len(userInputValidation.BucketItemDataMaxBytes))
+	for bucket, value := range userInputValidation.BucketItemDataMaxBytes {
+		if config.BucketItemDataMaxBytes[bucket], err = limit("bucket "+bucket, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // useOrDefault returns the value if it's not the empty string. Otherwise, it returns the defaultValue.
 func useOrDefault(value, defaultValue string) string {
 	if len(value) > 0 {
@@ -16,6 +16,7 @@ func TestNewTransportConfig(t *testing.T) {
 	type testCase struct {
 		Description             string
 		UserInputValConfig      UserInputValidationConfig
+		Store                   S
 		ExpectedTransportConfig transportConfig
 		ShouldUnmarshalFail     bool
 		ExpectedErr             error
@@ -50,9 +51,34 @@ func TestNewTransportConfig(t *testing.T) {
 				BucketFormatRegex: ".+",
 				OwnerFormatRegex:  ".*",
 				ItemDataMaxDepth:  5,
+				MaxBodyBytes:      2048,
 			},
 			ExpectedTransportConfig: getCheckValuesExpectedConfig(),
 		},
+		{
+			Description: "Store size limit",
+			Store:       &MockSizeLimiterDAO{maxItemDataBytes: 1000},
+			UserInputValConfig: UserInputValidationConfig{
+				BucketItemDataMaxBytes: map[string]int64{"small": 100, "default": 0},
+			},
+			ExpectedTransportConfig: getSizeLimitsExpectedConfig(),
+		},
+		{
+			Description: "Item data limit over the store one",
+			Store:       &MockSizeLimiterDAO{maxItemDataBytes: 1000},
+			UserInputValConfig: UserInputValidationConfig{
+				ItemDataMaxBytes: 1001,
+			},
+			ExpectedErr: errItemDataMaxBytesHigh,
+		},
+		{
+			Description: "Bucket item data limit over the store one",
+			Store:       &MockSizeLimiterDAO{maxItemDataBytes: 1000},
+			UserInputValConfig: UserInputValidationConfig{
+				BucketItemDataMaxBytes: map[string]int64{"large": 2000},
+			},
+			ExpectedErr: errItemDataMaxBytesHigh,
+		},
 	}
 
 	for _, tc := range tcs {
@@ -63,18 +89,68 @@ func TestNewTransportConfig(t *testing.T) {
 			transportConfig, err := newTransportConfig(transportConfigIn{
 				AccessLevelAttributeKey: "attr-key",
 				UserInputValidation:     tc.UserInputValConfig,
+				Store:                   tc.Store,
 			})
 			if tc.ExpectedErr == nil {
 				require.Nil(err)
 				require.NotNil(transportConfig)
 				assert.Equal(tc.ExpectedTransportConfig, *transportConfig)
 			} else {
-				errors.Is(err, tc.ExpectedErr)
+				assert.True(errors.Is(err, tc.ExpectedErr))
 			}
 		})
 	}
 }
 
+func TestMaxItemDataBytes(t *testing.T) {
+	tcs := []struct {
+		Description string
+		Config      UserInputValidationConfig
+		Expected    int64
+	}{
+		{
+			Description: "Default values",
+			Expected:    defaultMaxBodyBytes,
+		},
+		{
+			Description: "Body size limit",
+			Config:      UserInputValidationConfig{MaxBodyBytes: 2048},
+			Expected:    2048,
+		},
+		{
+			Description: "Item data limits",
+			Config: UserInputValidationConfig{
+				ItemDataMaxBytes:       100,
+				BucketItemDataMaxBytes: map[string]int64{"large": 1000, "small": 10},
+			},
+			Expected: 1000,
+		},
+		{
+			Description: "Unlimited bucket",
+			Config: UserInputValidationConfig{
+				MaxBodyBytes:           2048,
+				ItemDataMaxBytes:       100,
+				BucketItemDataMaxBytes: map[string]int64{"default": 0},
+			},
+			Expected: 2048,
+		},
+		{
+			Description: "Item data limit over the body one",
+			Config: UserInputValidationConfig{
+				MaxBodyBytes:     2048,
+				ItemDataMaxBytes: 4096,
+			},
+			Expected: 2048,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert.Equal(t, tc.Expected, tc.Config.MaxItemDataBytes())
+		})
+	}
+}
+
 func getDefaultValuesExpectedConfig() transportConfig {
 	return transportConfig{
 		AccessLevelAttributeKey: "attr-key",
@@ -83,6 +159,7 @@ func getDefaultValuesExpectedConfig() transportConfig {
 		IDFormatRegex:           regexp.MustCompile(IDFormatRegexSource),
 		BucketFormatRegex:       regexp.MustCompile(BucketFormatRegexSource),
 		ItemDataMaxDepth:        defaultItemDataMaxDepth,
+		MaxBodyBytes:            defaultMaxBodyBytes,
 	}
 }
 
@@ -94,5 +171,13 @@ func getCheckValuesExpectedConfig() transportConfig {
 		IDFormatRegex:           regexp.MustCompile(IDFormatRegexSource),
 		BucketFormatRegex:       regexp.MustCompile(".+"),
 		ItemDataMaxDepth:        5,
+		MaxBodyBytes:            2048,
 	}
 }
+
+func getSizeLimitsExpectedConfig() transportConfig {
+	config := getDefaultValuesExpectedConfig()
+	config.ItemDataMaxBytes = 1000
+	config.BucketItemDataMaxBytes = map[string]int64{"small": 100, "default": 1000}
+	return config
+}
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	errQuotaAdminRequired = &ForbiddenRequestErr{Message: "quota usage requires elevated access", Code: "elevated_access_required"}
+	errInvalidUsage       = BadRequestErr{Message: "Usage items and bytes must not be negative.", Code: "invalid_usage", Field: "usage"}
+)
+
+// UsageTracker is implemented by stores enforcing quotas on the items of
+// buckets and their owners.
+type UsageTracker interface {
+	// Usage reports the usage of a bucket and of its owners.
+	Usage(bucket string) (BucketUsage, error)
+
+	// AdjustUsage overrides the usage of a bucket or, when owner is set, of an
+	// owner within the bucket. The difference with the usage counted from the
+	// items is kept when they're counted again.
+	AdjustUsage(bucket, owner string, usage Usage) (BucketUsage, error)
+}
+
+// Usage is an amount of items and of their bytes, JSON encoded. As a limit,
+// zero values mean unlimited.
+type Usage struct {
+	Items int64 `json:"items"`
+	Bytes int64 `json:"bytes"`
+}
+
+// BucketUsage is the usage of a bucket, its owners and their limits.
+type BucketUsage struct {
+	Bucket      string           `json:"bucket"`
+	Usage       Usage            `json:"usage"`
+	Owners      map[string]Usage `json:"owners"`
+	BucketLimit Usage            `json:"bucketLimit"`
+	OwnerLimit  Usage            `json:"ownerLimit"`
+}
+
+type usageRequest struct {
+	bucket string
+	adjust bool
+	owner  string
+	usage  Usage
+}
+
+type adjustUsageBody struct {
+	Owner string `json:"owner"`
+	Usage
+}
+
+type quotaHandlerIn struct {
+	fx.In
+	GetLogger    func(context.Context) *zap.Logger
+	UsageTracker UsageTracker `optional:"true"`
+	Config       *transportConfig
+}
+
+// newQuotaHandler returns nil when the store doesn't enforce quotas.
+func newQuotaHandler(in quotaHandlerIn) Handler {
+	if in.UsageTracker == nil {
+		return nil
+	}
+	return kithttp.NewServer(
+		newQuotaEndpoint(in.UsageTracker),
+		usageRequestDecoder(in.Config),
+		encodeUsageResponse,
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
+	)
+}
+
+func newQuotaEndpoint(t UsageTracker) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		usageRequest := request.(*usageRequest)
+		var (
+			usage BucketUsage
+			err   error
+		)
+		if usageRequest.adjust {
+			usage, err = t.AdjustUsage(usageRequest.bucket, usageRequest.owner, usageRequest.usage)
+		} else {
+			usage, err = t.Usage(usageRequest.bucket)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &usage, nil
+	}
+}
+
+// usageRequestDecoder reports the usage on GET and adjusts it on PUT.
+func usageRequestDecoder(config *transportConfig) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		bucket := mux.Vars(r)[bucketVarKey]
+		if !isBucketValid(config.BucketFormatRegex, bucket) {
+			return nil, errInvalidBucket
+		}
+		if !hasElevatedAccess(ctx, config.AccessLevelAttributeKey) {
+			return nil, errQuotaAdminRequired
+		}
+		request := &usageRequest{bucket: bucket}
+		if r.Method != http.MethodPut {
+			return request, nil
+		}
+
+		data, err := readBody(config, r)
+		if err != nil {
+			return nil, err
+		}
+		var body adjustUsageBody
+		if err := json.Unmarshal(data, &body); err != nil {
+			return nil, fmt.Errorf("%w: %v", errPayloadUnmarshalFailure, err)
+		}
+		if body.Owner != "" && !isOwnerValid(config.OwnerFormatRegex, body.Owner) {
+			return nil, errInvalidOwner
+		}
+		if body.Items < 0 || body.Bytes < 0 {
+			return nil, errInvalidUsage
+		}
+		request.adjust, request.owner, request.usage = true, body.Owner, body.Usage
+		return request, nil
+	}
+}
+
+func encodeUsageResponse(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
+	data, err := json.Marshal(response.(*BucketUsage))
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.Write(data)
+	return nil
+}
@@ -0,0 +1,471 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package quota provides a store.S decorator which limits the number and size
+// of the items of buckets and of each of their owners.
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/httpaux/erraux"
+)
+
+// Quota is the path to the configuration structure of this package
+// under the store configuration block.
+const Quota = "quota"
+
+const defaultRefreshInterval = 5 * time.Minute
+
+// ErrQuotaExceeded is returned by writes which would take a bucket or an owner
+// over its limits.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+var (
+	errHTTPItemQuota    = &erraux.Error{Err: errors.New("item quota exceeded"), Code: http.StatusTooManyRequests}
+	errHTTPStorageQuota = &erraux.Error{Err: errors.New("storage quota exceeded"), Code: http.StatusInsufficientStorage}
+)
+
+// Limits bounds an amount of items.
+type Limits struct {
+	// Items is the maximum number of items.
+	// (Optional) unlimited when 0.
+	Items int64
+
+	// Bytes is the maximum total size of the items, JSON encoded.
+	// (Optional) unlimited when 0.
+	Bytes int64
+}
+
+// BucketLimits are the limits of a bucket and of each owner within it.
+type BucketLimits struct {
+	Bucket Limits
+	Owner  Limits
+}
+
+// Config configures the quotas.
+type Config struct {
+	// Default applies to the buckets which aren't listed in Buckets.
+	Default BucketLimits
+
+	// Buckets overrides the limits of specific buckets.
+	Buckets map[string]BucketLimits
+
+	// RefreshInterval is how often the usage of a bucket is counted again from
+	// its items, dropping expired items and picking up the writes made through
+	// other instances. Counts after the first one run in the background, writes
+	// being checked against the previous count meanwhile.
+	// (Optional) defaults to 5m.
+	RefreshInterval time.Duration
+}
+
+// entry is the tracked share of an item in the usage.
+type entry struct {
+	owner string
+	size  int64
+}
+
+type bucketUsage struct {
+	lock      sync.Mutex
+	countedAt time.Time
+	counting  bool
+	entries   map[string]*entry
+	total     store.Usage
+	owners    map[string]store.Usage
+
+	// offsets hold the adjustments, as corrections of the counted usage kept
+	// across counts.
+	offset       store.Usage
+	ownerOffsets map[string]store.Usage
+}
+
+// Store tracks the usage of the buckets with limits from their items, counted
+// when first written to then every refresh interval. In between, writes
+// update the usage as they go. Expired items keep counting until the next
+// count.
+//
+// Limits are enforced per instance and are best effort: each instance keeps
+// its own usage in memory, along with the owner and size of every item of the
+// limited buckets, and only sees the writes of the others when it
+// counts again, so with N instances a bucket or an owner can go up to N times
+// over its limits in between. Likewise, adjustments only apply to the instance
+// they're made through and are lost when it restarts.
+type Store struct {
+	store.S
+	config  Config
+	now     func() time.Time
+	lock    sync.Mutex
+	buckets map[string]*bucketUsage
+
+	// counts tracks the background counts.
+	counts sync.WaitGroup
+}
+
+// New decorates s to enforce the quotas described by config.
+func New(s store.S, config Config) *Store {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = defaultRefreshInterval
+	}
+	return &Store{
+		S:       s,
+		config:  config,
+		now:     time.Now,
+		buckets: map[string]*bucketUsage{},
+	}
+}
+
+func (s *Store) limits(bucket string) BucketLimits {
+	if limits, ok := s.config.Buckets[bucket]; ok {
+		return limits
+	}
+	return s.config.Default
+}
+
+func (l BucketLimits) unlimited() bool {
+	return l == BucketLimits{}
+}
+
+func (s *Store) Push(key model.Key, item store.OwnableItem) error {
+	return s.write(key, item, func() error {
+		return s.S.Push(key, item)
+	})
+}
+
+func (s *Store) PushIfAbsent(key model.Key, item store.OwnableItem) error {
+	return s.write(key, item, func() error {
+		return store.PushIfAbsent(s.S, key, item)
+	})
+}
+
+func (s *Store) CompareAndSwap(key model.Key, old, item store.OwnableItem) error {
+	return s.write(key, item, func() error {
+		return store.CompareAndSwap(s.S, key, old, item)
+	})
+}
+
+// write reserves the usage of the item before running op, the reservation
+// being undone when op fails.
+func (s *Store) write(key model.Key, item store.OwnableItem, op func() error) error {
+	limits := s.limits(key.Bucket)
+	if limits.unlimited() {
+		return op()
+	}
+	u, err := s.lockUsage(key.Bucket)
+	if err != nil {
+		return err
+	}
+	undo, err := u.reserve(key, newEntry(item), limits)
+	u.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := op(); err != nil {
+		undo()
+		return err
+	}
+	return nil
+}
+
+// Increment reserves the usage of the item once incremented before the backend
+// applies the increment, as increments creating fields grow the item. The
+// usage is computed from the item as read, concurrent writes being picked up
+// by the next count.
+func (s *Store) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	if s.limits(key.Bucket).unlimited() {
+		return store.Increment(s.S, key, path, delta, modifiedBy)
+	}
+	incremented, err := s.S.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if incremented.Data, err = store.CopyData(incremented.Data); err != nil {
+		return 0, err
+	}
+	if _, err := store.IncrementData(incremented.Data, path, delta); err != nil {
+		return 0, store.SanitizeError(store.ItemOperationError{Err: err, Key: key, Operation: "increment"})
+	}
+	var value float64
+	err = s.write(key, incremented, func() error {
+		value, err = store.Increment(s.S, key, path, delta, modifiedBy)
+		return err
+	})
+	return value, err
+}
+
+func (s *Store) Delete(key model.Key) (store.OwnableItem, error) {
+	item, err := s.S.Delete(key)
+	if err == nil && !s.limits(key.Bucket).unlimited() {
+		s.forget(key)
+	}
+	return item, err
+}
+
+// Transact reserves the usage of all the items written before applying the
+// transaction.
+func (s *Store) Transact(ops []store.TransactionOp) error {
+	var undos []func()
+	undoAll := func() {
+		for _, undo := range undos {
+			undo()
+		}
+	}
+	for _, op := range ops {
+		limits := s.limits(op.Key.Bucket)
+		if op.Delete || limits.unlimited() {
+			continue
+		}
+		u, err := s.lockUsage(op.Key.Bucket)
+		if err != nil {
+			undoAll()
+			return err
+		}
+		undo, err := u.reserve(op.Key, newEntry(op.Item), limits)
+		u.lock.Unlock()
+		if err != nil {
+			undoAll()
+			return err
+		}
+		undos = append(undos, undo)
+	}
+
+	if err := store.Transact(s.S, ops); err != nil {
+		undoAll()
+		return err
+	}
+	for _, op := range ops {
+		if op.Delete && !s.limits(op.Key.Bucket).unlimited() {
+			s.forget(op.Key)
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, error) {
+	return store.GetAllByOwner(s.S, bucket, owner)
+}
+
+func (s *Store) BucketDigest(bucket string) (store.Digest, error) {
+	return store.BucketDigest(s.S, bucket, "", true)
+}
+
+func (s *Store) OwnerDigest(bucket, owner string) (store.Digest, error) {
+	return store.BucketDigest(s.S, bucket, owner, false)
+}
+
+func (s *Store) MaxItemDataBytes() int64 {
+	return store.MaxItemDataBytes(s.S)
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	if p, ok := s.S.(store.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (s *Store) Usage(bucket string) (store.BucketUsage, error) {
+	u, err := s.lockUsage(bucket)
+	if err != nil {
+		return store.BucketUsage{}, err
+	}
+	defer u.lock.Unlock()
+	return u.report(bucket, s.limits(bucket)), nil
+}
+
+func (s *Store) AdjustUsage(bucket, owner string, usage store.Usage) (store.BucketUsage, error) {
+	u, err := s.lockUsage(bucket)
+	if err != nil {
+		return store.BucketUsage{}, err
+	}
+	defer u.lock.Unlock()
+	if owner == "" {
+		u.offset = sub(usage, u.total)
+	} else {
+		u.ownerOffsets[owner] = sub(usage, u.owners[owner])
+	}
+	return u.report(bucket, s.limits(bucket)), nil
+}
+
+// lockUsage returns the locked usage of the bucket, counting it first when
+// it's never been counted. Later counts are started in the background when
+// due, so that writes don't wait for them.
+func (s *Store) lockUsage(bucket string) (*bucketUsage, error) {
+	s.lock.Lock()
+	u, ok := s.buckets[bucket]
+	if !ok {
+		u = &bucketUsage{}
+		s.buckets[bucket] = u
+	}
+	s.lock.Unlock()
+
+	u.lock.Lock()
+	now := s.now()
+	switch {
+	case u.countedAt.IsZero():
+		items, err := s.S.GetAll(bucket)
+		if err != nil {
+			u.lock.Unlock()
+			return nil, err
+		}
+		u.count(items)
+		u.countedAt = now
+	case !u.counting && now.Sub(u.countedAt) >= s.config.RefreshInterval:
+		u.counting = true
+		s.counts.Add(1)
+		go s.recount(bucket, u)
+	}
+	return u, nil
+}
+
+// recount counts the usage of the bucket again from its items. The writes
+// made while the items are read may be missed until the following count.
+func (s *Store) recount(bucket string, u *bucketUsage) {
+	defer s.counts.Done()
+	items, err := s.S.GetAll(bucket)
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.counting = false
+	if err == nil {
+		u.count(items)
+		u.countedAt = s.now()
+	}
+}
+
+func (s *Store) forget(key model.Key) {
+	s.lock.Lock()
+	u, ok := s.buckets[key.Bucket]
+	s.lock.Unlock()
+	if !ok {
+		return
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if e, ok := u.entries[key.ID]; ok {
+		u.remove(key.ID, e)
+	}
+}
+
+func newEntry(item store.OwnableItem) *entry {
+	data, _ := json.Marshal(item.Item)
+	return &entry{owner: item.Owner, size: int64(len(data))}
+}
+
+// count replaces the usage with the one of items, keeping the adjustments.
+func (u *bucketUsage) count(items map[string]store.OwnableItem) {
+	u.entries = make(map[string]*entry, len(items))
+	u.total = store.Usage{}
+	u.owners = map[string]store.Usage{}
+	if u.ownerOffsets == nil {
+		u.ownerOffsets = map[string]store.Usage{}
+	}
+	for id, item := range items {
+		u.add(id, newEntry(item))
+	}
+}
+
+// reserve checks the limits would still hold once e replaces the item at key,
+// then applies it. Writes which don't grow the usage are always accepted. The
+// returned function undoes the reservation unless the item was written again since.
+func (u *bucketUsage) reserve(key model.Key, e *entry, limits BucketLimits) (func(), error) {
+	previous := u.entries[key.ID]
+	delta := store.Usage{Items: 1, Bytes: e.size}
+	if previous != nil {
+		delta.Items--
+		delta.Bytes -= previous.size
+	}
+	if err := check(add(u.total, u.offset), delta, limits.Bucket, "bucket "+key.Bucket); err != nil {
+		return nil, err
+	}
+	ownerDelta := delta
+	if previous != nil && previous.owner != e.owner {
+		ownerDelta = store.Usage{Items: 1, Bytes: e.size}
+	}
+	if err := check(add(u.owners[e.owner], u.ownerOffsets[e.owner]), ownerDelta, limits.Owner, "owner "+e.owner); err != nil {
+		return nil, err
+	}
+
+	if previous != nil {
+		u.remove(key.ID, previous)
+	}
+	u.add(key.ID, e)
+	return func() {
+		u.lock.Lock()
+		defer u.lock.Unlock()
+		if u.entries[key.ID] != e {
+			return
+		}
+		u.remove(key.ID, e)
+		if previous != nil {
+			u.add(key.ID, previous)
+		}
+	}, nil
+}
+
+func (u *bucketUsage) add(id string, e *entry) {
+	u.entries[id] = e
+	u.total = add(u.total, store.Usage{Items: 1, Bytes: e.size})
+	u.owners[e.owner] = add(u.owners[e.owner], store.Usage{Items: 1, Bytes: e.size})
+}
+
+func (u *bucketUsage) remove(id string, e *entry) {
+	delete(u.entries, id)
+	u.total = sub(u.total, store.Usage{Items: 1, Bytes: e.size})
+	owner := sub(u.owners[e.owner], store.Usage{Items: 1, Bytes: e.size})
+	if owner == (store.Usage{}) {
+		delete(u.owners, e.owner)
+	} else {
+		u.owners[e.owner] = owner
+	}
+}
+
+func (u *bucketUsage) report(bucket string, limits BucketLimits) store.BucketUsage {
+	owners := make(map[string]store.Usage, len(u.owners))
+	for owner, usage := range u.owners {
+		owners[owner] = add(usage, u.ownerOffsets[owner])
+	}
+	for owner, offset := range u.ownerOffsets {
+		if _, ok := owners[owner]; !ok {
+			owners[owner] = offset
+		}
+	}
+	return store.BucketUsage{
+		Bucket:      bucket,
+		Usage:       add(u.total, u.offset),
+		Owners:      owners,
+		BucketLimit: store.Usage(limits.Bucket),
+		OwnerLimit:  store.Usage(limits.Owner),
+	}
+}
+
+// check returns the error of a write growing usage by delta over limits.
+func check(usage, delta store.Usage, limits Limits, scope string) error {
+	if limits.Items > 0 && delta.Items > 0 && usage.Items+delta.Items > limits.Items {
+		return store.SanitizedError{
+			Err:     fmt.Errorf("%w: %s is limited to %d items", ErrQuotaExceeded, scope, limits.Items),
+			ErrHTTP: errHTTPItemQuota,
+		}
+	}
+	if limits.Bytes > 0 && delta.Bytes > 0 && usage.Bytes+delta.Bytes > limits.Bytes {
+		return store.SanitizedError{
+			Err:     fmt.Errorf("%w: %s is limited to %d bytes", ErrQuotaExceeded, scope, limits.Bytes),
+			ErrHTTP: errHTTPStorageQuota,
+		}
+	}
+	return nil
+}
+
+func add(a, b store.Usage) store.Usage {
+	return store.Usage{Items: a.Items + b.Items, Bytes: a.Bytes + b.Bytes}
+}
+
+func sub(a, b store.Usage) store.Usage {
+	return store.Usage{Items: a.Items - b.Items, Bytes: a.Bytes - b.Bytes}
+}
@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package quota
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/argus/store/inmem"
+)
+
+func key(id string) model.Key {
+	return model.Key{Bucket: "bucket", ID: id}
+}
+
+func item(id, owner string, data map[string]interface{}) store.OwnableItem {
+	return store.OwnableItem{Owner: owner, Item: model.Item{ID: id, Data: data}}
+}
+
+func statusCode(err error) int {
+	var statusCoder interface{ StatusCode() int }
+	if !errors.As(err, &statusCoder) {
+		return 0
+	}
+	return statusCoder.StatusCode()
+}
+
+func TestItemQuota(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := New(inmem.NewSharded(inmem.Config{}, nil), Config{
+		Default: BucketLimits{Bucket: Limits{Items: 2}},
+	})
+	data := map[string]interface{}{"k": "v"}
+
+	require.NoError(s.Push(key("a"), item("a", "owner", data)))
+	require.NoError(s.Push(key("b"), item("b", "owner", data)))
+	err := s.Push(key("c"), item("c", "owner", data))
+	assert.ErrorIs(err, ErrQuotaExceeded)
+	assert.Equal(http.StatusTooManyRequests, statusCode(err))
+
+	require.NoError(s.Push(key("a"), item("a", "owner", map[string]interface{}{"k": "updated"})), "overwrites don't add items")
+	_, err = s.Delete(key("b"))
+	require.NoError(err)
+	require.NoError(s.Push(key("c"), item("c", "owner", data)))
+
+	err = s.Transact([]store.TransactionOp{
+		{Key: key("a"), Delete: true},
+		{Key: key("d"), Item: item("d", "owner", data)},
+	})
+	assert.ErrorIs(err, ErrQuotaExceeded, "deletes only free usage once applied")
+	usage, err := s.Usage("bucket")
+	require.NoError(err)
+	assert.Equal(int64(2), usage.Usage.Items)
+}
+
+func TestOwnerQuota(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := New(inmem.NewSharded(inmem.Config{}, nil), Config{
+		Buckets: map[string]BucketLimits{"bucket": {Owner: Limits{Bytes: 100}}},
+	})
+	small := map[string]interface{}{"k": "v"}
+	large := map[string]interface{}{"k": "0123456789012345678901234567890123456789012345678901234567890123456789"}
+
+	require.NoError(s.Push(key("a"), item("a", "owner", small)))
+	err := s.Push(key("b"), item("b", "owner", large))
+	assert.ErrorIs(err, ErrQuotaExceeded)
+	assert.Equal(http.StatusInsufficientStorage, statusCode(err))
+	require.NoError(s.Push(key("b"), item("b", "other", large)), "owners have their own quota")
+	require.NoError(s.Push(model.Key{Bucket: "other", ID: "b"}, item("b", "owner", large)), "other buckets use the default limits")
+
+	usage, err := s.Usage("bucket")
+	require.NoError(err)
+	assert.Equal(int64(1), usage.Owners["owner"].Items)
+	assert.Equal(int64(1), usage.Owners["other"].Items)
+	assert.Equal(store.Usage{Bytes: 100}, usage.OwnerLimit)
+}
+
+func TestFailedWrite(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	s := New(inmem.NewSharded(inmem.Config{}, nil), Config{
+		Default: BucketLimits{Bucket: Limits{Items: 2}},
+	})
+	data := map[string]interface{}{"k": "v"}
+
+	require.NoError(s.Push(key("a"), item("a", "owner", data)))
+	assert.ErrorIs(store.PushIfAbsent(s, key("a"), item("a", "owner", data)), store.ErrItemExists)
+	assert.ErrorIs(store.CompareAndSwap(s, key("b"), item("b", "owner", data), item("b", "owner", data)), store.ErrItemNotFound)
+
+	usage, err := s.Usage("bucket")
+	require.NoError(err)
+	assert.Equal(int64(1), usage.Usage.Items, "failed writes release their reservation")
+}
+
+func TestRefreshAndAdjust(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	backend := inmem.NewSharded(inmem.Config{}, nil)
+	s := New(backend, Config{
+		Default:         BucketLimits{Bucket: Limits{Items: 10}},
+		RefreshInterval: time.Minute,
+	})
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	data := map[string]interface{}{"k": "v"}
+
+	require.NoError(backend.Push(key("a"), item("a", "owner", data)))
+	require.NoError(s.Push(key("b"), item("b", "owner", data)))
+	require.NoError(backend.Push(key("c"), item("c", "owner", data)))
+
+	usage, err := s.Usage("bucket")
+	require.NoError(err)
+	assert.Equal(int64(2), usage.Usage.Items, "items written elsewhere are only counted on refresh")
+
+	usage, err = s.AdjustUsage("bucket", "", store.Usage{Items: 10})
+	require.NoError(err)
+	assert.Equal(int64(10), usage.Usage.Items)
+	assert.ErrorIs(s.Push(key("d"), item("d", "owner", data)), ErrQuotaExceeded)
+
+	usage, err = s.AdjustUsage("bucket", "owner", store.Usage{Items: 1, Bytes: 1})
+	require.NoError(err)
+	assert.Equal(store.Usage{Items: 1, Bytes: 1}, usage.Owners["owner"])
+
+	now = now.Add(time.Minute)
+	usage, err = s.Usage("bucket")
+	require.NoError(err)
+	assert.Equal(int64(10), usage.Usage.Items, "counts again in the background")
+	s.counts.Wait()
+
+	usage, err = s.Usage("bucket")
+	require.NoError(err)
+	assert.Equal(int64(11), usage.Usage.Items, "adjustments are kept across counts")
+	size := newEntry(item("a", "owner", data)).size
+	assert.Equal(store.Usage{Items: 2, Bytes: size + 1}, usage.Owners["owner"])
+	assert.ErrorIs(s.Push(key("d"), item("d", "owner", data)), ErrQuotaExceeded)
+}
+
+func TestIncrement(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	backend := inmem.NewSharded(inmem.Config{}, nil)
+	s := New(backend, Config{
+		Default: BucketLimits{Bucket: Limits{Bytes: 40}},
+	})
+
+	require.NoError(s.Push(key("a"), item("a", "owner", map[string]interface{}{"count": 1})))
+	value, err := s.Increment(key("a"), []string{"count"}, 10, "")
+	require.NoError(err)
+	assert.Equal(11.0, value)
+	usage, err := s.Usage("bucket")
+	require.NoError(err)
+	assert.Equal(store.Usage{Items: 1, Bytes: 30}, usage.Usage, "increments account for the size of the updated item")
+
+	_, err = s.Increment(key("a"), []string{"a_new_counter_field"}, 1, "")
+	assert.ErrorIs(err, ErrQuotaExceeded, "increments creating fields grow the item")
+	got, err := backend.Get(key("a"))
+	require.NoError(err)
+	assert.Equal(map[string]interface{}{"count": 11.0}, got.Data)
+
+	_, err = s.Increment(key("b"), []string{"count"}, 1, "")
+	assert.ErrorIs(err, store.ErrItemNotFound)
+	_, err = s.Increment(model.Key{Bucket: "unlimited", ID: "a"}, []string{"count"}, 1, "")
+	assert.ErrorIs(err, store.ErrItemNotFound, "unlimited buckets are incremented as is")
+	usage, err = s.Usage("bucket")
+	require.NoError(err)
+	assert.Equal(store.Usage{Items: 1, Bytes: 30}, usage.Usage, "failed increments release their reservation")
+}
+
+// ownerQueryStore records the owner queries it serves.
+type ownerQueryStore struct {
+	store.S
+	queries []string
+}
+
+func (s *ownerQueryStore) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, error) {
+	s.queries = append(s.queries, bucket+"/"+owner)
+	return store.FilterOwner(nil, owner), nil
+}
+
+func TestGetAllByOwner(t *testing.T) {
+	backend := &ownerQueryStore{S: inmem.NewSharded(inmem.Config{}, nil)}
+	s := New(backend, Config{Default: BucketLimits{Bucket: Limits{Items: 2}}})
+	_, err := store.GetAllByOwner(s, "bucket", "owner")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bucket/owner"}, backend.queries, "owner queries are pushed down to the backend")
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageRequestDecoder(t *testing.T) {
+	tcs := []struct {
+		Description     string
+		Bucket          string
+		Method          string
+		Body            string
+		ElevatedAccess  bool
+		ExpectedRequest interface{}
+		ExpectedErr     error
+	}{
+		{
+			Description:    "Invalid bucket",
+			Bucket:         "california?",
+			Method:         http.MethodGet,
+			ElevatedAccess: true,
+			ExpectedErr:    errInvalidBucket,
+		},
+		{
+			Description: "Not an admin",
+			Bucket:      "california",
+			Method:      http.MethodGet,
+			ExpectedErr: errQuotaAdminRequired,
+		},
+		{
+			Description:     "Report",
+			Bucket:          "california",
+			Method:          http.MethodGet,
+			ElevatedAccess:  true,
+			ExpectedRequest: &usageRequest{bucket: "california"},
+		},
+		{
+			Description:     "Adjust bucket",
+			Bucket:          "california",
+			Method:          http.MethodPut,
+			Body:            `{"items": 10, "bytes": 1000}`,
+			ElevatedAccess:  true,
+			ExpectedRequest: &usageRequest{bucket: "california", adjust: true, usage: Usage{Items: 10, Bytes: 1000}},
+		},
+		{
+			Description:     "Adjust owner",
+			Bucket:          "california",
+			Method:          http.MethodPut,
+			Body:            `{"owner": "SFGiantsTeam", "items": 1}`,
+			ElevatedAccess:  true,
+			ExpectedRequest: &usageRequest{bucket: "california", adjust: true, owner: "SFGiantsTeam", usage: Usage{Items: 1}},
+		},
+		{
+			Description:    "Negative usage",
+			Bucket:         "california",
+			Method:         http.MethodPut,
+			Body:           `{"items": -1}`,
+			ElevatedAccess: true,
+			ExpectedErr:    errInvalidUsage,
+		},
+		{
+			Description:    "Bad payload",
+			Bucket:         "california",
+			Method:         http.MethodPut,
+			Body:           `{`,
+			ElevatedAccess: true,
+			ExpectedErr:    errPayloadUnmarshalFailure,
+		},
+	}
+
+	decoder := usageRequestDecoder(getTestTransportConfig())
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			r := httptest.NewRequest(tc.Method, "http://localhost/test", bytes.NewBufferString(tc.Body))
+			r = mux.SetURLVars(r, map[string]string{bucketVarKey: tc.Bucket})
+			ctx := context.Background()
+			if tc.ElevatedAccess {
+				ctx = withElevatedAccess(ctx)
+			}
+
+			request, err := decoder(ctx, r)
+			assert.ErrorIs(err, tc.ExpectedErr)
+			if tc.ExpectedErr == nil {
+				assert.Equal(tc.ExpectedRequest, request)
+			}
+		})
+	}
+}
+
+func TestNewQuotaHandler(t *testing.T) {
+	assert.Nil(t, newQuotaHandler(quotaHandlerIn{Config: getTestTransportConfig()}))
+}
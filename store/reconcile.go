@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var errAdminRequired = &ForbiddenRequestErr{Message: "reconciliation requires elevated access", Code: "elevated_access_required"}
+
+// Reconciler is implemented by stores replicating their items across two backends.
+type Reconciler interface {
+	// Reconcile compares the items of a bucket on both backends. When repair
+	// is true, the secondary backend is updated to match the primary one.
+	Reconcile(bucket string, repair bool) (ReconcileReport, error)
+}
+
+// ReconcileReport lists the IDs of the items which differ between the backends.
+type ReconcileReport struct {
+	Bucket             string   `json:"bucket"`
+	PrimaryCount       int      `json:"primaryCount"`
+	SecondaryCount     int      `json:"secondaryCount"`
+	MissingInSecondary []string `json:"missingInSecondary"`
+	MissingInPrimary   []string `json:"missingInPrimary"`
+	Mismatched         []string `json:"mismatched"`
+	Repaired           bool     `json:"repaired"`
+}
+
+type reconcileRequest struct {
+	bucket string
+	repair bool
+}
+
+type reconcileHandlerIn struct {
+	fx.In
+	GetLogger  func(context.Context) *zap.Logger
+	Reconciler Reconciler `optional:"true"`
+	Config     *transportConfig
+}
+
+// newReconcileHandler returns nil when the store doesn't replicate its items.
+func newReconcileHandler(in reconcileHandlerIn) Handler {
+	if in.Reconciler == nil {
+		return nil
+	}
+	return kithttp.NewServer(
+		newReconcileEndpoint(in.Reconciler),
+		reconcileRequestDecoder(in.Config),
+		encodeReconcileResponse,
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
+	)
+}
+
+func newReconcileEndpoint(r Reconciler) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		reconcileRequest := request.(*reconcileRequest)
+		report, err := r.Reconcile(reconcileRequest.bucket, reconcileRequest.repair)
+		if err != nil {
+			return nil, err
+		}
+		return &report, nil
+	}
+}
+
+// reconcileRequestDecoder only reports on GET and repairs on POST.
+func reconcileRequestDecoder(config *transportConfig) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		bucket := mux.Vars(r)[bucketVarKey]
+		if !isBucketValid(config.BucketFormatRegex, bucket) {
+			return nil, errInvalidBucket
+		}
+		if !hasElevatedAccess(ctx, config.AccessLevelAttributeKey) {
+			return nil, errAdminRequired
+		}
+		return &reconcileRequest{
+			bucket: bucket,
+			repair: r.Method == http.MethodPost,
+		}, nil
+	}
+}
+
+func encodeReconcileResponse(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
+	data, err := json.Marshal(response.(*ReconcileReport))
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.Write(data)
+	return nil
+}
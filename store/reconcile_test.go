@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileRequestDecoder(t *testing.T) {
+	tcs := []struct {
+		Description     string
+		Bucket          string
+		Method          string
+		ElevatedAccess  bool
+		ExpectedRequest interface{}
+		ExpectedErr     error
+	}{
+		{
+			Description: "Invalid bucket",
+			Bucket:      "california?",
+			Method:      http.MethodGet,
+			ExpectedErr: errInvalidBucket,
+		},
+		{
+			Description: "Not an admin",
+			Bucket:      "california",
+			Method:      http.MethodGet,
+			ExpectedErr: errAdminRequired,
+		},
+		{
+			Description:     "Report",
+			Bucket:          "california",
+			Method:          http.MethodGet,
+			ElevatedAccess:  true,
+			ExpectedRequest: &reconcileRequest{bucket: "california"},
+		},
+		{
+			Description:     "Repair",
+			Bucket:          "california",
+			Method:          http.MethodPost,
+			ElevatedAccess:  true,
+			ExpectedRequest: &reconcileRequest{bucket: "california", repair: true},
+		},
+	}
+
+	decoder := reconcileRequestDecoder(getTestTransportConfig())
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			r := httptest.NewRequest(tc.Method, "http://localhost/test", nil)
+			r = mux.SetURLVars(r, map[string]string{bucketVarKey: tc.Bucket})
+			ctx := context.Background()
+			if tc.ElevatedAccess {
+				ctx = withElevatedAccess(ctx)
+			}
+
+			request, err := decoder(ctx, r)
+			assert.Equal(tc.ExpectedRequest, request)
+			assert.ErrorIs(err, tc.ExpectedErr)
+		})
+	}
+}
+
+func TestNewReconcileHandler(t *testing.T) {
+	assert.Nil(t, newReconcileHandler(reconcileHandlerIn{Config: getTestTransportConfig()}))
+}
@@ -0,0 +1,173 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cast"
+	"github.com/xmidt-org/argus/store/db/metric"
+	"github.com/xmidt-org/bascule"
+	"go.uber.org/fx"
+)
+
+// RedactedValue replaces the values of redacted fields.
+const RedactedValue = "[REDACTED]"
+
+var defaultRedactionCapabilityPath = []string{"capabilities"}
+
+// RedactionConfig lists the item data fields masked in API responses for
+// callers which don't own the items, such as admins listing a bucket.
+type RedactionConfig struct {
+	// Buckets maps bucket names to the dot separated paths of the data fields
+	// masked in their items, such as "secret" or "config.secret".
+	Buckets map[string][]string
+
+	// Capability lets the callers holding it see the redacted fields of all items.
+	// (Optional) only owners see them when not set.
+	Capability string
+
+	// CapabilityPath is the list of nested keys to get to the claim which
+	// contains the capabilities.
+	// (Optional) default: ["capabilities"]
+	CapabilityPath []string
+}
+
+type redactorIn struct {
+	fx.In
+	Config         RedactionConfig        `optional:"true"`
+	RedactedFields *prometheus.CounterVec `name:"redacted_fields_total" optional:"true"`
+}
+
+// redactor masks the configured fields of the items returned by the get, get
+// all and delete handlers.
+type redactor struct {
+	paths          map[string][][]string
+	capability     string
+	capabilityPath []string
+	redactedFields *prometheus.CounterVec
+}
+
+func newRedactor(in redactorIn) *redactor {
+	r := &redactor{
+		paths:          make(map[string][][]string, len(in.Config.Buckets)),
+		capability:     in.Config.Capability,
+		capabilityPath: in.Config.CapabilityPath,
+		redactedFields: in.RedactedFields,
+	}
+	if len(r.capabilityPath) == 0 {
+		r.capabilityPath = defaultRedactionCapabilityPath
+	}
+	for bucket, paths := range in.Config.Buckets {
+		for _, path := range paths {
+			if path != "" {
+				r.paths[bucket] = append(r.paths[bucket], strings.Split(path, "."))
+			}
+		}
+	}
+	return r
+}
+
+type redactionScopeKey struct{}
+
+// redactionScope holds what's needed to redact the items of a response.
+type redactionScope struct {
+	redactor   *redactor
+	bucket     string
+	owner      string
+	privileged bool
+}
+
+// captureScope is a kithttp.ServerBefore function saving the redaction scope
+// of requests against buckets with redaction rules, for the response encoders.
+func (r *redactor) captureScope(ctx context.Context, req *http.Request) context.Context {
+	return r.withScope(ctx, mux.Vars(req)[bucketVarKey], req.Header.Get(ItemOwnerHeaderKey))
+}
+
+// withScope saves the redaction scope of a request of owner against bucket
+// when the bucket has redaction rules.
+func (r *redactor) withScope(ctx context.Context, bucket, owner string) context.Context {
+	if r == nil || len(r.paths[bucket]) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, redactionScopeKey{}, &redactionScope{
+		redactor:   r,
+		bucket:     bucket,
+		owner:      owner,
+		privileged: r.hasCapability(ctx),
+	})
+}
+
+func (r *redactor) hasCapability(ctx context.Context) bool {
+	if r.capability == "" {
+		return false
+	}
+	basculeAuth, ok := bascule.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	capabilities, ok := bascule.GetNestedAttribute(basculeAuth.Token.Attributes(), r.capabilityPath...)
+	if !ok {
+		return false
+	}
+	for _, capability := range cast.ToStringSlice(capabilities) {
+		if capability == r.capability {
+			return true
+		}
+	}
+	return false
+}
+
+// redactItem returns the item with its redacted fields masked unless the
+// caller may see them. Data maps are copied along the masked paths so stored
+// items are left untouched.
+func redactItem(ctx context.Context, item OwnableItem) OwnableItem {
+	scope, ok := ctx.Value(redactionScopeKey{}).(*redactionScope)
+	if !ok || scope.privileged || item.Owner == scope.owner {
+		return item
+	}
+	var redacted int
+	for _, path := range scope.redactor.paths[scope.bucket] {
+		var masked bool
+		item.Data, masked = maskField(item.Data, path)
+		if masked {
+			redacted++
+		}
+	}
+	if redacted > 0 && scope.redactor.redactedFields != nil {
+		scope.redactor.redactedFields.With(prometheus.Labels{metric.BucketLabelKey: scope.bucket}).Add(float64(redacted))
+	}
+	return item
+}
+
+// maskField returns a copy of data with the field at path masked, or data
+// itself when there is no such field.
+func maskField(data map[string]interface{}, path []string) (map[string]interface{}, bool) {
+	value, ok := data[path[0]]
+	if !ok {
+		return data, false
+	}
+	if len(path) > 1 {
+		child, ok := value.(map[string]interface{})
+		if !ok {
+			return data, false
+		}
+		if value, ok = maskField(child, path[1:]); !ok {
+			return data, false
+		}
+	} else {
+		value = RedactedValue
+	}
+
+	c := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		c[k] = v
+	}
+	c[path[0]] = value
+	return c, true
+}
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store/db/metric"
+	"github.com/xmidt-org/bascule"
+)
+
+func newTestRedactor() *redactor {
+	return newRedactor(redactorIn{
+		Config: RedactionConfig{
+			Buckets: map[string][]string{
+				"webhooks": {"secret", "config.secret", "config.missing"},
+			},
+			Capability: "xmidt:argus:secrets",
+		},
+		RedactedFields: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "redacted"}, []string{metric.BucketLabelKey}),
+	})
+}
+
+func withCapabilities(ctx context.Context, capabilities ...string) context.Context {
+	attributes := bascule.NewAttributes(map[string]interface{}{
+		"capabilities": capabilities,
+	})
+	return bascule.WithAuthentication(ctx, bascule.Authentication{
+		Authorization: bascule.Authorization("Bearer"),
+		Token:         bascule.NewToken("Bearer", "testUser", attributes),
+	})
+}
+
+func TestRedactItem(t *testing.T) {
+	newItem := func() OwnableItem {
+		return OwnableItem{
+			Owner: "owner",
+			Item: model.Item{ID: "id", Data: map[string]interface{}{
+				"url":    "http://example.com",
+				"secret": "s3cr3t",
+				"config": map[string]interface{}{"secret": "s3cr3t", "retries": 3},
+			}},
+		}
+	}
+	redacted := map[string]interface{}{
+		"url":    "http://example.com",
+		"secret": RedactedValue,
+		"config": map[string]interface{}{"secret": RedactedValue, "retries": 3},
+	}
+
+	tcs := []struct {
+		Description      string
+		Bucket           string
+		Owner            string
+		Capabilities     []string
+		ExpectedData     map[string]interface{}
+		ExpectedRedacted float64
+	}{
+		{
+			Description:  "Owner",
+			Bucket:       "webhooks",
+			Owner:        "owner",
+			ExpectedData: newItem().Data,
+		},
+		{
+			Description:      "Admin without capability",
+			Bucket:           "webhooks",
+			Capabilities:     []string{"xmidt:svc:admin"},
+			ExpectedData:     redacted,
+			ExpectedRedacted: 2,
+		},
+		{
+			Description:  "Capability",
+			Bucket:       "webhooks",
+			Capabilities: []string{"xmidt:svc:admin", "xmidt:argus:secrets"},
+			ExpectedData: newItem().Data,
+		},
+		{
+			Description:  "Bucket without rules",
+			Bucket:       "devices",
+			ExpectedData: newItem().Data,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			r := newTestRedactor()
+			req := httptest.NewRequest(http.MethodGet, "http://localhost/test", nil)
+			req = mux.SetURLVars(req, map[string]string{bucketVarKey: tc.Bucket})
+			req.Header.Set(ItemOwnerHeaderKey, tc.Owner)
+			ctx := context.Background()
+			if tc.Capabilities != nil {
+				ctx = withCapabilities(ctx, tc.Capabilities...)
+			}
+
+			item := newItem()
+			result := redactItem(r.captureScope(ctx, req), item)
+			assert.Equal(tc.ExpectedData, result.Data)
+			assert.Equal(newItem(), item, "the original item is left untouched")
+			assert.Equal(tc.ExpectedRedacted, testutil.ToFloat64(r.redactedFields.With(prometheus.Labels{metric.BucketLabelKey: tc.Bucket})))
+		})
+	}
+}
+
+func TestEncodeRedactedItems(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/test", nil)
+	req = mux.SetURLVars(req, map[string]string{bucketVarKey: "webhooks"})
+	req.Header.Set(ItemOwnerHeaderKey, "owner")
+	ctx := newTestRedactor().captureScope(withElevatedAccess(context.Background()), req)
+	items := map[string]OwnableItem{
+		"a": {Owner: "owner", Item: model.Item{ID: "a", Data: map[string]interface{}{"secret": "mine"}}},
+		"b": {Owner: "other", Item: model.Item{ID: "b", Data: map[string]interface{}{"secret": "theirs"}}},
+	}
+
+	recorder := httptest.NewRecorder()
+	require.NoError(encodeGetAllItemsResponse(ctx, recorder, &getAllItemsResponse{items: items}))
+	assert.JSONEq(`[{"id":"a","data":{"secret":"mine"}},{"id":"b","data":{"secret":"[REDACTED]"}}]`, recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	item := items["b"]
+	require.NoError(encodeGetOrDeleteItemResponse(ctx, recorder, &item))
+	assert.JSONEq(`{"id":"b","data":{"secret":"[REDACTED]"}}`, recorder.Body.String())
+}
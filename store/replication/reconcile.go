@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/argus/store/db/metric"
+)
+
+// Reconcile compares the items of the bucket on both backends. Items are considered
+// the same when their owner and data match, their TTLs naturally drifting apart.
+// When repair is true, missing and mismatched items are pushed to the secondary
+// backend and the items it holds on its own are deleted.
+func (s *Store) Reconcile(bucket string, repair bool) (store.ReconcileReport, error) {
+	report := store.ReconcileReport{
+		Bucket:             bucket,
+		MissingInSecondary: []string{},
+		MissingInPrimary:   []string{},
+		Mismatched:         []string{},
+	}
+	primaryItems, err := s.primary.GetAll(bucket)
+	if err != nil {
+		return report, fmt.Errorf("failed to read primary backend: %w", err)
+	}
+	secondaryItems, err := s.secondary.GetAll(bucket)
+	if err != nil {
+		return report, fmt.Errorf("failed to read secondary backend: %w", err)
+	}
+	report.PrimaryCount = len(primaryItems)
+	report.SecondaryCount = len(secondaryItems)
+
+	for id, primaryItem := range primaryItems {
+		secondaryItem, ok := secondaryItems[id]
+		switch {
+		case !ok:
+			report.MissingInSecondary = append(report.MissingInSecondary, id)
+		case primaryItem.Owner != secondaryItem.Owner || !reflect.DeepEqual(primaryItem.Data, secondaryItem.Data):
+			report.Mismatched = append(report.Mismatched, id)
+		}
+	}
+	for id := range secondaryItems {
+		if _, ok := primaryItems[id]; !ok {
+			report.MissingInPrimary = append(report.MissingInPrimary, id)
+		}
+	}
+	sort.Strings(report.MissingInSecondary)
+	sort.Strings(report.MissingInPrimary)
+	sort.Strings(report.Mismatched)
+
+	s.countDivergences(metric.MissingInSecondaryDivergence, len(report.MissingInSecondary))
+	s.countDivergences(metric.MissingInPrimaryDivergence, len(report.MissingInPrimary))
+	s.countDivergences(metric.MismatchDivergence, len(report.Mismatched))
+
+	if !repair {
+		return report, nil
+	}
+
+	var errs []error
+	for _, ids := range [][]string{report.MissingInSecondary, report.Mismatched} {
+		for _, id := range ids {
+			key := model.Key{Bucket: bucket, ID: id}
+			if err := s.apply(writeOp{queryType: metric.PushQueryType, key: key, item: primaryItems[id]}); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	for _, id := range report.MissingInPrimary {
+		key := model.Key{Bucket: bucket, ID: id}
+		if err := s.apply(writeOp{queryType: metric.DeleteQueryType, key: key}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return report, fmt.Errorf("failed to repair %d items: %w", len(errs), errors.Join(errs...))
+	}
+	report.Repaired = true
+	return report, nil
+}
+
+func (s *Store) countDivergences(reason string, count int) {
+	if count > 0 {
+		s.measures.ReplicationDivergences.With(prometheus.Labels{
+			metric.DivergenceReasonLabelKey: reason,
+		}).Add(float64(count))
+	}
+}
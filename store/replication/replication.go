@@ -0,0 +1,410 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package replication provides a store.S writing to two backends, typically
+// while migrating from one to the other.
+package replication
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/argus/store/db/metric"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultQueueSize     = 1000
+	defaultWorkers       = 1
+	defaultMaxAttempts   = 5
+	defaultRetryInterval = time.Second
+)
+
+// Config configures the replication between a primary and a secondary backend.
+type Config struct {
+	// Primary is the backend serving reads and whose writes must succeed:
+	// one of dynamo, yugabyte or inmem.
+	Primary string
+
+	// Secondary is the backend receiving a copy of the writes.
+	Secondary string
+
+	// Async makes writes return as soon as the primary is updated, the secondary
+	// being updated in the background. Otherwise the secondary is written inline
+	// and only failed writes are queued for retries. Either way, a failure of the
+	// secondary is never returned to clients.
+	// (Optional) defaults to false.
+	Async bool
+
+	// ReadFallback serves reads from the secondary when the primary fails.
+	// Items not found on the primary aren't looked up on the secondary.
+	// (Optional) defaults to false.
+	ReadFallback bool
+
+	// Queue configures the retries of the secondary writes.
+	Queue QueueConfig
+}
+
+// QueueConfig configures the queue of the secondary writes.
+type QueueConfig struct {
+	// Size is the number of writes the queue holds. Writes beyond it are dropped.
+	// (Optional) defaults to 1000.
+	Size int
+
+	// Workers is the number of writes applied concurrently. A single worker keeps
+	// the writes of a key in order. Retried writes replicate the item held by
+	// the primary when they're retried, so they can't bring back an older one.
+	// (Optional) defaults to 1.
+	Workers int
+
+	// MaxAttempts is the number of times a write is tried before it's dropped.
+	// (Optional) defaults to 5.
+	MaxAttempts int
+
+	// RetryInterval is the time waited before retrying a failed write.
+	// (Optional) defaults to 1s.
+	RetryInterval time.Duration
+}
+
+type writeOp struct {
+	queryType string
+	key       model.Key
+	item      store.OwnableItem
+	attempts  int
+	notBefore time.Time
+
+	// retry is set once the write failed, its item being possibly stale.
+	retry bool
+}
+
+// Store writes to both backends and reads from the primary one.
+type Store struct {
+	primary   store.S
+	secondary store.S
+	config    Config
+	measures  metric.Measures
+	logger    *zap.Logger
+	now       func() time.Time
+
+	queue chan writeOp
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New builds the replicating store. Queued writes are only applied once Start is called.
+func New(primary, secondary store.S, config Config, measures metric.Measures, logger *zap.Logger) *Store {
+	validateConfig(&config)
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Store{
+		primary:   primary,
+		secondary: secondary,
+		config:    config,
+		measures:  measures,
+		logger:    logger,
+		now:       time.Now,
+		queue:     make(chan writeOp, config.Queue.Size),
+		stop:      make(chan struct{}),
+	}
+}
+
+func validateConfig(config *Config) {
+	q := &config.Queue
+	if q.Size <= 0 {
+		q.Size = defaultQueueSize
+	}
+	if q.Workers <= 0 {
+		q.Workers = defaultWorkers
+	}
+	if q.MaxAttempts <= 0 {
+		q.MaxAttempts = defaultMaxAttempts
+	}
+	if q.RetryInterval <= 0 {
+		q.RetryInterval = defaultRetryInterval
+	}
+}
+
+// Start starts the workers applying the queued secondary writes.
+func (s *Store) Start() {
+	for i := 0; i < s.config.Queue.Workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+}
+
+// Stop stops the workers. Writes still queued are tried once more without delay.
+func (s *Store) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+	for {
+		select {
+		case op := <-s.queue:
+			s.measures.ReplicationQueueSize.Dec()
+			if err := s.apply(op); err != nil {
+				s.drop(op, err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (s *Store) Push(key model.Key, item store.OwnableItem) error {
+	if err := s.primary.Push(key, item); err != nil {
+		return err
+	}
+	s.replicate(writeOp{queryType: metric.PushQueryType, key: key, item: item})
+	return nil
+}
+
+// PushIfAbsent creates the item on the primary, which decides whether the key
+// is taken, and replicates it as a regular push.
+func (s *Store) PushIfAbsent(key model.Key, item store.OwnableItem) error {
+	if err := store.PushIfAbsent(s.primary, key, item); err != nil {
+		return err
+	}
+	s.replicate(writeOp{queryType: metric.PushQueryType, key: key, item: item})
+	return nil
+}
+
+// CompareAndSwap swaps the item on the primary, which holds the reference
+// copy, and replicates the new item as a regular push.
+func (s *Store) CompareAndSwap(key model.Key, old, item store.OwnableItem) error {
+	if err := store.CompareAndSwap(s.primary, key, old, item); err != nil {
+		return err
+	}
+	s.replicate(writeOp{queryType: metric.PushQueryType, key: key, item: item})
+	return nil
+}
+
+// Increment updates the item on the primary then replicates the whole updated
+// item as a regular push, so retried replications can't apply the delta twice.
+func (s *Store) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	value, err := store.Increment(s.primary, key, path, delta, modifiedBy)
+	if err != nil {
+		return value, err
+	}
+	item, err := s.primary.Get(key)
+	if err != nil {
+		s.logger.Warn("failed to read incremented item for replication", zap.String("bucket", key.Bucket), zap.String("id", key.ID), zap.Error(err))
+		return value, nil
+	}
+	s.replicate(writeOp{queryType: metric.PushQueryType, key: key, item: item})
+	return value, nil
+}
+
+// Transact applies the transaction on the primary then replicates each of its
+// operations as a regular push or delete, so the secondary may briefly expose
+// a partially applied transaction.
+func (s *Store) Transact(ops []store.TransactionOp) error {
+	if err := store.Transact(s.primary, ops); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if op.Delete {
+			s.replicate(writeOp{queryType: metric.DeleteQueryType, key: op.Key})
+		} else {
+			s.replicate(writeOp{queryType: metric.PushQueryType, key: op.Key, item: op.Item})
+		}
+	}
+	return nil
+}
+
+func (s *Store) Delete(key model.Key) (store.OwnableItem, error) {
+	item, err := s.primary.Delete(key)
+	if err != nil {
+		return item, err
+	}
+	s.replicate(writeOp{queryType: metric.DeleteQueryType, key: key})
+	return item, nil
+}
+
+func (s *Store) Get(key model.Key) (store.OwnableItem, error) {
+	item, err := s.primary.Get(key)
+	if err != nil && s.shouldFallback(err) {
+		s.measures.ReplicationReadFallbacks.With(prometheus.Labels{metric.QueryTypeLabelKey: metric.GetQueryType}).Inc()
+		return s.secondary.Get(key)
+	}
+	return item, err
+}
+
+func (s *Store) GetAll(bucket string) (map[string]store.OwnableItem, error) {
+	items, err := s.primary.GetAll(bucket)
+	if err != nil && s.shouldFallback(err) {
+		s.measures.ReplicationReadFallbacks.With(prometheus.Labels{metric.QueryTypeLabelKey: metric.GetAllQueryType}).Inc()
+		return s.secondary.GetAll(bucket)
+	}
+	return items, err
+}
+
+func (s *Store) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, error) {
+	items, err := store.GetAllByOwner(s.primary, bucket, owner)
+	if err != nil && s.shouldFallback(err) {
+		s.measures.ReplicationReadFallbacks.With(prometheus.Labels{metric.QueryTypeLabelKey: metric.GetAllByOwnerQueryType}).Inc()
+		return store.GetAllByOwner(s.secondary, bucket, owner)
+	}
+	return items, err
+}
+
+// BucketDigest returns the digest kept by the primary backend, which serves
+// the reads.
+func (s *Store) BucketDigest(bucket string) (store.Digest, error) {
+	return store.BucketDigest(s.primary, bucket, "", true)
+}
+
+// OwnerDigest returns the digest kept by the primary backend.
+func (s *Store) OwnerDigest(bucket, owner string) (store.Digest, error) {
+	return store.BucketDigest(s.primary, bucket, owner, false)
+}
+
+// MaxItemDataBytes returns the smallest size limit of the two backends as
+// items are written to both.
+func (s *Store) MaxItemDataBytes() int64 {
+	primary, secondary := store.MaxItemDataBytes(s.primary), store.MaxItemDataBytes(s.secondary)
+	if primary == 0 || (secondary > 0 && secondary < primary) {
+		return secondary
+	}
+	return primary
+}
+
+// Ping only reports on the primary backend as the secondary one isn't required to serve requests.
+func (s *Store) Ping(ctx context.Context) error {
+	if p, ok := s.primary.(store.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// shouldFallback is true for failures of the primary backend itself,
+// as opposed to missing items or rejected requests.
+func (s *Store) shouldFallback(err error) bool {
+	if !s.config.ReadFallback || errors.Is(err, store.ErrItemNotFound) {
+		return false
+	}
+	var coder kithttp.StatusCoder
+	if errors.As(err, &coder) {
+		return coder.StatusCode() >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// replicate writes to the secondary inline or through the queue.
+func (s *Store) replicate(op writeOp) {
+	if s.config.Async {
+		s.enqueue(op)
+		return
+	}
+	if err := s.apply(op); err != nil {
+		op.attempts = 1
+		op.notBefore = s.now().Add(s.config.Queue.RetryInterval)
+		op.retry = true
+		s.enqueue(op)
+	}
+}
+
+func (s *Store) enqueue(op writeOp) {
+	select {
+	case s.queue <- op:
+		s.measures.ReplicationQueueSize.Inc()
+	default:
+		s.drop(op, errors.New("replication queue is full"))
+	}
+}
+
+func (s *Store) apply(op writeOp) error {
+	var err error
+	if op.retry {
+		op, err = s.current(op)
+	}
+	switch {
+	case err != nil:
+	case op.queryType == metric.PushQueryType:
+		err = s.secondary.Push(op.key, op.item)
+	case op.queryType == metric.DeleteQueryType:
+		_, err = s.secondary.Delete(op.key)
+		if errors.Is(err, store.ErrItemNotFound) {
+			err = nil
+		}
+	}
+
+	outcome := metric.SuccessQueryOutcome
+	if err != nil {
+		outcome = metric.FailQueryOutcome
+	}
+	s.measures.ReplicationWrites.With(prometheus.Labels{
+		metric.QueryOutcomeLabelKey: outcome,
+		metric.QueryTypeLabelKey:    op.queryType,
+	}).Inc()
+	return err
+}
+
+func (s *Store) work() {
+	defer s.wg.Done()
+	for {
+		var op writeOp
+		select {
+		case <-s.stop:
+			return
+		case op = <-s.queue:
+			s.measures.ReplicationQueueSize.Dec()
+		}
+
+		if wait := op.notBefore.Sub(s.now()); wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-s.stop:
+				t.Stop()
+				s.enqueue(op)
+				return
+			case <-t.C:
+			}
+		}
+
+		op.attempts++
+		if err := s.apply(op); err != nil {
+			if op.attempts >= s.config.Queue.MaxAttempts {
+				s.drop(op, err)
+				continue
+			}
+			op.notBefore = s.now().Add(s.config.Queue.RetryInterval)
+			op.retry = true
+			s.enqueue(op)
+		}
+	}
+}
+
+// current returns the write replicating the item the primary holds at the key
+// of op, as writes made since op was first tried may have reached the
+// secondary already.
+func (s *Store) current(op writeOp) (writeOp, error) {
+	item, err := s.primary.Get(op.key)
+	switch {
+	case errors.Is(err, store.ErrItemNotFound):
+		op.queryType = metric.DeleteQueryType
+		op.item = store.OwnableItem{}
+	case err != nil:
+		return op, err
+	default:
+		op.queryType = metric.PushQueryType
+		op.item = item
+	}
+	return op, nil
+}
+
+// drop gives up on a secondary write, leaving the backends diverged
+// until the bucket is reconciled.
+func (s *Store) drop(op writeOp, err error) {
+	s.measures.ReplicationDivergences.With(prometheus.Labels{
+		metric.DivergenceReasonLabelKey: metric.DroppedWriteDivergence,
+	}).Inc()
+	s.logger.Error("dropping secondary write", zap.String("type", op.queryType),
+		zap.String("bucket", op.key.Bucket), zap.String("id", op.key.ID), zap.Error(err))
+}
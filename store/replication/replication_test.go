@@ -0,0 +1,429 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package replication
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/argus/store/db/metric"
+	"github.com/xmidt-org/argus/store/inmem"
+	"github.com/xmidt-org/argus/store/test"
+)
+
+var (
+	testKey  = model.Key{Bucket: "world", ID: "earth"}
+	testItem = store.OwnableItem{Owner: "Louis Armstrong", Item: model.Item{ID: "earth", Data: map[string]interface{}{"k": "v"}}}
+
+	errBackend = store.SanitizeError(errors.New("unavailable"))
+)
+
+func newTestMeasures() metric.Measures {
+	return metric.Measures{
+		ReplicationQueueSize: prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue"}),
+		ReplicationWrites: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "writes"},
+			[]string{metric.QueryOutcomeLabelKey, metric.QueryTypeLabelKey}),
+		ReplicationReadFallbacks: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "fallbacks"},
+			[]string{metric.QueryTypeLabelKey}),
+		ReplicationDivergences: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "divergences"},
+			[]string{metric.DivergenceReasonLabelKey}),
+	}
+}
+
+func divergences(m metric.Measures, reason string) float64 {
+	return testutil.ToFloat64(m.ReplicationDivergences.With(prometheus.Labels{metric.DivergenceReasonLabelKey: reason}))
+}
+
+// withData matches the items with the owner and data of item, as retried
+// writes replicate the item read back from the primary.
+func withData(item store.OwnableItem) interface{} {
+	return mock.MatchedBy(func(got store.OwnableItem) bool {
+		return got.Owner == item.Owner && reflect.DeepEqual(got.Data, item.Data)
+	})
+}
+
+func TestSyncWrites(t *testing.T) {
+	tcs := []struct {
+		Description       string
+		PrimaryErr        error
+		SecondaryErr      error
+		ExpectedErr       error
+		ExpectedQueueSize float64
+	}{
+		{
+			Description: "Both succeed",
+		},
+		{
+			Description:       "Secondary fails",
+			SecondaryErr:      errBackend,
+			ExpectedQueueSize: 1,
+		},
+		{
+			Description: "Primary fails",
+			PrimaryErr:  errBackend,
+			ExpectedErr: errBackend,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			primary, secondary := new(test.MockDB), new(test.MockDB)
+			primary.On("Push", testKey, testItem).Return(tc.PrimaryErr)
+			if tc.PrimaryErr == nil {
+				secondary.On("Push", testKey, testItem).Return(tc.SecondaryErr)
+			}
+			m := newTestMeasures()
+			s := New(primary, secondary, Config{}, m, nil)
+
+			assert.Equal(tc.ExpectedErr, s.Push(testKey, testItem))
+			assert.Equal(tc.ExpectedQueueSize, testutil.ToFloat64(m.ReplicationQueueSize))
+			assert.Len(s.queue, int(tc.ExpectedQueueSize))
+			primary.AssertExpectations(t)
+			secondary.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAsyncWrites(t *testing.T) {
+	assert := assert.New(t)
+	primary, secondary := inmem.NewSharded(inmem.Config{}, nil), new(test.MockDB)
+	done := make(chan struct{})
+	secondary.On("Push", testKey, testItem).Return(errBackend).Once()
+	secondary.On("Push", testKey, withData(testItem)).Return(nil).Once().Run(func(mock.Arguments) { close(done) })
+
+	m := newTestMeasures()
+	s := New(primary, secondary, Config{Async: true, Queue: QueueConfig{RetryInterval: time.Millisecond}}, m, nil)
+	s.Start()
+	assert.NoError(s.Push(testKey, testItem))
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("secondary write wasn't retried")
+	}
+	s.Stop()
+	secondary.AssertExpectations(t)
+	assert.Zero(divergences(m, metric.DroppedWriteDivergence))
+	assert.Equal(float64(1), testutil.ToFloat64(m.ReplicationWrites.With(prometheus.Labels{
+		metric.QueryOutcomeLabelKey: metric.FailQueryOutcome,
+		metric.QueryTypeLabelKey:    metric.PushQueryType,
+	})))
+}
+
+func TestRetriedWritesReplicateCurrentItem(t *testing.T) {
+	v1, v2 := testItem, testItem
+	v1.Data = map[string]interface{}{"v": "1"}
+	v2.Data = map[string]interface{}{"v": "2"}
+
+	tcs := []struct {
+		Description  string
+		Delete       bool
+		ExpectedItem *store.OwnableItem
+	}{
+		{
+			Description:  "Overwritten since",
+			ExpectedItem: &v2,
+		},
+		{
+			Description: "Deleted since",
+			Delete:      true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+			secondary := inmem.NewSharded(inmem.Config{}, nil)
+			flaky := new(test.MockDB)
+			flaky.On("Push", testKey, withData(v1)).Return(errBackend).Once()
+			flaky.On("Push", testKey, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+				require.NoError(secondary.Push(testKey, args.Get(1).(store.OwnableItem)))
+			})
+			flaky.On("Delete", testKey).Return(store.OwnableItem{}, nil).Run(func(mock.Arguments) {
+				secondary.Delete(testKey)
+			})
+
+			m := newTestMeasures()
+			s := New(inmem.NewSharded(inmem.Config{}, nil), flaky, Config{Queue: QueueConfig{RetryInterval: time.Millisecond}}, m, nil)
+			require.NoError(s.Push(testKey, v1))
+			if tc.Delete {
+				_, err := s.Delete(testKey)
+				require.NoError(err)
+			} else {
+				require.NoError(s.Push(testKey, v2))
+			}
+
+			// the queued v1 write is retried after the later write reached the secondary.
+			s.Start()
+			assert.Eventually(func() bool {
+				return testutil.ToFloat64(m.ReplicationQueueSize) == 0
+			}, 5*time.Second, time.Millisecond)
+			s.Stop()
+
+			got, err := secondary.Get(testKey)
+			if tc.ExpectedItem == nil {
+				assert.ErrorIs(err, store.ErrItemNotFound)
+			} else {
+				require.NoError(err)
+				assert.Equal(tc.ExpectedItem.Data, got.Data)
+			}
+			assert.Zero(divergences(m, metric.DroppedWriteDivergence))
+		})
+	}
+}
+
+func TestDroppedWrites(t *testing.T) {
+	t.Run("Attempts exhausted", func(t *testing.T) {
+		assert := assert.New(t)
+		primary, secondary := inmem.NewSharded(inmem.Config{}, nil), new(test.MockDB)
+		secondary.On("Delete", testKey).Return(store.OwnableItem{}, errBackend)
+		require.NoError(t, primary.Push(testKey, testItem))
+
+		m := newTestMeasures()
+		s := New(primary, secondary, Config{Queue: QueueConfig{MaxAttempts: 2, RetryInterval: time.Millisecond}}, m, nil)
+		s.Start()
+		_, err := s.Delete(testKey)
+		assert.NoError(err)
+
+		assert.Eventually(func() bool {
+			return divergences(m, metric.DroppedWriteDivergence) == 1
+		}, 5*time.Second, time.Millisecond)
+		s.Stop()
+		secondary.AssertNumberOfCalls(t, "Delete", 2)
+	})
+
+	t.Run("Queue full", func(t *testing.T) {
+		assert := assert.New(t)
+		m := newTestMeasures()
+		s := New(inmem.NewSharded(inmem.Config{}, nil), new(test.MockDB), Config{Async: true, Queue: QueueConfig{Size: 1}}, m, nil)
+		assert.NoError(s.Push(testKey, testItem))
+		assert.NoError(s.Push(testKey, testItem))
+		assert.Equal(float64(1), divergences(m, metric.DroppedWriteDivergence))
+	})
+}
+
+func TestStopDrainsQueue(t *testing.T) {
+	secondary := new(test.MockDB)
+	secondary.On("Push", testKey, testItem).Return(nil)
+	m := newTestMeasures()
+	s := New(inmem.NewSharded(inmem.Config{}, nil), secondary, Config{Async: true}, m, nil)
+	require.NoError(t, s.Push(testKey, testItem))
+	s.Start()
+	s.Stop()
+	assert.Zero(t, testutil.ToFloat64(m.ReplicationQueueSize))
+	secondary.AssertNumberOfCalls(t, "Push", 1)
+}
+
+func TestReadFallback(t *testing.T) {
+	tcs := []struct {
+		Description      string
+		ReadFallback     bool
+		PrimaryErr       error
+		ExpectedFallback bool
+	}{
+		{
+			Description:      "Primary failure",
+			ReadFallback:     true,
+			PrimaryErr:       errBackend,
+			ExpectedFallback: true,
+		},
+		{
+			Description: "Fallback disabled",
+			PrimaryErr:  errBackend,
+		},
+		{
+			Description:  "Item not found",
+			ReadFallback: true,
+			PrimaryErr:   store.ErrItemNotFound,
+		},
+		{
+			Description:  "Primary success",
+			ReadFallback: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			primary, secondary := new(test.MockDB), new(test.MockDB)
+			primary.On("Get", testKey).Return(testItem, tc.PrimaryErr)
+			primary.On("GetAllByOwner", testKey.Bucket, testItem.Owner).Return(map[string]store.OwnableItem{}, tc.PrimaryErr)
+			if tc.ExpectedFallback {
+				secondary.On("Get", testKey).Return(testItem, nil)
+				secondary.On("GetAllByOwner", testKey.Bucket, testItem.Owner).Return(map[string]store.OwnableItem{}, nil)
+			}
+			m := newTestMeasures()
+			s := New(primary, secondary, Config{ReadFallback: tc.ReadFallback}, m, nil)
+
+			_, err := s.Get(testKey)
+			_, ownerErr := s.GetAllByOwner(testKey.Bucket, testItem.Owner)
+			if tc.ExpectedFallback {
+				assert.NoError(err)
+				assert.NoError(ownerErr)
+				assert.Equal(2, testutil.CollectAndCount(m.ReplicationReadFallbacks))
+			} else {
+				assert.Equal(tc.PrimaryErr, err)
+				assert.Equal(tc.PrimaryErr, ownerErr)
+				assert.Zero(testutil.CollectAndCount(m.ReplicationReadFallbacks))
+			}
+			primary.AssertExpectations(t)
+			secondary.AssertExpectations(t)
+		})
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	primary, secondary := inmem.NewSharded(inmem.Config{}, nil), inmem.NewSharded(inmem.Config{}, nil)
+	item := func(id, owner string) store.OwnableItem {
+		return store.OwnableItem{Owner: owner, Item: model.Item{ID: id, Data: map[string]interface{}{"id": id}}}
+	}
+	push := func(s store.S, i store.OwnableItem) {
+		require.NoError(s.Push(model.Key{Bucket: testKey.Bucket, ID: i.ID}, i))
+	}
+	push(primary, item("same", "a"))
+	push(secondary, item("same", "a"))
+	push(primary, item("changed", "a"))
+	push(secondary, item("changed", "b"))
+	push(primary, item("new", "a"))
+	push(secondary, item("stale", "a"))
+
+	m := newTestMeasures()
+	s := New(primary, secondary, Config{}, m, nil)
+
+	report, err := s.Reconcile(testKey.Bucket, false)
+	require.NoError(err)
+	assert.Equal(store.ReconcileReport{
+		Bucket:             testKey.Bucket,
+		PrimaryCount:       3,
+		SecondaryCount:     3,
+		MissingInSecondary: []string{"new"},
+		MissingInPrimary:   []string{"stale"},
+		Mismatched:         []string{"changed"},
+	}, report)
+	assert.Equal(float64(1), divergences(m, metric.MismatchDivergence))
+
+	report, err = s.Reconcile(testKey.Bucket, true)
+	require.NoError(err)
+	assert.True(report.Repaired)
+
+	report, err = s.Reconcile(testKey.Bucket, false)
+	require.NoError(err)
+	assert.Empty(report.MissingInSecondary)
+	assert.Empty(report.MissingInPrimary)
+	assert.Empty(report.Mismatched)
+}
+
+func TestReconcileFailure(t *testing.T) {
+	primary := new(test.MockDB)
+	primary.On("GetAll", testKey.Bucket).Return(map[string]store.OwnableItem{}, errBackend)
+	s := New(primary, inmem.NewSharded(inmem.Config{}, nil), Config{}, newTestMeasures(), nil)
+	_, err := s.Reconcile(testKey.Bucket, false)
+	assert.ErrorIs(t, err, errBackend)
+}
+
+func TestPushIfAbsent(t *testing.T) {
+	assert := assert.New(t)
+	primary, secondary := inmem.NewSharded(inmem.Config{}, nil), new(test.MockDB)
+	secondary.On("Push", testKey, testItem).Return(nil).Once()
+	s := New(primary, secondary, Config{}, newTestMeasures(), nil)
+
+	assert.NoError(s.PushIfAbsent(testKey, testItem))
+	assert.ErrorIs(s.PushIfAbsent(testKey, testItem), store.ErrItemExists)
+	secondary.AssertExpectations(t)
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	assert := assert.New(t)
+	primary, secondary := inmem.NewSharded(inmem.Config{}, nil), new(test.MockDB)
+	swapped := store.OwnableItem{Owner: testItem.Owner, Item: model.Item{ID: testKey.ID, Data: map[string]interface{}{"swapped": true}}}
+	secondary.On("Push", testKey, swapped).Return(nil).Once()
+	s := New(primary, secondary, Config{}, newTestMeasures(), nil)
+	assert.NoError(primary.Push(testKey, testItem))
+
+	assert.NoError(s.CompareAndSwap(testKey, testItem, swapped))
+	assert.ErrorIs(s.CompareAndSwap(testKey, testItem, swapped), store.ErrItemChanged)
+	secondary.AssertExpectations(t)
+}
+
+func TestIncrement(t *testing.T) {
+	assert := assert.New(t)
+	primary, secondary := inmem.NewSharded(inmem.Config{}, nil), new(test.MockDB)
+	counter := store.OwnableItem{Owner: testItem.Owner, Item: model.Item{ID: testKey.ID, Data: map[string]interface{}{"count": float64(1)}}}
+	incremented := store.OwnableItem{Owner: testItem.Owner, Item: model.Item{ID: testKey.ID, Data: map[string]interface{}{"count": float64(3)}}, Version: 1}
+	// The item is read back from the primary backend, its metadata included.
+	secondary.On("Push", testKey, mock.MatchedBy(func(item store.OwnableItem) bool {
+		item.LastModified = time.Time{}
+		item.CreatedAt = time.Time{}
+		return reflect.DeepEqual(incremented, item)
+	})).Return(nil).Once()
+	s := New(primary, secondary, Config{}, newTestMeasures(), nil)
+	assert.NoError(primary.Push(testKey, counter))
+
+	value, err := s.Increment(testKey, []string{"count"}, 2, "")
+	assert.NoError(err)
+	assert.Equal(float64(3), value)
+	secondary.AssertExpectations(t)
+}
+
+func TestTransact(t *testing.T) {
+	assert := assert.New(t)
+	primary, secondary := inmem.NewSharded(inmem.Config{}, nil), new(test.MockDB)
+	removed := model.Key{Bucket: "secrets", ID: "removed"}
+	secondary.On("Push", testKey, testItem).Return(nil).Once()
+	secondary.On("Delete", removed).Return(store.OwnableItem{}, nil).Once()
+	s := New(primary, secondary, Config{}, newTestMeasures(), nil)
+	assert.NoError(primary.Push(removed, testItem))
+
+	ops := []store.TransactionOp{
+		{Key: testKey, Item: testItem, Condition: store.IfAbsent},
+		{Key: removed, Delete: true},
+	}
+	assert.NoError(s.Transact(ops))
+	assert.ErrorIs(s.Transact(ops), store.ErrItemExists)
+	secondary.AssertExpectations(t)
+}
+
+type sizeLimitedStore struct {
+	store.S
+	limit int64
+}
+
+func (s sizeLimitedStore) MaxItemDataBytes() int64 {
+	return s.limit
+}
+
+func TestMaxItemDataBytes(t *testing.T) {
+	tcs := []struct {
+		Description string
+		Primary     int64
+		Secondary   int64
+		Expected    int64
+	}{
+		{Description: "Unlimited"},
+		{Description: "Primary limit", Primary: 100, Expected: 100},
+		{Description: "Secondary limit", Secondary: 100, Expected: 100},
+		{Description: "Smallest limit", Primary: 200, Secondary: 100, Expected: 100},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			primary := sizeLimitedStore{S: inmem.NewSharded(inmem.Config{}, nil), limit: tc.Primary}
+			secondary := sizeLimitedStore{S: inmem.NewSharded(inmem.Config{}, nil), limit: tc.Secondary}
+			s := New(primary, secondary, Config{}, newTestMeasures(), nil)
+			assert.Equal(t, tc.Expected, s.MaxItemDataBytes())
+		})
+	}
+}
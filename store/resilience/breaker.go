@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+// breakerState values double as the values reported by the circuit breaker state gauge.
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateHalfOpen
+	stateOpen
+)
+
+// breaker is a consecutive-failure circuit breaker. Once failureThreshold
+// consecutive failures are observed, it opens and rejects calls until
+// openDuration has elapsed. It then lets a single probe call through (half-open)
+// whose outcome decides whether the breaker closes or opens again.
+type breaker struct {
+	lock             sync.Mutex
+	state            breakerState
+	failures         int
+	openedAt         time.Time
+	probing          bool
+	failureThreshold int
+	openDuration     time.Duration
+	now              func() time.Time
+	onStateChange    func(breakerState)
+}
+
+// allow reports whether a call may proceed. When it may not, the returned
+// duration is the time left until the breaker is willing to probe the backend.
+func (b *breaker) allow() (bool, time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		remaining := b.openDuration - b.now().Sub(b.openedAt)
+		if remaining > 0 {
+			return false, remaining
+		}
+		b.setState(stateHalfOpen)
+		b.probing = true
+		return true, 0
+	case stateHalfOpen:
+		if b.probing {
+			return false, b.openDuration
+		}
+		b.probing = true
+		return true, 0
+	default:
+		return true, 0
+	}
+}
+
+// record feeds the outcome of an allowed call back into the breaker.
+func (b *breaker) record(failed bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == stateHalfOpen {
+		b.probing = false
+		if failed {
+			b.open()
+			return
+		}
+		b.failures = 0
+		b.setState(stateClosed)
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == stateClosed && b.failures >= b.failureThreshold {
+		b.open()
+	}
+}
+
+func (b *breaker) open() {
+	b.openedAt = b.now()
+	b.failures = 0
+	b.setState(stateOpen)
+}
+
+func (b *breaker) setState(s breakerState) {
+	if b.state == s {
+		return
+	}
+	b.state = s
+	if b.onStateChange != nil {
+		b.onStateChange(s)
+	}
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package resilience
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	var states []breakerState
+	b := &breaker{
+		failureThreshold: 3,
+		openDuration:     time.Minute,
+		now:              func() time.Time { return now },
+		onStateChange:    func(s breakerState) { states = append(states, s) },
+	}
+
+	// successes reset the consecutive failure count.
+	b.record(true)
+	b.record(true)
+	b.record(false)
+	b.record(true)
+	b.record(true)
+	ok, _ := b.allow()
+	assert.True(ok)
+	assert.Equal(stateClosed, b.state)
+
+	b.record(true)
+	assert.Equal(stateOpen, b.state)
+
+	now = now.Add(20 * time.Second)
+	ok, retryAfter := b.allow()
+	assert.False(ok)
+	assert.Equal(40*time.Second, retryAfter)
+
+	// only a single probe is let through while half-open.
+	now = now.Add(time.Minute)
+	ok, _ = b.allow()
+	assert.True(ok)
+	assert.Equal(stateHalfOpen, b.state)
+	ok, _ = b.allow()
+	assert.False(ok)
+
+	// a failed probe opens the breaker right away.
+	b.record(true)
+	assert.Equal(stateOpen, b.state)
+
+	now = now.Add(time.Minute)
+	ok, _ = b.allow()
+	assert.True(ok)
+	b.record(false)
+	assert.Equal(stateClosed, b.state)
+
+	assert.Equal([]breakerState{stateOpen, stateHalfOpen, stateOpen, stateHalfOpen, stateClosed}, states)
+}
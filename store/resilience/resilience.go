@@ -0,0 +1,429 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package resilience provides a store.S decorator which applies per-operation
+// timeouts, retries with exponential backoff and a circuit breaker to the
+// calls made against a data backend.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/argus/store/db/metric"
+	"github.com/xmidt-org/httpaux/erraux"
+)
+
+// Resilience is the path to the configuration structure of this package
+// under the store configuration block.
+const Resilience = "resilience"
+
+// default configuration values.
+const (
+	defaultTimeout          = 10 * time.Second
+	defaultMaxAttempts      = 3
+	defaultInitialInterval  = 100 * time.Millisecond
+	defaultMaxInterval      = 2 * time.Second
+	defaultMultiplier       = 2.0
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 30 * time.Second
+)
+
+// Sentinel errors.
+var (
+	ErrTimeout     = errors.New("DB operation timed out")
+	ErrCircuitOpen = errors.New("DB circuit breaker is open")
+)
+
+var (
+	errHTTPTimeout = &erraux.Error{
+		Err:  errors.New("DB operation timed out"),
+		Code: http.StatusServiceUnavailable,
+	}
+)
+
+// Config groups the timeout, retry and circuit breaker options.
+// Any zero value is replaced by its default.
+type Config struct {
+	// Timeouts bounds how long each operation may run.
+	Timeouts TimeoutConfig
+
+	// Retry configures how failed operations marked as retryable are retried.
+	Retry RetryConfig
+
+	// CircuitBreaker configures when calls should fail fast because the
+	// backend is considered unhealthy.
+	CircuitBreaker CircuitBreakerConfig
+}
+
+// TimeoutConfig holds per-operation timeouts.
+type TimeoutConfig struct {
+	// Default applies to any operation without a specific timeout.
+	// (Optional) defaults to 10s.
+	Default time.Duration
+
+	Get    time.Duration
+	GetAll time.Duration
+	Push   time.Duration
+	Delete time.Duration
+}
+
+// RetryConfig describes an exponential backoff with full jitter.
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts per operation, the first one included.
+	// Set it to 1 to disable retries.
+	// (Optional) defaults to 3.
+	MaxAttempts int
+
+	// InitialInterval is the backoff upper bound before the first retry.
+	// (Optional) defaults to 100ms.
+	InitialInterval time.Duration
+
+	// MaxInterval caps the backoff upper bound.
+	// (Optional) defaults to 2s.
+	MaxInterval time.Duration
+
+	// Multiplier is the growth factor of the backoff upper bound between attempts.
+	// (Optional) defaults to 2.
+	Multiplier float64
+}
+
+// CircuitBreakerConfig configures the circuit breaker.
+type CircuitBreakerConfig struct {
+	// Disabled turns off the circuit breaker.
+	Disabled bool
+
+	// FailureThreshold is the number of consecutive failed operations which opens the breaker.
+	// (Optional) defaults to 5.
+	FailureThreshold int
+
+	// OpenDuration is how long the breaker rejects operations before probing the backend again.
+	// It is also the upper bound of the Retry-After header sent to clients.
+	// (Optional) defaults to 30s.
+	OpenDuration time.Duration
+}
+
+// CircuitOpenError is returned while the circuit breaker rejects operations.
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v: retry after %v", ErrCircuitOpen, e.RetryAfter)
+}
+
+func (e CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+func (e CircuitOpenError) SanitizedError() string {
+	return "DB is unavailable"
+}
+
+func (e CircuitOpenError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// Headers sets Retry-After to the number of whole seconds left, rounded up.
+func (e CircuitOpenError) Headers() http.Header {
+	seconds := int64(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return http.Header{"Retry-After": []string{strconv.FormatInt(seconds, 10)}}
+}
+
+type resilientStore struct {
+	store.S
+	config   Config
+	breaker  *breaker
+	measures metric.Measures
+	sleep    func(time.Duration)
+	jitter   func(time.Duration) time.Duration
+}
+
+// New decorates s with the timeout, retry and circuit breaker policies
+// described by config.
+func New(s store.S, config Config, measures metric.Measures) store.S {
+	validateConfig(&config)
+	r := &resilientStore{
+		S:        s,
+		config:   config,
+		measures: measures,
+		sleep:    time.Sleep,
+		jitter:   fullJitter,
+	}
+	if !config.CircuitBreaker.Disabled {
+		r.breaker = &breaker{
+			failureThreshold: config.CircuitBreaker.FailureThreshold,
+			openDuration:     config.CircuitBreaker.OpenDuration,
+			now:              time.Now,
+			onStateChange: func(s breakerState) {
+				measures.CircuitBreakerState.Set(float64(s))
+			},
+		}
+	}
+	return r
+}
+
+func validateConfig(config *Config) {
+	t := &config.Timeouts
+	if t.Default <= 0 {
+		t.Default = defaultTimeout
+	}
+	for _, d := range []*time.Duration{&t.Get, &t.GetAll, &t.Push, &t.Delete} {
+		if *d <= 0 {
+			*d = t.Default
+		}
+	}
+
+	r := &config.Retry
+	if r.MaxAttempts < 1 {
+		r.MaxAttempts = defaultMaxAttempts
+	}
+	if r.InitialInterval <= 0 {
+		r.InitialInterval = defaultInitialInterval
+	}
+	if r.MaxInterval <= 0 {
+		r.MaxInterval = defaultMaxInterval
+	}
+	if r.Multiplier < 1 {
+		r.Multiplier = defaultMultiplier
+	}
+
+	cb := &config.CircuitBreaker
+	if cb.FailureThreshold < 1 {
+		cb.FailureThreshold = defaultFailureThreshold
+	}
+	if cb.OpenDuration <= 0 {
+		cb.OpenDuration = defaultOpenDuration
+	}
+}
+
+func (r *resilientStore) Push(key model.Key, item store.OwnableItem) error {
+	_, err := execute(r, metric.PushQueryType, r.config.Timeouts.Push, store.IsRetryable, func() (struct{}, error) {
+		return struct{}{}, r.S.Push(key, item)
+	})
+	return err
+}
+
+func (r *resilientStore) PushIfAbsent(key model.Key, item store.OwnableItem) error {
+	if _, ok := r.S.(store.Creator); !ok {
+		return store.PushIfAbsent(r.S, key, item)
+	}
+	_, err := execute(r, metric.PushIfAbsentQueryType, r.config.Timeouts.Push, isRetryableWrite, func() (struct{}, error) {
+		return struct{}{}, store.PushIfAbsent(r.S, key, item)
+	})
+	return err
+}
+
+func (r *resilientStore) CompareAndSwap(key model.Key, old, item store.OwnableItem) error {
+	if _, ok := r.S.(store.Swapper); !ok {
+		return store.CompareAndSwap(r.S, key, old, item)
+	}
+	_, err := execute(r, metric.CompareAndSwapQueryType, r.config.Timeouts.Push, isRetryableWrite, func() (struct{}, error) {
+		return struct{}{}, store.CompareAndSwap(r.S, key, old, item)
+	})
+	return err
+}
+
+func (r *resilientStore) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	if _, ok := r.S.(store.Incrementer); !ok {
+		return store.Increment(r.S, key, path, delta, modifiedBy)
+	}
+	return execute(r, metric.IncrementQueryType, r.config.Timeouts.Push, isRetryableWrite, func() (float64, error) {
+		return store.Increment(r.S, key, path, delta, modifiedBy)
+	})
+}
+
+func (r *resilientStore) Transact(ops []store.TransactionOp) error {
+	if _, ok := r.S.(store.Transactor); !ok {
+		return store.Transact(r.S, ops)
+	}
+	_, err := execute(r, metric.TransactQueryType, r.config.Timeouts.Push, isRetryableWrite, func() (struct{}, error) {
+		return struct{}{}, store.Transact(r.S, ops)
+	})
+	return err
+}
+
+func (r *resilientStore) Get(key model.Key) (store.OwnableItem, error) {
+	return execute(r, metric.GetQueryType, r.config.Timeouts.Get, store.IsRetryable, func() (store.OwnableItem, error) {
+		return r.S.Get(key)
+	})
+}
+
+func (r *resilientStore) Delete(key model.Key) (store.OwnableItem, error) {
+	return execute(r, metric.DeleteQueryType, r.config.Timeouts.Delete, isRetryableWrite, func() (store.OwnableItem, error) {
+		return r.S.Delete(key)
+	})
+}
+
+func (r *resilientStore) GetAll(bucket string) (map[string]store.OwnableItem, error) {
+	items, err := execute(r, metric.GetAllQueryType, r.config.Timeouts.GetAll, store.IsRetryable, func() (map[string]store.OwnableItem, error) {
+		return r.S.GetAll(bucket)
+	})
+	if items == nil {
+		items = map[string]store.OwnableItem{}
+	}
+	return items, err
+}
+
+// GetAllByOwner is bound by the GetAll timeout and pushes the filtering down
+// to the wrapped store when it supports it.
+func (r *resilientStore) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, error) {
+	items, err := execute(r, metric.GetAllByOwnerQueryType, r.config.Timeouts.GetAll, store.IsRetryable, func() (map[string]store.OwnableItem, error) {
+		return store.GetAllByOwner(r.S, bucket, owner)
+	})
+	if items == nil {
+		items = map[string]store.OwnableItem{}
+	}
+	return items, err
+}
+
+// BucketDigest and OwnerDigest bypass the policies as the stores keeping
+// digests hold them in memory.
+func (r *resilientStore) BucketDigest(bucket string) (store.Digest, error) {
+	return store.BucketDigest(r.S, bucket, "", true)
+}
+
+func (r *resilientStore) OwnerDigest(bucket, owner string) (store.Digest, error) {
+	return store.BucketDigest(r.S, bucket, owner, false)
+}
+
+func (r *resilientStore) MaxItemDataBytes() int64 {
+	return store.MaxItemDataBytes(r.S)
+}
+
+// Ping checks the backend directly, bypassing the policies so health checks
+// reflect its actual state even while the breaker is open.
+func (r *resilientStore) Ping(ctx context.Context) error {
+	if p, ok := r.S.(store.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// execute runs op under the circuit breaker, retrying it with backoff while
+// it fails with an error retryable tells to retry.
+func execute[T any](r *resilientStore, queryType string, timeout time.Duration, retryable func(error) bool, op func() (T, error)) (T, error) {
+	var (
+		labels = prometheus.Labels{metric.QueryTypeLabelKey: queryType}
+		result T
+		err    error
+	)
+	for attempt := 0; attempt < r.config.Retry.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			r.sleep(r.jitter(r.backoff(attempt)))
+			r.measures.QueryRetries.With(labels).Add(1)
+		}
+
+		if r.breaker != nil {
+			if ok, retryAfter := r.breaker.allow(); !ok {
+				r.measures.CircuitBreakerRejections.With(labels).Add(1)
+				var zero T
+				return zero, CircuitOpenError{RetryAfter: retryAfter}
+			}
+		}
+
+		result, err = withTimeout(timeout, op)
+		if errors.Is(err, ErrTimeout) {
+			r.measures.QueryTimeouts.With(labels).Add(1)
+		}
+
+		if r.breaker != nil {
+			r.breaker.record(isFailure(err))
+		}
+
+		if err == nil || !retryable(err) {
+			return result, err
+		}
+	}
+	return result, err
+}
+
+// isRetryableWrite returns true if the writes which can't be repeated, as their
+// outcome depends on the stored item, should be retried after err. They're
+// only retried when err shows they weren't applied: a timed out write may
+// still be applied in the background, and applying it again would increment
+// twice or fail its condition against its own outcome.
+func isRetryableWrite(err error) bool {
+	return store.IsRetryable(err) && store.IsUnapplied(err)
+}
+
+// backoff returns the upper bound of the wait before the given retry attempt.
+func (r *resilientStore) backoff(attempt int) time.Duration {
+	d := float64(r.config.Retry.InitialInterval) * math.Pow(r.config.Retry.Multiplier, float64(attempt-1))
+	if d > float64(r.config.Retry.MaxInterval) {
+		return r.config.Retry.MaxInterval
+	}
+	return time.Duration(d)
+}
+
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	// nolint:gosec
+	return time.Duration(rand.Int64N(int64(d)))
+}
+
+// withTimeout runs op and gives up waiting on it once timeout elapses. Since the
+// store.S interface takes no context, an abandoned operation keeps running in the
+// background until the backend's own client timeouts end it.
+func withTimeout[T any](timeout time.Duration, op func() (T, error)) (T, error) {
+	type outcome struct {
+		result T
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := op()
+		done <- outcome{result: result, err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-timer.C:
+		var zero T
+		return zero, store.SanitizedError{
+			Err:     store.InternalError{Reason: ErrTimeout, Retryable: true},
+			ErrHTTP: errHTTPTimeout,
+		}
+	}
+}
+
+// backendFaultCodes are the status codes of the errors of unhealthy backends.
+// Other server errors, such as exceeded storage quotas or unimplemented
+// operations, are about the request rather than the backend.
+var backendFaultCodes = map[int]bool{
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// isFailure returns true if err indicates the backend itself is unhealthy.
+// Missing items, client errors such as validation failures and exceeded
+// quotas don't count.
+func isFailure(err error) bool {
+	if err == nil || errors.Is(err, store.ErrItemNotFound) {
+		return false
+	}
+	var statusCoder interface{ StatusCode() int }
+	if errors.As(err, &statusCoder) {
+		return backendFaultCodes[statusCoder.StatusCode()]
+	}
+	return true
+}
@@ -0,0 +1,446 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package resilience
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
+	"github.com/xmidt-org/argus/store"
+	"github.com/xmidt-org/argus/store/db/metric"
+	"github.com/xmidt-org/argus/store/inmem"
+	"github.com/xmidt-org/argus/store/quota"
+	"github.com/xmidt-org/argus/store/test"
+)
+
+var (
+	testKey  = model.Key{Bucket: "world", ID: "earth"}
+	testItem = store.OwnableItem{Owner: "Louis Armstrong"}
+
+	errTransient = store.SanitizedError{
+		Err:     store.InternalError{Reason: errors.New("throttled"), Retryable: true, Unapplied: true},
+		ErrHTTP: store.ErrHTTPOpFailed,
+	}
+	errPermanent = store.SanitizeError(errors.New("broken"))
+
+	// errAmbiguous is retryable but doesn't tell whether the operation was applied.
+	errAmbiguous = store.SanitizedError{
+		Err:     store.InternalError{Reason: errors.New("write timeout"), Retryable: true},
+		ErrHTTP: store.ErrHTTPOpFailed,
+	}
+)
+
+func newTestMeasures() metric.Measures {
+	return metric.Measures{
+		QueryRetries: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "retries"},
+			[]string{metric.QueryTypeLabelKey}),
+		QueryTimeouts: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "timeouts"},
+			[]string{metric.QueryTypeLabelKey}),
+		CircuitBreakerState: prometheus.NewGauge(prometheus.GaugeOpts{Name: "state"}),
+		CircuitBreakerRejections: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "rejections"},
+			[]string{metric.QueryTypeLabelKey}),
+	}
+}
+
+func newTestStore(s store.S, config Config) (*resilientStore, metric.Measures) {
+	measures := newTestMeasures()
+	r := New(s, config, measures).(*resilientStore)
+	r.sleep = func(time.Duration) {}
+	return r, measures
+}
+
+func TestRetries(t *testing.T) {
+	tcs := []struct {
+		Description      string
+		Errs             []error
+		MaxAttempts      int
+		ExpectedCalls    int
+		ExpectedErr      error
+		ExpectedRetries  float64
+		ExpectedItemSent bool
+	}{
+		{
+			Description:      "Success",
+			Errs:             []error{nil},
+			MaxAttempts:      3,
+			ExpectedCalls:    1,
+			ExpectedItemSent: true,
+		},
+		{
+			Description:      "Transient error then success",
+			Errs:             []error{errTransient, nil},
+			MaxAttempts:      3,
+			ExpectedCalls:    2,
+			ExpectedRetries:  1,
+			ExpectedItemSent: true,
+		},
+		{
+			Description:     "Attempts exhausted",
+			Errs:            []error{errTransient, errTransient, errTransient},
+			MaxAttempts:     3,
+			ExpectedCalls:   3,
+			ExpectedRetries: 2,
+			ExpectedErr:     errTransient,
+		},
+		{
+			Description:      "Ambiguous error then success",
+			Errs:             []error{errAmbiguous, nil},
+			MaxAttempts:      3,
+			ExpectedCalls:    2,
+			ExpectedRetries:  1,
+			ExpectedItemSent: true,
+		},
+		{
+			Description:   "Permanent error",
+			Errs:          []error{errPermanent},
+			MaxAttempts:   3,
+			ExpectedCalls: 1,
+			ExpectedErr:   errPermanent,
+		},
+		{
+			Description:   "Not found is not retried",
+			Errs:          []error{store.SanitizeError(store.ErrItemNotFound)},
+			MaxAttempts:   3,
+			ExpectedCalls: 1,
+			ExpectedErr:   store.SanitizeError(store.ErrItemNotFound),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			m := new(test.MockDB)
+			for _, err := range tc.Errs {
+				item := testItem
+				if err != nil {
+					item = store.OwnableItem{}
+				}
+				m.On("Get", testKey).Return(item, err).Once()
+			}
+			r, measures := newTestStore(m, Config{Retry: RetryConfig{MaxAttempts: tc.MaxAttempts}})
+
+			item, err := r.Get(testKey)
+			assert.Equal(tc.ExpectedErr, err)
+			if tc.ExpectedItemSent {
+				assert.Equal(testItem, item)
+			}
+			m.AssertNumberOfCalls(t, "Get", tc.ExpectedCalls)
+			assert.Equal(tc.ExpectedRetries, testutil.ToFloat64(measures.QueryRetries.WithLabelValues(metric.GetQueryType)))
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+	r, _ := newTestStore(new(test.MockDB), Config{
+		Retry: RetryConfig{
+			InitialInterval: 100 * time.Millisecond,
+			MaxInterval:     time.Second,
+			Multiplier:      2,
+		},
+	})
+	assert.Equal(100*time.Millisecond, r.backoff(1))
+	assert.Equal(200*time.Millisecond, r.backoff(2))
+	assert.Equal(400*time.Millisecond, r.backoff(3))
+	assert.Equal(800*time.Millisecond, r.backoff(4))
+	assert.Equal(time.Second, r.backoff(5))
+
+	for i := 0; i < 100; i++ {
+		d := fullJitter(time.Second)
+		assert.True(d >= 0 && d < time.Second)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	m := new(test.MockDB)
+	release := make(chan time.Time)
+	defer close(release)
+	m.On("GetAll", "world").WaitUntil(release).Return(map[string]store.OwnableItem{}, nil)
+	r, measures := newTestStore(m, Config{
+		Timeouts: TimeoutConfig{GetAll: 10 * time.Millisecond},
+		Retry:    RetryConfig{MaxAttempts: 2},
+	})
+
+	items, err := r.GetAll("world")
+	require.Error(err)
+	assert.True(errors.Is(err, ErrTimeout))
+	assert.Empty(items)
+
+	var sErr store.SanitizedError
+	require.True(errors.As(err, &sErr))
+	assert.Equal(http.StatusServiceUnavailable, sErr.StatusCode())
+	assert.Equal(float64(2), testutil.ToFloat64(measures.QueryTimeouts.WithLabelValues(metric.GetAllQueryType)))
+	assert.Equal(float64(1), testutil.ToFloat64(measures.QueryRetries.WithLabelValues(metric.GetAllQueryType)))
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	m := new(test.MockDB)
+	m.On("Push", testKey, testItem).Return(errPermanent).Times(2)
+	r, measures := newTestStore(m, Config{
+		Retry: RetryConfig{MaxAttempts: 1},
+		CircuitBreaker: CircuitBreakerConfig{
+			FailureThreshold: 2,
+			OpenDuration:     90 * time.Second,
+		},
+	})
+	now := time.Now()
+	r.breaker.now = func() time.Time { return now }
+
+	assert.Equal(errPermanent, r.Push(testKey, testItem))
+	assert.Equal(errPermanent, r.Push(testKey, testItem))
+	assert.Equal(float64(stateOpen), testutil.ToFloat64(measures.CircuitBreakerState))
+
+	now = now.Add(30 * time.Second)
+	err := r.Push(testKey, testItem)
+	require.Error(err)
+	assert.True(errors.Is(err, ErrCircuitOpen))
+
+	var openErr CircuitOpenError
+	require.True(errors.As(err, &openErr))
+	assert.Equal(http.StatusServiceUnavailable, openErr.StatusCode())
+	assert.Equal("60", openErr.Headers().Get("Retry-After"))
+	assert.Equal(float64(1), testutil.ToFloat64(measures.CircuitBreakerRejections.WithLabelValues(metric.PushQueryType)))
+	m.AssertNumberOfCalls(t, "Push", 2)
+
+	// a successful probe after the open duration closes the breaker again.
+	m.On("Push", testKey, testItem).Return(nil).Once()
+	now = now.Add(time.Minute)
+	assert.NoError(r.Push(testKey, testItem))
+	assert.Equal(float64(stateClosed), testutil.ToFloat64(measures.CircuitBreakerState))
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	assert := assert.New(t)
+	m := new(test.MockDB)
+	notFound := store.SanitizeError(store.ErrItemNotFound)
+	m.On("Delete", testKey).Return(store.OwnableItem{}, notFound)
+	r, measures := newTestStore(m, Config{
+		CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 1},
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err := r.Delete(testKey)
+		assert.Equal(notFound, err)
+	}
+	assert.Equal(float64(stateClosed), testutil.ToFloat64(measures.CircuitBreakerState))
+	m.AssertNumberOfCalls(t, "Delete", 3)
+}
+
+func TestCircuitBreakerIgnoresQuotaErrors(t *testing.T) {
+	assert := assert.New(t)
+	q := quota.New(inmem.NewSharded(inmem.Config{}, nil), quota.Config{
+		Default: quota.BucketLimits{Bucket: quota.Limits{Bytes: 1}},
+	})
+	r, measures := newTestStore(q, Config{
+		CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 1},
+	})
+
+	for i := 0; i < 3; i++ {
+		err := r.Push(testKey, testItem)
+		assert.ErrorIs(err, quota.ErrQuotaExceeded)
+		var statusCoder interface{ StatusCode() int }
+		if assert.ErrorAs(err, &statusCoder) {
+			assert.Equal(http.StatusInsufficientStorage, statusCoder.StatusCode())
+		}
+	}
+	assert.Equal(float64(stateClosed), testutil.ToFloat64(measures.CircuitBreakerState))
+}
+
+func TestGetAllByOwner(t *testing.T) {
+	assert := assert.New(t)
+	items := map[string]store.OwnableItem{"earth": testItem}
+	m := new(test.MockDB)
+	m.On("GetAllByOwner", "world", testItem.Owner).Return(map[string]store.OwnableItem{}, errTransient).Once()
+	m.On("GetAllByOwner", "world", testItem.Owner).Return(items, nil).Once()
+	r, measures := newTestStore(m, Config{})
+
+	result, err := r.GetAllByOwner("world", testItem.Owner)
+	assert.NoError(err)
+	assert.Equal(items, result)
+	assert.Equal(float64(1), testutil.ToFloat64(measures.QueryRetries.WithLabelValues(metric.GetAllByOwnerQueryType)))
+	m.AssertExpectations(t)
+}
+
+func TestPushIfAbsent(t *testing.T) {
+	assert := assert.New(t)
+	exists := store.SanitizeError(store.ErrItemExists)
+	m := new(test.MockDB)
+	m.On("PushIfAbsent", testKey, testItem).Return(errTransient).Once()
+	m.On("PushIfAbsent", testKey, testItem).Return(exists).Once()
+	r, measures := newTestStore(m, Config{
+		CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 2},
+	})
+
+	assert.Equal(exists, r.PushIfAbsent(testKey, testItem))
+	assert.Equal(float64(1), testutil.ToFloat64(measures.QueryRetries.WithLabelValues(metric.PushIfAbsentQueryType)))
+	assert.Equal(float64(stateClosed), testutil.ToFloat64(measures.CircuitBreakerState))
+	m.AssertExpectations(t)
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	assert := assert.New(t)
+	changed := store.SanitizeError(store.ErrItemChanged)
+	old := store.OwnableItem{Owner: testItem.Owner}
+	m := new(test.MockDB)
+	m.On("CompareAndSwap", testKey, old, testItem).Return(errTransient).Once()
+	m.On("CompareAndSwap", testKey, old, testItem).Return(changed).Once()
+	r, measures := newTestStore(m, Config{
+		CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 2},
+	})
+
+	assert.Equal(changed, r.CompareAndSwap(testKey, old, testItem))
+	assert.Equal(float64(1), testutil.ToFloat64(measures.QueryRetries.WithLabelValues(metric.CompareAndSwapQueryType)))
+	assert.Equal(float64(stateClosed), testutil.ToFloat64(measures.CircuitBreakerState))
+	m.AssertExpectations(t)
+}
+
+func TestIncrement(t *testing.T) {
+	assert := assert.New(t)
+	path := []string{"count"}
+	m := new(test.MockDB)
+	m.On("Increment", testKey, path, float64(1), "").Return(float64(0), errTransient).Once()
+	m.On("Increment", testKey, path, float64(1), "").Return(float64(2), nil).Once()
+	r, measures := newTestStore(m, Config{})
+
+	value, err := r.Increment(testKey, path, 1, "")
+	assert.NoError(err)
+	assert.Equal(float64(2), value)
+	assert.Equal(float64(1), testutil.ToFloat64(measures.QueryRetries.WithLabelValues(metric.IncrementQueryType)))
+	m.AssertExpectations(t)
+}
+
+func TestTransact(t *testing.T) {
+	assert := assert.New(t)
+	ops := []store.TransactionOp{{Key: testKey, Item: testItem, Condition: store.IfAbsent}}
+	aborted := store.SanitizeError(store.TransactionConditionError{Index: 0, Err: store.ErrItemExists})
+	m := new(test.MockDB)
+	m.On("Transact", ops).Return(errTransient).Once()
+	m.On("Transact", ops).Return(aborted).Once()
+	r, measures := newTestStore(m, Config{
+		CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 2},
+	})
+
+	assert.Equal(aborted, r.Transact(ops))
+	assert.Equal(float64(1), testutil.ToFloat64(measures.QueryRetries.WithLabelValues(metric.TransactQueryType)))
+	assert.Equal(float64(stateClosed), testutil.ToFloat64(measures.CircuitBreakerState))
+	m.AssertExpectations(t)
+}
+
+// slowStore applies its writes after a delay, once per call.
+type slowStore struct {
+	store.S
+	delay time.Duration
+	calls atomic.Int32
+}
+
+func (s *slowStore) apply() {
+	s.calls.Add(1)
+	time.Sleep(s.delay)
+}
+
+func (s *slowStore) PushIfAbsent(model.Key, store.OwnableItem) error {
+	s.apply()
+	return nil
+}
+
+func (s *slowStore) CompareAndSwap(model.Key, store.OwnableItem, store.OwnableItem) error {
+	s.apply()
+	return nil
+}
+
+func (s *slowStore) Increment(model.Key, []string, float64, string) (float64, error) {
+	s.apply()
+	return 1, nil
+}
+
+func (s *slowStore) Transact([]store.TransactionOp) error {
+	s.apply()
+	return nil
+}
+
+func (s *slowStore) Delete(model.Key) (store.OwnableItem, error) {
+	s.apply()
+	return testItem, nil
+}
+
+func TestWritesNotRetriedAfterTimeout(t *testing.T) {
+	tcs := []struct {
+		Description string
+		Write       func(store.S) error
+	}{
+		{
+			Description: "PushIfAbsent",
+			Write: func(s store.S) error {
+				return store.PushIfAbsent(s, testKey, testItem)
+			},
+		},
+		{
+			Description: "CompareAndSwap",
+			Write: func(s store.S) error {
+				return store.CompareAndSwap(s, testKey, testItem, testItem)
+			},
+		},
+		{
+			Description: "Increment",
+			Write: func(s store.S) error {
+				_, err := store.Increment(s, testKey, []string{"count"}, 1, "")
+				return err
+			},
+		},
+		{
+			Description: "Transact",
+			Write: func(s store.S) error {
+				return store.Transact(s, []store.TransactionOp{{Key: testKey, Item: testItem}})
+			},
+		},
+		{
+			Description: "Delete",
+			Write: func(s store.S) error {
+				_, err := s.Delete(testKey)
+				return err
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			backend := &slowStore{delay: 50 * time.Millisecond}
+			r, _ := newTestStore(backend, Config{
+				Timeouts: TimeoutConfig{Default: 5 * time.Millisecond},
+				Retry:    RetryConfig{MaxAttempts: 3},
+			})
+
+			err := tc.Write(r)
+			assert.ErrorIs(err, ErrTimeout)
+			time.Sleep(2 * backend.delay)
+			assert.Equal(int32(1), backend.calls.Load(), "timed out writes may still be applied")
+		})
+	}
+}
+
+func TestWritesNotRetriedWhenAmbiguous(t *testing.T) {
+	assert := assert.New(t)
+	path := []string{"count"}
+	m := new(test.MockDB)
+	m.On("Increment", testKey, path, float64(1), "").Return(float64(0), errAmbiguous).Once()
+	r, measures := newTestStore(m, Config{})
+
+	_, err := r.Increment(testKey, path, 1, "")
+	assert.Equal(errAmbiguous, err, "writes aren't retried when they may have been applied")
+	assert.Zero(testutil.ToFloat64(measures.QueryRetries.WithLabelValues(metric.IncrementQueryType)))
+	m.AssertExpectations(t)
+}
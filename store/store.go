@@ -4,6 +4,13 @@
 package store
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
 	"github.com/xmidt-org/argus/model"
 )
 
@@ -25,9 +32,361 @@ type S interface {
 	GetAll(bucket string) (map[string]OwnableItem, error)
 }
 
+// Pinger is implemented by stores which can verify they are able to reach their backend.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// SizeLimiter is implemented by stores whose backend bounds the size of the
+// items it holds.
+type SizeLimiter interface {
+	// MaxItemDataBytes is the size, JSON encoded, of the largest item data the
+	// backend accepts, leaving room for the rest of the item.
+	MaxItemDataBytes() int64
+}
+
+// MaxItemDataBytes returns the size limit of the item data of the store, 0
+// when it has none.
+func MaxItemDataBytes(s S) int64 {
+	if l, ok := s.(SizeLimiter); ok {
+		return l.MaxItemDataBytes()
+	}
+	return 0
+}
+
+// OwnerQuerier is implemented by stores which can filter the items of a bucket
+// by owner on the backend side rather than returning the whole bucket.
+type OwnerQuerier interface {
+	GetAllByOwner(bucket, owner string) (map[string]OwnableItem, error)
+}
+
+// Creator is implemented by stores which can atomically create an item only when
+// no live item exists at its key.
+type Creator interface {
+	// PushIfAbsent stores the item unless its key is taken, in which case an
+	// error wrapping ErrItemExists is returned.
+	PushIfAbsent(key model.Key, item OwnableItem) error
+}
+
+// PushIfAbsent creates the item through the store when it supports atomic
+// creation and fails with a 501 error otherwise.
+func PushIfAbsent(s S, key model.Key, item OwnableItem) error {
+	if c, ok := s.(Creator); ok {
+		return c.PushIfAbsent(key, item)
+	}
+	return errCreateUnsupported
+}
+
+// Swapper is implemented by stores which can atomically replace an item only
+// while it's unchanged.
+type Swapper interface {
+	// CompareAndSwap replaces the item at key with item when the stored one
+	// still has the owner and data of old, TTLs being ignored. Otherwise an
+	// error wrapping ErrItemChanged, or ErrItemNotFound when the key is free,
+	// is returned.
+	CompareAndSwap(key model.Key, old, item OwnableItem) error
+}
+
+// CompareAndSwap replaces the item through the store when it supports atomic
+// swaps and fails with a 501 error otherwise.
+func CompareAndSwap(s S, key model.Key, old, item OwnableItem) error {
+	if sw, ok := s.(Swapper); ok {
+		return sw.CompareAndSwap(key, old, item)
+	}
+	return errSwapUnsupported
+}
+
+// Incrementer is implemented by stores which can atomically add to a numeric
+// field of the data of an item.
+type Incrementer interface {
+	// Increment adds delta to the field at path in the data of the live item at
+	// key, records modifiedBy as its last writer and returns the new value. See
+	// IncrementData for the path semantics.
+	Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error)
+}
+
+// Increment updates the item through the store when it supports atomic
+// increments and fails with a 501 error otherwise.
+func Increment(s S, key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	if i, ok := s.(Incrementer); ok {
+		return i.Increment(key, path, delta, modifiedBy)
+	}
+	return 0, errIncrementUnsupported
+}
+
+// TransactionCondition is the state an item must be in for a transaction to apply.
+type TransactionCondition int
+
+const (
+	// Unconditional operations apply whatever the current item.
+	Unconditional TransactionCondition = iota
+
+	// IfAbsent operations only apply when no live item exists at their key.
+	IfAbsent
+
+	// IfUnchanged operations only apply while the live item at their key has
+	// the owner and data of their Expected item.
+	IfUnchanged
+)
+
+// TransactionOp is a put, or a delete, of an item within a transaction.
+type TransactionOp struct {
+	Key       model.Key
+	Delete    bool
+	Item      OwnableItem
+	Condition TransactionCondition
+	Expected  OwnableItem
+}
+
+// Transactor is implemented by stores which can apply writes to several items,
+// possibly across buckets, all-or-nothing.
+type Transactor interface {
+	// Transact applies all the operations or none of them. When the condition
+	// of an operation doesn't hold, a TransactionConditionError is returned.
+	// Operations must target distinct keys.
+	Transact(ops []TransactionOp) error
+}
+
+// Transact applies the operations through the store when it supports
+// transactions and fails with a 501 error otherwise.
+func Transact(s S, ops []TransactionOp) error {
+	if t, ok := s.(Transactor); ok {
+		return t.Transact(ops)
+	}
+	return errTransactionUnsupported
+}
+
+// CheckCondition returns the error of an operation whose condition doesn't hold
+// for the current item, nil when the key is free.
+func CheckCondition(op TransactionOp, current *OwnableItem) error {
+	switch op.Condition {
+	case IfAbsent:
+		if current != nil {
+			return ErrItemExists
+		}
+	case IfUnchanged:
+		if current == nil {
+			return ErrItemNotFound
+		}
+		if current.Owner != op.Expected.Owner || !reflect.DeepEqual(current.Data, op.Expected.Data) {
+			return ErrItemChanged
+		}
+	}
+	return nil
+}
+
+// maxCodecIncrementAttempts bounds the compare-and-swap loop of the increments
+// applied by Codec.
+const maxCodecIncrementAttempts = 10
+
+// Codec converts items between the form they're read in and the form the
+// wrapped store holds them in, for the stores transforming the data of items
+// such as compression and encryption. The wrapped store can't apply the
+// conditional writes, increments and transactions on data it can't read, so
+// the stores run them through the Codec.
+type Codec struct {
+	// Encode returns the item as held by the wrapped store.
+	Encode func(key model.Key, item OwnableItem) (OwnableItem, error)
+
+	// Decode returns the item held by the wrapped store as it's read.
+	Decode func(key model.Key, stored OwnableItem) (OwnableItem, error)
+}
+
+// CompareAndSwap compares old with the decoded item stored in s, then swaps
+// the stored item as read so concurrent changes are still detected by s.
+func (c Codec) CompareAndSwap(s S, key model.Key, old, item OwnableItem) error {
+	stored, err := c.checkUnchanged(s, key, old, "compareandswap")
+	if err != nil {
+		return err
+	}
+	if item, err = c.Encode(key, item); err != nil {
+		return err
+	}
+	return CompareAndSwap(s, key, stored, item)
+}
+
+// Increment applies the increment on the decoded item and swaps the updated
+// item in, retrying on concurrent changes.
+func (c Codec) Increment(s S, key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	for attempt := 0; ; attempt++ {
+		stored, err := s.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		item, err := c.Decode(key, stored)
+		if err != nil {
+			return 0, err
+		}
+		// Items the codec leaves as is share their data with stored, which
+		// must be left as is to swap it.
+		if item.Data, err = CopyData(item.Data); err != nil {
+			return 0, err
+		}
+		value, err := IncrementData(item.Data, path, delta)
+		if err != nil {
+			return 0, SanitizeError(ItemOperationError{Err: err, Key: key, Operation: "increment"})
+		}
+		item.ModifiedBy = modifiedBy
+		if item, err = c.Encode(key, Revise(item, &stored)); err != nil {
+			return 0, err
+		}
+		err = CompareAndSwap(s, key, stored, item)
+		if err == nil {
+			return value, nil
+		}
+		if !errors.Is(err, ErrItemChanged) || attempt+1 == maxCodecIncrementAttempts {
+			return 0, err
+		}
+	}
+}
+
+// Transact encodes the items of the operations and, like CompareAndSwap,
+// conditions the operations on the stored items matching the expected ones.
+// skip lists the operations left as they are, nil when there are none.
+func (c Codec) Transact(s S, ops []TransactionOp, skip func(TransactionOp) bool) error {
+	encoded := make([]TransactionOp, len(ops))
+	for i, op := range ops {
+		if skip != nil && skip(op) {
+			encoded[i] = op
+			continue
+		}
+		if op.Condition == IfUnchanged {
+			stored, err := c.checkUnchanged(s, op.Key, op.Expected, "transact")
+			if errors.Is(err, ErrItemNotFound) || errors.Is(err, ErrItemChanged) {
+				return SanitizeError(TransactionConditionError{Index: i, Err: err})
+			}
+			if err != nil {
+				return err
+			}
+			op.Expected = stored
+		}
+		if !op.Delete {
+			item, err := c.Encode(op.Key, op.Item)
+			if err != nil {
+				return err
+			}
+			op.Item = item
+		}
+		encoded[i] = op
+	}
+	return Transact(s, encoded)
+}
+
+// checkUnchanged returns the item stored at key once its decoded version is
+// found to match expected.
+func (c Codec) checkUnchanged(s S, key model.Key, expected OwnableItem, operation string) (OwnableItem, error) {
+	stored, err := s.Get(key)
+	if err != nil {
+		return stored, err
+	}
+	item, err := c.Decode(key, stored)
+	if err != nil {
+		return stored, err
+	}
+	if err := CheckCondition(TransactionOp{Condition: IfUnchanged, Expected: expected}, &item); err != nil {
+		return stored, SanitizeError(ItemOperationError{Err: err, Key: key, Operation: operation})
+	}
+	return stored, nil
+}
+
+// CopyData returns a deep copy of the data of an item.
+func CopyData(data map[string]interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, SanitizeError(fmt.Errorf("%w: %v", ErrJSONEncode, err))
+	}
+	var c map[string]interface{}
+	if err := json.Unmarshal(encoded, &c); err != nil {
+		return nil, SanitizeError(fmt.Errorf("%w: %v", ErrJSONDecode, err))
+	}
+	return c, nil
+}
+
+// Digester is implemented by stores which keep the digests of the items of
+// their buckets up to date as they're written, so listings can be validated
+// without being read.
+type Digester interface {
+	// BucketDigest returns the digest of the live items of the bucket.
+	BucketDigest(bucket string) (Digest, error)
+
+	// OwnerDigest returns the digest of the live items of the bucket
+	// belonging to owner.
+	OwnerDigest(bucket, owner string) (Digest, error)
+}
+
+// BucketDigest returns the digest the store keeps of the items of the bucket,
+// or of those belonging to owner unless all is set. An error wrapping
+// ErrDigestUnsupported is returned when the store doesn't keep digests.
+func BucketDigest(s S, bucket, owner string, all bool) (Digest, error) {
+	d, ok := s.(Digester)
+	switch {
+	case !ok:
+		return Digest{}, ErrDigestUnsupported
+	case all:
+		return d.BucketDigest(bucket)
+	default:
+		return d.OwnerDigest(bucket, owner)
+	}
+}
+
+// GetAllByOwner returns the items of the bucket belonging to owner. The filtering
+// is pushed down to the store when it supports it.
+func GetAllByOwner(s S, bucket, owner string) (map[string]OwnableItem, error) {
+	if q, ok := s.(OwnerQuerier); ok {
+		return q.GetAllByOwner(bucket, owner)
+	}
+	items, err := s.GetAll(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return FilterOwner(items, owner), nil
+}
+
+// CompressedDataKey is the only field of the data of the items compressed by
+// the compression store. Clients can't set it so their data isn't mistaken
+// for compressed data.
+const CompressedDataKey = "$compressed"
+
+// EncryptedDataKey is the only field of the data of the items encrypted by the
+// encryption store. Clients can't set it so their data, such as items stored
+// before encryption was enabled, isn't mistaken for encrypted data.
+const EncryptedDataKey = "$encrypted"
+
+// reservedDataKeys are the top level fields of item data kept for the stores.
+var reservedDataKeys = []string{CompressedDataKey, EncryptedDataKey}
+
 type OwnableItem struct {
 	model.Item
 	Owner string `json:"owner"`
+
+	// LastModified is set by the stores when the item is written. It's
+	// ignored on writes and zero for items written before it was tracked.
+	LastModified time.Time `json:"lastModified,omitzero"`
+
+	// CreatedAt and Version are carried over by writers from the item they
+	// replace, see Revise, and persisted as they are so replicas and copies
+	// of the item keep them. Stores set CreatedAt to the write time when it's
+	// zero and increase Version on increments. Version is zero for items
+	// written before it was tracked.
+	CreatedAt time.Time `json:"createdAt,omitzero"`
+	Version   int64     `json:"version,omitempty"`
+
+	// ModifiedBy is the principal of the last writer of the item, set by the
+	// endpoints from the request token. It's empty for items written without
+	// a principal or before it was tracked.
+	ModifiedBy string `json:"modifiedBy,omitempty"`
+}
+
+// Revise returns item with the creation time and the next version of current,
+// the item it replaces, which is nil when item is created.
+func Revise(item OwnableItem, current *OwnableItem) OwnableItem {
+	item.CreatedAt = time.Time{}
+	item.Version = 1
+	if current != nil {
+		item.CreatedAt = current.CreatedAt
+		item.Version = current.Version + 1
+	}
+	return item
 }
 
 func FilterOwner(value map[string]OwnableItem, owner string) map[string]OwnableItem {
@@ -6,9 +6,12 @@
 package store
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/argus/model"
 )
 
 func TestFilterOwner(t *testing.T) {
@@ -66,3 +69,86 @@ func TestFilterOwner(t *testing.T) {
 
 	}
 }
+
+func TestGetAllByOwner(t *testing.T) {
+	items := map[string]OwnableItem{
+		"item0": {Owner: "Tr1d1um"},
+		"item1": {Owner: "Argus"},
+	}
+	argusItems := map[string]OwnableItem{
+		"item1": {Owner: "Argus"},
+	}
+
+	t.Run("Filtered locally", func(t *testing.T) {
+		assert := assert.New(t)
+		m := new(MockDAO)
+		m.On("GetAll", "bucket").Return(items, nil).Once()
+		result, err := GetAllByOwner(m, "bucket", "Argus")
+		assert.NoError(err)
+		assert.Equal(argusItems, result)
+		m.AssertExpectations(t)
+	})
+
+	t.Run("Filtered locally error", func(t *testing.T) {
+		assert := assert.New(t)
+		m := new(MockDAO)
+		m.On("GetAll", "bucket").Return(map[string]OwnableItem{}, errors.New("db failed")).Once()
+		result, err := GetAllByOwner(m, "bucket", "Argus")
+		assert.Error(err)
+		assert.Nil(result)
+	})
+
+	t.Run("Pushed down", func(t *testing.T) {
+		assert := assert.New(t)
+		m := new(MockOwnerQuerierDAO)
+		m.On("GetAllByOwner", "bucket", "Argus").Return(argusItems, nil).Once()
+		result, err := GetAllByOwner(m, "bucket", "Argus")
+		assert.NoError(err)
+		assert.Equal(argusItems, result)
+		m.AssertExpectations(t)
+		m.AssertNotCalled(t, "GetAll", "bucket")
+	})
+}
+
+// wrapCodec stores the data of items under a single "wrapped" field and reads
+// items stored before as they are.
+var wrapCodec = Codec{
+	Encode: func(_ model.Key, item OwnableItem) (OwnableItem, error) {
+		item.Data = map[string]interface{}{"wrapped": item.Data}
+		return item, nil
+	},
+	Decode: func(_ model.Key, stored OwnableItem) (OwnableItem, error) {
+		if data, ok := stored.Data["wrapped"].(map[string]interface{}); ok {
+			stored.Data = data
+		}
+		return stored, nil
+	},
+}
+
+func TestCodec(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	key := model.Key{Bucket: "counters", ID: "id"}
+	s := &swapStore{items: map[model.Key]OwnableItem{}}
+	plain := OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: map[string]interface{}{"count": 1.0}}, Version: 1}
+	require.NoError(s.Push(key, plain))
+
+	value, err := wrapCodec.Increment(s, key, []string{"count"}, 2, "writer")
+	require.NoError(err)
+	assert.Equal(3.0, value)
+	assert.Equal(1.0, plain.Data["count"], "items stored as is aren't modified")
+	stored, err := s.Get(key)
+	require.NoError(err)
+	assert.Equal(map[string]interface{}{"wrapped": map[string]interface{}{"count": 3.0}}, stored.Data)
+	assert.Equal(int64(2), stored.Version)
+	assert.Equal("writer", stored.ModifiedBy)
+
+	swapped := OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: map[string]interface{}{"count": 0.0}}}
+	assert.ErrorIs(wrapCodec.CompareAndSwap(s, key, plain, swapped), ErrItemChanged)
+	current, err := wrapCodec.Decode(key, stored)
+	require.NoError(err)
+	require.NoError(wrapCodec.CompareAndSwap(s, key, current, swapped))
+	stored, err = s.Get(key)
+	require.NoError(err)
+	assert.Equal(map[string]interface{}{"wrapped": swapped.Data}, stored.Data)
+}
@@ -0,0 +1,8 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+// Package storepb holds the protobuf messages and gRPC stubs of the ArgusStore
+// service, generated from store.proto.
+package storepb
+
+//go:generate protoc -I../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative store/storepb/store.proto
@@ -4,6 +4,8 @@
 package test
 
 import (
+	"context"
+
 	"github.com/stretchr/testify/mock"
 	"github.com/xmidt-org/argus/model"
 	"github.com/xmidt-org/argus/store"
@@ -18,6 +20,26 @@ func (s *MockDB) Push(key model.Key, item store.OwnableItem) error {
 	return args.Error(0)
 }
 
+func (s *MockDB) PushIfAbsent(key model.Key, item store.OwnableItem) error {
+	args := s.Called(key, item)
+	return args.Error(0)
+}
+
+func (s *MockDB) CompareAndSwap(key model.Key, old, item store.OwnableItem) error {
+	args := s.Called(key, old, item)
+	return args.Error(0)
+}
+
+func (s *MockDB) Increment(key model.Key, path []string, delta float64, modifiedBy string) (float64, error) {
+	args := s.Called(key, path, delta, modifiedBy)
+	return args.Get(0).(float64), args.Error(1)
+}
+
+func (s *MockDB) Transact(ops []store.TransactionOp) error {
+	args := s.Called(ops)
+	return args.Error(0)
+}
+
 func (s *MockDB) Get(key model.Key) (store.OwnableItem, error) {
 	args := s.Called(key)
 	return args.Get(0).(store.OwnableItem), args.Error(1)
@@ -33,11 +55,16 @@ func (s *MockDB) GetAll(bucket string) (map[string]store.OwnableItem, error) {
 	return args.Get(0).(map[string]store.OwnableItem), args.Error(1)
 }
 
+func (s *MockDB) GetAllByOwner(bucket, owner string) (map[string]store.OwnableItem, error) {
+	args := s.Called(bucket, owner)
+	return args.Get(0).(map[string]store.OwnableItem), args.Error(1)
+}
+
 func (s *MockDB) Close() {
 	s.Called()
 }
 
-func (s *MockDB) Ping() error {
-	args := s.Called()
+func (s *MockDB) Ping(ctx context.Context) error {
+	args := s.Called(ctx)
 	return args.Error(0)
 }
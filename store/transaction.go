@@ -0,0 +1,287 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/xmidt-org/argus/model"
+)
+
+// maxTransactionOps is the maximum number of operations of a transaction.
+const maxTransactionOps = 25
+
+// Transaction operation types and conditions.
+const (
+	putOpType    = "put"
+	deleteOpType = "delete"
+
+	absentCondition = "absent"
+	existsCondition = "exists"
+)
+
+var (
+	errTransactionOpsMissing  = BadRequestErr{Message: "Transaction operations must be set.", Code: "transaction_operations_missing", Field: "operations"}
+	errTooManyTransactionOps  = BadRequestErr{Message: fmt.Sprintf("Transactions are limited to %d operations.", maxTransactionOps), Code: "too_many_transaction_operations", Field: "operations"}
+	errInvalidTransactionOp   = BadRequestErr{Message: "Transaction operations must be a put or a delete.", Code: "invalid_transaction_operation", Field: "op"}
+	errInvalidCondition       = BadRequestErr{Message: "Transaction operation conditions must be absent or exists.", Code: "invalid_transaction_condition", Field: "condition"}
+	errDuplicateTransactionOp = BadRequestErr{Message: "Transaction operations must target distinct items.", Code: "duplicate_transaction_operation", Field: "operations"}
+	errTransactionItemMissing = BadRequestErr{Message: "Transaction put operations must hold an item.", Code: "transaction_item_missing", Field: "item"}
+)
+
+type transactionRequest struct {
+	ops       []transactionOpRequest
+	owner     string
+	principal string
+	adminMode bool
+}
+
+type transactionOpRequest struct {
+	key       model.Key
+	delete    bool
+	item      model.Item
+	condition string
+}
+
+type transactionBody struct {
+	Operations []transactionOpBody `json:"operations"`
+}
+
+type transactionOpBody struct {
+	Op        string          `json:"op"`
+	Bucket    string          `json:"bucket"`
+	ID        string          `json:"id"`
+	Item      json.RawMessage `json:"item"`
+	Condition string          `json:"condition"`
+}
+
+// transactionResponse reports the outcome of each operation. When the
+// transaction is aborted, the operations which caused it carry their error
+// status while the others carry a 424 Failed Dependency.
+type transactionResponse struct {
+	Committed  bool                    `json:"committed"`
+	Operations []transactionOpResponse `json:"operations"`
+}
+
+type transactionOpResponse struct {
+	Bucket  string `json:"bucket"`
+	ID      string `json:"id"`
+	Status  int    `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+func newTransactionHandler(in handlerIn) Handler {
+	return kithttp.NewServer(
+		newTransactionEndpoint(in.Store),
+		transactionRequestDecoder(in.Config),
+		encodeTransactionResponse,
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
+	)
+}
+
+// newTransactionEndpoint reads the items of the operations to check their owner
+// and condition. Each operation is then conditioned on its item not changing
+// since it was read, so the checks still hold when the transaction applies.
+func newTransactionEndpoint(s S) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		transactionRequest := request.(*transactionRequest)
+		response := &transactionResponse{Operations: make([]transactionOpResponse, len(transactionRequest.ops))}
+		ops := make([]TransactionOp, len(transactionRequest.ops))
+		aborted := false
+		for i, opRequest := range transactionRequest.ops {
+			response.Operations[i] = transactionOpResponse{Bucket: opRequest.key.Bucket, ID: opRequest.key.ID}
+			existing, err := s.Get(opRequest.key)
+			found := err == nil
+			if err != nil && !errors.Is(err, ErrItemNotFound) {
+				return nil, err
+			}
+
+			var opErr error
+			switch {
+			case found && !authorized(transactionRequest.adminMode, existing.Owner, transactionRequest.owner):
+				opErr = accessDeniedErr
+			case found && opRequest.condition == absentCondition:
+				opErr = ErrHTTPItemExists
+			case !found && (opRequest.delete || opRequest.condition == existsCondition):
+				opErr = ErrHTTPItemNotFound
+			}
+			if opErr != nil {
+				response.Operations[i].fail(opErr)
+				aborted = true
+				continue
+			}
+
+			op := TransactionOp{Key: opRequest.key, Delete: opRequest.delete, Condition: IfAbsent}
+			owner := transactionRequest.owner
+			var current *OwnableItem
+			if found {
+				op.Condition, op.Expected = IfUnchanged, existing
+				owner = existing.Owner
+				current = &existing
+			}
+			if !opRequest.delete {
+				op.Item = Revise(OwnableItem{Item: opRequest.item, Owner: owner, ModifiedBy: transactionRequest.principal}, current)
+			}
+			ops[i] = op
+			response.Operations[i].Status = opStatus(opRequest.delete, found)
+		}
+
+		if !aborted {
+			err := Transact(s, ops)
+			var conditionErr TransactionConditionError
+			switch {
+			case err == nil:
+				response.Committed = true
+				return response, nil
+			case !errors.As(err, &conditionErr):
+				return nil, err
+			case conditionErr.Index < 0:
+				// The store can't tell which item changed.
+				for i := range response.Operations {
+					response.Operations[i].fail(ErrHTTPItemChanged)
+				}
+				return response, nil
+			default:
+				response.Operations[conditionErr.Index].fail(ErrHTTPItemChanged)
+			}
+		}
+
+		for i := range response.Operations {
+			if op := &response.Operations[i]; op.Message == "" {
+				op.Status = http.StatusFailedDependency
+			}
+		}
+		return response, nil
+	}
+}
+
+// opStatus mirrors the statuses of the item handlers: puts creating an item
+// are 201 Created.
+func opStatus(delete, found bool) int {
+	if !delete && !found {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
+
+func (r *transactionOpResponse) fail(err error) {
+	r.Status = http.StatusInternalServerError
+	var statusCoder kithttp.StatusCoder
+	if errors.As(err, &statusCoder) {
+		r.Status = statusCoder.StatusCode()
+	}
+	r.Message = err.Error()
+}
+
+func transactionRequestDecoder(config *transportConfig) kithttp.DecodeRequestFunc {
+	return func(ctx context.Context, r *http.Request) (interface{}, error) {
+		owner := r.Header.Get(ItemOwnerHeaderKey)
+		if !isOwnerValid(config.OwnerFormatRegex, owner) {
+			return nil, errInvalidOwner
+		}
+
+		data, err := readBody(config, r)
+		if err != nil {
+			return nil, err
+		}
+		var body transactionBody
+		if err := json.Unmarshal(data, &body); err != nil {
+			return nil, fmt.Errorf("%w: %v", errPayloadUnmarshalFailure, err)
+		}
+		if len(body.Operations) == 0 {
+			return nil, errTransactionOpsMissing
+		}
+		if len(body.Operations) > maxTransactionOps {
+			return nil, errTooManyTransactionOps
+		}
+
+		request := &transactionRequest{
+			ops:       make([]transactionOpRequest, 0, len(body.Operations)),
+			owner:     owner,
+			principal: tokenPrincipal(ctx),
+			adminMode: hasElevatedAccess(ctx, config.AccessLevelAttributeKey),
+		}
+		keys := make(map[model.Key]bool, len(body.Operations))
+		for _, opBody := range body.Operations {
+			opRequest, err := decodeTransactionOp(config, opBody)
+			if err != nil {
+				return nil, err
+			}
+			if keys[opRequest.key] {
+				return nil, errDuplicateTransactionOp
+			}
+			keys[opRequest.key] = true
+			request.ops = append(request.ops, opRequest)
+		}
+		return request, nil
+	}
+}
+
+func decodeTransactionOp(config *transportConfig, opBody transactionOpBody) (transactionOpRequest, error) {
+	opRequest := transactionOpRequest{
+		key:       model.Key{Bucket: opBody.Bucket, ID: opBody.ID},
+		condition: opBody.Condition,
+	}
+	if !isIDValid(config.IDFormatRegex, opBody.ID) {
+		return opRequest, errInvalidID
+	}
+	if !isBucketValid(config.BucketFormatRegex, opBody.Bucket) {
+		return opRequest, errInvalidBucket
+	}
+	switch opBody.Condition {
+	case "", absentCondition, existsCondition:
+	default:
+		return opRequest, errInvalidCondition
+	}
+
+	switch opBody.Op {
+	case deleteOpType:
+		if opBody.Condition == absentCondition {
+			return opRequest, errInvalidCondition
+		}
+		opRequest.delete = true
+	case putOpType:
+		if len(opBody.Item) == 0 {
+			return opRequest, errTransactionItemMissing
+		}
+		unmarshaler := validItemUnmarshaler{config: config, id: opBody.ID}
+		if err := json.Unmarshal(opBody.Item, &unmarshaler); err != nil {
+			var berr BadRequestErr
+			if ok := errors.As(err, &berr); !ok {
+				err = fmt.Errorf("%w: %v", errPayloadUnmarshalFailure, err)
+			}
+			return opRequest, err
+		}
+		if err := validateItemDataSize(config, opBody.Bucket, unmarshaler.item.Data); err != nil {
+			return opRequest, err
+		}
+		opRequest.item = unmarshaler.item
+	default:
+		return opRequest, errInvalidTransactionOp
+	}
+	return opRequest, nil
+}
+
+// encodeTransactionResponse replies with a 409 Conflict when the transaction
+// was aborted.
+func encodeTransactionResponse(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
+	r := response.(*transactionResponse)
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	if !r.Committed {
+		rw.WriteHeader(http.StatusConflict)
+	}
+	rw.Write(data)
+	return nil
+}
@@ -0,0 +1,256 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/xmidt-org/argus/model"
+)
+
+func TestTransactionRequestDecoder(t *testing.T) {
+	id := "7e8c5f378b4addbaebc70897c4478cca06009e3e360208ebd073dbee4b3774e7"
+	otherID := "252f10c83610ebca1a059c0bae8255eba2f95be4d1d7bcfa89d7248a82d9f111"
+	tcs := []struct {
+		Description     string
+		Body            string
+		Owner           string
+		ExpectedRequest *transactionRequest
+		ExpectedErr     error
+	}{
+		{
+			Description: "Put and delete",
+			Owner:       "test-owner",
+			Body: `{"operations": [
+				{"op": "put", "bucket": "bucket-a", "id": "` + id + `", "item": {"id": "` + id + `", "data": {"k": "v"}}, "condition": "absent"},
+				{"op": "delete", "bucket": "bucket-b", "id": "` + otherID + `"}
+			]}`,
+			ExpectedRequest: &transactionRequest{
+				owner: "test-owner",
+				ops: []transactionOpRequest{
+					{
+						key:       model.Key{Bucket: "bucket-a", ID: id},
+						item:      model.Item{ID: id, Data: map[string]interface{}{"k": "v"}, TTL: int64Ptr(int64((time.Hour * 24).Seconds()))},
+						condition: absentCondition,
+					},
+					{key: model.Key{Bucket: "bucket-b", ID: otherID}, delete: true},
+				},
+			},
+		},
+		{
+			Description: "No operations",
+			Body:        `{"operations": []}`,
+			ExpectedErr: errTransactionOpsMissing,
+		},
+		{
+			Description: "Bad payload",
+			Body:        `{`,
+			ExpectedErr: errPayloadUnmarshalFailure,
+		},
+		{
+			Description: "Unknown op",
+			Body:        `{"operations": [{"op": "get", "bucket": "bucket-a", "id": "` + id + `"}]}`,
+			ExpectedErr: errInvalidTransactionOp,
+		},
+		{
+			Description: "Unknown condition",
+			Body:        `{"operations": [{"op": "delete", "bucket": "bucket-a", "id": "` + id + `", "condition": "maybe"}]}`,
+			ExpectedErr: errInvalidCondition,
+		},
+		{
+			Description: "Delete if absent",
+			Body:        `{"operations": [{"op": "delete", "bucket": "bucket-a", "id": "` + id + `", "condition": "absent"}]}`,
+			ExpectedErr: errInvalidCondition,
+		},
+		{
+			Description: "Put without item",
+			Body:        `{"operations": [{"op": "put", "bucket": "bucket-a", "id": "` + id + `"}]}`,
+			ExpectedErr: errTransactionItemMissing,
+		},
+		{
+			Description: "Item ID mismatch",
+			Body:        `{"operations": [{"op": "put", "bucket": "bucket-a", "id": "` + id + `", "item": {"id": "` + otherID + `", "data": {"k": "v"}}}]}`,
+			ExpectedErr: errIDMismatch,
+		},
+		{
+			Description: "Invalid bucket",
+			Body:        `{"operations": [{"op": "delete", "bucket": "a!", "id": "` + id + `"}]}`,
+			ExpectedErr: errInvalidBucket,
+		},
+		{
+			Description: "Duplicate item",
+			Body: `{"operations": [
+				{"op": "delete", "bucket": "bucket-a", "id": "` + id + `"},
+				{"op": "delete", "bucket": "bucket-a", "id": "` + id + `"}
+			]}`,
+			ExpectedErr: errDuplicateTransactionOp,
+		},
+	}
+
+	decoder := transactionRequestDecoder(getTestTransportConfig())
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			r := httptest.NewRequest(http.MethodPost, "http://localhost/transactions", bytes.NewBufferString(tc.Body))
+			r.Header.Set(ItemOwnerHeaderKey, tc.Owner)
+
+			request, err := decoder(context.Background(), r)
+			assert.ErrorIs(err, tc.ExpectedErr)
+			if tc.ExpectedErr == nil {
+				assert.Equal(tc.ExpectedRequest, request)
+			}
+		})
+	}
+}
+
+func TestTransactionEndpoint(t *testing.T) {
+	var (
+		keyA     = model.Key{Bucket: "a", ID: "id"}
+		keyB     = model.Key{Bucket: "b", ID: "id"}
+		itemA    = OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: map[string]interface{}{"k": "a"}}, CreatedAt: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC), Version: 2}
+		itemB    = OwnableItem{Owner: "owner", Item: model.Item{ID: "id", Data: map[string]interface{}{"k": "b"}}}
+		newItem  = model.Item{ID: "id", Data: map[string]interface{}{"k": "new"}}
+		putA     = transactionOpRequest{key: keyA, item: newItem}
+		deleteB  = transactionOpRequest{key: keyB, delete: true}
+		storeErr = errors.New("store failure")
+	)
+
+	tcs := []struct {
+		Description      string
+		Request          transactionRequest
+		Items            map[model.Key]OwnableItem
+		TransactErr      error
+		ExpectedOps      []TransactionOp
+		ExpectedResponse *transactionResponse
+		ExpectedErr      error
+	}{
+		{
+			Description: "Committed",
+			Request:     transactionRequest{owner: "owner", ops: []transactionOpRequest{putA, deleteB}},
+			Items:       map[model.Key]OwnableItem{keyB: itemB},
+			ExpectedOps: []TransactionOp{
+				{Key: keyA, Item: OwnableItem{Owner: "owner", Item: newItem, Version: 1}, Condition: IfAbsent},
+				{Key: keyB, Delete: true, Condition: IfUnchanged, Expected: itemB},
+			},
+			ExpectedResponse: &transactionResponse{
+				Committed: true,
+				Operations: []transactionOpResponse{
+					{Bucket: "a", ID: "id", Status: http.StatusCreated},
+					{Bucket: "b", ID: "id", Status: http.StatusOK},
+				},
+			},
+		},
+		{
+			Description: "Admin keeps the owner",
+			Request:     transactionRequest{owner: "admin", adminMode: true, ops: []transactionOpRequest{putA}},
+			Items:       map[model.Key]OwnableItem{keyA: itemA},
+			ExpectedOps: []TransactionOp{
+				{Key: keyA, Item: OwnableItem{Owner: "owner", Item: newItem, CreatedAt: itemA.CreatedAt, Version: itemA.Version + 1}, Condition: IfUnchanged, Expected: itemA},
+			},
+			ExpectedResponse: &transactionResponse{
+				Committed:  true,
+				Operations: []transactionOpResponse{{Bucket: "a", ID: "id", Status: http.StatusOK}},
+			},
+		},
+		{
+			Description: "Owner mismatch",
+			Request:     transactionRequest{owner: "other", ops: []transactionOpRequest{putA, deleteB}},
+			Items:       map[model.Key]OwnableItem{keyB: itemB},
+			ExpectedResponse: &transactionResponse{
+				Operations: []transactionOpResponse{
+					{Bucket: "a", ID: "id", Status: http.StatusFailedDependency},
+					{Bucket: "b", ID: "id", Status: http.StatusForbidden, Message: accessDeniedErr.Error()},
+				},
+			},
+		},
+		{
+			Description: "Condition failed",
+			Request: transactionRequest{owner: "owner", ops: []transactionOpRequest{
+				{key: keyA, item: newItem, condition: existsCondition}, deleteB,
+			}},
+			Items: map[model.Key]OwnableItem{keyB: itemB},
+			ExpectedResponse: &transactionResponse{
+				Operations: []transactionOpResponse{
+					{Bucket: "a", ID: "id", Status: http.StatusNotFound, Message: ErrHTTPItemNotFound.Error()},
+					{Bucket: "b", ID: "id", Status: http.StatusFailedDependency},
+				},
+			},
+		},
+		{
+			Description: "Changed concurrently",
+			Request:     transactionRequest{owner: "owner", ops: []transactionOpRequest{putA, deleteB}},
+			Items:       map[model.Key]OwnableItem{keyB: itemB},
+			TransactErr: TransactionConditionError{Index: 1, Err: ErrItemChanged},
+			ExpectedResponse: &transactionResponse{
+				Operations: []transactionOpResponse{
+					{Bucket: "a", ID: "id", Status: http.StatusFailedDependency},
+					{Bucket: "b", ID: "id", Status: http.StatusPreconditionFailed, Message: ErrHTTPItemChanged.Error()},
+				},
+			},
+		},
+		{
+			Description: "Unknown change",
+			Request:     transactionRequest{owner: "owner", ops: []transactionOpRequest{putA, deleteB}},
+			Items:       map[model.Key]OwnableItem{keyB: itemB},
+			TransactErr: TransactionConditionError{Index: -1, Err: ErrItemChanged},
+			ExpectedResponse: &transactionResponse{
+				Operations: []transactionOpResponse{
+					{Bucket: "a", ID: "id", Status: http.StatusPreconditionFailed, Message: ErrHTTPItemChanged.Error()},
+					{Bucket: "b", ID: "id", Status: http.StatusPreconditionFailed, Message: ErrHTTPItemChanged.Error()},
+				},
+			},
+		},
+		{
+			Description: "Store failure",
+			Request:     transactionRequest{owner: "owner", ops: []transactionOpRequest{putA}},
+			TransactErr: storeErr,
+			ExpectedErr: storeErr,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			m := new(MockTransactorDAO)
+			for _, op := range tc.Request.ops {
+				item, ok := tc.Items[op.key]
+				if ok {
+					m.On("Get", op.key).Return(item, nil)
+				} else {
+					m.On("Get", op.key).Return(OwnableItem{}, ErrItemNotFound)
+				}
+			}
+			if tc.ExpectedOps != nil {
+				m.On("Transact", tc.ExpectedOps).Return(tc.TransactErr)
+			} else {
+				m.On("Transact", mock.Anything).Return(tc.TransactErr)
+			}
+
+			response, err := newTransactionEndpoint(m)(context.Background(), &tc.Request)
+			assert.ErrorIs(err, tc.ExpectedErr)
+			if tc.ExpectedErr == nil {
+				assert.Equal(tc.ExpectedResponse, response)
+			}
+		})
+	}
+}
+
+func TestTransactionUnsupported(t *testing.T) {
+	assert := assert.New(t)
+	key := model.Key{Bucket: "a", ID: "id"}
+	m := new(MockDAO)
+	m.On("Get", key).Return(OwnableItem{}, ErrItemNotFound)
+	request := &transactionRequest{ops: []transactionOpRequest{{key: key, item: model.Item{ID: "id"}}}}
+
+	_, err := newTransactionEndpoint(m)(context.Background(), request)
+	assert.ErrorIs(err, errTransactionUnsupported)
+}
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"regexp"
 	"sort"
+	"strings"
 	"time"
 
 	kithttp "github.com/go-kit/kit/transport/http"
@@ -30,8 +31,9 @@ const (
 
 // Request and Response Headers.
 const (
-	ItemOwnerHeaderKey  = "X-Xmidt-Owner"
-	XmidtErrorHeaderKey = "X-Xmidt-Error"
+	ItemOwnerHeaderKey   = "X-Xmidt-Owner"
+	XmidtErrorHeaderKey  = "X-Xmidt-Error"
+	IfNoneMatchHeaderKey = "If-None-Match"
 )
 
 // ElevatedAccessLevel is the bascule attribute value found in requests that should be granted
@@ -43,8 +45,10 @@ const ElevatedAccessLevel = 1
 var ErrCasting = errors.New("casting error due to middleware wiring mistake")
 
 var (
-	errBodyReadFailure         = BadRequestErr{Message: "Failed to read body."}
-	errPayloadUnmarshalFailure = BadRequestErr{Message: "Failed to unmarshal json payload."}
+	errBodyReadFailure         = BadRequestErr{Message: "Failed to read body.", Code: "body_read_failure"}
+	errPayloadUnmarshalFailure = BadRequestErr{Message: "Failed to unmarshal json payload.", Code: "invalid_payload"}
+	errUnsupportedIfNoneMatch  = BadRequestErr{Message: "Only '*' is supported as If-None-Match value.", Code: "unsupported_if_none_match", Field: "If-None-Match"}
+	errBodyTooLarge            = PayloadTooLargeErr{Message: "Request body is too large.", Code: "body_too_large"}
 )
 
 type transportConfig struct {
@@ -54,7 +58,22 @@ type transportConfig struct {
 	BucketFormatRegex       *regexp.Regexp
 	OwnerFormatRegex        *regexp.Regexp
 	ItemDataMaxDepth        uint
+	MaxBodyBytes            int64
+
+	// ItemDataMaxBytes and BucketItemDataMaxBytes bound the size of item data,
+	// JSON encoded. 0 means unlimited.
+	ItemDataMaxBytes       int64
+	BucketItemDataMaxBytes map[string]int64
 }
+
+// itemDataMaxBytes returns the size limit of the item data of bucket.
+func (c *transportConfig) itemDataMaxBytes(bucket string) int64 {
+	if limit, ok := c.BucketItemDataMaxBytes[bucket]; ok {
+		return limit
+	}
+	return c.ItemDataMaxBytes
+}
+
 type getOrDeleteItemRequest struct {
 	key       model.Key
 	owner     string
@@ -68,34 +87,53 @@ type getAllItemsRequest struct {
 }
 
 type setItemRequest struct {
-	key       model.Key
-	item      OwnableItem
-	adminMode bool
+	key        model.Key
+	item       OwnableItem
+	adminMode  bool
+	createOnly bool
 }
 
 type setItemResponse struct {
 	existingResource bool
 }
 
+// getAllItemsResponse holds the items of a listing along with their digest.
+// items is nil when the digest kept by the store showed the caller's copy is
+// current.
+type getAllItemsResponse struct {
+	items  map[string]OwnableItem
+	digest Digest
+
+	// tracked is true when the digest was kept by the store, its
+	// LastModified then accounting for deletions.
+	tracked bool
+}
+
 func getAllItemsRequestDecoder(config *transportConfig) kithttp.DecodeRequestFunc {
 	return func(ctx context.Context, r *http.Request) (interface{}, error) {
-		var (
-			bucket = mux.Vars(r)[bucketVarKey]
-			owner  = r.Header.Get(ItemOwnerHeaderKey)
-		)
-		if !isBucketValid(config.BucketFormatRegex, bucket) {
-			return nil, errInvalidBucket
-		}
-		if !isOwnerValid(config.OwnerFormatRegex, owner) {
-			return nil, errInvalidOwner
+		itemsRequest, err := newGetAllItemsRequest(ctx, config, mux.Vars(r)[bucketVarKey], r.Header.Get(ItemOwnerHeaderKey))
+		if err != nil {
+			return nil, err
 		}
+		return itemsRequest, nil
+	}
+}
 
-		return &getAllItemsRequest{
-			bucket:    bucket,
-			owner:     owner,
-			adminMode: hasElevatedAccess(ctx, config.AccessLevelAttributeKey),
-		}, nil
+// newGetAllItemsRequest validates the variables of listings, whichever API
+// they come through.
+func newGetAllItemsRequest(ctx context.Context, config *transportConfig, bucket, owner string) (*getAllItemsRequest, error) {
+	if !isBucketValid(config.BucketFormatRegex, bucket) {
+		return nil, errInvalidBucket
+	}
+	if !isOwnerValid(config.OwnerFormatRegex, owner) {
+		return nil, errInvalidOwner
 	}
+
+	return &getAllItemsRequest{
+		bucket:    bucket,
+		owner:     owner,
+		adminMode: hasElevatedAccess(ctx, config.AccessLevelAttributeKey),
+	}, nil
 }
 
 func setItemRequestDecoder(config *transportConfig) kithttp.DecodeRequestFunc {
@@ -111,57 +149,116 @@ func setItemRequestDecoder(config *transportConfig) kithttp.DecodeRequestFunc {
 			return nil, err
 		}
 
-		data, err := io.ReadAll(r.Body)
+		createOnly, err := isCreateOnly(r)
 		if err != nil {
-			return nil, fmt.Errorf("%w: %v", errBodyReadFailure, err)
+			return nil, err
 		}
 
-		unmarshaler := validItemUnmarshaler{config: config, id: id}
-
-		if err := json.Unmarshal(data, &unmarshaler); err != nil {
-			var berr BadRequestErr
-			if ok := errors.As(err, &berr); !ok {
-				err = fmt.Errorf("%w: %v", errPayloadUnmarshalFailure, err)
-			}
+		data, err := readBody(config, r)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = decodeBody(r, data); err != nil {
+			return nil, err
+		}
+		item, err := decodeItem(config, bucket, id, data)
+		if err != nil {
 			return nil, err
 		}
 
 		return &setItemRequest{
 			item: OwnableItem{
-				Item:  unmarshaler.item,
-				Owner: owner,
+				Item:       item,
+				Owner:      owner,
+				ModifiedBy: tokenPrincipal(ctx),
 			},
 			key: model.Key{
 				Bucket: bucket,
 				ID:     id,
 			},
-			adminMode: hasElevatedAccess(ctx, config.AccessLevelAttributeKey),
+			adminMode:  hasElevatedAccess(ctx, config.AccessLevelAttributeKey),
+			createOnly: createOnly,
 		}, nil
 	}
 }
 
+// decodeItem unmarshals and validates the JSON encoded item to be written at id
+// in bucket.
+func decodeItem(config *transportConfig, bucket, id string, data []byte) (model.Item, error) {
+	unmarshaler := validItemUnmarshaler{config: config, id: id}
+	if err := json.Unmarshal(data, &unmarshaler); err != nil {
+		var berr BadRequestErr
+		if ok := errors.As(err, &berr); !ok {
+			err = fmt.Errorf("%w: %v", errPayloadUnmarshalFailure, err)
+		}
+		return model.Item{}, err
+	}
+	if err := validateItemDataSize(config, bucket, unmarshaler.item.Data); err != nil {
+		return model.Item{}, err
+	}
+	return unmarshaler.item, nil
+}
+
+// readBody reads the body of r, stopping as soon as it goes over the configured
+// limit. Bodies announcing a larger size aren't read at all.
+func readBody(config *transportConfig, r *http.Request) ([]byte, error) {
+	body := r.Body
+	if config.MaxBodyBytes > 0 {
+		if r.ContentLength > config.MaxBodyBytes {
+			return nil, errBodyTooLarge
+		}
+		body = http.MaxBytesReader(nil, body, config.MaxBodyBytes)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, errBodyTooLarge
+		}
+		return nil, fmt.Errorf("%w: %v", errBodyReadFailure, err)
+	}
+	return data, nil
+}
+
+// isCreateOnly is true for requests with an If-None-Match: * header, which
+// must only create the item when its key isn't taken.
+func isCreateOnly(r *http.Request) (bool, error) {
+	switch strings.TrimSpace(r.Header.Get(IfNoneMatchHeaderKey)) {
+	case "":
+		return false, nil
+	case "*":
+		return true, nil
+	default:
+		return false, errUnsupportedIfNoneMatch
+	}
+}
+
 func getOrDeleteItemRequestDecoder(config *transportConfig) kithttp.DecodeRequestFunc {
 	return func(ctx context.Context, r *http.Request) (interface{}, error) {
-		var (
-			URLVars = mux.Vars(r)
-			id      = URLVars[idVarKey]
-			bucket  = URLVars[bucketVarKey]
-			owner   = r.Header.Get(ItemOwnerHeaderKey)
-		)
-
-		if err := validateItemRequestVars(config, owner, bucket, id); err != nil {
+		URLVars := mux.Vars(r)
+		itemRequest, err := newGetOrDeleteItemRequest(ctx, config, URLVars[bucketVarKey], URLVars[idVarKey], r.Header.Get(ItemOwnerHeaderKey))
+		if err != nil {
 			return nil, err
 		}
+		return itemRequest, nil
+	}
+}
 
-		return &getOrDeleteItemRequest{
-			key: model.Key{
-				Bucket: bucket,
-				ID:     id,
-			},
-			adminMode: hasElevatedAccess(ctx, config.AccessLevelAttributeKey),
-			owner:     r.Header.Get(ItemOwnerHeaderKey),
-		}, nil
+// newGetOrDeleteItemRequest validates the variables of item reads and deletes,
+// whichever API they come through.
+func newGetOrDeleteItemRequest(ctx context.Context, config *transportConfig, bucket, id, owner string) (*getOrDeleteItemRequest, error) {
+	if err := validateItemRequestVars(config, owner, bucket, id); err != nil {
+		return nil, err
 	}
+
+	return &getOrDeleteItemRequest{
+		key: model.Key{
+			Bucket: bucket,
+			ID:     id,
+		},
+		adminMode: hasElevatedAccess(ctx, config.AccessLevelAttributeKey),
+		owner:     owner,
+	}, nil
 }
 
 func encodeSetItemResponse(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
@@ -178,38 +275,44 @@ func encodeSetItemResponse(ctx context.Context, rw http.ResponseWriter, response
 // This is because of dynamodb. To make tests easier, results are sorted by lexicographical non-decreasing
 // order of the ids.
 func encodeGetAllItemsResponse(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
-	items := response.(map[string]OwnableItem)
-	list := make([]model.Item, 0, len(items))
-	for _, value := range items {
-		list = append(list, value.Item)
+	r := response.(*getAllItemsResponse)
+	if newValidators(ctx, r.digest, r.tracked).write(ctx, rw) {
+		return nil
+	}
+	list := make([]model.Item, 0, len(r.items))
+	for _, value := range r.items {
+		list = append(list, redactItem(ctx, value).Item)
 	}
 
 	sort.SliceStable(list, func(i, j int) bool {
 		return list[i].ID < list[j].ID
 	})
 
-	data, err := json.Marshal(&list)
-	if err != nil {
-		return err
+	return writeResponse(ctx, rw, &list)
+}
+
+// encodeGetItemResponse answers with a 304 when the caller's copy of the item
+// is current.
+func encodeGetItemResponse(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
+	if writeItemValidators(ctx, rw, *response.(*OwnableItem)) {
+		return nil
 	}
+	return encodeGetOrDeleteItemResponse(ctx, rw, response)
+}
 
-	rw.Header().Add("Content-Type", "application/json")
-	rw.Write(data)
-	return nil
+// writeItemValidators sets the validators of item, returning true when a 304
+// was sent as the caller's copy of the item is current.
+func writeItemValidators(ctx context.Context, rw http.ResponseWriter, item OwnableItem) bool {
+	digest := Digest{LastModified: item.LastModified}
+	digest.Toggle(item)
+	return newValidators(ctx, digest, true).write(ctx, rw)
 }
 
 func encodeGetOrDeleteItemResponse(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
-	item := response.(*OwnableItem)
-
-	data, err := json.Marshal(&item.Item)
-	if err != nil {
-		return err
-	}
-
-	rw.Header().Add("Content-Type", "application/json")
-	rw.Write(data)
-	return nil
+	item := redactItem(ctx, *response.(*OwnableItem))
+	return writeResponse(ctx, rw, &item.Item)
 }
+
 func transferHeaders(w http.ResponseWriter, h http.Header) {
 	for k, values := range h {
 		for _, v := range values {
@@ -218,7 +321,9 @@ func transferHeaders(w http.ResponseWriter, h http.Header) {
 	}
 }
 
-func encodeError(getLogger func(context.Context) *zap.Logger) kithttp.ErrorEncoder {
+// encodeError sends the RFC 7807 problem details of errors. Their sanitized
+// message is also sent in the X-Xmidt-Error header for older clients.
+func encodeError(getLogger func(context.Context) *zap.Logger, config *transportConfig) kithttp.ErrorEncoder {
 	return func(ctx context.Context, err error, w http.ResponseWriter) {
 		var headerer kithttp.Headerer
 		if errors.As(err, &headerer) {
@@ -241,7 +346,7 @@ func encodeError(getLogger func(context.Context) *zap.Logger) kithttp.ErrorEncod
 			logger.Error("sending non-200, non-404 response", zap.Error(err), zap.Int("code", code))
 		}
 
-		w.WriteHeader(code)
+		writeProblem(w, newProblem(ctx, config, err, code))
 	}
 }
 
@@ -267,3 +372,12 @@ func hasElevatedAccess(ctx context.Context, accessLevelAttributeKey string) bool
 
 	return accessLevel == auth.ElevatedAccessLevelAttributeValue
 }
+
+// tokenPrincipal returns the principal of the token of ctx, which is empty for
+// requests without one.
+func tokenPrincipal(ctx context.Context) string {
+	if basculeAuth, ok := bascule.FromContext(ctx); ok && basculeAuth.Token != nil {
+		return basculeAuth.Token.Principal()
+	}
+	return ""
+}
@@ -5,30 +5,42 @@ package store
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/xmidt-org/argus/auth"
 	"github.com/xmidt-org/argus/model"
 	"github.com/xmidt-org/bascule"
 	"github.com/xmidt-org/httpaux/erraux"
 	"github.com/xmidt-org/sallust"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestEncodeError(t *testing.T) {
 	errHTTPMsg := errors.New("sanitized api error")
+	traceID := trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	tracedCtx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	}))
 	tcs := []struct {
 		Description     string
+		Ctx             context.Context
 		InputErr        error
 		ExpectedHeaders http.Header
 		ExpectedCode    int
+		ExpectedProblem Problem
 	}{
 		{
 			Description: "Headers and code",
@@ -40,25 +52,104 @@ func TestEncodeError(t *testing.T) {
 					Header: http.Header{"X-Some-Header": []string{"val0", "val1"}},
 				},
 			},
-			ExpectedHeaders: http.Header{"X-Some-Header": []string{"val0", "val1"}, XmidtErrorHeaderKey: []string{errHTTPMsg.Error()}},
-			ExpectedCode:    http.StatusBadRequest,
+			ExpectedHeaders: http.Header{
+				"X-Some-Header":     []string{"val0", "val1"},
+				XmidtErrorHeaderKey: []string{errHTTPMsg.Error()},
+				"Content-Type":      []string{ProblemContentType},
+			},
+			ExpectedCode: http.StatusBadRequest,
+			ExpectedProblem: Problem{
+				Type:   "about:blank",
+				Title:  "Bad Request",
+				Status: http.StatusBadRequest,
+				Detail: errHTTPMsg.Error(),
+				Code:   "bad_request",
+			},
 		},
 		{
 			Description:     "Default",
 			InputErr:        errors.New("some internal error"),
-			ExpectedHeaders: http.Header{},
+			ExpectedHeaders: http.Header{"Content-Type": []string{ProblemContentType}},
 			ExpectedCode:    http.StatusInternalServerError,
+			ExpectedProblem: Problem{
+				Type:   "about:blank",
+				Title:  "Internal Server Error",
+				Status: http.StatusInternalServerError,
+				Code:   "internal_server_error",
+			},
+		},
+		{
+			Description: "Field with a format",
+			Ctx:         tracedCtx,
+			InputErr:    errInvalidBucket,
+			ExpectedHeaders: http.Header{
+				XmidtErrorHeaderKey: []string{errInvalidBucket.Message},
+				"Content-Type":      []string{ProblemContentType},
+			},
+			ExpectedCode: http.StatusBadRequest,
+			ExpectedProblem: Problem{
+				Type:    "about:blank",
+				Title:   "Bad Request",
+				Status:  http.StatusBadRequest,
+				Detail:  errInvalidBucket.Message,
+				Code:    "invalid_bucket",
+				Field:   "bucket",
+				Format:  BucketFormatRegexSource,
+				TraceID: traceID.String(),
+			},
+		},
+		{
+			Description: "Wrapped field error",
+			InputErr:    fmt.Errorf("%w: %v", errIDMismatch, errors.New("details")),
+			ExpectedHeaders: http.Header{
+				XmidtErrorHeaderKey: []string{errIDMismatch.Message},
+				"Content-Type":      []string{ProblemContentType},
+			},
+			ExpectedCode: http.StatusBadRequest,
+			ExpectedProblem: Problem{
+				Type:   "about:blank",
+				Title:  "Bad Request",
+				Status: http.StatusBadRequest,
+				Detail: errIDMismatch.Message,
+				Code:   "id_mismatch",
+				Field:  "id",
+				Format: IDFormatRegexSource,
+			},
+		},
+		{
+			Description: "Forbidden",
+			InputErr:    accessDeniedErr,
+			ExpectedHeaders: http.Header{
+				"Content-Type": []string{ProblemContentType},
+			},
+			ExpectedCode: http.StatusForbidden,
+			ExpectedProblem: Problem{
+				Type:   "about:blank",
+				Title:  "Forbidden",
+				Status: http.StatusForbidden,
+				Code:   "owner_mismatch",
+			},
 		},
 	}
 
 	for _, tc := range tcs {
 		t.Run(tc.Description, func(t *testing.T) {
 			assert := assert.New(t)
+			require := require.New(t)
+			ctx := tc.Ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			config := getDefaultValuesExpectedConfig()
 			w := httptest.NewRecorder()
-			e := encodeError(sallust.Get)
-			e(context.Background(), tc.InputErr, w)
+			e := encodeError(sallust.Get, &config)
+			e(ctx, tc.InputErr, w)
 			assert.Equal(tc.ExpectedCode, w.Code)
 			assert.Equal(tc.ExpectedHeaders, w.Header())
+
+			var problem Problem
+			require.Nil(json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(tc.ExpectedProblem, problem)
 		})
 	}
 }
@@ -189,6 +280,7 @@ func TestEncodeGetOrDeleteItemResponse(t *testing.T) {
 			ExpectedCode: 200,
 			ExpectedHeaders: http.Header{
 				"Content-Type": []string{"application/json"},
+				"Vary":         []string{"Accept, Accept-Encoding"},
 			},
 		},
 	}
@@ -304,7 +396,7 @@ func TestEncodeGetAllItemsResponse(t *testing.T) {
 	}
 	recorder := httptest.NewRecorder()
 	expectedResponseBody := fmt.Sprintf("[{\"id\":\"%s\",\"data\":{}},{\"id\":\"%s\",\"data\":{},\"ttl\":1}]", y9gItemID, evgItemID)
-	err := encodeGetAllItemsResponse(context.Background(), recorder, response)
+	err := encodeGetAllItemsResponse(context.Background(), recorder, &getAllItemsResponse{items: response})
 	assert.Nil(err)
 	assert.JSONEq(expectedResponseBody, recorder.Body.String())
 }
@@ -316,6 +408,7 @@ func TestSetItemRequestDecoder(t *testing.T) {
 		Owner           string
 		ElevatedAccess  bool
 		RequestBody     string
+		IfNoneMatch     string
 		ExpectedErr     error
 		ExpectedRequest *setItemRequest
 	}{
@@ -338,6 +431,20 @@ func TestSetItemRequestDecoder(t *testing.T) {
 			RequestBody: `{"id":"4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b", "data": {"nestedKey": {"depth":"unsupported"}}, "ttl": 100}`,
 			ExpectedErr: errInvalidItemDataDepth,
 		},
+		{
+			Name:        "Reserved data field",
+			URLVars:     map[string]string{bucketVarKey: "variables", idVarKey: "4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b"},
+			Owner:       "mathematics",
+			RequestBody: `{"id":"4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b", "data": {"$compressed": "gzip"}, "ttl": 100}`,
+			ExpectedErr: errReservedDataField,
+		},
+		{
+			Name:        "Reserved encrypted data field",
+			URLVars:     map[string]string{bucketVarKey: "variables", idVarKey: "4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b"},
+			Owner:       "mathematics",
+			RequestBody: `{"id":"4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b", "data": {"$encrypted": "k1"}, "ttl": 100}`,
+			ExpectedErr: errReservedDataField,
+		},
 		{
 			Name:        "Capped TTL",
 			URLVars:     map[string]string{bucketVarKey: "variables", idVarKey: "4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b"},
@@ -419,7 +526,8 @@ func TestSetItemRequestDecoder(t *testing.T) {
 						},
 						TTL: int64Ptr(39),
 					},
-					Owner: "mathematics",
+					Owner:      "mathematics",
+					ModifiedBy: "testUser",
 				},
 				key: model.Key{
 					Bucket: "variables",
@@ -428,6 +536,35 @@ func TestSetItemRequestDecoder(t *testing.T) {
 				adminMode: true,
 			},
 		},
+		{
+			Name:        "Create only",
+			URLVars:     map[string]string{bucketVarKey: "variables", idVarKey: "4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b"},
+			Owner:       "mathematics",
+			IfNoneMatch: "*",
+			RequestBody: `{"id":"4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b", "data": {"x": 0}, "ttl": 39}`,
+			ExpectedRequest: &setItemRequest{
+				item: OwnableItem{
+					Item: model.Item{
+						ID:   "4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b",
+						Data: map[string]interface{}{"x": float64(0)},
+						TTL:  int64Ptr(39),
+					},
+					Owner: "mathematics",
+				},
+				key: model.Key{
+					Bucket: "variables",
+					ID:     "4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b",
+				},
+				createOnly: true,
+			},
+		},
+		{
+			Name:        "Unsupported If-None-Match",
+			URLVars:     map[string]string{bucketVarKey: "variables", idVarKey: "4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b"},
+			IfNoneMatch: `"abc"`,
+			RequestBody: `{"id":"4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b", "data": {"x": 0}}`,
+			ExpectedErr: errUnsupportedIfNoneMatch,
+		},
 	}
 
 	decoder := setItemRequestDecoder(getTestTransportConfig())
@@ -439,6 +576,9 @@ func TestSetItemRequestDecoder(t *testing.T) {
 			if len(testCase.Owner) > 0 {
 				r.Header.Set(ItemOwnerHeaderKey, testCase.Owner)
 			}
+			if len(testCase.IfNoneMatch) > 0 {
+				r.Header.Set(IfNoneMatchHeaderKey, testCase.IfNoneMatch)
+			}
 
 			ctx := context.Background()
 			if testCase.ElevatedAccess {
@@ -463,6 +603,74 @@ func TestSetItemRequestDecoder(t *testing.T) {
 	}
 }
 
+func TestSetItemRequestDecoderSizeLimits(t *testing.T) {
+	const id = "4b13653e5d6d611de5999ab0e7c0aa67e1d83d4cba8349a04da0a431fb27f74b"
+	body := func(data string) string {
+		return fmt.Sprintf(`{"id":"%s", "data": %s}`, id, data)
+	}
+	tcs := []struct {
+		Description   string
+		Bucket        string
+		Body          string
+		ContentLength int64
+		ExpectedErr   error
+	}{
+		{
+			Description: "Within limits",
+			Bucket:      "variables",
+			Body:        body(`{"x": "0123456789"}`),
+		},
+		{
+			Description: "Data over the limit",
+			Bucket:      "variables",
+			Body:        body(`{"x": "0123456789012345678901234567890123456789"}`),
+			ExpectedErr: errItemDataTooLarge,
+		},
+		{
+			Description: "Data within the limit of the bucket",
+			Bucket:      "large",
+			Body:        body(`{"x": "0123456789012345678901234567890123456789"}`),
+		},
+		{
+			Description: "Body over the limit",
+			Bucket:      "large",
+			Body:        body(`{"x": "` + strings.Repeat("0", 200) + `"}`),
+			ExpectedErr: errBodyTooLarge,
+		},
+		{
+			Description:   "Announced body over the limit",
+			Bucket:        "large",
+			Body:          body(`{"x": 0}`),
+			ContentLength: 1000,
+			ExpectedErr:   errBodyTooLarge,
+		},
+	}
+
+	config := getTestTransportConfig()
+	config.MaxBodyBytes = 200
+	config.ItemDataMaxBytes = 30
+	config.BucketItemDataMaxBytes = map[string]int64{"large": 100}
+	decoder := setItemRequestDecoder(config)
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert := assert.New(t)
+			r := httptest.NewRequest(http.MethodPut, "http://localhost", strings.NewReader(tc.Body))
+			r = mux.SetURLVars(r, map[string]string{bucketVarKey: tc.Bucket, idVarKey: id})
+			if tc.ContentLength > 0 {
+				r.ContentLength = tc.ContentLength
+			}
+
+			_, err := decoder(context.Background(), r)
+			assert.ErrorIs(err, tc.ExpectedErr)
+			if tc.ExpectedErr != nil {
+				var statusCoder kithttp.StatusCoder
+				assert.True(errors.As(err, &statusCoder))
+				assert.Equal(http.StatusRequestEntityTooLarge, statusCoder.StatusCode())
+			}
+		})
+	}
+}
+
 func TestEncodeSetItemResponse(t *testing.T) {
 	assert := assert.New(t)
 	createdRecorder := httptest.NewRecorder()
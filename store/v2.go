@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/xmidt-org/argus/model"
+)
+
+// The v2 handlers serve the same endpoints as their v1 counterparts, items
+// being sent in a model.ItemEnvelope along with their metadata. Items are
+// written through the v1 set handler, which ignores the metadata of envelopes.
+
+func newGetItemV2Handler(in handlerIn) Handler {
+	return kithttp.NewServer(
+		newGetItemEndpoint(in.Store),
+		getOrDeleteItemRequestDecoder(in.Config),
+		encodeGetItemV2Response,
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
+		kithttp.ServerBefore(kithttp.PopulateRequestContext, in.Redactor.captureScope, captureConditions),
+	)
+}
+
+func newDeleteItemV2Handler(in handlerIn) Handler {
+	return kithttp.NewServer(
+		newDeleteItemEndpoint(in.Store),
+		getOrDeleteItemRequestDecoder(in.Config),
+		encodeGetOrDeleteItemV2Response,
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
+		kithttp.ServerBefore(kithttp.PopulateRequestContext, in.Redactor.captureScope),
+	)
+}
+
+func newGetAllItemsV2Handler(in handlerIn) Handler {
+	return kithttp.NewServer(
+		newGetAllItemsEndpoint(in.Store),
+		getAllItemsRequestDecoder(in.Config),
+		encodeGetAllItemsV2Response,
+		kithttp.ServerErrorEncoder(encodeError(in.GetLogger, in.Config)),
+		kithttp.ServerBefore(kithttp.PopulateRequestContext, in.Redactor.captureScope, captureConditions),
+	)
+}
+
+func encodeGetItemV2Response(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
+	if writeItemValidators(ctx, rw, *response.(*OwnableItem)) {
+		return nil
+	}
+	return encodeGetOrDeleteItemV2Response(ctx, rw, response)
+}
+
+func encodeGetOrDeleteItemV2Response(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
+	envelope := newItemEnvelope(redactItem(ctx, *response.(*OwnableItem)), time.Now())
+	return writeResponse(ctx, rw, &envelope)
+}
+
+func encodeGetAllItemsV2Response(ctx context.Context, rw http.ResponseWriter, response interface{}) error {
+	r := response.(*getAllItemsResponse)
+	if newValidators(ctx, r.digest, r.tracked).write(ctx, rw) {
+		return nil
+	}
+	now := time.Now()
+	items := sortItems(ctx, r.items)
+	list := make([]model.ItemEnvelope, len(items))
+	for i, item := range items {
+		list[i] = newItemEnvelope(item, now)
+	}
+	return writeResponse(ctx, rw, &list)
+}
+
+// newItemEnvelope returns the envelope of item, read at now. Its owner is always
+// sent as the endpoints only return items to their owners and admins.
+func newItemEnvelope(item OwnableItem, now time.Time) model.ItemEnvelope {
+	envelope := model.ItemEnvelope{
+		Item:       item.Item,
+		Owner:      item.Owner,
+		CreatedAt:  item.CreatedAt,
+		UpdatedAt:  item.LastModified,
+		ModifiedBy: item.ModifiedBy,
+		Version:    item.Version,
+	}
+	if item.TTL != nil {
+		envelope.ExpiresAt = now.Add(time.Duration(*item.TTL) * time.Second).UTC().Truncate(time.Second)
+	}
+	return envelope
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2021 Comcast Cable Communications Management, LLC
+// SPDX-License-Identifier: Apache-2.0
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xmidt-org/argus/model"
+)
+
+func TestNewItemEnvelope(t *testing.T) {
+	var (
+		now       = time.Date(2021, 4, 1, 12, 0, 0, 500, time.UTC)
+		createdAt = time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+		updatedAt = time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC)
+		item      = model.Item{
+			ID:   "NaYFGE961cS_3dpzJcoP3QTL4kBYcw9ua3Q6Hy5E4nI",
+			Data: map[string]interface{}{"key": 10},
+		}
+	)
+
+	tcs := []struct {
+		Description      string
+		Item             OwnableItem
+		ExpectedEnvelope model.ItemEnvelope
+	}{
+		{
+			Description: "Untracked item",
+			Item:        OwnableItem{Item: item},
+			ExpectedEnvelope: model.ItemEnvelope{
+				Item: item,
+			},
+		},
+		{
+			Description: "Tracked item",
+			Item: OwnableItem{
+				Item:         item,
+				Owner:        "xmidtUSATeam",
+				CreatedAt:    createdAt,
+				LastModified: updatedAt,
+				Version:      3,
+				ModifiedBy:   "writer",
+			},
+			ExpectedEnvelope: model.ItemEnvelope{
+				Item:       item,
+				Owner:      "xmidtUSATeam",
+				CreatedAt:  createdAt,
+				UpdatedAt:  updatedAt,
+				ModifiedBy: "writer",
+				Version:    3,
+			},
+		},
+		{
+			Description: "Expiring item",
+			Item: OwnableItem{
+				Item:    model.Item{ID: item.ID, Data: item.Data, TTL: int64Ptr(90)},
+				Version: 1,
+			},
+			ExpectedEnvelope: model.ItemEnvelope{
+				Item:      model.Item{ID: item.ID, Data: item.Data, TTL: int64Ptr(90)},
+				Version:   1,
+				ExpiresAt: time.Date(2021, 4, 1, 12, 1, 30, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.Description, func(t *testing.T) {
+			assert.Equal(t, tc.ExpectedEnvelope, newItemEnvelope(tc.Item, now))
+		})
+	}
+}
+
+func TestEncodeGetAllItemsV2Response(t *testing.T) {
+	assert := assert.New(t)
+	createdAt := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	evgItemID := Sha256HexDigest("E-VG")
+	y9gItemID := Sha256HexDigest("Y9G")
+	response := map[string]OwnableItem{
+		"E-VG": {
+			Item: model.Item{
+				ID:   evgItemID,
+				Data: map[string]interface{}{},
+			},
+			Owner:        "xmidtUSATeam",
+			CreatedAt:    createdAt,
+			LastModified: createdAt,
+			Version:      2,
+		},
+		"Y9G": {
+			Item: model.Item{
+				ID:   y9gItemID,
+				Data: map[string]interface{}{},
+			},
+		},
+	}
+	recorder := httptest.NewRecorder()
+	expectedResponseBody := fmt.Sprintf(`[{"id":"%s","data":{},"version":0},{"id":"%s","data":{},"owner":"xmidtUSATeam","createdAt":"2021-03-01T00:00:00Z","updatedAt":"2021-03-01T00:00:00Z","version":2}]`, y9gItemID, evgItemID)
+	err := encodeGetAllItemsV2Response(context.Background(), recorder, &getAllItemsResponse{items: response})
+	assert.Nil(err)
+	assert.JSONEq(expectedResponseBody, recorder.Body.String())
+}